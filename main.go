@@ -3,22 +3,39 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"flag"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
+	"math/big"
+	mathrand "math/rand"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -44,6 +61,16 @@ type Server struct {
 	Notes           string `json:"notes,omitempty"`             // User editable notes
 	FirstSeenOn     string `json:"first_seen_on,omitempty"`     // When we first discovered this server
 	LastActivatedOn string `json:"last_activated_on,omitempty"` // When it was last activated
+	ExpiresAt       string `json:"expires_at,omitempty"`        // Activation ends automatically at this time
+	ExpiryBlocked   string `json:"expiry_blocked,omitempty"`    // Why the expired activation could not be ended yet
+	LastDeactivatedOn  string `json:"last_deactivated_on,omitempty"` // When it was last deactivated
+	DeactivationReason string `json:"deactivation_reason,omitempty"` // Why it was last deactivated
+	State           string `json:"state,omitempty"`             // Lifecycle state: provisioning, standby, active, draining, maintenance, retired
+	StateChangedOn  string `json:"state_changed_on,omitempty"`  // When the state last changed
+	StateReason     string `json:"state_reason,omitempty"`      // Why the state last changed
+	Maintenance     *MaintenanceInfo `json:"maintenance,omitempty"` // Set while the server is in maintenance
+	Drain           *DrainState `json:"drain,omitempty"`             // Set while the server is being drained
+	Canary          *CanaryState `json:"canary,omitempty"`           // Set when the server was added as a canary
 	
 	// Cloudflare DNS record fields (configuration)
 	Type     string   `json:"type"`
@@ -68,6 +95,8 @@ type ServerConfig struct {
 	Servers           []Server  `json:"servers"`
 	AvailableAccounts []string  `json:"available_accounts,omitempty"`   // Available account tags
 	AvailableContainers []string `json:"available_containers,omitempty"` // Available container tags
+	FreezeWindows     []FreezeWindow `json:"freeze_windows,omitempty"`     // Periods during which changes are blocked
+	Profiles          []Profile      `json:"profiles,omitempty"`           // Named snapshots of the active set
 }
 
 type Credentials struct {
@@ -91,15 +120,69 @@ type CloudflareRecord struct {
 }
 
 type CloudflareResponse struct {
-	Success bool               `json:"success"`
-	Errors  []interface{}      `json:"errors"`
-	Result  []CloudflareRecord `json:"result"`
+	Success    bool               `json:"success"`
+	Errors     []CloudflareError  `json:"errors"`
+	Result     []CloudflareRecord `json:"result"`
+	ResultInfo *ResultInfo        `json:"result_info,omitempty"`
+}
+
+// ResultInfo is the pagination block of Cloudflare list responses
+type ResultInfo struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Count      int `json:"count"`
+	TotalCount int `json:"total_count"`
+	TotalPages int `json:"total_pages"`
 }
 
 type CloudflareCreateResponse struct {
-	Success bool             `json:"success"`
-	Errors  []interface{}    `json:"errors"`
-	Result  CloudflareRecord `json:"result"`
+	Success bool              `json:"success"`
+	Errors  []CloudflareError `json:"errors"`
+	Result  CloudflareRecord  `json:"result"`
+}
+
+// CloudflareError is one entry of the errors array of an API response
+type CloudflareError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// APIError is returned for every failed Cloudflare call that got a response
+type APIError struct {
+	Status     int               // HTTP status code
+	Errors     []CloudflareError // Decoded from the response, may be empty
+	RetryAfter time.Duration     // From the Retry-After header, if any
+}
+
+func (e *APIError) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("cloudflare API error: status %d", e.Status)
+	}
+	var parts []string
+	for _, cfErr := range e.Errors {
+		parts = append(parts, fmt.Sprintf("[%d] %s", cfErr.Code, cfErr.Message))
+	}
+	return fmt.Sprintf("cloudflare API error (status %d): %s", e.Status, strings.Join(parts, "; "))
+}
+
+// HasCode reports whether Cloudflare returned the given error code
+func (e *APIError) HasCode(code int) bool {
+	for _, cfErr := range e.Errors {
+		if cfErr.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Temporary reports whether the call may succeed when retried. Rejected
+// (429) calls were not processed and are always safe to retry; server errors
+// are only retried for idempotent methods, as the change may have been made.
+func (e *APIError) Temporary(idempotent bool) bool {
+	if e.Status == http.StatusTooManyRequests {
+		return true
+	}
+	return idempotent && e.Status >= 500
 }
 
 // Global variables
@@ -116,11 +199,93 @@ var (
 	backupDir   = flag.String("backup-dir", "", "Directory to store backups (default: same as config)")
 	keepBackups = flag.Int("keep-backups", 10, "Number of backups to keep (0 = unlimited)")
 	
+	// TLS related flags
+	tlsEnabled       = flag.Bool("tls", false, "Serve HTTPS (a self-signed certificate is generated if -tls-cert/-tls-key are not given)")
+	tlsCert          = flag.String("tls-cert", "", "Path to TLS certificate in PEM format (implies -tls)")
+	tlsKey           = flag.String("tls-key", "", "Path to TLS private key in PEM format (implies -tls)")
+	tlsClientCA      = flag.String("tls-client-ca", "", "CA bundle used to verify client certificates (enables mutual TLS)")
+	httpRedirectPort = flag.Int("http-redirect-port", 0, "Port for a plain HTTP listener that redirects to HTTPS (0 = disabled)")
+	allowedHosts     = flag.String("allowed-hosts", "", "Comma-separated extra host names or IPs the web interface may be reached under (needed for access by LAN IP)")
+	
+	// Change approval flags
+	requireApproval = flag.Bool("require-approval", true, "Require a second operator to approve production DNS changes (needs -tls-client-ca)")
+	approvalTTL     = flag.Duration("approval-ttl", time.Hour, "How long a production change request stays open for approval")
+	adminNames      = flag.String("admins", "", "Comma-separated operators allowed to add and remove freeze windows")
+	
+	// Blast-radius guard flags
+	maxRemovals       = flag.Int("max-removals", 5, "Maximum number of records removed by one update without force (0 = no limit)")
+	maxRemovalPercent = flag.Float64("max-removal-percent", 50, "Maximum percentage of records removed by one update without force (0 = no limit)")
+	
+	// Drain flags
+	drainTTL = flag.Int("drain-ttl", 60, "TTL in seconds a record is lowered to before a drain removes it")
+	
+	// Canary flags
+	canaryPrefix  = flag.String("canary-prefix", "canary", "Name prefix of canary records (canary.<name>)")
+	canaryTimeout = flag.Duration("canary-timeout", 24*time.Hour, "Remove canaries that were not promoted within this time")
+	
+	// Drift detection flags
+	driftInterval = flag.Duration("drift-interval", 5*time.Minute, "How often live records are compared with the configuration (0 = disabled)")
+	driftPolicy   = flag.String("drift-policy", "report", "What to do about drift: report, adopt (update the configuration) or revert (update Cloudflare)")
+	
+	// Metadata sync flags
+	syncMetadata = flag.Bool("sync-metadata", true, "Store alias, account and container in record comments and restore them on import and drift checks")
+	metadataTags = flag.Bool("metadata-tags", false, "Also store the metadata as record tags (needs a Cloudflare plan with tag support)")
+	writeMetadata = flag.Bool("write-metadata", false, "Let adopt and revert drift checks write the configured metadata to records that have none")
+	
+	// Record cache flags
+	recordCacheTTL = flag.Duration("record-cache-ttl", 30*time.Second, "How long cached DNS records are served before they are refreshed in the background")
+	pageSize       = flag.Int("page-size", 100, "Number of DNS records requested per page from Cloudflare (5-5000000)")
+	
+	// Cloudflare API flags
+	apiRetries = flag.Int("api-retries", 3, "How often a failed or throttled Cloudflare call is retried")
+	apiRate    = flag.Float64("api-rate", 4, "Maximum Cloudflare API calls per second (Cloudflare allows 1200 per 5 minutes; 0 = unlimited)")
+	apiTimeout    = flag.Duration("api-timeout", 30*time.Second, "Deadline for a single Cloudflare call")
+	verifyTimeout = flag.Duration("verify-timeout", 10*time.Second, "How long a created or deleted record is polled until the API shows the change")
+	
+	// Propagation check flags
+	recursiveResolvers = flag.String("resolvers", "1.1.1.1,8.8.8.8,9.9.9.9", "Comma-separated recursive resolvers checked after an update (host or host:port)")
+	authoritativeNS    = flag.String("authoritative", "", "Comma-separated authoritative nameservers to check (default: looked up from the zone's NS records)")
+	propagationTimeout = flag.Duration("propagation-timeout", 10*time.Minute, "How long resolvers are checked after an update before giving up (0 = no checks)")
+	
+	// Shutdown and deadline flags
+	applyTimeout    = flag.Duration("apply-timeout", 5*time.Minute, "Deadline for one complete apply; changes not made by then are reported as failed")
+	shutdownTimeout = flag.Duration("shutdown-timeout", time.Minute, "How long a shutdown waits for in-flight applies before cancelling them")
+	
+	// Batch flags
+	batchUpdates  = flag.Bool("batch", true, "Apply all record changes of an update in one atomic Cloudflare batch request")
+	transactional = flag.Bool("transactional", true, "Undo the completed changes of a sequential update when one of them fails")
+	
+	// Scheduler flags
+	scheduleGrace = flag.Duration("schedule-grace", 15*time.Minute, "Skip scheduled runs that were missed by more than this (e.g. while stopped)")
+	
+	// Profile related flags
+	listProfiles     = flag.Bool("list-profiles", false, "List activation profiles and how they differ from the live state")
+	saveProfileName  = flag.String("save-profile", "", "Save the current active set as a named profile")
+	applyProfileName = flag.String("apply-profile", "", "Switch the zone to a named profile")
+	
+	// Operation journal flags
+	listUnfinished  = flag.Bool("list-unfinished", false, "List applies interrupted by a crash and how far they got")
+	resumeApplyID   = flag.String("resume-apply", "", "Make the remaining changes of an unfinished apply")
+	rollbackApplyID = flag.String("rollback-apply", "", "Undo the applied changes of an unfinished apply")
+	
+	// Command line change flags
+	operatorName     = flag.String("operator", "", "Operator name recorded for command line changes (default: $USER)")
+	forceReason      = flag.String("force-reason", "", "Override the blast-radius guard for command line changes with this reason")
+	breakGlassReason = flag.String("break-glass-reason", "", "Override active freeze windows for command line changes with this reason")
+	
 	logger      *Logger
 	credentials *Credentials
 	configMutex sync.RWMutex
+	csrfToken   string
 )
 
+// randomID returns a random hex identifier of n bytes
+func randomID(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
 // generateServerID creates a unique identifier for a server based on its DNS name and IP
 func generateServerID(name, ip string) string {
 	data := fmt.Sprintf("%s:%s", name, ip)
@@ -130,8 +295,23 @@ func generateServerID(name, ip string) string {
 
 // Logger structure
 type Logger struct {
-	file *os.File
-	mu   sync.Mutex
+	file      *os.File
+	auditFile *os.File
+	mu        sync.Mutex
+}
+
+// AuditEntry is one line of the audit trail
+type AuditEntry struct {
+	Time        time.Time `json:"time"`
+	Environment string    `json:"environment"`
+	Action      string    `json:"action"`
+	Operator    string    `json:"operator,omitempty"`
+	Approver    string    `json:"approver,omitempty"`
+	ChangeID    string    `json:"change_id,omitempty"`
+	Source      string    `json:"source,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	Success     bool      `json:"success"`
+	Details     []string  `json:"details,omitempty"`
 }
 
 func NewLogger(env string) (*Logger, error) {
@@ -148,7 +328,15 @@ func NewLogger(env string) (*Logger, error) {
 		return nil, err
 	}
 	
-	return &Logger{file: file}, nil
+	// The audit trail is a single JSON-lines file per environment
+	auditFilename := filepath.Join(logDir, fmt.Sprintf("xmr-manager-%s-audit.jsonl", env))
+	auditFile, err := os.OpenFile(auditFilename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	
+	return &Logger{file: file, auditFile: auditFile}, nil
 }
 
 func (l *Logger) Log(level, message string) {
@@ -165,10 +353,35 @@ func (l *Logger) Log(level, message string) {
 	}
 }
 
+// Audit appends an entry to the audit trail
+func (l *Logger) Audit(entry AuditEntry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if entry.Environment == "" {
+		entry.Environment = *environment
+	}
+	
+	data, err := json.Marshal(entry)
+	if err != nil {
+		l.Log("ERROR", fmt.Sprintf("Failed to encode audit entry: %v", err))
+		return
+	}
+	
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.auditFile != nil {
+		l.auditFile.Write(append(data, '\n'))
+	}
+}
+
 func (l *Logger) Close() {
 	if l.file != nil {
 		l.file.Close()
 	}
+	if l.auditFile != nil {
+		l.auditFile.Close()
+	}
 }
 
 // Embedded HTML template
@@ -176,6 +389,7 @@ const indexHTML = `<!DOCTYPE html>
 <html>
 <head>
     <title>XMR Server Manager - {{.Environment}}</title>
+    <meta name="csrf-token" content="{{.CSRFToken}}">
     <style>
         body {
             font-family: Arial, sans-serif;
@@ -285,6 +499,29 @@ const indexHTML = `<!DOCTYPE html>
             background-color: #e7f5e7;
             box-shadow: 0 2px 8px rgba(40, 167, 69, 0.15);
         }
+        .entry-row.state-provisioning { border-left: 6px solid #17a2b8; }
+        .entry-row.state-standby { border-left: 6px solid #adb5bd; }
+        .entry-row.state-active { border-left: 6px solid #28a745; }
+        .entry-row.state-draining { border-left: 6px solid #6f42c1; }
+        .entry-row.state-maintenance { border-left: 6px solid #ffc107; }
+        .entry-row.state-retired {
+            border-left: 6px solid #343a40;
+            opacity: 0.6;
+        }
+        .state-badge {
+            color: white;
+            padding: 2px 8px;
+            border-radius: 3px;
+            font-size: 11px;
+            font-weight: bold;
+            text-transform: uppercase;
+        }
+        .state-badge.state-provisioning { background-color: #17a2b8; }
+        .state-badge.state-standby { background-color: #6c757d; }
+        .state-badge.state-active { background-color: #28a745; }
+        .state-badge.state-draining { background-color: #6f42c1; }
+        .state-badge.state-maintenance { background-color: #ffc107; color: #333; }
+        .state-badge.state-retired { background-color: #343a40; }
         .entry-main {
             display: flex;
             align-items: center;
@@ -623,6 +860,192 @@ const indexHTML = `<!DOCTYPE html>
         .btn-delete:hover {
             background-color: #c82333;
         }
+        .changes-container {
+            background-color: #fff8e1;
+            border: 2px solid #ffc107;
+            padding: 15px 20px;
+            border-radius: 8px;
+            margin-bottom: 20px;
+        }
+        .changes-title {
+            font-size: 18px;
+            font-weight: bold;
+            margin-bottom: 10px;
+            color: #333;
+        }
+        .change-item {
+            background-color: white;
+            border-radius: 6px;
+            padding: 12px;
+            margin-bottom: 10px;
+        }
+        .change-meta {
+            font-size: 13px;
+            color: #666;
+            margin-bottom: 6px;
+        }
+        .change-plan {
+            font-family: monospace;
+            font-size: 12px;
+            margin: 6px 0 10px 0;
+            padding-left: 18px;
+        }
+        .btn-approve {
+            background-color: #28a745;
+            color: white;
+            padding: 4px 12px;
+            border: none;
+            border-radius: 4px;
+            cursor: pointer;
+            font-size: 12px;
+        }
+        .btn-approve:hover {
+            background-color: #218838;
+        }
+        .freeze-container {
+            background-color: white;
+            padding: 15px 20px;
+            border-radius: 8px;
+            margin-bottom: 20px;
+            box-shadow: 0 2px 4px rgba(0,0,0,0.1);
+        }
+        .freeze-container.frozen {
+            background-color: #e3f2fd;
+            border: 2px solid #1976d2;
+        }
+        .freeze-badge {
+            background-color: #1976d2;
+            color: white;
+            padding: 2px 8px;
+            border-radius: 3px;
+            font-size: 11px;
+            font-weight: bold;
+            margin-left: 8px;
+        }
+        .drain-badge {
+            background-color: #e2e3f3;
+            color: #3d3f8f;
+            padding: 2px 8px;
+            border-radius: 3px;
+            font-size: 12px;
+            font-weight: 500;
+        }
+        .canary-badge {
+            background-color: #fff8e1;
+            color: #8a6d00;
+            padding: 2px 8px;
+            border-radius: 3px;
+            font-size: 12px;
+            font-weight: 500;
+            cursor: help;
+        }
+        .canary-badge.canary-healthy,
+        .canary-badge.canary-promoted {
+            background-color: #d4edda;
+            color: #155724;
+        }
+        .canary-badge.canary-failed,
+        .canary-badge.canary-aborted {
+            background-color: #f8d7da;
+            color: #721c24;
+        }
+        .canary-result {
+            color: #666;
+            font-size: 12px;
+        }
+        .maintenance-banner {
+            background-color: #fff3cd;
+            border: 1px solid #ffc107;
+            color: #856404;
+            border-radius: 4px;
+            padding: 8px 12px;
+            margin-bottom: 10px;
+            font-size: 13px;
+        }
+        .maintenance-banner.overdue {
+            background-color: #f8d7da;
+            border-color: #dc3545;
+            color: #721c24;
+        }
+        .live-banner {
+            display: flex;
+            align-items: center;
+            gap: 12px;
+            background-color: #d1ecf1;
+            border: 1px solid #17a2b8;
+            color: #0c5460;
+            padding: 10px 15px;
+            border-radius: 5px;
+            margin-bottom: 15px;
+            font-size: 14px;
+        }
+        .live-banner.conflict {
+            background-color: #fff3cd;
+            border-color: #ffc107;
+            color: #856404;
+        }
+        .live-banner button {
+            margin-left: auto;
+            background: none;
+            border: none;
+            font-size: 18px;
+            cursor: pointer;
+            color: inherit;
+        }
+        .maintenance-flag {
+            background-color: #ffc107;
+            color: #333;
+            padding: 4px 10px;
+            border-radius: 4px;
+            font-size: 12px;
+            font-weight: bold;
+        }
+        .btn-maintenance {
+            background-color: #ffc107;
+            color: #333;
+            border: none;
+            padding: 5px 10px;
+            border-radius: 3px;
+            cursor: pointer;
+            font-size: 12px;
+        }
+        .btn-maintenance:hover {
+            background-color: #e0a800;
+        }
+        .drain-error {
+            color: #dc3545;
+            font-size: 12px;
+        }
+        .btn-drain {
+            background-color: #6f42c1;
+            color: white;
+            border: none;
+            padding: 5px 10px;
+            border-radius: 3px;
+            cursor: pointer;
+            font-size: 12px;
+        }
+        .btn-drain:hover {
+            background-color: #59359a;
+        }
+        .expiry-badge {
+            background-color: #fff3cd;
+            color: #856404;
+            padding: 2px 8px;
+            border-radius: 3px;
+            font-size: 12px;
+            font-weight: 500;
+        }
+        .expiry-badge.expiry-blocked {
+            background-color: #f8d7da;
+            color: #721c24;
+        }
+        .freeze-form {
+            display: grid;
+            grid-template-columns: repeat(auto-fit, minmax(180px, 1fr));
+            gap: 10px;
+            margin-top: 10px;
+        }
     </style>
 </head>
 <body>
@@ -635,8 +1058,21 @@ const indexHTML = `<!DOCTYPE html>
         <strong>Total Servers:</strong> {{.TotalServers}} | 
         <strong>Active Entries:</strong> {{.ActiveCount}} | 
         <strong>Inactive Entries:</strong> {{.InactiveCount}} |
-        <strong>Last Updated:</strong> <span id="lastUpdate">{{.LastUpdate}}</span>
+        <strong>Last Updated:</strong> <span id="lastUpdate">{{.LastUpdate}}</span> |
+        <strong>DNS State From:</strong> {{.RecordsFetchedAt}}{{if .RecordsStale}} (refreshing){{end}}
+    </div>
+    
+    {{if not .RecordsTotal.Complete}}
+    <div class="maintenance-banner overdue">
+        ⚠ Cloudflare reported {{.RecordsTotal.Reported}} DNS records but only {{.RecordsTotal.Fetched}} were fetched. Servers may be shown as inactive although they still have records, and changes are refused until a complete listing is fetched.
+    </div>
+    {{end}}
+    
+    {{if .CloudflareError}}
+    <div class="maintenance-banner overdue">
+        ⚠ Cloudflare is unreachable ({{.CloudflareError}}). Showing the last known DNS state from {{.RecordsFetchedAt}}.
     </div>
+    {{end}}
     
     <!-- Sorting and Filtering Controls -->
     <div class="controls-container">
@@ -660,13 +1096,197 @@ const indexHTML = `<!DOCTYPE html>
                 <option value="all">All Entries</option>
                 <option value="active">Active Only</option>
                 <option value="inactive">Inactive Only</option>
+                {{range .LifecycleStates}}<option value="state:{{.}}">State: {{.}}</option>{{end}}
             </select>
         </div>
         <div class="controls-group">
             <button type="button" class="btn-clear-filters" onclick="clearFilters()">Clear Filters</button>
         </div>
+        <div class="controls-group">
+            <label for="operatorName">Operator:</label>
+            <input type="text" id="operatorName" placeholder="Your name..." onchange="saveOperator(this.value)">
+        </div>
+    </div>
+    
+    {{if .RequireApproval}}
+    <!-- Pending production change requests -->
+    <div class="changes-container">
+        <div class="changes-title">Pending Change Requests</div>
+        {{range .PendingChanges}}
+        <div class="change-item" data-change-id="{{.ID}}">
+            <div class="change-meta">
+                <strong>#{{.ID}}</strong> requested by <strong>{{.RequestedBy}}</strong>
+                on {{.CreatedAt.Format "2006-01-02 15:04:05"}} &middot; expires {{.ExpiresAt.Format "15:04:05"}}
+            </div>
+            <ul class="change-plan">
+                {{range .Plan}}<li>{{.}}</li>{{end}}
+            </ul>
+            <button type="button" class="btn-approve" onclick="decideChange('{{.ID}}', true)">Approve &amp; Apply</button>
+            <button type="button" class="btn-delete" onclick="decideChange('{{.ID}}', false)">Reject</button>
+        </div>
+        {{else}}
+        <div class="change-meta">No pending changes. Production updates must be approved by a second operator before they are applied.</div>
+        {{end}}
+    </div>
+    {{end}}
+    
+    <!-- Applies interrupted by a crash -->
+    {{if .UnfinishedApplies}}
+    <div class="changes-container">
+        <div class="changes-title">⚠️ Unfinished Applies</div>
+        <div class="change-meta">These applies were interrupted before they finished. Resume them to make the remaining changes, or roll them back to restore the records they started from.</div>
+        {{range .UnfinishedApplies}}
+        <div class="change-request">
+            <div class="change-meta">
+                <strong>#{{.ID}}</strong> started {{.StartedAt.Format "2006-01-02 15:04:05"}}{{if .Options.Source}} via {{.Options.Source}}{{end}}{{if .Options.Operator}} by {{.Options.Operator}}{{end}}
+            </div>
+            <ul class="change-plan">
+                {{range .Ops}}<li>{{.Op}} {{.Name}} &rarr; {{.IP}} &middot; journal: {{.Journal}} &middot; live: <strong>{{.Live}}</strong></li>{{end}}
+            </ul>
+            <button type="button" class="btn-approve" onclick="resolveApply('{{.ID}}', 'resume')">Resume</button>
+            <button type="button" class="btn-delete" onclick="resolveApply('{{.ID}}', 'rollback')">Roll Back</button>
+        </div>
+        {{end}}
+    </div>
+    {{end}}
+    
+    <!-- Freeze windows -->
+    <div class="freeze-container {{if .FreezeActive}}frozen{{end}}">
+        <div class="changes-title">{{if .FreezeActive}}🧊 Change freeze in effect{{else}}Freeze Windows{{end}}</div>
+        {{range .FreezeWindows}}
+        <div class="change-meta">
+            <strong>{{.Name}}</strong> &middot; {{.Summary}}
+            {{if .Active}}<span class="freeze-badge">ACTIVE</span>{{end}}
+            <button type="button" class="btn-delete" onclick="deleteFreezeWindow('{{.ID}}', '{{.Name}}')">Remove</button>
+        </div>
+        {{else}}
+        <div class="change-meta">No freeze windows defined.</div>
+        {{end}}
+        <details>
+            <summary class="change-meta">Add freeze window</summary>
+            <form class="freeze-form" onsubmit="addFreezeWindow(event)">
+                <input type="text" name="name" class="form-input" placeholder="Name (e.g. Pool payout)" required>
+                <input type="text" name="cron" class="form-input" placeholder="Recurring: cron (e.g. 55 23 * * *)">
+                <input type="text" name="duration" class="form-input" placeholder="Duration (e.g. 30m)">
+                <input type="datetime-local" name="start" class="form-input" title="One-off start">
+                <input type="datetime-local" name="end" class="form-input" title="One-off end">
+                <input type="text" name="accounts" class="form-input" placeholder="Accounts (comma separated, optional)">
+                <input type="text" name="containers" class="form-input" placeholder="Containers (comma separated, optional)">
+                <button type="submit" class="btn-add-dns">Add Freeze Window</button>
+            </form>
+        </details>
+    </div>
+    
+    <!-- Drift between configuration and Cloudflare -->
+    <div class="freeze-container">
+        <div class="changes-title">Drift</div>
+        {{with .Drift}}
+        <div class="change-meta">
+            Last check {{.CheckedAt.Format "2006-01-02 15:04:05"}} &middot; policy <strong>{{.Policy}}</strong>
+            {{if .Error}}&middot; <span class="drain-error">{{.Error}}</span>{{end}}
+        </div>
+        {{range .Items}}
+        <div class="change-meta">
+            <span class="freeze-badge" style="background-color: #dc3545;">{{.Kind}}</span>
+            {{.Name}} &rarr; {{.IP}}{{range .Details}} &middot; {{.}}{{end}}
+            {{if .Action}}<em>[{{.Action}}]</em>{{end}}
+        </div>
+        {{else}}
+        <div class="change-meta">{{if not .Error}}Configuration and Cloudflare are in sync.{{end}}</div>
+        {{end}}
+        {{else}}
+        <div class="change-meta">No drift check has run yet.</div>
+        {{end}}
+        <button type="button" class="btn-add-dns" onclick="checkDrift()">Check Now</button>
+    </div>
+    
+    <!-- Activation profiles -->
+    <div class="freeze-container">
+        <div class="changes-title">Profiles</div>
+        {{range .Profiles}}
+        <div class="change-meta">
+            <strong>{{.Name}}</strong> &middot; {{.Servers}} entries &middot; saved {{.CreatedAt.Format "2006-01-02 15:04"}}{{if .CreatedBy}} by {{.CreatedBy}}{{end}}
+            &middot; {{if .IsCurrent}}<span class="freeze-badge" style="background-color: #28a745;">CURRENT</span>{{else}}+{{.ToCreate}} / -{{.ToDelete}} vs. live{{end}}
+            {{if not .IsCurrent}}<button type="button" class="btn-approve" onclick="applyProfile('{{.Name}}')">Switch</button>{{end}}
+            <button type="button" class="btn-delete" onclick="deleteProfile('{{.Name}}')">Delete</button>
+            {{if .Changes}}
+            <details>
+                <summary>Show differences</summary>
+                <ul class="change-plan">
+                    {{range .Changes}}<li>{{.}}</li>{{end}}
+                </ul>
+            </details>
+            {{end}}
+        </div>
+        {{else}}
+        <div class="change-meta">No profiles saved.</div>
+        {{end}}
+        <button type="button" class="btn-add-dns" onclick="saveProfile()">Save Current Active Set as Profile</button>
+    </div>
+    
+    <!-- Import and backups -->
+    <div class="freeze-container">
+        <div class="changes-title">Configuration</div>
+        <div class="change-meta">
+            Add live Cloudflare records that are missing from the configuration.
+            <button type="button" class="btn-add-dns" onclick="importRecords()">Import from Cloudflare</button>
+        </div>
+        {{range .Backups}}
+        <div class="change-meta">
+            <code>{{.Name}}</code> &middot; {{.Modified.Format "2006-01-02 15:04:05"}} &middot; {{.Size}} bytes
+            <button type="button" class="btn-delete" onclick="restoreConfig('{{.Name}}')">Restore</button>
+        </div>
+        {{else}}
+        <div class="change-meta">No configuration backups yet.</div>
+        {{end}}
     </div>
     
+    <!-- Scheduled activations and deactivations -->
+    <div class="freeze-container">
+        <div class="changes-title">Schedules</div>
+        {{range .Schedules}}
+        <div class="change-meta" data-schedule-id="{{.ID}}">
+            <strong>{{.Action}}</strong> {{.TargetType}} <strong>{{.Target}}</strong>
+            &middot; {{if .Cron}}cron <code>{{.Cron}}</code>{{else if .At}}at {{.At.Format "2006-01-02 15:04"}}{{end}}
+            &middot; {{.Status}}{{if .NextRun}} &middot; next {{.NextRun.Format "2006-01-02 15:04"}}{{end}}
+            {{if .LastRun}}&middot; last run {{.LastRun.Format "2006-01-02 15:04"}}: {{if .LastSuccess}}✅{{else}}❌{{end}} {{.LastResult}}{{end}}
+            {{if .CreatedBy}}&middot; by {{.CreatedBy}}{{end}}{{if .ApprovedBy}}, approved by {{.ApprovedBy}}{{end}}
+            {{if eq .Status "pending_approval"}}<button type="button" class="btn-approve" onclick="updateSchedule('{{.ID}}', 'approve')">Approve</button>{{end}}
+            {{if or (eq .Status "active") (eq .Status "pending_approval")}}<button type="button" class="btn-delete" onclick="updateSchedule('{{.ID}}', 'cancel')">Cancel</button>{{end}}
+        </div>
+        {{else}}
+        <div class="change-meta">No schedules defined.</div>
+        {{end}}
+        <details>
+            <summary class="change-meta">Add schedule</summary>
+            <form class="freeze-form" onsubmit="addSchedule(event)">
+                <select name="action" class="form-input">
+                    <option value="activate">Activate</option>
+                    <option value="deactivate">Deactivate</option>
+                </select>
+                <select name="target" class="form-input" required>
+                    <optgroup label="Servers">
+                        {{range .ScheduleServers}}<option value="server:{{.UniqueID}}">{{.Alias}} ({{.Content}}, {{.Name}})</option>{{end}}
+                    </optgroup>
+                    <optgroup label="Accounts">
+                        {{range .AvailableAccounts}}<option value="account:{{.}}">{{.}}</option>{{end}}
+                    </optgroup>
+                    <optgroup label="Containers">
+                        {{range .AvailableContainers}}<option value="container:{{.}}">{{.}}</option>{{end}}
+                    </optgroup>
+                    <optgroup label="DNS names">
+                        {{range .ServerGroups}}<option value="name:{{.Name}}">{{.Name}}</option>{{end}}
+                    </optgroup>
+                </select>
+                <input type="datetime-local" name="at" class="form-input" title="Run once at">
+                <input type="text" name="cron" class="form-input" placeholder="Or cron (e.g. 0 6 * * 1-5)">
+                <button type="submit" class="btn-add-dns">Add Schedule</button>
+            </form>
+        </details>
+    </div>
+    
+    <div id="liveBanner" class="live-banner" style="display: none;"></div>
+    
     <form id="serverForm" onsubmit="updateServers(event)">
         <div class="server-grid">
             {{range .ServerGroups}}
@@ -676,6 +1296,7 @@ const indexHTML = `<!DOCTYPE html>
                         <div class="server-name">{{.Name}}</div>
                         <div class="server-ip">{{len .Entries}} DNS {{if eq (len .Entries) 1}}entry{{else}}entries{{end}}</div>
                     </div>
+                    {{if .InMaintenance}}<span class="maintenance-flag">🛠 MAINTENANCE</span>{{end}}
                     <div class="server-status">
                         <span class="status-indicator {{if .HasActiveEntries}}status-active{{else}}status-inactive{{end}}"></span>
                         <span>{{if .HasActiveEntries}}Active{{else}}Inactive{{end}}</span>
@@ -684,20 +1305,51 @@ const indexHTML = `<!DOCTYPE html>
                 
                 <div class="entries-container">
                     {{range .Entries}}
-                    <div class="entry-row" data-name="{{.Name}}" data-alias="{{.Alias}}" data-ip="{{.IP}}" data-created="{{.FirstSeenOn}}" data-active="{{.IsActive}}">
+                    <div class="entry-row state-{{.State}}" data-name="{{.Name}}" data-alias="{{.Alias}}" data-ip="{{.IP}}" data-created="{{.FirstSeenOn}}" data-active="{{.IsActive}}" data-state="{{.State}}">
+                        {{with .Maintenance}}
+                        <div class="maintenance-banner{{if .IsOverdue}} overdue{{end}}">
+                            🛠 <strong>In maintenance</strong> by {{.Owner}} since {{.StartedAt.Format "2006-01-02 15:04"}}: {{.Reason}}
+                            {{if .ExpectedEnd}}&middot; expected end {{.ExpectedEnd.Format "2006-01-02 15:04"}}{{if .IsOverdue}} (overdue){{end}}{{else}}&middot; no expected end{{end}}
+                        </div>
+                        {{end}}
                         <div class="entry-main">
                             <div class="entry-info">
                                 <span class="entry-name">{{.IP}} - {{.Alias}}</span>
                                 <div class="entry-details">
+                                    <span class="state-badge state-{{.State}}" title="{{.StateReason}}">{{.State}}</span>
                                     {{if .Proxied}}
                                         <span class="proxy-badge proxy-on">Proxied</span>
                                     {{else}}
                                         <span class="proxy-badge proxy-off">DNS only</span>
                                     {{end}}
                                     <span>TTL: {{.TTL}}s</span>
+                                    {{if and .IsActive .ExpiresAt}}
+                                        <span class="expiry-badge{{if .ExpiryBlocked}} expiry-blocked{{end}}" data-expires="{{.ExpiresAt}}" data-blocked="{{.ExpiryBlocked}}" title="{{if .ExpiryBlocked}}Deactivation blocked: {{.ExpiryBlocked}}{{else}}Deactivated automatically at {{.ExpiresAt}}{{end}}">⏱ expires</span>
+                                    {{end}}
+                                    {{with .Canary}}
+                                        <span class="canary-badge canary-{{.State}}" title="{{range .Transitions}}{{.At.Format "2006-01-02 15:04"}} {{if .From}}{{.From}} → {{end}}{{.To}}{{if .Reason}}: {{.Reason}}{{end}}&#10;{{end}}">🐤 canary: {{.State}}</span>
+                                        {{if and .IsRunning .LastResult}}<span class="canary-result">{{.LastResult}}</span>{{end}}
+                                    {{end}}
+                                    {{with .Drain}}
+                                        <span class="drain-badge" data-phase="{{.Phase}}" data-next="{{.NextStepAt.Format "2006-01-02T15:04:05Z07:00"}}" title="Draining since {{.StartedAt.Format "2006-01-02 15:04:05"}}{{if .Operator}} by {{.Operator}}{{end}}{{if .Reason}}: {{.Reason}}{{end}}">⏬ draining</span>
+                                        {{if .Error}}<span class="drain-error" title="{{.Error}}">⚠ waiting</span>{{end}}
+                                    {{end}}
                                 </div>
                             </div>
                             <div style="display: flex; align-items: center; gap: 10px;">
+                                {{if and .Canary .Canary.IsRunning}}
+                                    <button type="button" class="btn-drain" onclick="abortCanary('{{.CanaryID}}')">Abort Canary</button>
+                                {{end}}
+                                {{if eq .State "maintenance"}}
+                                    <button type="button" class="btn-maintenance" onclick="endMaintenance('{{.UniqueID}}')">End Maintenance</button>
+                                {{else if .CanMaintain}}
+                                    <button type="button" class="btn-maintenance" onclick="startMaintenance('{{.UniqueID}}', '{{.Alias}}')">Maintenance</button>
+                                {{end}}
+                                {{if .Drain}}
+                                    {{if eq .Drain.Phase "ttl"}}<button type="button" class="btn-drain" onclick="cancelDrain('{{.UniqueID}}')">Cancel Drain</button>{{end}}
+                                {{else if .IsActive}}
+                                    <button type="button" class="btn-drain" onclick="drainEntry('{{.UniqueID}}', '{{.Alias}}')">Drain</button>
+                                {{end}}
                                 <button type="button" class="btn-delete" onclick="deleteDNSEntry('{{.Name}}', '{{.IP}}')">Delete</button>
                                 <input type="checkbox" class="entry-checkbox" 
                                    name="active" 
@@ -709,7 +1361,8 @@ const indexHTML = `<!DOCTYPE html>
                                    data-ttl="{{.TTL}}"
                                    data-account="{{.Account}}"
                                    data-container="{{.Container}}"
-                                   {{if .IsActive}}checked{{end}}>
+                                   {{if .IsActive}}checked{{end}}
+                                   {{if and (not .IsActive) (or (eq .State "retired") (eq .State "maintenance"))}}disabled title="Move to standby before activating"{{end}}>
                             </div>
                         </div>
                         <div class="entry-tags">
@@ -737,6 +1390,26 @@ const indexHTML = `<!DOCTYPE html>
                                 </select>
                                 <button type="button" class="add-tag-btn" onclick="addTag('container')" title="Add new container">+</button>
                             </div>
+                            {{if .NextStates}}
+                            <div class="tag-group">
+                                <span class="tag-label">State:</span>
+                                <select class="tag-select" onchange="changeState('{{.UniqueID}}', this)">
+                                    <option value="">{{.State}}</option>
+                                    {{range .NextStates}}<option value="{{.}}">→ {{.}}</option>{{end}}
+                                </select>
+                            </div>
+                            {{end}}
+                            <div class="tag-group">
+                                <span class="tag-label">Active for:</span>
+                                <select class="tag-select expiry-select" title="Deactivate automatically after this time">
+                                    <option value="">{{if .ExpiresAt}}Keep current expiry{{else}}No limit{{end}}</option>
+                                    {{if .ExpiresAt}}<option value="0">No limit</option>{{end}}
+                                    <option value="1h">1 hour</option>
+                                    <option value="6h">6 hours</option>
+                                    <option value="24h">24 hours</option>
+                                    <option value="72h">3 days</option>
+                                </select>
+                            </div>
                         </div>
                     </div>
                     {{end}}
@@ -786,12 +1459,49 @@ const indexHTML = `<!DOCTYPE html>
                 <input type="number" id="newDnsTTL" name="ttl" 
                        value="60" min="60" max="86400">
             </div>
+            <div class="form-group">
+                <label for="newDnsExpires">Active for:</label>
+                <select id="newDnsExpires" name="expires_in" class="form-input">
+                    <option value="">No limit</option>
+                    <option value="1h">1 hour</option>
+                    <option value="6h">6 hours</option>
+                    <option value="24h">24 hours</option>
+                    <option value="72h">3 days</option>
+                </select>
+            </div>
             <div class="form-group">
                 <label for="newDnsProxied">
                     <input type="checkbox" id="newDnsProxied" name="proxied">
                     Proxied through Cloudflare
                 </label>
             </div>
+            <div class="form-group">
+                <label for="newDnsCanary">
+                    <input type="checkbox" id="newDnsCanary" name="canary" onchange="toggleCanaryFields(this.checked)">
+                    Add as canary first
+                </label>
+            </div>
+            <div class="form-group canary-field" style="display: none;">
+                <label for="newDnsProbePort">Probe port:</label>
+                <input type="number" id="newDnsProbePort" name="probe_port" value="3333" min="1" max="65535">
+            </div>
+            <div class="form-group canary-field" style="display: none;">
+                <label for="newDnsPeriod">Promote after healthy for:</label>
+                <select id="newDnsPeriod" name="period" class="form-input">
+                    <option value="15m">15 minutes</option>
+                    <option value="1h" selected>1 hour</option>
+                    <option value="6h">6 hours</option>
+                    <option value="24h">24 hours</option>
+                </select>
+            </div>
+            <div class="form-group canary-field" style="display: none;">
+                <label for="newDnsHashrateURL">Hashrate URL (optional):</label>
+                <input type="text" id="newDnsHashrateURL" name="hashrate_url" placeholder="e.g., http://1.2.3.4:8080/2/summary">
+            </div>
+            <div class="form-group canary-field" style="display: none;">
+                <label for="newDnsMinHashrate">Minimum hashrate (H/s):</label>
+                <input type="number" id="newDnsMinHashrate" name="min_hashrate" value="0" min="0">
+            </div>
             <div class="form-group" style="grid-column: 1 / -1;">
                 <button type="submit" class="btn-add-dns">Add DNS Entry</button>
             </div>
@@ -806,32 +1516,177 @@ const indexHTML = `<!DOCTYPE html>
     </div>
     
     <script>
-        // Populate tag dropdowns on page load
-        window.onload = function() {
-            const availableAccounts = {{.AvailableAccounts}};
-            const availableContainers = {{.AvailableContainers}};
-            
-            // Add event listeners to checkboxes to update visual state
-            const checkboxes = document.querySelectorAll('.entry-checkbox');
-            checkboxes.forEach(checkbox => {
-                // Set initial state
-                updateEntryVisualState(checkbox);
-                
-                // Add change listener
-                checkbox.addEventListener('change', function() {
-                    updateEntryVisualState(this);
-                    updateServerCardState(this);
-                });
-            });
-            
-            // Update server card states on load
-            updateAllServerCardStates();
+        // CSRF token required by all mutating API endpoints
+        const csrfToken = document.querySelector('meta[name="csrf-token"]').content;
+        
+        // Identifies this page in live events, so its own changes are not
+        // reported back as conflicts
+        const clientID = Math.random().toString(36).slice(2) + Date.now().toString(36);
+        
+        function apiHeaders() {
+            return {
+                'Content-Type': 'application/json',
+                'X-CSRF-Token': csrfToken,
+                'X-Operator': getOperator(),
+                'X-Client-ID': clientID,
+            };
+        }
+        
+        // Operator name is remembered per browser and sent with every change
+        function getOperator() {
+            return localStorage.getItem('xmrOperator') || '';
+        }
+        
+        function saveOperator(name) {
+            localStorage.setItem('xmrOperator', name.trim());
+        }
+        
+        function requireOperator() {
+            if (getOperator()) {
+                return true;
+            }
+            const name = prompt('Please enter your operator name:');
+            if (!name || name.trim() === '') {
+                return false;
+            }
+            saveOperator(name);
+            document.getElementById('operatorName').value = name.trim();
+            return true;
+        }
+        
+        // Approve or reject a pending production change request
+        // Import and restore run as jobs whose progress goes to the operation log
+        async function runConfigJob(url, payload, title) {
+            const statusDiv = document.getElementById('status');
+            statusDiv.className = 'status info';
+            statusDiv.innerHTML = '<span class="spinner"></span>' + title + '...';
+            statusDiv.style.display = 'block';
+            document.getElementById('logEntries').innerHTML = '';
+            addLog(title + '...');
             
-            // Populate all account dropdowns
-            const accountSelects = document.querySelectorAll('.account-select');
-            accountSelects.forEach(select => {
-                const currentValue = select.dataset.currentValue;
-                availableAccounts.forEach(account => {
+            try {
+                const data = await postWithOverrides(url, payload);
+                statusDiv.className = data.success ? 'status success' : 'status error';
+                statusDiv.innerHTML = (data.success ? '✅ ' : '❌ Error: ') + data.message;
+                if (data.success) {
+                    setTimeout(() => window.location.reload(), 3000);
+                }
+            } catch (error) {
+                statusDiv.className = 'status error';
+                statusDiv.innerHTML = '❌ Error: ' + error.message;
+            }
+        }
+        
+        function importRecords() {
+            runConfigJob('/api/import', {}, 'Importing records from Cloudflare');
+        }
+        
+        function restoreConfig(name) {
+            if (!confirm('Replace the {{.Environment | toUpper}} configuration with backup ' + name + '?\n\nThe current configuration is backed up first. DNS records are not changed.')) {
+                return;
+            }
+            runConfigJob('/api/backups/restore', { name }, 'Restoring ' + name);
+        }
+        
+        async function resolveApply(id, action) {
+            if (!requireOperator()) {
+                return;
+            }
+            const question = action === 'resume'
+                ? 'Make the remaining changes of interrupted apply #' + id + '?'
+                : 'Undo the applied changes of interrupted apply #' + id + '?';
+            if (!confirm(question)) {
+                return;
+            }
+            
+            try {
+                const result = await postWithOverrides('/api/journal/' + action, { id });
+                alert(result.success ? result.message : 'Error: ' + (result.message || 'Failed to resolve apply'));
+                window.location.reload();
+            } catch (error) {
+                alert('Error: ' + error.message);
+            }
+        }
+        
+        async function decideChange(id, approve, breakGlassReason, forceReason) {
+            if (!requireOperator()) {
+                return;
+            }
+            let reason = '';
+            if (breakGlassReason || forceReason) {
+                // Already confirmed, retrying with an override
+            } else if (approve) {
+                if (!confirm('⚠️ Approve and apply change request #' + id + ' to PRODUCTION DNS records?')) {
+                    return;
+                }
+            } else {
+                reason = prompt('Reason for rejecting change request #' + id + ':') || '';
+            }
+            
+            try {
+                const response = await fetch(approve ? '/api/changes/approve' : '/api/changes/reject', {
+                    method: 'POST',
+                    headers: apiHeaders(),
+                    body: JSON.stringify({ id, reason, break_glass_reason: breakGlassReason || '', force: !!forceReason, force_reason: forceReason || '' })
+                });
+                let result = await response.json();
+                if (result.job_id) {
+                    result = await followJob(result.job_id);
+                }
+                
+                if (result.frozen && !breakGlassReason) {
+                    const override = askBreakGlass(result.message);
+                    if (override) {
+                        decideChange(id, approve, override, forceReason);
+                    }
+                    return;
+                }
+                if (result.guarded && !forceReason) {
+                    const override = askForce(result.message);
+                    if (override) {
+                        decideChange(id, approve, breakGlassReason, override);
+                    }
+                    return;
+                }
+                if (result.success) {
+                    alert(result.message);
+                } else {
+                    alert('Error: ' + (result.message || 'Failed to process change request'));
+                }
+                window.location.reload();
+            } catch (error) {
+                alert('Error: ' + error.message);
+            }
+        }
+        
+        // Populate tag dropdowns on page load
+        window.onload = function() {
+            document.getElementById('operatorName').value = getOperator();
+            
+            const availableAccounts = {{.AvailableAccounts}};
+            const availableContainers = {{.AvailableContainers}};
+            
+            // Add event listeners to checkboxes to update visual state
+            const checkboxes = document.querySelectorAll('.entry-checkbox');
+            checkboxes.forEach(checkbox => {
+                // Set initial state
+                updateEntryVisualState(checkbox);
+                
+                // Add change listener
+                checkbox.addEventListener('change', function() {
+                    updateEntryVisualState(this);
+                    updateServerCardState(this);
+                });
+            });
+            
+            // Update server card states on load
+            updateAllServerCardStates();
+            
+            // Populate all account dropdowns
+            const accountSelects = document.querySelectorAll('.account-select');
+            accountSelects.forEach(select => {
+                const currentValue = select.dataset.currentValue;
+                availableAccounts.forEach(account => {
                     const option = document.createElement('option');
                     option.value = account;
                     option.textContent = account;
@@ -860,6 +1715,8 @@ const indexHTML = `<!DOCTYPE html>
                 // Store current value for revert
                 select.dataset.previousValue = currentValue || '';
             });
+            
+            connectLiveEvents();
         };
         
         // Function to update entry row visual state
@@ -904,6 +1761,169 @@ const indexHTML = `<!DOCTYPE html>
             });
         }
         
+        // Live updates: changes made by other users and background workers
+        // are applied to the cards in place
+        function selectorValue(value) {
+            return window.CSS && CSS.escape ? CSS.escape(value) : value.replace(/["\\]/g, '\\$&');
+        }
+        
+        function findEntryRow(server) {
+            if (server.unique_id) {
+                const select = document.querySelector('.account-select[data-unique-id="' + selectorValue(server.unique_id) + '"]');
+                if (select) {
+                    return select.closest('.entry-row');
+                }
+            }
+            return document.querySelector('.entry-row[data-name="' + selectorValue(server.name) + '"][data-ip="' + selectorValue(server.ip || '') + '"]');
+        }
+        
+        // Show a notice above the cards; conflicts are highlighted
+        function showLiveNotice(message, conflict) {
+            const banner = document.getElementById('liveBanner');
+            banner.className = 'live-banner' + (conflict ? ' conflict' : '');
+            banner.innerHTML = '';
+            
+            const text = document.createElement('span');
+            text.textContent = message;
+            const reload = document.createElement('a');
+            reload.href = '#';
+            reload.textContent = 'Reload';
+            reload.onclick = event => {
+                event.preventDefault();
+                window.location.reload();
+            };
+            const dismiss = document.createElement('button');
+            dismiss.type = 'button';
+            dismiss.textContent = '×';
+            dismiss.title = 'Dismiss';
+            dismiss.onclick = () => { banner.style.display = 'none'; };
+            
+            banner.append(text, reload, dismiss);
+            banner.style.display = 'flex';
+        }
+        
+        function setTagSelect(select, value) {
+            if (value && !Array.from(select.options).some(option => option.value === value)) {
+                const option = document.createElement('option');
+                option.value = value;
+                option.textContent = value;
+                select.appendChild(option);
+            }
+            select.value = value;
+            select.dataset.currentValue = value;
+            select.dataset.previousValue = value;
+        }
+        
+        // Apply one changed entry. Returns 'applied', 'conflict' when the
+        // user is editing what changed, or 'missing' when the entry is not
+        // on this page.
+        function applyServerEvent(server, own) {
+            if (server.notes !== undefined) {
+                const textarea = document.querySelector('.notes-textarea[data-name="' + selectorValue(server.name) + '"]');
+                if (!textarea) {
+                    return 'missing';
+                }
+                const saved = textarea.dataset.previousValue !== undefined ? textarea.dataset.previousValue : textarea.defaultValue;
+                if (!own && textarea.value !== server.notes && (document.activeElement === textarea || textarea.value !== saved)) {
+                    return 'conflict';
+                }
+                textarea.value = server.notes;
+                textarea.dataset.previousValue = server.notes;
+                return 'applied';
+            }
+            
+            const row = findEntryRow(server);
+            if (!row) {
+                return 'missing';
+            }
+            let outcome = 'applied';
+            
+            [['account', server.account], ['container', server.container]].forEach(([tagType, value]) => {
+                if (value === undefined) {
+                    return;
+                }
+                const select = row.querySelector('.' + tagType + '-select');
+                if (!own && document.activeElement === select && select.value !== value) {
+                    outcome = 'conflict';
+                    return;
+                }
+                setTagSelect(select, value);
+            });
+            
+            if (server.active !== undefined) {
+                const checkbox = row.querySelector('.entry-checkbox');
+                const edited = checkbox.checked !== checkbox.defaultChecked;
+                if (!own && edited && checkbox.checked !== server.active) {
+                    outcome = 'conflict';
+                } else {
+                    checkbox.checked = server.active;
+                    checkbox.defaultChecked = server.active;
+                    row.dataset.active = String(server.active);
+                    updateEntryVisualState(checkbox);
+                    updateServerCardState(checkbox);
+                }
+            }
+            
+            if (server.state) {
+                const badge = row.querySelector('.state-badge');
+                row.classList.remove('state-' + row.dataset.state);
+                row.classList.add('state-' + server.state);
+                row.dataset.state = server.state;
+                if (badge) {
+                    badge.textContent = server.state;
+                    badge.className = 'state-badge state-' + server.state;
+                }
+            }
+            return outcome;
+        }
+        
+        function handleLiveEvent(event) {
+            const own = event.client === clientID;
+            let conflict = false;
+            let missing = false;
+            (event.servers || []).forEach(server => {
+                const outcome = applyServerEvent(server, own);
+                conflict = conflict || outcome === 'conflict';
+                missing = missing || outcome === 'missing';
+            });
+            
+            // New account or container options become selectable right away
+            if (event.type === 'tags' && event.data && event.data.tag_name) {
+                document.querySelectorAll('.' + event.data.tag_type + '-select').forEach(select => {
+                    if (!Array.from(select.options).some(option => option.value === event.data.tag_name)) {
+                        const option = document.createElement('option');
+                        option.value = event.data.tag_name;
+                        option.textContent = event.data.tag_name;
+                        select.appendChild(option);
+                    }
+                });
+            }
+            
+            if (own) {
+                return;
+            }
+            const who = event.operator || 'Another user';
+            if (conflict) {
+                showLiveNotice(who + ' changed something you are editing: ' + event.message + '. Your edit was kept; reload to see their change or save to overwrite it.', true);
+            } else if (missing) {
+                showLiveNotice(event.message + '. Reload to see the new entries.', false);
+            } else if (event.type === 'health' || event.type === 'drift') {
+                showLiveNotice(event.message, event.type === 'drift');
+            }
+        }
+        
+        // EventSource reconnects by itself and sends Last-Event-ID, so
+        // events missed while disconnected are replayed
+        function connectLiveEvents() {
+            if (!window.EventSource) {
+                return;
+            }
+            const source = new EventSource('/api/events');
+            ['activation', 'notes', 'tags', 'state', 'health', 'drift'].forEach(type => {
+                source.addEventListener(type, message => handleLiveEvent(JSON.parse(message.data)));
+            });
+        }
+        
         // Sorting and filtering functions
         function applySortingAndFiltering() {
             const sortBy = document.getElementById('sortBy').value;
@@ -935,6 +1955,8 @@ const indexHTML = `<!DOCTYPE html>
                         showEntry = false;
                     } else if (filterState === 'inactive' && isActive) {
                         showEntry = false;
+                    } else if (filterState.startsWith('state:') && entry.dataset.state !== filterState.slice(6)) {
+                        showEntry = false;
                     }
                     
                     entry.style.display = showEntry ? '' : 'none';
@@ -1019,20 +2041,24 @@ const indexHTML = `<!DOCTYPE html>
         }
         
         // Delete DNS entry function
-        async function deleteDNSEntry(name, ip) {
-            const confirmMsg = 'Are you sure you want to delete the DNS entry:\n\n' + name + ' -> ' + ip + '\n\nThis action cannot be undone.';
+        async function deleteDNSEntry(name, ip, breakGlassReason, forceReason) {
+            const confirmMsg = 'Are you sure you want to delete the DNS entry:\n\n' + name + ' -> ' + ip + '\n\nThe server is kept as retired and can be moved back to standby later.';
             
-            if (!confirm(confirmMsg)) {
+            if (!breakGlassReason && !forceReason && !confirm(confirmMsg)) {
                 return;
             }
             
             try {
                 const response = await fetch('/api/dns/delete', {
                     method: 'POST',
-                    headers: {
-                        'Content-Type': 'application/json',
-                    },
-                    body: JSON.stringify({ name, ip })
+                    headers: apiHeaders(),
+                    body: JSON.stringify({
+                        name,
+                        ip,
+                        break_glass_reason: breakGlassReason || '',
+                        force: !!forceReason,
+                        force_reason: forceReason || ''
+                    })
                 });
                 
                 const result = await response.json();
@@ -1040,6 +2066,16 @@ const indexHTML = `<!DOCTYPE html>
                 if (response.ok) {
                     alert('DNS entry deleted successfully');
                     window.location.reload();
+                } else if (result.frozen && !breakGlassReason) {
+                    const reason = askBreakGlass(result.error);
+                    if (reason) {
+                        deleteDNSEntry(name, ip, reason, forceReason);
+                    }
+                } else if (result.guarded && !forceReason) {
+                    const reason = askForce(result.error);
+                    if (reason) {
+                        deleteDNSEntry(name, ip, breakGlassReason, reason);
+                    }
                 } else {
                     alert('Error: ' + (result.error || 'Failed to delete DNS entry'));
                 }
@@ -1048,1926 +2084,10452 @@ const indexHTML = `<!DOCTYPE html>
             }
         }
         
-        function confirmProduction() {
-            return confirm('⚠️ WARNING: You are about to modify PRODUCTION DNS records. Are you sure?');
+        // Ask for a break-glass reason when a change is blocked by a freeze window
+        function askBreakGlass(message) {
+            const reason = prompt('🧊 ' + message + '\n\nTo override the freeze (break glass), enter a reason:');
+            return reason && reason.trim() !== '' ? reason.trim() : null;
         }
         
-        function updateServers(event) {
+        // Ask for a reason to force a change blocked by the blast-radius guard
+        function askForce(message) {
+            const reason = prompt('🛑 ' + message + '\n\nTo apply anyway (force), enter a reason:');
+            return reason && reason.trim() !== '' ? reason.trim() : null;
+        }
+        
+        // Freeze window management
+        async function addFreezeWindow(event) {
             event.preventDefault();
+            const form = event.target;
+            const formData = new FormData(form);
+            const splitList = value => (value || '').split(',').map(v => v.trim()).filter(v => v !== '');
             
-            const statusDiv = document.getElementById('status');
-            const logDiv = document.getElementById('operationLog');
-            const logEntries = document.getElementById('logEntries');
-            
-            statusDiv.className = 'status info';
-            statusDiv.innerHTML = '<span class="spinner"></span>Processing DNS updates...';
-            statusDiv.style.display = 'block';
-            logDiv.style.display = 'block';
-            logEntries.innerHTML = '';
-            
-            const formData = new FormData(event.target);
-            const activeIPs = formData.getAll('active');
+            const windowDef = {
+                name: formData.get('name'),
+                cron: formData.get('cron') || '',
+                duration: formData.get('duration') || '',
+                accounts: splitList(formData.get('accounts')),
+                containers: splitList(formData.get('containers'))
+            };
+            if (formData.get('start')) {
+                windowDef.start = new Date(formData.get('start')).toISOString();
+            }
+            if (formData.get('end')) {
+                windowDef.end = new Date(formData.get('end')).toISOString();
+            }
             
-            // Build request data with all fields including tags
-            const servers = [];
-            document.querySelectorAll('input[name="active"]:checked').forEach(checkbox => {
-                // Find the corresponding select elements in the same entry
-                const entryRow = checkbox.closest('.entry-row');
-                const accountSelect = entryRow.querySelector('.account-select');
-                const containerSelect = entryRow.querySelector('.container-select');
-                
-                servers.push({
-                    ip: checkbox.dataset.ip,
-                    name: checkbox.dataset.name,
-                    alias: checkbox.dataset.alias,
-                    account: accountSelect ? accountSelect.value : '',
-                    container: containerSelect ? containerSelect.value : '',
-                    proxied: checkbox.dataset.proxied === 'true',
-                    ttl: parseInt(checkbox.dataset.ttl) || 60,
-                    active: true
+            try {
+                const response = await fetch('/api/freeze/add', {
+                    method: 'POST',
+                    headers: apiHeaders(),
+                    body: JSON.stringify(windowDef)
                 });
-            });
-            
-            // Add log entry
-            function addLog(message, type = 'info') {
-                const entry = document.createElement('div');
-                entry.className = 'log-entry';
-                const timestamp = new Date().toLocaleTimeString();
-                entry.innerHTML = '[' + timestamp + '] ' + message;
-                entry.style.color = type === 'error' ? '#dc3545' : type === 'success' ? '#28a745' : '#333';
-                logEntries.appendChild(entry);
-                logEntries.scrollTop = logEntries.scrollHeight;
+                const result = await response.json();
+                if (result.success) {
+                    window.location.reload();
+                } else {
+                    alert('Error: ' + result.message);
+                }
+            } catch (error) {
+                alert('Error: ' + error.message);
             }
-            
-            addLog('Starting DNS update process...');
-            
-            fetch('/api/update', {
-                method: 'POST',
-                headers: {
-                    'Content-Type': 'application/json',
-                },
-                body: JSON.stringify({active_servers: servers})
-            })
-            .then(response => response.json())
-            .then(data => {
-                if (data.success) {
-                    statusDiv.className = 'status success';
-                    statusDiv.innerHTML = '✅ ' + data.message;
-                    
-                    // Log details
-                    if (data.details) {
-                        data.details.forEach(detail => {
-                            addLog(detail.message, detail.status);
-                        });
-                    }
-                    
-                    // Reload page after 3 seconds
-                    setTimeout(() => {
-                        window.location.reload();
-                    }, 3000);
+        }
+        
+        async function deleteFreezeWindow(id, name) {
+            if (!confirm('Remove freeze window "' + name + '"?')) {
+                return;
+            }
+            try {
+                const result = await postWithOverrides('/api/freeze/delete', { id });
+                if (result.success) {
+                    window.location.reload();
                 } else {
-                    statusDiv.className = 'status error';
-                    statusDiv.innerHTML = '❌ Error: ' + data.message;
-                    addLog('Error: ' + data.message, 'error');
+                    alert('Error: ' + result.message);
                 }
-            })
-            .catch(error => {
-                statusDiv.className = 'status error';
-                statusDiv.innerHTML = '❌ Error: ' + error.message;
-                addLog('Fatal error: ' + error.message, 'error');
-            });
+            } catch (error) {
+                alert('Error: ' + error.message);
+            }
         }
         
-        // Auto-refresh every 30 seconds
-        setInterval(() => {
-            document.getElementById('lastUpdate').textContent = new Date().toLocaleString();
-        }, 30000);
+        // Add an entry to the operation log
+        function addLog(message, type = 'info') {
+            const logEntries = document.getElementById('logEntries');
+            document.getElementById('operationLog').style.display = 'block';
+            const entry = document.createElement('div');
+            entry.className = 'log-entry';
+            const timestamp = new Date().toLocaleTimeString();
+            entry.innerHTML = '[' + timestamp + '] ' + message;
+            entry.style.color = type === 'error' ? '#dc3545' : type === 'success' ? '#28a745' : type === 'warning' ? '#b8860b' : '#333';
+            logEntries.appendChild(entry);
+            logEntries.scrollTop = logEntries.scrollHeight;
+        }
         
-        // Function to update tags
-        function updateTag(selectElement, tagType) {
-            const uniqueId = selectElement.dataset.uniqueId;
-            const ip = selectElement.dataset.ip;
-            const name = selectElement.dataset.name;
-            const value = selectElement.value;
-            
-            // Send update to server
-            fetch('/api/update-tag', {
-                method: 'POST',
-                headers: {
-                    'Content-Type': 'application/json',
-                },
-                body: JSON.stringify({
-                    unique_id: uniqueId,
-                    ip: ip,
-                    name: name,
-                    tag_type: tagType,
-                    value: value
-                })
-            })
-            .then(response => response.json())
-            .then(data => {
-                if (!data.success) {
-                    alert('Failed to update tag: ' + data.message);
-                    // Revert the selection on failure
-                    selectElement.value = selectElement.dataset.previousValue || '';
-                }
-            })
-            .catch(error => {
-                alert('Error updating tag: ' + error.message);
-                selectElement.value = selectElement.dataset.previousValue || '';
+        // Follow a background job, logging each record change as it happens.
+        // Resolves with the job's result; result.streamed is set when its
+        // details were logged already.
+        function followJob(id) {
+            return new Promise((resolve, reject) => {
+                const source = new EventSource('/api/jobs/' + encodeURIComponent(id) + '/stream');
+                let streamed = false;
+                source.addEventListener('progress', event => {
+                    const progress = JSON.parse(event.data);
+                    addLog(progress.message, progress.status);
+                    streamed = true;
+                });
+                source.addEventListener('done', event => {
+                    source.close();
+                    const job = JSON.parse(event.data);
+                    const result = job.result || { success: job.status === 'succeeded', message: job.message };
+                    result.streamed = streamed;
+                    resolve(result);
+                });
+                source.onerror = () => {
+                    source.close();
+                    reject(new Error('Lost connection to job ' + id + '; see /api/jobs/' + id));
+                };
             });
-            
-            // Store current value for potential revert
-            selectElement.dataset.previousValue = value;
         }
         
-        // Function to update notes
-        function updateNotes(textarea) {
-            const name = textarea.dataset.name;
-            const notes = textarea.value;
-            
-            // Send update to server
-            fetch('/api/update-notes', {
-                method: 'POST',
-                headers: {
-                    'Content-Type': 'application/json',
-                },
-                body: JSON.stringify({
-                    name: name,
-                    notes: notes
-                })
-            })
-            .then(response => response.json())
-            .then(data => {
-                if (!data.success) {
-                    alert('Failed to update notes: ' + data.message);
-                    // Revert the text on failure
-                    textarea.value = textarea.dataset.previousValue || '';
+        // Post a change and ask for break-glass / force overrides when it is blocked
+        async function postWithOverrides(url, payload) {
+            while (true) {
+                const response = await fetch(url, {
+                    method: 'POST',
+                    headers: apiHeaders(),
+                    body: JSON.stringify(payload)
+                });
+                let data = await response.json();
+                if (data.job_id) {
+                    data = await followJob(data.job_id);
                 }
-            })
-            .catch(error => {
-                alert('Error updating notes: ' + error.message);
-                textarea.value = textarea.dataset.previousValue || '';
-            });
-            
-            // Store current value for potential revert
-            textarea.dataset.previousValue = notes;
+                
+                if (data.frozen && !payload.break_glass_reason) {
+                    const reason = askBreakGlass(data.message);
+                    if (!reason) {
+                        return data;
+                    }
+                    payload.break_glass_reason = reason;
+                    continue;
+                }
+                if (data.guarded && !payload.force) {
+                    const reason = askForce(data.message);
+                    if (!reason) {
+                        return data;
+                    }
+                    payload.force = true;
+                    payload.force_reason = reason;
+                    continue;
+                }
+                return data;
+            }
         }
         
-        // Function to add a new tag
-        function addTag(tagType) {
-            const newTag = prompt('Enter new ' + tagType + ':');
-            if (!newTag || newTag.trim() === '') {
+        // Drain management
+        async function drainEntry(uniqueId, alias) {
+            const reason = prompt('Drain ' + alias + '? The TTL is lowered first and the record removed once resolvers caught up.\n\nReason (optional):');
+            if (reason === null) {
+                return;
+            }
+            try {
+                const data = await postWithOverrides('/api/drain', { unique_id: uniqueId, reason: reason.trim() });
+                if (data.success) {
+                    window.location.reload();
+                } else {
+                    alert('Error: ' + data.message);
+                }
+            } catch (error) {
+                alert('Error: ' + error.message);
+            }
+        }
+        
+        async function cancelDrain(uniqueId) {
+            if (!confirm('Cancel the drain and restore the original TTL?')) {
+                return;
+            }
+            try {
+                const response = await fetch('/api/drain/cancel', {
+                    method: 'POST',
+                    headers: apiHeaders(),
+                    body: JSON.stringify({ unique_id: uniqueId })
+                });
+                const result = await response.json();
+                if (result.success) {
+                    window.location.reload();
+                } else {
+                    alert('Error: ' + result.message);
+                }
+            } catch (error) {
+                alert('Error: ' + error.message);
+            }
+        }
+        
+        // Drift detection
+        async function checkDrift() {
+            try {
+                const response = await fetch('/api/drift/check', {
+                    method: 'POST',
+                    headers: apiHeaders(),
+                    body: JSON.stringify({})
+                });
+                const result = await response.json();
+                if (result.pending) {
+                    alert(result.message);
+                } else if (!result.success) {
+                    alert('Error: ' + (result.drift && result.drift.error ? result.drift.error : result.message));
+                }
+                window.location.reload();
+            } catch (error) {
+                alert('Error: ' + error.message);
+            }
+        }
+        
+        // Profile management
+        async function saveProfile() {
+            const name = prompt('Save the current active set as profile:');
+            if (!name || name.trim() === '') {
+                return;
+            }
+            try {
+                const response = await fetch('/api/profiles/save', {
+                    method: 'POST',
+                    headers: apiHeaders(),
+                    body: JSON.stringify({ name: name.trim() })
+                });
+                const result = await response.json();
+                alert(result.success ? result.message : 'Error: ' + result.message);
+                window.location.reload();
+            } catch (error) {
+                alert('Error: ' + error.message);
+            }
+        }
+        
+        async function applyProfile(name) {
+            {{if .RequireApproval}}
+            if (!requireOperator()) {
+                return;
+            }
+            {{end}}
+            if (!confirm('Switch {{.Environment | toUpper}} DNS records to profile "' + name + '"?')) {
                 return;
             }
             
-            // Send request to add new tag
-            fetch('/api/add-tag', {
-                method: 'POST',
-                headers: {
-                    'Content-Type': 'application/json',
-                },
-                body: JSON.stringify({
-                    tag_type: tagType,
-                    tag_name: newTag.trim()
-                })
-            })
-            .then(response => response.json())
-            .then(data => {
+            const statusDiv = document.getElementById('status');
+            statusDiv.className = 'status info';
+            statusDiv.innerHTML = '<span class="spinner"></span>Switching to profile ' + name + '...';
+            statusDiv.style.display = 'block';
+            
+            try {
+                const data = await postWithOverrides('/api/profiles/apply', { name });
                 if (data.success) {
-                    // Reload the page to show the new tag in all dropdowns
-                    location.reload();
+                    statusDiv.className = data.pending ? 'status info' : 'status success';
+                    statusDiv.innerHTML = (data.pending ? '⏳ ' : '✅ ') + data.message;
+                    setTimeout(() => window.location.reload(), 3000);
                 } else {
-                    alert('Failed to add tag: ' + data.message);
+                    statusDiv.className = 'status error';
+                    statusDiv.innerHTML = '❌ Error: ' + data.message;
                 }
-            })
-            .catch(error => {
-                alert('Error adding tag: ' + error.message);
-            });
+            } catch (error) {
+                statusDiv.className = 'status error';
+                statusDiv.innerHTML = '❌ Error: ' + error.message;
+            }
         }
         
-        // Function to add DNS entry
-        async function addDNSEntry(event) {
+        async function deleteProfile(name) {
+            if (!confirm('Delete profile "' + name + '"?')) {
+                return;
+            }
+            try {
+                const response = await fetch('/api/profiles/delete', {
+                    method: 'POST',
+                    headers: apiHeaders(),
+                    body: JSON.stringify({ name })
+                });
+                const result = await response.json();
+                if (result.success) {
+                    window.location.reload();
+                } else {
+                    alert('Error: ' + result.message);
+                }
+            } catch (error) {
+                alert('Error: ' + error.message);
+            }
+        }
+        
+        // Schedule management
+        async function addSchedule(event) {
             event.preventDefault();
+            const formData = new FormData(event.target);
+            const target = formData.get('target') || '';
+            const separator = target.indexOf(':');
             
-            const form = event.target;
-            const formData = new FormData(form);
-            
-            const dnsEntry = {
-                name: formData.get('name'),
-                ip: formData.get('ip'),
-                alias: formData.get('alias') || formData.get('name'),
-                ttl: parseInt(formData.get('ttl')) || 60,
-                proxied: formData.get('proxied') === 'on'
+            const schedule = {
+                action: formData.get('action'),
+                target_type: target.substring(0, separator),
+                target: target.substring(separator + 1),
+                cron: formData.get('cron') || ''
             };
-            
-            // Show loading state
-            const submitBtn = form.querySelector('.btn-add-dns');
-            const originalText = submitBtn.textContent;
-            submitBtn.disabled = true;
-            submitBtn.textContent = 'Adding...';
-            
-            // Show status
-            const statusDiv = document.getElementById('status');
+            if (formData.get('at')) {
+                schedule.at = new Date(formData.get('at')).toISOString();
+            }
             
             try {
-                const response = await fetch('/api/dns/create', {
+                const response = await fetch('/api/schedules/add', {
                     method: 'POST',
-                    headers: {
-                        'Content-Type': 'application/json',
-                    },
-                    body: JSON.stringify(dnsEntry)
+                    headers: apiHeaders(),
+                    body: JSON.stringify(schedule)
                 });
-                
                 const result = await response.json();
-                
-                if (response.ok) {
-                    statusDiv.textContent = 'DNS entry added successfully! Refreshing...';
-                    statusDiv.style.color = 'green';
-                    statusDiv.style.display = 'block';
-                    form.reset();
-                    // Reload page to show new entry
-                    setTimeout(() => {
-                        window.location.reload();
-                    }, 1500);
+                if (result.success) {
+                    alert(result.message);
+                    window.location.reload();
                 } else {
-                    statusDiv.textContent = 'Error: ' + (result.error || 'Failed to add DNS entry');
-                    statusDiv.style.color = 'red';
-                    statusDiv.style.display = 'block';
+                    alert('Error: ' + result.message);
                 }
             } catch (error) {
-                statusDiv.textContent = 'Error: ' + error.message;
-                statusDiv.style.color = 'red';
-                statusDiv.style.display = 'block';
-            } finally {
-                submitBtn.disabled = false;
-                submitBtn.textContent = originalText;
+                alert('Error: ' + error.message);
             }
         }
-    </script>
-</body>
-</html>`
+        
+        async function updateSchedule(id, action) {
+            if (action === 'cancel' && !confirm('Cancel this schedule?')) {
+                return;
+            }
+            if (action === 'approve' && !requireOperator()) {
+                return;
+            }
+            try {
+                const response = await fetch('/api/schedules/' + action, {
+                    method: 'POST',
+                    headers: apiHeaders(),
+                    body: JSON.stringify({ id })
+                });
+                const result = await response.json();
+                if (result.success) {
+                    window.location.reload();
+                } else {
+                    alert('Error: ' + result.message);
+                }
+            } catch (error) {
+                alert('Error: ' + error.message);
+            }
+        }
+        
+        function confirmProduction() {
+            return confirm('⚠️ WARNING: You are about to modify PRODUCTION DNS records. Are you sure?');
+        }
+        
+        function updateServers(event) {
+            event.preventDefault();
+            
+            {{if .RequireApproval}}
+            if (!requireOperator()) {
+                return;
+            }
+            {{end}}
+            
+            const statusDiv = document.getElementById('status');
+            const logDiv = document.getElementById('operationLog');
+            const logEntries = document.getElementById('logEntries');
+            
+            statusDiv.className = 'status info';
+            statusDiv.innerHTML = '<span class="spinner"></span>Processing DNS updates...';
+            statusDiv.style.display = 'block';
+            logDiv.style.display = 'block';
+            logEntries.innerHTML = '';
+            
+            const formData = new FormData(event.target);
+            const activeIPs = formData.getAll('active');
+            
+            // Build request data with all fields including tags
+            const servers = [];
+            document.querySelectorAll('input[name="active"]:checked').forEach(checkbox => {
+                // Find the corresponding select elements in the same entry
+                const entryRow = checkbox.closest('.entry-row');
+                const accountSelect = entryRow.querySelector('.account-select');
+                const containerSelect = entryRow.querySelector('.container-select');
+                const expirySelect = entryRow.querySelector('.expiry-select');
+                
+                servers.push({
+                    ip: checkbox.dataset.ip,
+                    name: checkbox.dataset.name,
+                    alias: checkbox.dataset.alias,
+                    account: accountSelect ? accountSelect.value : '',
+                    container: containerSelect ? containerSelect.value : '',
+                    proxied: checkbox.dataset.proxied === 'true',
+                    ttl: parseInt(checkbox.dataset.ttl) || 60,
+                    active: true,
+                    expires_in: expirySelect ? expirySelect.value : ''
+                });
+            });
+            
+            addLog('Starting DNS update process...');
+            
+            let force = null;
+            sendUpdate('');
+            
+            function sendUpdate(breakGlassReason) {
+            fetch('/api/update', {
+                method: 'POST',
+                headers: apiHeaders(),
+                body: JSON.stringify({
+                    active_servers: servers,
+                    break_glass_reason: breakGlassReason,
+                    force: force !== null,
+                    force_reason: force ? force.reason : ''
+                })
+            })
+            .then(response => response.json())
+            .then(data => data.job_id ? followJob(data.job_id) : data)
+            .then(data => {
+                if (data.success && data.pending) {
+                    statusDiv.className = 'status info';
+                    statusDiv.innerHTML = '⏳ ' + data.message;
+                    
+                    if (data.details) {
+                        data.details.forEach(detail => {
+                            addLog(detail.message, detail.status);
+                        });
+                    }
+                    
+                    setTimeout(() => {
+                        window.location.reload();
+                    }, 3000);
+                } else if (data.success) {
+                    statusDiv.className = 'status success';
+                    statusDiv.innerHTML = '✅ ' + data.message;
+                    
+                    // Log details unless they were streamed already
+                    if (data.details && !data.streamed) {
+                        data.details.forEach(detail => {
+                            addLog(detail.message, detail.status);
+                        });
+                    }
+                    
+                    // Follow resolver propagation, then reload
+                    if (data.propagation_id) {
+                        followPropagation(data.propagation_id, addLog, () => window.location.reload());
+                    } else {
+                        setTimeout(() => {
+                            window.location.reload();
+                        }, 3000);
+                    }
+                } else if (data.guarded && !force) {
+                    addLog(data.message, 'error');
+                    const reason = askForce(data.message);
+                    if (reason) {
+                        addLog('Retrying with force: ' + reason);
+                        force = { reason: reason };
+                        sendUpdate(breakGlassReason);
+                    } else {
+                        statusDiv.className = 'status error';
+                        statusDiv.innerHTML = '🛑 ' + data.message;
+                    }
+                } else if (data.frozen && !breakGlassReason) {
+                    addLog(data.message, 'error');
+                    const reason = askBreakGlass(data.message);
+                    if (reason) {
+                        addLog('Retrying with break-glass override: ' + reason);
+                        sendUpdate(reason);
+                    } else {
+                        statusDiv.className = 'status error';
+                        statusDiv.innerHTML = '🧊 ' + data.message;
+                    }
+                } else {
+                    statusDiv.className = 'status error';
+                    statusDiv.innerHTML = '❌ Error: ' + data.message;
+                    if (data.details && !data.streamed) {
+                        data.details.forEach(detail => {
+                            addLog(detail.message, detail.status);
+                        });
+                    }
+                    if (data.rollback && !data.streamed) {
+                        addLog('Rolling back completed changes...', 'warning');
+                        data.rollback.details.forEach(detail => {
+                            addLog(detail.message, detail.status);
+                        });
+                    }
+                    addLog('Error: ' + data.message, 'error');
+                }
+            })
+            .catch(error => {
+                statusDiv.className = 'status error';
+                statusDiv.innerHTML = '❌ Error: ' + error.message;
+                addLog('Fatal error: ' + error.message, 'error');
+            });
+            }
+        }
+        
+        // Resolver propagation after an update
+        function propagationSummary(name) {
+            if (name.skipped) {
+                return name.name + ': not checked (' + name.skipped + ')';
+            }
+            const matching = name.results.filter(r => r.match).length;
+            const waiting = name.results.filter(r => !r.match)
+                .map(r => r.resolver + ' → ' + (r.error || r.ips.join(', ') || 'no records'));
+            let summary = name.name + ': ' + matching + '/' + name.results.length + ' nameservers return ' + (name.desired.join(', ') || 'no records');
+            if (waiting.length > 0) {
+                summary += ' (waiting for ' + waiting.join('; ') + ')';
+            }
+            return summary;
+        }
+        
+        function followPropagation(id, log, onDone) {
+            log('Checking propagation at the authoritative nameservers and resolvers...');
+            const lastSummary = {};
+            const source = new EventSource('/api/propagation/stream?id=' + encodeURIComponent(id));
+            const report = check => {
+                check.names.forEach(name => {
+                    const summary = propagationSummary(name);
+                    if (lastSummary[name.name] !== summary) {
+                        lastSummary[name.name] = summary;
+                        log(summary, name.converged ? 'success' : 'info');
+                    }
+                });
+            };
+            source.addEventListener('progress', event => report(JSON.parse(event.data)));
+            source.addEventListener('done', event => {
+                source.close();
+                const check = JSON.parse(event.data);
+                report(check);
+                if (check.converged) {
+                    log('✓ All nameservers return the new records', 'success');
+                } else {
+                    log('Propagation not confirmed: ' + (check.error || 'unknown'), 'warning');
+                }
+                setTimeout(onDone, 3000);
+            });
+            source.onerror = () => {
+                source.close();
+                log('Lost the propagation stream', 'warning');
+                setTimeout(onDone, 3000);
+            };
+        }
+        
+        // Countdown for time-limited activations
+        function formatRemaining(ms) {
+            const total = Math.floor(ms / 1000);
+            const days = Math.floor(total / 86400);
+            const hours = Math.floor((total % 86400) / 3600);
+            const minutes = Math.floor((total % 3600) / 60);
+            const seconds = total % 60;
+            if (days > 0) {
+                return days + 'd ' + hours + 'h ' + minutes + 'm';
+            }
+            if (hours > 0) {
+                return hours + 'h ' + minutes + 'm';
+            }
+            return minutes + 'm ' + String(seconds).padStart(2, '0') + 's';
+        }
+        
+        function updateCountdowns() {
+            document.querySelectorAll('.expiry-badge').forEach(badge => {
+                const remaining = new Date(badge.dataset.expires) - new Date();
+                if (remaining <= 0 && badge.dataset.blocked) {
+                    badge.textContent = '⏱ expired, deactivation blocked';
+                    return;
+                }
+                badge.textContent = remaining > 0
+                    ? '⏱ expires in ' + formatRemaining(remaining)
+                    : '⏱ expired, deactivating...';
+            });
+            document.querySelectorAll('.drain-badge').forEach(badge => {
+                const remaining = new Date(badge.dataset.next) - new Date();
+                const step = badge.dataset.phase === 'ttl' ? 'record removed in ' : 'inactive in ';
+                badge.textContent = remaining > 0
+                    ? '⏬ draining, ' + step + formatRemaining(remaining)
+                    : '⏬ draining...';
+            });
+        }
+        updateCountdowns();
+        setInterval(updateCountdowns, 1000);
+        
+        // Auto-refresh every 30 seconds
+        setInterval(() => {
+            document.getElementById('lastUpdate').textContent = new Date().toLocaleString();
+        }, 30000);
+        
+        // Function to update tags
+        function updateTag(selectElement, tagType) {
+            const uniqueId = selectElement.dataset.uniqueId;
+            const ip = selectElement.dataset.ip;
+            const name = selectElement.dataset.name;
+            const value = selectElement.value;
+            
+            // Send update to server
+            fetch('/api/update-tag', {
+                method: 'POST',
+                headers: apiHeaders(),
+                body: JSON.stringify({
+                    unique_id: uniqueId,
+                    ip: ip,
+                    name: name,
+                    tag_type: tagType,
+                    value: value
+                })
+            })
+            .then(response => response.json())
+            .then(data => {
+                if (data.pending) {
+                    // The tag changes once another operator approved it
+                    alert(data.message);
+                    location.reload();
+                } else if (!data.success) {
+                    alert('Failed to update tag: ' + data.message);
+                    // Revert the selection on failure
+                    selectElement.value = selectElement.dataset.previousValue || '';
+                }
+            })
+            .catch(error => {
+                alert('Error updating tag: ' + error.message);
+                selectElement.value = selectElement.dataset.previousValue || '';
+            });
+            
+            // Store current value for potential revert
+            selectElement.dataset.previousValue = value;
+        }
+        
+        // Function to update notes
+        function updateNotes(textarea) {
+            const name = textarea.dataset.name;
+            const notes = textarea.value;
+            
+            // Send update to server
+            fetch('/api/update-notes', {
+                method: 'POST',
+                headers: apiHeaders(),
+                body: JSON.stringify({
+                    name: name,
+                    notes: notes
+                })
+            })
+            .then(response => response.json())
+            .then(data => {
+                if (!data.success) {
+                    alert('Failed to update notes: ' + data.message);
+                    // Revert the text on failure
+                    textarea.value = textarea.dataset.previousValue || '';
+                }
+            })
+            .catch(error => {
+                alert('Error updating notes: ' + error.message);
+                textarea.value = textarea.dataset.previousValue || '';
+            });
+            
+            // Store current value for potential revert
+            textarea.dataset.previousValue = notes;
+        }
+        
+        // Function to add a new tag
+        function addTag(tagType) {
+            const newTag = prompt('Enter new ' + tagType + ':');
+            if (!newTag || newTag.trim() === '') {
+                return;
+            }
+            
+            // Send request to add new tag
+            fetch('/api/add-tag', {
+                method: 'POST',
+                headers: apiHeaders(),
+                body: JSON.stringify({
+                    tag_type: tagType,
+                    tag_name: newTag.trim()
+                })
+            })
+            .then(response => response.json())
+            .then(data => {
+                if (data.success) {
+                    if (data.pending) {
+                        alert(data.message);
+                    }
+                    // Reload the page to show the new tag in all dropdowns
+                    location.reload();
+                } else {
+                    alert('Failed to add tag: ' + data.message);
+                }
+            })
+            .catch(error => {
+                alert('Error adding tag: ' + error.message);
+            });
+        }
+        
+        // Maintenance mode
+        async function startMaintenance(uniqueId, alias) {
+            if (!requireOperator()) {
+                return;
+            }
+            const reason = prompt('Put ' + alias + ' into maintenance? Its DNS record is removed and it cannot be activated until maintenance ends.\n\nReason:');
+            if (!reason || reason.trim() === '') {
+                return;
+            }
+            const duration = prompt('Expected duration (e.g. 2h, leave empty if unknown):', '');
+            if (duration === null) {
+                return;
+            }
+            try {
+                const data = await postWithOverrides('/api/maintenance/start', {
+                    unique_id: uniqueId,
+                    reason: reason.trim(),
+                    expected_duration: duration.trim()
+                });
+                if (!data.success) {
+                    alert('Error: ' + data.message);
+                }
+                window.location.reload();
+            } catch (error) {
+                alert('Error: ' + error.message);
+            }
+        }
+        
+        async function endMaintenance(uniqueId) {
+            if (!confirm('End maintenance? The server goes to standby and can be activated again.')) {
+                return;
+            }
+            try {
+                const response = await fetch('/api/maintenance/end', {
+                    method: 'POST',
+                    headers: apiHeaders(),
+                    body: JSON.stringify({ unique_id: uniqueId })
+                });
+                const result = await response.json();
+                if (result.success) {
+                    window.location.reload();
+                } else {
+                    alert('Error: ' + result.message);
+                }
+            } catch (error) {
+                alert('Error: ' + error.message);
+            }
+        }
+        
+        async function changeState(uniqueId, select) {
+            const state = select.value;
+            if (!state) {
+                return;
+            }
+            const reason = prompt('Reason for moving to ' + state + ' (optional):');
+            if (reason === null) {
+                select.value = '';
+                return;
+            }
+            try {
+                const response = await fetch('/api/state', {
+                    method: 'POST',
+                    headers: apiHeaders(),
+                    body: JSON.stringify({ unique_id: uniqueId, state, reason: reason.trim() })
+                });
+                const result = await response.json();
+                if (result.success) {
+                    window.location.reload();
+                } else {
+                    alert('Error: ' + result.message);
+                    select.value = '';
+                }
+            } catch (error) {
+                alert('Error: ' + error.message);
+                select.value = '';
+            }
+        }
+        
+        function toggleCanaryFields(enabled) {
+            document.querySelectorAll('.canary-field').forEach(field => {
+                field.style.display = enabled ? '' : 'none';
+            });
+        }
+        
+        async function abortCanary(uniqueId) {
+            if (!confirm('Abort this canary and remove its canary record?')) {
+                return;
+            }
+            try {
+                const response = await fetch('/api/canary/abort', {
+                    method: 'POST',
+                    headers: apiHeaders(),
+                    body: JSON.stringify({ unique_id: uniqueId })
+                });
+                const result = await response.json();
+                if (result.success) {
+                    window.location.reload();
+                } else {
+                    alert('Error: ' + result.message);
+                }
+            } catch (error) {
+                alert('Error: ' + error.message);
+            }
+        }
+        
+        // Function to add DNS entry
+        async function addDNSEntry(event) {
+            event.preventDefault();
+            
+            const form = event.target;
+            const formData = new FormData(form);
+            const asCanary = formData.get('canary') === 'on';
+            
+            const dnsEntry = {
+                break_glass_reason: form.dataset.breakGlassReason || '',
+                name: formData.get('name'),
+                ip: formData.get('ip'),
+                alias: formData.get('alias') || formData.get('name'),
+                ttl: parseInt(formData.get('ttl')) || 60,
+                proxied: formData.get('proxied') === 'on',
+                expires_in: formData.get('expires_in') || ''
+            };
+            if (asCanary) {
+                dnsEntry.probe_port = parseInt(formData.get('probe_port')) || 0;
+                dnsEntry.period = formData.get('period');
+                dnsEntry.hashrate_url = (formData.get('hashrate_url') || '').trim();
+                dnsEntry.min_hashrate = parseFloat(formData.get('min_hashrate')) || 0;
+            }
+            
+            // Show loading state
+            const submitBtn = form.querySelector('.btn-add-dns');
+            const originalText = submitBtn.textContent;
+            submitBtn.disabled = true;
+            submitBtn.textContent = 'Adding...';
+            
+            // Show status
+            const statusDiv = document.getElementById('status');
+            
+            try {
+                const response = await fetch(asCanary ? '/api/canary' : '/api/dns/create', {
+                    method: 'POST',
+                    headers: apiHeaders(),
+                    body: JSON.stringify(dnsEntry)
+                });
+                
+                const result = await response.json();
+                
+                if (response.ok) {
+                    statusDiv.textContent = 'DNS entry added successfully! Refreshing...';
+                    statusDiv.style.color = 'green';
+                    statusDiv.style.display = 'block';
+                    form.reset();
+                    // Reload page to show new entry
+                    setTimeout(() => {
+                        window.location.reload();
+                    }, 1500);
+                } else if (result.frozen && !dnsEntry.break_glass_reason) {
+                    const reason = askBreakGlass(result.error);
+                    if (reason) {
+                        form.dataset.breakGlassReason = reason;
+                        form.requestSubmit();
+                        delete form.dataset.breakGlassReason;
+                    }
+                } else {
+                    statusDiv.textContent = 'Error: ' + (result.error || 'Failed to add DNS entry');
+                    statusDiv.style.color = 'red';
+                    statusDiv.style.display = 'block';
+                }
+            } catch (error) {
+                statusDiv.textContent = 'Error: ' + error.message;
+                statusDiv.style.color = 'red';
+                statusDiv.style.display = 'block';
+            } finally {
+                submitBtn.disabled = false;
+                submitBtn.textContent = originalText;
+            }
+        }
+    </script>
+</body>
+</html>`
+
+// CloudflareClient handles all API interactions
+type CloudflareClient struct {
+	credentials *Credentials
+	httpClient  *http.Client
+}
+
+// cloudflareHTTPClient is shared by all clients so connections are reused
+var cloudflareHTTPClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
+
+func NewCloudflareClient(creds *Credentials) *CloudflareClient {
+	return &CloudflareClient{
+		credentials: creds,
+		httpClient:  cloudflareHTTPClient,
+	}
+}
+
+func (c *CloudflareClient) makeRequest(ctx context.Context, method, endpoint string, body io.Reader) (*http.Request, error) {
+	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s%s", c.credentials.ZoneID, endpoint)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	
+	req.Header.Set("Authorization", "Bearer "+c.credentials.Token)
+	req.Header.Set("Content-Type", "application/json")
+	
+	return req, nil
+}
+
+// rateLimiter is a token bucket shared by all Cloudflare calls
+type rateLimiter struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+var apiLimiter = &rateLimiter{}
+
+// Wait blocks until the next call is allowed by -api-rate
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		rate := *apiRate
+		if rate <= 0 {
+			l.mu.Unlock()
+			return nil
+		}
+		burst := rate
+		if burst < 1 {
+			burst = 1
+		}
+		
+		now := time.Now()
+		if l.last.IsZero() {
+			l.tokens = burst
+		} else {
+			l.tokens += now.Sub(l.last).Seconds() * rate
+			if l.tokens > burst {
+				l.tokens = burst
+			}
+		}
+		l.last = now
+		
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - l.tokens) / rate * float64(time.Second))
+		l.mu.Unlock()
+		
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// sleepContext waits for the given duration unless the context ends first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as a date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// maxRetryDelay bounds the wait before a retry, including Retry-After
+const maxRetryDelay = 30 * time.Second
+
+// retryDelay returns the wait before the given retry: Retry-After if the API
+// sent one, otherwise exponential backoff with jitter
+func retryDelay(attempt int, lastErr error) time.Duration {
+	var apiErr *APIError
+	if errors.As(lastErr, &apiErr) && apiErr.RetryAfter > 0 {
+		if apiErr.RetryAfter > maxRetryDelay {
+			return maxRetryDelay
+		}
+		return apiErr.RetryAfter
+	}
+	backoff := time.Duration(1<<uint(attempt-1)) * time.Second
+	if backoff > maxRetryDelay {
+		backoff = maxRetryDelay
+	}
+	return backoff/2 + time.Duration(mathrand.Int63n(int64(backoff/2)+1))
+}
+
+// do sends one API call. Every attempt gets a fresh request, waits for the
+// rate limiter and is retried on throttling, server errors (idempotent
+// methods only) and network errors (idempotent methods only). The response
+// envelope is decoded into out; failures are returned as *APIError.
+func (c *CloudflareClient) do(ctx context.Context, method, endpoint string, payload interface{}, out interface{}) error {
+	var body []byte
+	if payload != nil {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return err
+		}
+	}
+	idempotent := method != "POST"
+	
+	var lastErr error
+	for attempt := 0; attempt <= *apiRetries; attempt++ {
+		if attempt > 0 {
+			delay := retryDelay(attempt, lastErr)
+			logger.Log("INFO", fmt.Sprintf("Retrying %s %s after %v (attempt %d/%d): %v", method, endpoint, delay.Round(time.Millisecond), attempt+1, *apiRetries+1, lastErr))
+			if err := sleepContext(ctx, delay); err != nil {
+				return err
+			}
+		}
+		
+		if err := apiLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		
+		err := c.attempt(ctx, method, endpoint, body, out)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && method == "DELETE" && attempt > 0 && apiErr.Status == http.StatusNotFound {
+			// An earlier attempt deleted the record but its response was lost
+			logger.Log("INFO", fmt.Sprintf("%s %s: record already gone after an earlier attempt (%v)", method, endpoint, lastErr))
+			return nil
+		}
+		lastErr = err
+		
+		if errors.As(err, &apiErr) {
+			if !apiErr.Temporary(idempotent) {
+				return err
+			}
+		} else if !idempotent {
+			// Network error: a create may have reached Cloudflare
+			return err
+		}
+	}
+	
+	return lastErr
+}
+
+// attempt sends a single request, bounded by -api-timeout
+func (c *CloudflareClient) attempt(ctx context.Context, method, endpoint string, body []byte, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, *apiTimeout)
+	defer cancel()
+	
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := c.makeRequest(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	
+	return decodeResponse(resp, out)
+}
+
+// decodeResponse checks status and success flag of a response and decodes it into out
+func decodeResponse(resp *http.Response, out interface{}) error {
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	
+	var envelope struct {
+		Success bool              `json:"success"`
+		Errors  []CloudflareError `json:"errors"`
+	}
+	decodeErr := json.Unmarshal(data, &envelope)
+	
+	if resp.StatusCode >= 300 || (decodeErr == nil && !envelope.Success) {
+		return &APIError{
+			Status:     resp.StatusCode,
+			Errors:     envelope.Errors,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("invalid Cloudflare response: %v", decodeErr)
+	}
+	
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+// IncompleteListingError is returned when Cloudflare reported more records
+// than were listed. Changes planned from such a listing would treat the
+// records that were never fetched as missing.
+type IncompleteListingError struct {
+	Count RecordCount
+}
+
+func (e *IncompleteListingError) Error() string {
+	return fmt.Sprintf("Cloudflare reported %d DNS records but %d were fetched; refusing to work from an incomplete listing", e.Count.Reported, e.Count.Fetched)
+}
+
+// GetDNSRecords fetches the live records and refreshes the record cache. An
+// incomplete listing is cached for display but returned as an error.
+func (c *CloudflareClient) GetDNSRecords(ctx context.Context) ([]CloudflareRecord, error) {
+	records, total, err := c.listDNSRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !total.Complete() {
+		return nil, &IncompleteListingError{Count: total}
+	}
+	return records, nil
+}
+
+// listDNSRecords fetches the live records and refreshes the record cache
+func (c *CloudflareClient) listDNSRecords(ctx context.Context) ([]CloudflareRecord, RecordCount, error) {
+	recordCache.mu.Lock()
+	generation := recordCache.generation
+	recordCache.mu.Unlock()
+	
+	records, total, err := c.fetchDNSRecords(ctx)
+	if err != nil {
+		recordCache.mu.Lock()
+		recordCache.lastError = err
+		// A request cancelled by its caller says nothing about Cloudflare
+		changed := !recordCache.unreachable && ctx.Err() == nil
+		if changed {
+			recordCache.unreachable = true
+		}
+		recordCache.mu.Unlock()
+		if changed {
+			publishEvent(UIEvent{
+				Type:    "health",
+				Message: fmt.Sprintf("Cloudflare is unreachable: %v", err),
+				Data:    map[string]bool{"healthy": false},
+			})
+		}
+		return nil, total, err
+	}
+	
+	recordCache.mu.Lock()
+	recovered := recordCache.unreachable
+	recordCache.unreachable = false
+	recordCache.lastError = nil
+	// A write invalidated the cache while we were listing, so the records
+	// may predate it
+	if recordCache.generation == generation {
+		recordCache.records = append([]CloudflareRecord(nil), records...)
+		recordCache.fetchedAt = time.Now()
+		recordCache.total = total
+		recordCache.valid = true
+	}
+	recordCache.mu.Unlock()
+	if recovered {
+		publishEvent(UIEvent{
+			Type:    "health",
+			Message: "Cloudflare is reachable again",
+			Data:    map[string]bool{"healthy": true},
+		})
+	}
+	return records, total, nil
+}
+
+// fetchDNSRecords lists all pages of A records ending with the domain. The
+// returned count compares Cloudflare's total_count with the records that
+// were actually received.
+func (c *CloudflareClient) fetchDNSRecords(ctx context.Context) ([]CloudflareRecord, RecordCount, error) {
+	var count RecordCount
+	var records []CloudflareRecord
+	seen := make(map[string]bool)
+	
+	logger.Log("INFO", fmt.Sprintf("Fetching DNS records ending with %s", c.credentials.Domain))
+	
+	for page := 1; ; page++ {
+		// Get all A records that end with the domain (including subdomains like us.xmr)
+		var cfResp CloudflareResponse
+		endpoint := fmt.Sprintf("/dns_records?type=A&name~end=%s&page=%d&per_page=%d", c.credentials.Domain, page, *pageSize)
+		if err := c.do(ctx, "GET", endpoint, nil, &cfResp); err != nil {
+			logger.Log("ERROR", fmt.Sprintf("Failed to fetch DNS records (page %d): %v", page, err))
+			return nil, count, err
+		}
+		
+		for _, record := range cfResp.Result {
+			// Records can shift between pages while we are listing
+			if seen[record.ID] {
+				continue
+			}
+			seen[record.ID] = true
+			records = append(records, record)
+		}
+		
+		info := cfResp.ResultInfo
+		if info == nil {
+			// No pagination info: the response is all there is
+			count.Reported = len(records)
+			break
+		}
+		count.Reported = info.TotalCount
+		if len(cfResp.Result) == 0 || page >= info.TotalPages {
+			break
+		}
+	}
+	count.Fetched = len(records)
+	
+	if !count.Complete() {
+		logger.Log("WARNING", fmt.Sprintf("Cloudflare reported %d DNS records but %d were fetched; some servers may be shown as inactive and changes are refused", count.Reported, count.Fetched))
+	}
+	
+	// Filter to only include records ending with our domain
+	var filteredRecords []CloudflareRecord
+	for _, record := range records {
+		if strings.HasSuffix(record.Name, c.credentials.Domain) {
+			filteredRecords = append(filteredRecords, record)
+		}
+	}
+	
+	logger.Log("INFO", fmt.Sprintf("Found %d DNS records for domain %s", len(filteredRecords), c.credentials.Domain))
+	return filteredRecords, count, nil
+}
+
+// recordPayload builds the body of a new A record, including its metadata
+func (c *CloudflareClient) recordPayload(ip, dnsName string, meta RecordMetadata, proxied bool, ttl int) map[string]interface{} {
+	if ttl <= 0 {
+		ttl = 60 // Default to 1 minute
+	}
+	
+	// Construct full DNS name
+	fullName := dnsName
+	if !strings.Contains(dnsName, ".") {
+		fullName = dnsName + "." + c.credentials.Domain
+	} else if !strings.HasSuffix(dnsName, c.credentials.Domain) {
+		fullName = dnsName + "." + c.credentials.Domain
+	}
+	
+	payload := map[string]interface{}{
+		"type":    "A",
+		"name":    fullName,
+		"content": ip,
+		"ttl":     ttl,
+		"proxied": proxied,
+	}
+	meta.UniqueID = generateServerID(fullName, ip)
+	for key, value := range metadataFields(meta, nil) {
+		payload[key] = value
+	}
+	return payload
+}
+
+// CreateDNSRecord creates an A record and polls it until the API returns it.
+// It returns the record ID and the verification status.
+func (c *CloudflareClient) CreateDNSRecord(ctx context.Context, ip, dnsName string, meta RecordMetadata, proxied bool, ttl int) (string, string, error) {
+	payload := c.recordPayload(ip, dnsName, meta, proxied, ttl)
+	alias := meta.Alias
+	
+	logger.Log("INFO", fmt.Sprintf("Creating DNS record for %s (%s)", alias, ip))
+	
+	var cfResp CloudflareCreateResponse
+	err := c.do(ctx, "POST", "/dns_records", payload, &cfResp)
+	invalidateRecords()
+	if err != nil {
+		logger.Log("ERROR", fmt.Sprintf("Failed to create DNS record: %v", err))
+		return "", "", err
+	}
+	
+	// Verify creation
+	recordID := cfResp.Result.ID
+	logger.Log("INFO", fmt.Sprintf("Created record with ID: %s, verifying...", recordID))
+	
+	status := c.VerifyCreated(ctx, recordID, ip)
+	switch status {
+	case VerificationVerified:
+		logger.Log("SUCCESS", fmt.Sprintf("DNS record for %s (%s) created and verified", alias, ip))
+	case VerificationPending:
+		logger.Log("WARNING", fmt.Sprintf("DNS record for %s (%s) created but not yet visible after %s", alias, ip, *verifyTimeout))
+	default:
+		logger.Log("WARNING", fmt.Sprintf("DNS record for %s (%s) created but verification failed", alias, ip))
+	}
+	return recordID, status, nil
+}
+
+// DeleteDNSRecord deletes a record and polls until the API no longer returns
+// it. It returns the verification status.
+func (c *CloudflareClient) DeleteDNSRecord(ctx context.Context, recordID string) (string, error) {
+	logger.Log("INFO", fmt.Sprintf("Deleting DNS record %s", recordID))
+	
+	err := c.do(ctx, "DELETE", fmt.Sprintf("/dns_records/%s", recordID), nil, nil)
+	invalidateRecords()
+	if err != nil {
+		logger.Log("ERROR", fmt.Sprintf("Failed to delete DNS record: %v", err))
+		return "", err
+	}
+	
+	// Verify deletion
+	status := c.VerifyDeleted(ctx, recordID)
+	switch status {
+	case VerificationVerified:
+		logger.Log("SUCCESS", fmt.Sprintf("DNS record %s deleted and verified", recordID))
+	case VerificationPending:
+		logger.Log("WARNING", fmt.Sprintf("DNS record %s deleted but still returned after %s", recordID, *verifyTimeout))
+	default:
+		logger.Log("WARNING", fmt.Sprintf("DNS record %s deleted but verification failed", recordID))
+	}
+	return status, nil
+}
+
+// UpdateDNSRecord changes the given fields (ttl, proxied, comment, ...) of an existing record
+func (c *CloudflareClient) UpdateDNSRecord(ctx context.Context, recordID string, changes map[string]interface{}) error {
+	logger.Log("INFO", fmt.Sprintf("Updating DNS record %s", recordID))
+	
+	err := c.do(ctx, "PATCH", fmt.Sprintf("/dns_records/%s", recordID), changes, nil)
+	invalidateRecords()
+	if err != nil {
+		logger.Log("ERROR", fmt.Sprintf("Failed to update DNS record: %v", err))
+		return err
+	}
+	
+	return nil
+}
+
+// RestoreDNSRecord recreates a deleted record with its TTL, proxy status,
+// comment and tags. The restored record gets a new ID, which is returned.
+func (c *CloudflareClient) RestoreDNSRecord(ctx context.Context, record CloudflareRecord) (string, error) {
+	payload := map[string]interface{}{
+		"type":    "A",
+		"name":    record.Name,
+		"content": record.Content,
+		"ttl":     record.TTL,
+		"proxied": record.Proxied,
+		"comment": record.Comment,
+	}
+	if len(record.Tags) > 0 {
+		payload["tags"] = record.Tags
+	}
+	
+	logger.Log("INFO", fmt.Sprintf("Restoring DNS record %s (%s)", record.Name, record.Content))
+	
+	var cfResp CloudflareCreateResponse
+	err := c.do(ctx, "POST", "/dns_records", payload, &cfResp)
+	invalidateRecords()
+	if err != nil {
+		logger.Log("ERROR", fmt.Sprintf("Failed to restore DNS record: %v", err))
+		return "", err
+	}
+	return cfResp.Result.ID, nil
+}
+
+// DNSBatch is one atomic set of record changes for the dns_records/batch
+// endpoint. Cloudflare runs deletes first, then patches, then posts, and
+// applies either all of them or none.
+type DNSBatch struct {
+	Deletes []DNSBatchDelete         `json:"deletes,omitempty"`
+	Patches []map[string]interface{} `json:"patches,omitempty"` // Each with the "id" of the record to change
+	Posts   []map[string]interface{} `json:"posts,omitempty"`
+}
+
+type DNSBatchDelete struct {
+	ID string `json:"id"`
+}
+
+// DNSBatchResult holds the records affected by a batch, in request order
+type DNSBatchResult struct {
+	Deletes []CloudflareRecord `json:"deletes"`
+	Patches []CloudflareRecord `json:"patches"`
+	Posts   []CloudflareRecord `json:"posts"`
+}
+
+// Size returns the number of operations in the batch
+func (b DNSBatch) Size() int {
+	return len(b.Deletes) + len(b.Patches) + len(b.Posts)
+}
+
+// errBatchUnsupported is returned when the API has no batch endpoint
+var errBatchUnsupported = errors.New("batch DNS changes are not supported by the API")
+
+// batchUnsupported remembers that the batch endpoint is missing so later
+// applies go straight to sequential mode
+var batchUnsupported struct {
+	mu    sync.Mutex
+	value bool
+}
+
+// batchAvailable reports whether applies should use the batch endpoint
+func batchAvailable() bool {
+	batchUnsupported.mu.Lock()
+	defer batchUnsupported.mu.Unlock()
+	return *batchUpdates && !batchUnsupported.value
+}
+
+// BatchDNSRecords submits all changes of a batch in one request
+func (c *CloudflareClient) BatchDNSRecords(ctx context.Context, batch DNSBatch) (*DNSBatchResult, error) {
+	logger.Log("INFO", fmt.Sprintf("Submitting DNS batch (%d deletes, %d patches, %d posts)", len(batch.Deletes), len(batch.Patches), len(batch.Posts)))
+	
+	var cfResp struct {
+		Result DNSBatchResult `json:"result"`
+	}
+	err := c.do(ctx, "POST", "/dns_records/batch", batch, &cfResp)
+	invalidateRecords()
+	
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && (apiErr.Status == http.StatusNotFound || apiErr.Status == http.StatusMethodNotAllowed) {
+		batchUnsupported.mu.Lock()
+		batchUnsupported.value = true
+		batchUnsupported.mu.Unlock()
+		return nil, errBatchUnsupported
+	}
+	if err != nil {
+		logger.Log("ERROR", fmt.Sprintf("Failed to submit DNS batch: %v", err))
+		return nil, err
+	}
+	
+	logger.Log("SUCCESS", fmt.Sprintf("DNS batch applied (%d changes)", batch.Size()))
+	return &cfResp.Result, nil
+}
+
+// GetDNSRecord fetches a single record; it returns nil if the record does not exist
+func (c *CloudflareClient) GetDNSRecord(ctx context.Context, recordID string) (*CloudflareRecord, error) {
+	var cfResp CloudflareCreateResponse
+	err := c.do(ctx, "GET", fmt.Sprintf("/dns_records/%s", recordID), nil, &cfResp)
+	
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cfResp.Result, nil
+}
+
+// Verification statuses of a record change
+const (
+	VerificationVerified = "verified" // The API shows the change
+	VerificationPending  = "pending"  // The API did not show the change before -verify-timeout
+	VerificationFailed   = "failed"   // The API shows a different record, or could not be read
+)
+
+// pollRecord fetches a single record with backoff until check reports a
+// final status or -verify-timeout passes. check sees nil for a missing record
+// and returns "" to keep polling.
+func (c *CloudflareClient) pollRecord(ctx context.Context, recordID string, check func(record *CloudflareRecord) string) string {
+	ctx, cancel := context.WithTimeout(ctx, *verifyTimeout)
+	defer cancel()
+	
+	delay := 250 * time.Millisecond
+	var lastErr error
+	for {
+		record, err := c.GetDNSRecord(ctx, recordID)
+		if err == nil {
+			if status := check(record); status != "" {
+				return status
+			}
+		}
+		// An error caused by the deadline itself only means time ran out
+		if ctx.Err() == nil {
+			lastErr = err
+		}
+		
+		if sleepContext(ctx, delay) != nil {
+			break
+		}
+		if delay *= 2; delay > 2*time.Second {
+			delay = 2 * time.Second
+		}
+	}
+	
+	if lastErr != nil {
+		logger.Log("WARNING", fmt.Sprintf("Could not verify DNS record %s: %v", recordID, lastErr))
+		return VerificationFailed
+	}
+	return VerificationPending
+}
+
+// VerifyCreated polls a new record until it is returned with the expected IP
+func (c *CloudflareClient) VerifyCreated(ctx context.Context, recordID, expectedIP string) string {
+	return c.pollRecord(ctx, recordID, func(record *CloudflareRecord) string {
+		switch {
+		case record == nil:
+			return ""
+		case record.Content == expectedIP:
+			return VerificationVerified
+		default:
+			return VerificationFailed
+		}
+	})
+}
+
+// VerifyDeleted polls a deleted record until it is no longer returned
+func (c *CloudflareClient) VerifyDeleted(ctx context.Context, recordID string) string {
+	return c.pollRecord(ctx, recordID, func(record *CloudflareRecord) string {
+		if record == nil {
+			return VerificationVerified
+		}
+		return ""
+	})
+}
+
+// DNS record cache
+
+// errorString returns the message of err, or "" if err is nil
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// recordCache keeps the last known records so page loads do not have to wait
+// for Cloudflare, and can still render while it is unreachable
+var recordCache struct {
+	mu         sync.Mutex
+	records    []CloudflareRecord
+	fetchedAt  time.Time
+	valid      bool  // Cleared after our own writes
+	generation uint64 // Bumped by every invalidation; fetches started before it are not cached
+	lastError  error // Error of the last fetch, if it failed
+	total      RecordCount
+	refreshing bool
+	unreachable bool // Last reachability announced to the UI
+}
+
+// RecordCount compares the number of records Cloudflare reported with the
+// number that was actually fetched across all pages
+type RecordCount struct {
+	Reported int `json:"reported"`
+	Fetched  int `json:"fetched"`
+}
+
+// Complete reports whether every record Cloudflare knows about was fetched
+func (rc RecordCount) Complete() bool {
+	return rc.Reported == rc.Fetched
+}
+
+// CachedRecords is a snapshot of the record cache
+type CachedRecords struct {
+	Records   []CloudflareRecord
+	FetchedAt time.Time
+	Stale     bool  // Older than -record-cache-ttl or served after a failed fetch
+	Error     error // Why Cloudflare could not be reached
+	Total     RecordCount
+}
+
+// invalidateRecords makes the next cached read fetch from Cloudflare
+func invalidateRecords() {
+	recordCache.mu.Lock()
+	recordCache.valid = false
+	recordCache.generation++
+	recordCache.mu.Unlock()
+}
+
+// recordSnapshot copies the cache; callers must hold recordCache.mu
+func recordSnapshot(stale bool) *CachedRecords {
+	return &CachedRecords{
+		Records:   append([]CloudflareRecord(nil), recordCache.records...),
+		FetchedAt: recordCache.fetchedAt,
+		Stale:     stale,
+		Error:     recordCache.lastError,
+		Total:     recordCache.total,
+	}
+}
+
+// GetCachedDNSRecords returns the records from the cache. Fresh entries are
+// served directly, stale ones are served while a refresh runs in the
+// background, and after our own writes the records are fetched again. When
+// Cloudflare is unreachable the last known state is returned.
+func (c *CloudflareClient) GetCachedDNSRecords(ctx context.Context) (*CachedRecords, error) {
+	recordCache.mu.Lock()
+	known := !recordCache.fetchedAt.IsZero()
+	if known && recordCache.valid {
+		if time.Since(recordCache.fetchedAt) < *recordCacheTTL {
+			snapshot := recordSnapshot(false)
+			recordCache.mu.Unlock()
+			return snapshot, nil
+		}
+		if !recordCache.refreshing {
+			recordCache.refreshing = true
+			go func() {
+				// The refresh outlives the request that triggered it
+				c.listDNSRecords(workCtx)
+				recordCache.mu.Lock()
+				recordCache.refreshing = false
+				recordCache.mu.Unlock()
+			}()
+		}
+		snapshot := recordSnapshot(true)
+		recordCache.mu.Unlock()
+		return snapshot, nil
+	}
+	recordCache.mu.Unlock()
+	
+	records, _, err := c.listDNSRecords(ctx)
+	recordCache.mu.Lock()
+	defer recordCache.mu.Unlock()
+	if err == nil {
+		return &CachedRecords{Records: records, FetchedAt: time.Now(), Total: recordCache.total}, nil
+	}
+	
+	if known {
+		logger.Log("WARNING", fmt.Sprintf("Cloudflare unreachable, using records from %s: %v", recordCache.fetchedAt.Format("15:04:05"), err))
+		return recordSnapshot(true), nil
+	}
+	return nil, err
+}
+
+// Credential management
+func getCredentials(env string) (*Credentials, error) {
+	creds := &Credentials{}
+	
+	// 1. Try command-line config file
+	if *configFile != "" {
+		logger.Log("INFO", fmt.Sprintf("Loading credentials from custom file: %s", *configFile))
+		if err := godotenv.Load(*configFile); err == nil {
+			creds.Token = os.Getenv("CF_API_TOKEN")
+			creds.ZoneID = os.Getenv("CF_ZONE_ID")
+			creds.Domain = os.Getenv("DNS_NAME")
+			if creds.Token != "" && creds.ZoneID != "" && creds.Domain != "" {
+				return creds, nil
+			}
+		}
+	}
+	
+	// 2. Try environment variables
+	if token := os.Getenv("CF_API_TOKEN"); token != "" {
+		logger.Log("INFO", "Loading credentials from environment variables")
+		creds.Token = token
+		creds.ZoneID = os.Getenv("CF_ZONE_ID")
+		creds.Domain = os.Getenv("DNS_NAME")
+		if creds.Token != "" && creds.ZoneID != "" && creds.Domain != "" {
+			return creds, nil
+		}
+	}
+	
+	// 3. Try .env file
+	envFile := fmt.Sprintf(".env.%s", env)
+	if _, err := os.Stat(envFile); err == nil {
+		logger.Log("INFO", fmt.Sprintf("Loading credentials from %s", envFile))
+		if err := godotenv.Load(envFile); err == nil {
+			creds.Token = os.Getenv("CF_API_TOKEN")
+			creds.ZoneID = os.Getenv("CF_ZONE_ID")
+			creds.Domain = os.Getenv("DNS_NAME")
+			if creds.Token != "" && creds.ZoneID != "" && creds.Domain != "" {
+				return creds, nil
+			}
+		}
+	}
+	
+	// 4. Interactive setup
+	logger.Log("INFO", "No credentials found, starting interactive setup")
+	return interactiveSetup(env)
+}
+
+func interactiveSetup(env string) (*Credentials, error) {
+	reader := bufio.NewReader(os.Stdin)
+	creds := &Credentials{}
+	
+	fmt.Printf("\n=== Cloudflare Credentials Setup for %s ===\n", strings.ToUpper(env))
+	fmt.Println("You can find these values in your Cloudflare dashboard")
+	fmt.Println("API Token: https://dash.cloudflare.com/profile/api-tokens")
+	fmt.Println("Zone ID: Domain Overview page -> API section")
+	fmt.Println()
+	
+	fmt.Print("Enter Cloudflare API Token: ")
+	token, _ := reader.ReadString('\n')
+	creds.Token = strings.TrimSpace(token)
+	
+	fmt.Print("Enter Zone ID: ")
+	zoneID, _ := reader.ReadString('\n')
+	creds.ZoneID = strings.TrimSpace(zoneID)
+	
+	fmt.Print("Enter DNS Name (e.g., xmr.qubic.li): ")
+	domain, _ := reader.ReadString('\n')
+	creds.Domain = strings.TrimSpace(domain)
+	
+	// Save to .env file
+	envFile := fmt.Sprintf(".env.%s", env)
+	fmt.Printf("\nSave these credentials to %s? (y/n): ", envFile)
+	save, _ := reader.ReadString('\n')
+	
+	if strings.ToLower(strings.TrimSpace(save)) == "y" {
+		content := fmt.Sprintf("CF_API_TOKEN=%s\nCF_ZONE_ID=%s\nDNS_NAME=%s\n", 
+			creds.Token, creds.ZoneID, creds.Domain)
+		
+		if err := os.WriteFile(envFile, []byte(content), 0600); err != nil {
+			logger.Log("ERROR", fmt.Sprintf("Failed to save credentials: %v", err))
+		} else {
+			logger.Log("INFO", fmt.Sprintf("Credentials saved to %s", envFile))
+		}
+	}
+	
+	return creds, nil
+}
+
+// Server configuration management
+func loadServerConfig(env string) (*ServerConfig, error) {
+	configFile := fmt.Sprintf("servers.%s.json", env)
+	
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			logger.Log("INFO", fmt.Sprintf("No server configuration found at %s", configFile))
+			return nil, nil
+		}
+		return nil, err
+	}
+	
+	var config ServerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	
+	// Initialize default available tags if not present
+	if len(config.AvailableAccounts) == 0 {
+		config.AvailableAccounts = []string{"Pool1", "Pool2", "Pool3", "Zgirt", "Jetski"}
+	}
+	if len(config.AvailableContainers) == 0 {
+		config.AvailableContainers = []string{"Group1", "Group2", "Test"}
+	}
+	
+	// Migrate: Add unique IDs to servers that don't have them
+	modified := false
+	for i := range config.Servers {
+		if config.Servers[i].UniqueID == "" {
+			config.Servers[i].UniqueID = generateServerID(config.Servers[i].Name, config.Servers[i].Content)
+			modified = true
+			logger.Log("INFO", fmt.Sprintf("Generated UniqueID for server %s (%s): %s", 
+				config.Servers[i].Name, config.Servers[i].Content, config.Servers[i].UniqueID))
+		}
+	}
+	
+	// Save if we modified the config
+	if modified {
+		if err := saveServerConfig(workCtx, env, &config); err != nil {
+			logger.Log("WARNING", fmt.Sprintf("Failed to save migrated config: %v", err))
+		} else {
+			logger.Log("INFO", "Saved config with generated unique IDs")
+		}
+	}
+	
+	logger.Log("INFO", fmt.Sprintf("Loaded %d servers from %s", len(config.Servers), configFile))
+	return &config, nil
+}
+
+// Backup management functions
+func getBackupDir(configFile string) string {
+	if *backupDir != "" {
+		return *backupDir
+	}
+	return filepath.Dir(configFile)
+}
+
+func getBackupFiles(env string) ([]string, error) {
+	configFile := fmt.Sprintf("servers.%s.json", env)
+	dir := getBackupDir(configFile)
+	pattern := fmt.Sprintf("%s.backup-*", filepath.Base(configFile))
+	
+	files, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return nil, err
+	}
+	
+	// Sort by modification time (newest first)
+	sort.Slice(files, func(i, j int) bool {
+		fi, _ := os.Stat(files[i])
+		fj, _ := os.Stat(files[j])
+		return fi.ModTime().After(fj.ModTime())
+	})
+	
+	return files, nil
+}
+
+func cleanOldBackups(env string) error {
+	if *keepBackups <= 0 {
+		return nil // Unlimited backups
+	}
+	
+	backups, err := getBackupFiles(env)
+	if err != nil {
+		return err
+	}
+	
+	if len(backups) <= *keepBackups {
+		return nil
+	}
+	
+	// Remove old backups
+	for i := *keepBackups; i < len(backups); i++ {
+		if err := os.Remove(backups[i]); err != nil {
+			logger.Log("ERROR", fmt.Sprintf("Failed to remove old backup %s: %v", backups[i], err))
+		} else {
+			logger.Log("INFO", fmt.Sprintf("Removed old backup: %s", filepath.Base(backups[i])))
+		}
+	}
+	
+	return nil
+}
+
+func createBackup(env string) (string, error) {
+	configFile := fmt.Sprintf("servers.%s.json", env)
+	
+	// Check if config exists
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("no configuration file to backup: %s", configFile)
+		}
+		return "", err
+	}
+	
+	// Create backup filename
+	dir := getBackupDir(configFile)
+	backupFile := filepath.Join(dir, fmt.Sprintf("%s.backup-%s", filepath.Base(configFile), time.Now().Format("20060102-150405")))
+	
+	// Ensure backup directory exists
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	
+	// Write backup
+	if err := os.WriteFile(backupFile, data, 0644); err != nil {
+		return "", err
+	}
+	
+	logger.Log("INFO", fmt.Sprintf("Backup created: %s", backupFile))
+	
+	// Clean old backups
+	cleanOldBackups(env)
+	
+	return backupFile, nil
+}
+
+func restoreBackup(backupFile string, env string) error {
+	// Read backup file
+	data, err := os.ReadFile(backupFile)
+	if err != nil {
+		return fmt.Errorf("failed to read backup file: %v", err)
+	}
+	
+	// Validate it's valid JSON
+	var config ServerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("invalid backup file format: %v", err)
+	}
+	
+	// Create a backup of current config before restoring
+	configFile := fmt.Sprintf("servers.%s.json", env)
+	if _, err := os.Stat(configFile); err == nil {
+		if _, err := createBackup(env); err != nil {
+			logger.Log("WARNING", fmt.Sprintf("Failed to backup current config: %v", err))
+		}
+	}
+	
+	// Restore the backup
+	if err := os.WriteFile(configFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to restore backup: %v", err)
+	}
+	
+	logger.Log("INFO", fmt.Sprintf("Configuration restored from %s", backupFile))
+	return nil
+}
+
+func listBackupFiles(env string) error {
+	backups, err := getBackupFiles(env)
+	if err != nil {
+		return err
+	}
+	
+	if len(backups) == 0 {
+		fmt.Printf("No backups found for %s environment\n", env)
+		return nil
+	}
+	
+	fmt.Printf("\nAvailable backups for %s environment:\n", env)
+	fmt.Println(strings.Repeat("-", 80))
+	
+	for i, backup := range backups {
+		info, err := os.Stat(backup)
+		if err != nil {
+			continue
+		}
+		
+		// Extract timestamp from filename
+		base := filepath.Base(backup)
+		
+		fmt.Printf("%2d. %s\n", i+1, base)
+		fmt.Printf("    Size: %d bytes | Modified: %s\n", 
+			info.Size(), 
+			info.ModTime().Format("2006-01-02 15:04:05"))
+		
+		if i < *keepBackups {
+			fmt.Printf("    Status: KEPT (within retention limit)\n")
+		} else {
+			fmt.Printf("    Status: TO BE REMOVED (exceeds retention limit)\n")
+		}
+		fmt.Println()
+	}
+	
+	fmt.Printf("Retention policy: Keep %d most recent backups\n", *keepBackups)
+	fmt.Printf("Backup directory: %s\n", getBackupDir(fmt.Sprintf("servers.%s.json", env)))
+	
+	return nil
+}
+
+// updateServerConfig loads, modifies and saves the server configuration while
+// holding configMutex, so concurrent writers do not lose each other's changes.
+// Saves that record changes already made in Cloudflare pass a
+// context.WithoutCancel context so they are not lost when a request ends.
+func updateServerConfig(ctx context.Context, modify func(config *ServerConfig) error) error {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	
+	config, err := loadServerConfig(*environment)
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		config = &ServerConfig{
+			Environment: *environment,
+			Domain:      credentials.Domain,
+			Servers:     []Server{},
+		}
+	}
+	
+	if err := modify(config); err != nil {
+		return err
+	}
+	return saveServerConfig(ctx, *environment, config)
+}
+
+func saveServerConfig(ctx context.Context, env string, config *ServerConfig) error {
+	configFile := fmt.Sprintf("servers.%s.json", env)
+	
+	// Create backup if file exists
+	if _, err := os.Stat(configFile); err == nil {
+		if _, err := createBackup(env); err != nil {
+			logger.Log("WARNING", fmt.Sprintf("Failed to create backup: %v", err))
+		}
+	}
+	
+	config.LastSync = time.Now()
+	
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("configuration not saved: %v", err)
+	}
+	
+	// Write to a temporary file first so an interrupted save never leaves a truncated config
+	tmpFile := configFile + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFile, configFile); err != nil {
+		return err
+	}
+	
+	logger.Log("INFO", fmt.Sprintf("Server configuration saved to %s", configFile))
+	return nil
+}
+
+func importFromCloudflare(env string, records []CloudflareRecord) (*ServerConfig, error) {
+	config := &ServerConfig{
+		Environment: env,
+		Domain:      credentials.Domain,
+		Servers:     []Server{},
+	}
+	
+	for _, record := range records {
+		server := importedServer(record)
+		addTagOptions(config, server.Account, server.Container)
+		config.Servers = append(config.Servers, server)
+	}
+	
+	return config, nil
+}
+
+// importedServer builds the configuration entry of a live record
+func importedServer(record CloudflareRecord) Server {
+	// Use the metadata stored with the record, or generate an alias
+	meta, _ := recordMetadata(record)
+	alias := meta.Alias
+	if alias == "" {
+		alias = fmt.Sprintf("server-%s", strings.ReplaceAll(record.Content, ".", "-"))
+	}
+	uniqueID := meta.UniqueID
+	if uniqueID == "" {
+		uniqueID = generateServerID(record.Name, record.Content)
+	}
+	
+	now := time.Now().Format(time.RFC3339)
+	return Server{
+		// Unique identifier
+		UniqueID:        uniqueID,
+		
+		// Custom fields
+		Alias:           alias,
+		Account:         meta.Account,
+		Container:       meta.Container,
+		Description:     fmt.Sprintf("Imported from Cloudflare on %s", time.Now().Format("2006-01-02")),
+		FirstSeenOn:     now,
+		LastActivatedOn: now, // It's active when we import it
+		State:           "active",
+		StateChangedOn:  now,
+		
+		// Cloudflare configuration
+		Type:    record.Type,
+		Name:    record.Name,
+		Content: record.Content,
+		TTL:     record.TTL,
+		Proxied: record.Proxied,
+		Comment: record.Comment,
+		Tags:    record.Tags,
+		
+		// Transient fields (set but not saved)
+		ID:         record.ID,
+		CreatedOn:  record.CreatedOn,
+		ModifiedOn: record.ModifiedOn,
+		Proxiable:  record.Proxiable,
+	}
+}
+
+// Record metadata
+
+// RecordMetadata is the inventory data stored with each DNS record, so the
+// configuration can be rebuilt from Cloudflare if servers.<env>.json is lost
+type RecordMetadata struct {
+	UniqueID  string
+	Alias     string
+	Account   string
+	Container string
+}
+
+const (
+	metadataMarker    = "[xsm:" // Starts the structured part of a record comment
+	metadataTagPrefix = "xsm-"  // Prefix of metadata record tags, e.g. xsm-account:Pool1
+	maxCommentLength  = 100     // Cloudflare's comment limit on free plans
+)
+
+// serverMetadata returns the metadata of a configured server
+func serverMetadata(server Server) RecordMetadata {
+	return RecordMetadata{UniqueID: server.UniqueID, Alias: server.Alias, Account: server.Account, Container: server.Container}
+}
+
+// activeServerMetadata returns the metadata of a record about to be created
+func activeServerMetadata(info ActiveServer) RecordMetadata {
+	return RecordMetadata{
+		UniqueID:  generateServerID(fullDNSName(info.Name), info.IP),
+		Alias:     info.Alias,
+		Account:   info.Account,
+		Container: info.Container,
+	}
+}
+
+// encodeRecordComment writes the alias followed by the other fields, e.g.
+// "pool-eu-1 [xsm:id=0123456789abcdef;account=Pool1;container=Group1]".
+// The alias is shortened when the comment would exceed the length limit.
+func encodeRecordComment(meta RecordMetadata) string {
+	var fields []string
+	for _, field := range [][2]string{{"id", meta.UniqueID}, {"account", meta.Account}, {"container", meta.Container}} {
+		if field[1] != "" {
+			fields = append(fields, field[0]+"="+url.QueryEscape(field[1]))
+		}
+	}
+	if len(fields) == 0 {
+		return meta.Alias
+	}
+	structured := metadataMarker + strings.Join(fields, ";") + "]"
+	
+	alias := meta.Alias
+	if room := maxCommentLength - len(structured) - 1; len(alias) > room {
+		if room < 4 {
+			return structured
+		}
+		alias = strings.ToValidUTF8(alias[:room-3], "") + "…"
+	}
+	if alias == "" {
+		return structured
+	}
+	return alias + " " + structured
+}
+
+// parseRecordComment reads a comment written by encodeRecordComment. Other
+// comments are taken as a plain alias and reported as not structured.
+func parseRecordComment(comment string) (RecordMetadata, bool) {
+	start := strings.LastIndex(comment, metadataMarker)
+	if start < 0 || !strings.HasSuffix(comment, "]") {
+		return RecordMetadata{Alias: comment}, false
+	}
+	
+	meta := RecordMetadata{Alias: strings.TrimSpace(comment[:start])}
+	for _, field := range strings.Split(comment[start+len(metadataMarker):len(comment)-1], ";") {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		value, err := url.QueryUnescape(value)
+		if err != nil {
+			continue
+		}
+		switch key {
+		case "id":
+			meta.UniqueID = value
+		case "account":
+			meta.Account = value
+		case "container":
+			meta.Container = value
+		}
+	}
+	return meta, true
+}
+
+// recordMetadata returns the metadata stored with a live record. Tags are
+// never shortened, so they take precedence over the comment.
+func recordMetadata(record CloudflareRecord) (RecordMetadata, bool) {
+	meta, structured := parseRecordComment(record.Comment)
+	for _, tag := range record.Tags {
+		name, value, ok := strings.Cut(tag, ":")
+		if !ok || !strings.HasPrefix(name, metadataTagPrefix) {
+			continue
+		}
+		structured = true
+		switch strings.TrimPrefix(name, metadataTagPrefix) {
+		case "id":
+			meta.UniqueID = value
+		case "alias":
+			meta.Alias = value
+		case "account":
+			meta.Account = value
+		case "container":
+			meta.Container = value
+		}
+	}
+	return meta, structured
+}
+
+// Alias returns the alias stored in the record's comment or tags
+func (r CloudflareRecord) Alias() string {
+	meta, _ := recordMetadata(r)
+	return meta.Alias
+}
+
+// metadataRecordTags replaces the metadata tags of a record and keeps all others
+func metadataRecordTags(meta RecordMetadata, existing []string) []string {
+	tags := []string{}
+	for _, tag := range existing {
+		if !strings.HasPrefix(tag, metadataTagPrefix) {
+			tags = append(tags, tag)
+		}
+	}
+	for _, field := range [][2]string{{"id", meta.UniqueID}, {"alias", meta.Alias}, {"account", meta.Account}, {"container", meta.Container}} {
+		if field[1] != "" {
+			tags = append(tags, metadataTagPrefix+field[0]+":"+field[1])
+		}
+	}
+	return tags
+}
+
+// recordComment returns the comment a record with this metadata carries
+func recordComment(meta RecordMetadata) string {
+	if !*syncMetadata {
+		return meta.Alias
+	}
+	return encodeRecordComment(meta)
+}
+
+// metadataFields returns the comment (and tags) a record should carry
+func metadataFields(meta RecordMetadata, existingTags []string) map[string]interface{} {
+	fields := map[string]interface{}{"comment": recordComment(meta)}
+	if *syncMetadata && *metadataTags {
+		fields["tags"] = metadataRecordTags(meta, existingTags)
+	}
+	return fields
+}
+
+// metadataConflicts lists the fields a record and the configuration disagree
+// on. Fields missing on either side are gaps, not conflicts.
+func metadataConflicts(local, remote RecordMetadata) []string {
+	var conflicts []string
+	// A shortened alias matches the alias it was made from
+	remoteAlias, shortened := strings.CutSuffix(remote.Alias, "…")
+	if local.Alias != "" && remote.Alias != "" && local.Alias != remote.Alias && !(shortened && strings.HasPrefix(local.Alias, remoteAlias)) {
+		conflicts = append(conflicts, fmt.Sprintf("alias %q -> %q", local.Alias, remote.Alias))
+	}
+	if local.Account != "" && remote.Account != "" && local.Account != remote.Account {
+		conflicts = append(conflicts, fmt.Sprintf("account %q -> %q", local.Account, remote.Account))
+	}
+	if local.Container != "" && remote.Container != "" && local.Container != remote.Container {
+		conflicts = append(conflicts, fmt.Sprintf("container %q -> %q", local.Container, remote.Container))
+	}
+	return conflicts
+}
+
+// restoreMetadata fills the fields of a server that are empty in the
+// configuration from its record and returns what was filled in
+func restoreMetadata(config *ServerConfig, server *Server, meta RecordMetadata) []string {
+	var restored []string
+	if server.Alias == "" && meta.Alias != "" && !strings.HasSuffix(meta.Alias, "…") {
+		server.Alias = meta.Alias
+		restored = append(restored, "alias "+meta.Alias)
+	}
+	if server.Account == "" && meta.Account != "" {
+		server.Account = meta.Account
+		restored = append(restored, "account "+meta.Account)
+	}
+	if server.Container == "" && meta.Container != "" {
+		server.Container = meta.Container
+		restored = append(restored, "container "+meta.Container)
+	}
+	addTagOptions(config, server.Account, server.Container)
+	return restored
+}
+
+// addTagOptions makes restored accounts and containers selectable in the UI
+func addTagOptions(config *ServerConfig, account, container string) {
+	if account != "" && !containsString(config.AvailableAccounts, account) {
+		config.AvailableAccounts = append(config.AvailableAccounts, account)
+		sort.Strings(config.AvailableAccounts)
+	}
+	if container != "" && !containsString(config.AvailableContainers, container) {
+		config.AvailableContainers = append(config.AvailableContainers, container)
+		sort.Strings(config.AvailableContainers)
+	}
+}
+
+// pushRecordMetadata writes a server's metadata to its live record
+func pushRecordMetadata(ctx context.Context, cfClient *CloudflareClient, record CloudflareRecord, meta RecordMetadata, operator string) error {
+	return journaledPatch(ctx, cfClient, record, metadataFields(meta, record.Tags), ApplyOptions{Operator: operator, Source: "metadata"})
+}
+
+// recordNeedsMetadata reports whether a record lacks metadata the
+// configuration has, without disagreeing with it
+func recordNeedsMetadata(record CloudflareRecord, meta RecordMetadata) bool {
+	remote, structured := recordMetadata(record)
+	if structured && len(metadataConflicts(meta, remote)) > 0 {
+		return false
+	}
+	wanted := metadataFields(meta, record.Tags)
+	if wanted["comment"] != record.Comment {
+		return true
+	}
+	if tags, ok := wanted["tags"].([]string); ok {
+		have := append([]string(nil), record.Tags...)
+		sort.Strings(have)
+		sort.Strings(tags)
+		return strings.Join(have, ",") != strings.Join(tags, ",")
+	}
+	return false
+}
+
+// syncRecordMetadata closes the gaps before a drift check: empty
+// configuration fields are restored from the records and, with
+// writeRecords, records without (complete) metadata get the configured
+// values. Fields both sides set differently are drift and left to the drift
+// policy. It returns the records with the comments and tags it wrote.
+func syncRecordMetadata(ctx context.Context, cfClient *CloudflareClient, records []CloudflareRecord, writeRecords bool) []CloudflareRecord {
+	config, err := loadServerConfig(*environment)
+	if err != nil || config == nil {
+		return records
+	}
+	
+	synced := append([]CloudflareRecord(nil), records...)
+	restore := false
+	for _, server := range config.Servers {
+		for i := range synced {
+			record := synced[i]
+			if record.Name != server.Name || record.Content != server.Content {
+				continue
+			}
+			if meta, structured := recordMetadata(record); structured && len(restoreMetadata(config, &server, meta)) > 0 {
+				restore = true
+			}
+			
+			meta := serverMetadata(server)
+			if !writeRecords || !recordNeedsMetadata(record, meta) {
+				continue
+			}
+			if err := pushRecordMetadata(ctx, cfClient, record, meta, "system"); err != nil {
+				logger.Log("WARNING", fmt.Sprintf("Failed to write metadata to %s -> %s: %v", record.Name, record.Content, err))
+				continue
+			}
+			fields := metadataFields(meta, record.Tags)
+			synced[i].Comment = fields["comment"].(string)
+			if tags, ok := fields["tags"].([]string); ok {
+				synced[i].Tags = tags
+			}
+			logger.Log("INFO", fmt.Sprintf("Wrote metadata of %s to %s -> %s", server.Alias, record.Name, record.Content))
+		}
+	}
+	
+	// Only save when something was restored, every save makes a backup
+	if restore {
+		err := updateServerConfig(ctx, func(config *ServerConfig) error {
+			for i := range config.Servers {
+				record := findLiveRecord(records, config.Servers[i])
+				if record == nil {
+					continue
+				}
+				if meta, structured := recordMetadata(*record); structured {
+					if restored := restoreMetadata(config, &config.Servers[i], meta); len(restored) > 0 {
+						logger.Log("INFO", fmt.Sprintf("Restored %s of %s (%s) from its record", strings.Join(restored, ", "), config.Servers[i].Alias, config.Servers[i].Content))
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			logger.Log("WARNING", fmt.Sprintf("Failed to restore metadata from records: %v", err))
+		}
+	}
+	return synced
+}
+
+// writeServerMetadata updates the comment (and tags) of a server's live
+// record after its metadata changed in the configuration. Servers without a
+// record get their metadata when they are activated.
+func writeServerMetadata(ctx context.Context, cfClient *CloudflareClient, server Server, operator string) error {
+	if !*syncMetadata {
+		return nil
+	}
+	cached, err := cfClient.GetCachedDNSRecords(ctx)
+	if err != nil {
+		return err
+	}
+	record := findLiveRecord(cached.Records, server)
+	if record == nil || !recordNeedsMetadata(*record, serverMetadata(server)) {
+		return nil
+	}
+	return pushRecordMetadata(ctx, cfClient, *record, serverMetadata(server), operator)
+}
+
+// containsString reports whether list contains value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// importHandler adds live records that are missing from the configuration,
+// as a job that reports each record
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	operator := operatorFromRequest(r)
+	runAsJob(w, r, "import", func(ctx context.Context, progress func(UpdateDetail)) (bool, string, interface{}) {
+		invalidateRecords()
+		records, err := NewCloudflareClient(credentials).GetDNSRecords(ctx)
+		if err != nil {
+			message := fmt.Sprintf("Failed to fetch DNS records: %v", err)
+			return false, message, map[string]interface{}{"success": false, "message": message}
+		}
+		
+		imported, restored := 0, 0
+		err = updateServerConfig(context.WithoutCancel(ctx), func(config *ServerConfig) error {
+			known := make(map[recordKey]int)
+			for i, server := range config.Servers {
+				known[recordKey{name: server.Name, ip: server.Content}] = i
+			}
+			for _, record := range records {
+				if i, ok := known[recordKey{name: record.Name, ip: record.Content}]; ok {
+					// Fill in what the configuration lost from the record's metadata
+					if meta, structured := recordMetadata(record); structured {
+						if fields := restoreMetadata(config, &config.Servers[i], meta); len(fields) > 0 {
+							restored++
+							progress(UpdateDetail{Message: fmt.Sprintf("✓ Restored %s of %s -> %s", strings.Join(fields, ", "), record.Name, record.Content), Status: "success"})
+							continue
+						}
+					}
+					progress(UpdateDetail{Message: fmt.Sprintf("%s -> %s is already configured", record.Name, record.Content), Status: "skipped"})
+					continue
+				}
+				server := importedServer(record)
+				addTagOptions(config, server.Account, server.Container)
+				config.Servers = append(config.Servers, server)
+				imported++
+				progress(UpdateDetail{Message: fmt.Sprintf("✓ Imported %s -> %s as %s", record.Name, record.Content, server.Alias), Status: "success"})
+			}
+			return nil
+		})
+		if err != nil {
+			message := fmt.Sprintf("Failed to save configuration: %v", err)
+			return false, message, map[string]interface{}{"success": false, "message": message}
+		}
+		
+		message := fmt.Sprintf("Imported %d of %d records from Cloudflare", imported, len(records))
+		if restored > 0 {
+			message += fmt.Sprintf(", restored metadata of %d", restored)
+		}
+		logger.Log("INFO", message)
+		logger.Audit(AuditEntry{Action: "import", Operator: operator, Source: "ui", Success: true, Details: []string{message}})
+		return true, message, map[string]interface{}{"success": true, "message": message, "imported": imported, "restored": restored}
+	})
+}
+
+// backupsHandler lists the configuration backups, newest first
+func backupsHandler(w http.ResponseWriter, r *http.Request) {
+	files, err := getBackupFiles(*environment)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"backups": backupViews(files),
+	})
+}
+
+// BackupView describes one configuration backup
+type BackupView struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+func backupViews(files []string) []BackupView {
+	views := []BackupView{}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		views = append(views, BackupView{Name: filepath.Base(file), Size: info.Size(), Modified: info.ModTime()})
+	}
+	return views
+}
+
+// restoreHandler restores the configuration from a backup as a job
+func restoreHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		writeAPIError(w, http.StatusBadRequest, "Backup name is required")
+		return
+	}
+	
+	// Only files from the backup directory can be restored
+	files, err := getBackupFiles(*environment)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	backupFile := ""
+	for _, file := range files {
+		if filepath.Base(file) == req.Name {
+			backupFile = file
+		}
+	}
+	if backupFile == "" {
+		writeAPIError(w, http.StatusNotFound, fmt.Sprintf("Backup %s not found", req.Name))
+		return
+	}
+	
+	operator := operatorFromRequest(r)
+	runAsJob(w, r, "restore", func(ctx context.Context, progress func(UpdateDetail)) (bool, string, interface{}) {
+		configMutex.Lock()
+		err := restoreBackup(backupFile, *environment)
+		configMutex.Unlock()
+		if err != nil {
+			message := err.Error()
+			logger.Audit(AuditEntry{Action: "restore", Operator: operator, Source: "ui", Success: false, Details: []string{req.Name, message}})
+			return false, message, map[string]interface{}{"success": false, "message": message}
+		}
+		progress(UpdateDetail{Message: fmt.Sprintf("✓ Restored configuration from %s", req.Name), Status: "success"})
+		
+		config, err := loadServerConfig(*environment)
+		if err == nil && config != nil {
+			for _, server := range config.Servers {
+				progress(UpdateDetail{Message: fmt.Sprintf("%s (%s -> %s)", server.Alias, server.Name, server.Content), Status: "info"})
+			}
+		}
+		
+		message := fmt.Sprintf("Configuration restored from %s", req.Name)
+		logger.Audit(AuditEntry{Action: "restore", Operator: operator, Source: "ui", Success: true, Details: []string{req.Name}})
+		return true, message, map[string]interface{}{"success": true, "message": message}
+	})
+}
+
+// Web handlers
+func indexHandler(w http.ResponseWriter, r *http.Request) {
+	cfClient := NewCloudflareClient(credentials)
+	
+	// Load server configuration
+	config, err := loadServerConfig(*environment)
+	if err != nil {
+		http.Error(w, "Failed to load configuration", http.StatusInternalServerError)
+		return
+	}
+	
+	// Get current DNS records, falling back to the last known state
+	cached, err := cfClient.GetCachedDNSRecords(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to fetch DNS records", http.StatusInternalServerError)
+		return
+	}
+	records := cached.Records
+	
+	// If no config exists, offer to import
+	if config == nil {
+		if len(records) > 0 {
+			// Auto-import from Cloudflare
+			imported, err := importFromCloudflare(*environment, records)
+			if err != nil {
+				http.Error(w, "Failed to import configuration", http.StatusInternalServerError)
+				return
+			}
+			
+			config = imported
+			if err := updateServerConfig(r.Context(), func(current *ServerConfig) error {
+				// Another request may have imported the records meanwhile
+				if len(current.Servers) == 0 {
+					*current = *imported
+				}
+				config = current
+				return nil
+			}); err != nil {
+				logger.Log("ERROR", fmt.Sprintf("Failed to save imported config: %v", err))
+			}
+		} else {
+			// Create empty config
+			config = &ServerConfig{
+				Environment: *environment,
+				Domain:      credentials.Domain,
+				Servers:     []Server{},
+				AvailableAccounts: []string{"Pool1", "Pool2", "Pool3", "Zgirt", "Jetski"},
+				AvailableContainers: []string{"Group1", "Group2", "Test"},
+			}
+		}
+	}
+	
+	// Build active IP map
+	activeIPs := make(map[string]CloudflareRecord)
+	for _, record := range records {
+		activeIPs[record.Content] = record
+	}
+	
+	// Prepare template data
+	type DNSEntry struct {
+		UniqueID    string // Unique identifier for this entry
+		Name        string // The DNS name (e.g., "xmr", "us.xmr")
+		IP          string // The IP address for this entry
+		Alias       string // The descriptive alias from config
+		Account     string // Account tag
+		Container   string // Container tag
+		Proxied     bool
+		TTL         int
+		IsActive    bool
+		RecordID    string
+		FirstSeenOn string // Creation date for sorting
+		ExpiresAt   string // Activation ends automatically at this time
+		ExpiryBlocked string // Why the expired activation could not be ended yet
+		Drain       *DrainState // Set while the entry is being drained
+		Canary      *CanaryState // Set when the entry was added as a canary
+		CanaryID    string       // UniqueID of the server the canary belongs to
+		State       string       // Lifecycle state
+		StateReason string       // Why the state last changed
+		NextStates  []string     // States an operator can move the entry to
+		CanMaintain bool         // Entry can be put into maintenance
+		Maintenance *MaintenanceInfo // Set while the entry is in maintenance
+	}
+	
+	type ServerGroup struct {
+		Name             string // DNS name (primary grouping key)
+		Alias            string // Display alias for the group
+		IPs              string // Concatenated IPs separated by semicolon
+		Notes            string // Editable notes for this server
+		Entries          []DNSEntry
+		HasActiveEntries bool
+		InMaintenance    bool // At least one entry is in maintenance
+	}
+	
+	// First, create a map of all known servers from config indexed by UniqueID
+	configByID := make(map[string]Server)
+	for _, server := range config.Servers {
+		if server.UniqueID != "" {
+			configByID[server.UniqueID] = server
+		}
+	}
+	
+	// Also create a fallback map indexed by IP+Name for servers without UniqueID
+	type serverKey struct {
+		ip   string
+		name string
+	}
+	configByKey := make(map[serverKey]Server)
+	canaryByKey := make(map[serverKey]Server)
+	for _, server := range config.Servers {
+		if server.Canary != nil {
+			canaryByKey[serverKey{ip: server.Content, name: server.Canary.CanaryName}] = server
+		}
+		// Extract DNS name for the key
+		dnsName := strings.TrimSuffix(server.Name, "."+credentials.Domain)
+		key := serverKey{ip: server.Content, name: dnsName}
+		configByKey[key] = server
+	}
+	
+	// Group all DNS records by NAME
+	serverGroupsMap := make(map[string]*ServerGroup)
+	activeCount := 0
+	
+	// Process all active DNS records from Cloudflare
+	for _, record := range records {
+		ip := record.Content
+		
+		// Use the full domain name as the grouping key
+		dnsName := record.Name
+		
+		// Get or create server group for this NAME
+		if _, exists := serverGroupsMap[dnsName]; !exists {
+			serverGroupsMap[dnsName] = &ServerGroup{
+				Name:    dnsName,
+				Alias:   "",
+				IPs:     "",
+				Notes:   "",
+				Entries: []DNSEntry{},
+			}
+		}
+		
+		// Generate unique ID for this entry
+		uniqueID := generateServerID(record.Name, ip)
+		
+		// Get alias, account, and container from config if available,
+		// otherwise from the metadata stored with the record
+		meta, _ := recordMetadata(record)
+		alias := meta.Alias
+		account := meta.Account
+		container := meta.Container
+		
+		// First try to find by UniqueID
+		if configServer, exists := configByID[uniqueID]; exists {
+			if configServer.Alias != "" {
+				alias = configServer.Alias
+			}
+			if configServer.Account != "" || configServer.Container != "" {
+				account = configServer.Account
+				container = configServer.Container
+			}
+		} else {
+			// Fallback to key-based lookup
+			key := serverKey{ip: ip, name: dnsName}
+			if configServer, exists := configByKey[key]; exists {
+				if configServer.Alias != "" {
+					alias = configServer.Alias
+				}
+				if configServer.Account != "" || configServer.Container != "" {
+					account = configServer.Account
+					container = configServer.Container
+				}
+			}
+		}
+		
+		if alias == "" {
+			alias = dnsName
+		}
+		
+		// Get FirstSeenOn from config if available
+		firstSeenOn := ""
+		expiresAt, expiryBlocked := "", ""
+		var drain *DrainState
+		if configServer, exists := configByID[uniqueID]; exists {
+			firstSeenOn = configServer.FirstSeenOn
+			expiresAt = configServer.ExpiresAt
+			expiryBlocked = configServer.ExpiryBlocked
+			drain = configServer.Drain
+		}
+		
+		entry := DNSEntry{
+			UniqueID:    uniqueID,
+			Name:        dnsName,
+			IP:          ip,
+			Alias:       alias,
+			Account:     account,
+			Container:   container,
+			Proxied:     record.Proxied,
+			TTL:         record.TTL,
+			IsActive:    true,
+			RecordID:    record.ID,
+			FirstSeenOn: firstSeenOn,
+			ExpiresAt:   expiresAt,
+			ExpiryBlocked: expiryBlocked,
+			Drain:       drain,
+		}
+		entry.State = "active"
+		if canaryServer, exists := canaryByKey[serverKey{ip: ip, name: dnsName}]; exists {
+			// Canary record of a server that is still being tried out
+			entry.Alias = canaryServer.Alias
+			entry.Account = canaryServer.Account
+			entry.Container = canaryServer.Container
+			entry.Canary = withLatestProbe(canaryServer.UniqueID, canaryServer.Canary)
+			entry.CanaryID = canaryServer.UniqueID
+			entry.State = effectiveState(canaryServer, records)
+		} else if configServer, exists := configByID[uniqueID]; exists {
+			if configServer.Canary != nil {
+				entry.Canary = withLatestProbe(configServer.UniqueID, configServer.Canary)
+				entry.CanaryID = configServer.UniqueID
+			}
+			entry.State = effectiveState(configServer, records)
+			entry.StateReason = configServer.StateReason
+			entry.Maintenance = configServer.Maintenance
+			entry.CanMaintain = canTransition(entry.State, "maintenance")
+		}
+		
+		serverGroupsMap[dnsName].Entries = append(serverGroupsMap[dnsName].Entries, entry)
+		serverGroupsMap[dnsName].HasActiveEntries = true
+		if entry.State == "maintenance" {
+			serverGroupsMap[dnsName].InMaintenance = true
+		}
+		activeCount++
+		
+		// Set or update the group's alias
+		if serverGroupsMap[dnsName].Alias == "" {
+			serverGroupsMap[dnsName].Alias = alias
+		}
+		
+		// Add IP to the group's IP list
+		if serverGroupsMap[dnsName].IPs == "" {
+			serverGroupsMap[dnsName].IPs = ip
+		} else if !strings.Contains(serverGroupsMap[dnsName].IPs, ip) {
+			serverGroupsMap[dnsName].IPs += ", " + ip
+		}
+		
+		// Get notes from config if available (use the first non-empty notes found)
+		if serverGroupsMap[dnsName].Notes == "" {
+			if cfgServer, exists := configByID[uniqueID]; exists && cfgServer.Notes != "" {
+				serverGroupsMap[dnsName].Notes = cfgServer.Notes
+			} else {
+				key := serverKey{ip: ip, name: dnsName}
+				if cfgServer, exists := configByKey[key]; exists && cfgServer.Notes != "" {
+					serverGroupsMap[dnsName].Notes = cfgServer.Notes
+				}
+			}
+		}
+	}
+	
+	// Add inactive servers from config
+	for _, server := range config.Servers {
+		if _, isActive := activeIPs[server.Content]; !isActive {
+			ip := server.Content
+			
+			// Use full domain name for consistency
+			dnsName := server.Name
+			
+			// Get or create server group by NAME
+			if _, exists := serverGroupsMap[dnsName]; !exists {
+				serverGroupsMap[dnsName] = &ServerGroup{
+					Name:    dnsName,
+					Alias:   server.Alias,
+					IPs:     ip,
+					Notes:   server.Notes,
+					Entries: []DNSEntry{},
+				}
+			} else {
+				// Add IP if not already present
+				if !strings.Contains(serverGroupsMap[dnsName].IPs, ip) {
+					if serverGroupsMap[dnsName].IPs == "" {
+						serverGroupsMap[dnsName].IPs = ip
+					} else {
+						serverGroupsMap[dnsName].IPs += ", " + ip
+					}
+				}
+				// Add notes if not already present
+				if serverGroupsMap[dnsName].Notes == "" && server.Notes != "" {
+					serverGroupsMap[dnsName].Notes = server.Notes
+				}
+			}
+			
+			// Generate unique ID if not present
+			uniqueID := server.UniqueID
+			if uniqueID == "" {
+				uniqueID = generateServerID(server.Name, server.Content)
+			}
+			
+			entry := DNSEntry{
+				UniqueID:    uniqueID,
+				Name:        dnsName,
+				IP:          ip,
+				Alias:       server.Alias,
+				Account:     server.Account,
+				Container:   server.Container,
+				Proxied:     server.Proxied,
+				TTL:         server.TTL,
+				IsActive:    false,
+				RecordID:    "",
+				FirstSeenOn: server.FirstSeenOn,
+				Drain:       server.Drain,
+				Canary:      server.Canary,
+				CanaryID:    uniqueID,
+				State:       effectiveState(server, records),
+				StateReason: server.StateReason,
+			}
+			entry.NextStates = manualStates(entry.State)
+			entry.Maintenance = server.Maintenance
+			entry.CanMaintain = canTransition(entry.State, "maintenance")
+			
+			serverGroupsMap[dnsName].Entries = append(serverGroupsMap[dnsName].Entries, entry)
+			if entry.State == "maintenance" {
+				serverGroupsMap[dnsName].InMaintenance = true
+			}
+		}
+	}
+	
+	// Convert map to sorted slice
+	var serverGroups []ServerGroup
+	for _, group := range serverGroupsMap {
+		serverGroups = append(serverGroups, *group)
+	}
+	
+	// Sort server groups by Name
+	sort.Slice(serverGroups, func(i, j int) bool {
+		return serverGroups[i].Name < serverGroups[j].Name
+	})
+	
+	// Count total unique servers (by IP)
+	totalServers := len(serverGroupsMap)
+	
+	// Count total entries and inactive entries
+	totalEntries := 0
+	for _, group := range serverGroups {
+		totalEntries += len(group.Entries)
+	}
+	inactiveCount := totalEntries - activeCount
+	if inactiveCount < 0 {
+		inactiveCount = 0
+	}
+	
+	// Freeze windows with their current status
+	type FreezeView struct {
+		ID      string
+		Name    string
+		Summary string
+		Active  bool
+	}
+	var freezeViews []FreezeView
+	freezeActive := false
+	for _, fw := range config.FreezeWindows {
+		active := fw.IsActive(time.Now())
+		freezeActive = freezeActive || active
+		freezeViews = append(freezeViews, FreezeView{ID: fw.ID, Name: fw.Name, Summary: fw.Describe(), Active: active})
+	}
+	
+	// Most recent configuration backups
+	backupFiles, _ := getBackupFiles(*environment)
+	if len(backupFiles) > 5 {
+		backupFiles = backupFiles[:5]
+	}
+	backups := backupViews(backupFiles)
+	
+	// Profiles and their difference to the live state
+	var profiles []ProfileSummary
+	for _, profile := range config.Profiles {
+		profiles = append(profiles, summarizeProfile(profile, records))
+	}
+	
+	data := map[string]interface{}{
+		"Environment":        *environment,
+		"Domain":             config.Domain,
+		"ServerGroups":       serverGroups,
+		"TotalServers":       totalServers,
+		"ActiveCount":        activeCount,
+		"InactiveCount":      inactiveCount,
+		"LastUpdate":         time.Now().Format("2006-01-02 15:04:05"),
+		"AvailableAccounts":  config.AvailableAccounts,
+		"AvailableContainers": config.AvailableContainers,
+		"CSRFToken":          csrfToken,
+		"RequireApproval":    approvalRequired(),
+		"PendingChanges":     pendingChanges(),
+		"FreezeWindows":      freezeViews,
+		"FreezeActive":       freezeActive,
+		"Profiles":           profiles,
+		"Drift":              currentDrift(),
+		"UnfinishedApplies":  unfinishedApplies(records),
+		"Backups":            backups,
+		"RecordsFetchedAt":   cached.FetchedAt.Format("2006-01-02 15:04:05"),
+		"RecordsStale":       cached.Stale,
+		"RecordsTotal":       cached.Total,
+		"CloudflareError":    errorString(cached.Error),
+		"LifecycleStates":    lifecycleStates,
+		"Schedules":          visibleSchedules(),
+		"ScheduleServers":    config.Servers,
+	}
+	
+	tmpl := template.Must(template.New("index").Funcs(template.FuncMap{
+		"toUpper": strings.ToUpper,
+	}).Parse(indexHTML))
+	
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Failed to render template", http.StatusInternalServerError)
+	}
+}
+
+// ActiveServer is one entry of the requested active set
+type ActiveServer struct {
+	IP        string `json:"ip"`
+	Name      string `json:"name"`      // DNS name like "xmr" or "us.xmr"
+	Alias     string `json:"alias"`
+	Account   string `json:"account"`   // Account tag
+	Container string `json:"container"` // Container tag
+	Proxied   bool   `json:"proxied"`
+	TTL       int    `json:"ttl"`
+	Active    bool   `json:"active"`
+	ExpiresIn string `json:"expires_in,omitempty"` // Limit the activation, e.g. "6h" ("0" removes a limit)
+}
+
+type UpdateRequest struct {
+	ActiveServers    []ActiveServer `json:"active_servers"`
+	BreakGlassReason string         `json:"break_glass_reason,omitempty"` // Override active freeze windows
+	Force            bool           `json:"force,omitempty"`              // Override the blast-radius guard
+	ForceReason      string         `json:"force_reason,omitempty"`       // Required together with Force
+}
+
+type UpdateDetail struct {
+	Message      string `json:"message"`
+	Status       string `json:"status"`
+	Verification string `json:"verification,omitempty"` // verified, pending or failed
+}
+
+type UpdateResponse struct {
+	Success  bool           `json:"success"`
+	Message  string         `json:"message"`
+	Details  []UpdateDetail `json:"details"`
+	Pending  bool           `json:"pending,omitempty"`   // Change is waiting for approval
+	ChangeID string         `json:"change_id,omitempty"` // ID of the pending change request
+	Frozen   bool           `json:"frozen,omitempty"`    // Rejected because of an active freeze window
+	Guarded  bool           `json:"guarded,omitempty"`   // Rejected by the blast-radius guard
+	
+	Rollback      *RollbackReport `json:"rollback,omitempty"`       // How a failed transactional update was undone
+	PropagationID string          `json:"propagation_id,omitempty"` // Resolver propagation check of this update
+}
+
+// ApplyOptions describes who triggered an apply and why
+type ApplyOptions struct {
+	Operator string `json:"operator,omitempty"`  // Who requested the change
+	Approver string `json:"approver,omitempty"`  // Who approved the change (production only)
+	ChangeID string `json:"change_id,omitempty"` // Change request ID, if the apply comes from an approval
+	Source   string `json:"source,omitempty"`    // ui, api, approval, ...
+	Reason   string `json:"reason,omitempty"`    // Recorded as deactivation reason
+	
+	BreakGlassReason string `json:"break_glass_reason,omitempty"` // Overrides active freeze windows (applyServerChange only)
+	ForceReason      string `json:"force_reason,omitempty"`       // Overrides the blast-radius guard (applyServerChange only)
+	
+	Progress func(UpdateDetail) `json:"-"` // Reports each change as it is made, may be nil
+	ClientID string             `json:"-"` // Browser page that made the change, echoed in UI events
+}
+
+// fullDNSName expands a short name like "us" to "us.<domain>"
+func fullDNSName(name string) string {
+	if name == credentials.Domain || strings.HasSuffix(name, "."+credentials.Domain) {
+		return name
+	}
+	return name + "." + credentials.Domain
+}
+
+// shortDNSName reduces a name to the part in front of the domain
+func shortDNSName(name string) string {
+	return strings.TrimSuffix(fullDNSName(name), "."+credentials.Domain)
+}
+
+// recordKey identifies a DNS record by short name and IP
+type recordKey struct {
+	name string
+	ip   string
+}
+
+// UpdatePlan lists the record operations needed to reach a requested active set
+type UpdatePlan struct {
+	Create []ActiveServer     `json:"create,omitempty"`
+	Delete []CloudflareRecord `json:"delete,omitempty"`
+	Patch  []RecordPatch      `json:"patch,omitempty"` // Field changes of single writes (drain TTL, drift revert, metadata)
+}
+
+// IsEmpty reports whether the plan contains no operations
+func (p UpdatePlan) IsEmpty() bool {
+	return len(p.Create) == 0 && len(p.Delete) == 0 && len(p.Patch) == 0
+}
+
+// RecordPatch changes fields of a live record without touching its name or IP
+type RecordPatch struct {
+	ID      string                 `json:"id"`
+	Name    string                 `json:"name"`
+	IP      string                 `json:"ip"`
+	Changes map[string]interface{} `json:"changes"`
+	Before  map[string]interface{} `json:"before"` // The changed fields as they were, for a rollback
+}
+
+// newRecordPatch describes changing fields of a live record
+func newRecordPatch(record CloudflareRecord, changes map[string]interface{}) RecordPatch {
+	current := recordFields(record)
+	before := make(map[string]interface{})
+	for key := range changes {
+		before[key] = current[key]
+	}
+	return RecordPatch{ID: record.ID, Name: record.Name, IP: record.Content, Changes: changes, Before: before}
+}
+
+// recordFields returns the fields of a record as the API names them
+func recordFields(record CloudflareRecord) map[string]interface{} {
+	if record.Tags == nil {
+		record.Tags = []string{}
+	}
+	fields := map[string]interface{}{"comment": record.Comment, "tags": record.Tags}
+	data, _ := json.Marshal(record)
+	json.Unmarshal(data, &fields)
+	return fields
+}
+
+// hasFields reports whether a record has the given field values
+func hasFields(record CloudflareRecord, fields map[string]interface{}) bool {
+	current := recordFields(record)
+	for key, value := range fields {
+		want, _ := json.Marshal(value)
+		have, _ := json.Marshal(current[key])
+		if !bytes.Equal(want, have) {
+			return false
+		}
+	}
+	return true
+}
+
+// Describe lists the changed fields of a patch
+func (p RecordPatch) Describe() string {
+	var keys []string
+	for key := range p.Changes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var changes []string
+	for _, key := range keys {
+		changes = append(changes, fmt.Sprintf("%s %v -> %v", key, p.Before[key], p.Changes[key]))
+	}
+	return strings.Join(changes, ", ")
+}
+
+// Describe returns one human readable line per planned operation
+func (p UpdatePlan) Describe() []string {
+	var lines []string
+	for _, server := range p.Create {
+		lines = append(lines, fmt.Sprintf("Activate %s (%s -> %s) [TTL: %d]", server.Name, server.Alias, server.IP, server.TTL))
+	}
+	for _, record := range p.Delete {
+		lines = append(lines, fmt.Sprintf("Deactivate %s (%s -> %s)", strings.TrimSuffix(record.Name, "."+credentials.Domain), record.Alias(), record.Content))
+	}
+	return lines
+}
+
+// planUpdate computes which records have to be created and deleted so that
+// exactly the requested servers are active
+func planUpdate(records []CloudflareRecord, req UpdateRequest) UpdatePlan {
+	// Build map of current records by key (name+ip)
+	currentRecords := make(map[recordKey]CloudflareRecord)
+	for _, record := range records {
+		// Extract subdomain
+		dnsName := strings.TrimSuffix(record.Name, "."+credentials.Domain)
+		key := recordKey{name: dnsName, ip: record.Content}
+		currentRecords[key] = record
+	}
+	
+	// Build map of requested records
+	requestedRecords := make(map[recordKey]ActiveServer)
+	for _, server := range req.ActiveServers {
+		key := recordKey{name: shortDNSName(server.Name), ip: server.IP}
+		requestedRecords[key] = server
+	}
+	
+	var plan UpdatePlan
+	for key, server := range requestedRecords {
+		if _, exists := currentRecords[key]; !exists {
+			plan.Create = append(plan.Create, server)
+		}
+	}
+	for key, record := range currentRecords {
+		if _, shouldExist := requestedRecords[key]; !shouldExist {
+			plan.Delete = append(plan.Delete, record)
+		}
+	}
+	
+	// Keep the order stable so plans can be reviewed and compared
+	sort.Slice(plan.Create, func(i, j int) bool {
+		if plan.Create[i].Name != plan.Create[j].Name {
+			return plan.Create[i].Name < plan.Create[j].Name
+		}
+		return plan.Create[i].IP < plan.Create[j].IP
+	})
+	sort.Slice(plan.Delete, func(i, j int) bool {
+		if plan.Delete[i].Name != plan.Delete[j].Name {
+			return plan.Delete[i].Name < plan.Delete[j].Name
+		}
+		return plan.Delete[i].Content < plan.Delete[j].Content
+	})
+	
+	return plan
+}
+
+// recordsFingerprint summarises the live record set so a stored plan can
+// detect that the zone changed in the meantime
+func recordsFingerprint(records []CloudflareRecord) string {
+	var keys []string
+	for _, record := range records {
+		keys = append(keys, fmt.Sprintf("%s|%s", record.Name, record.Content))
+	}
+	sort.Strings(keys)
+	hash := sha256.Sum256([]byte(strings.Join(keys, "\n")))
+	return hex.EncodeToString(hash[:8])
+}
+
+// PlanResult is the outcome of executing an UpdatePlan
+type PlanResult struct {
+	Details     []UpdateDetail
+	Activated   []ActiveServer
+	Created     []CloudflareRecord // Records created for Activated, in the same order
+	Deactivated []CloudflareRecord
+	Patched     []RecordPatch
+	BatchError  error           // Set when an atomic batch was rejected as a whole
+	Unknown     error           // Set when the outcome of a batch could not be read back
+	Failed      bool            // At least one change failed or was skipped
+	Rollback    *RollbackReport // Set when completed changes were undone
+	
+	progress func(UpdateDetail) // Called with each detail as it happens, may be nil
+}
+
+// add records the detail of one change and reports it as progress
+func (r *PlanResult) add(detail UpdateDetail) {
+	r.Details = append(r.Details, detail)
+	if r.progress != nil {
+		r.progress(detail)
+	}
+}
+
+// addRollback records the detail of one undone change and reports it as progress
+func (r *PlanResult) addRollback(report *RollbackReport, detail UpdateDetail) {
+	report.Details = append(report.Details, detail)
+	if r.progress != nil {
+		r.progress(detail)
+	}
+}
+
+// RollbackReport describes how the changes of a failed transactional update were undone
+type RollbackReport struct {
+	Success bool           `json:"success"` // Every completed change was undone
+	Details []UpdateDetail `json:"details"`
+}
+
+// activatedMessage describes a successful activation
+func activatedMessage(info ActiveServer) string {
+	proxyStatus := "DNS-only"
+	if info.Proxied {
+		proxyStatus = "proxied"
+	}
+	return fmt.Sprintf("✓ Activated %s (%s -> %s) [%s, TTL: %d]", info.Name, info.Alias, info.IP, proxyStatus, info.TTL)
+}
+
+// verifiedDetail builds the detail of a successful change; changes the API
+// does not show yet are reported as warnings
+func verifiedDetail(message, verification string) UpdateDetail {
+	detail := UpdateDetail{Message: message, Status: "success", Verification: verification}
+	if verification != VerificationVerified {
+		detail.Status = "warning"
+		detail.Message = fmt.Sprintf("%s (verification %s)", message, verification)
+	}
+	return detail
+}
+
+// executePlan applies a plan in one atomic batch where possible and falls
+// back to one request per record otherwise
+func executePlan(ctx context.Context, cfClient *CloudflareClient, plan UpdatePlan, journal *applyJournal, progress func(UpdateDetail)) PlanResult {
+	if plan.IsEmpty() {
+		return PlanResult{}
+	}
+	if batchAvailable() {
+		result, err := executePlanBatch(ctx, cfClient, plan, journal, progress)
+		if !errors.Is(err, errBatchUnsupported) {
+			return result
+		}
+		logger.Log("WARNING", "Cloudflare batch endpoint not available, applying changes one by one")
+	}
+	return executePlanSequential(ctx, cfClient, plan, journal, progress)
+}
+
+// executePlanBatch submits all deletes and creates of a plan as one batch
+func executePlanBatch(ctx context.Context, cfClient *CloudflareClient, plan UpdatePlan, journal *applyJournal, progress func(UpdateDetail)) (PlanResult, error) {
+	result := PlanResult{progress: progress}
+	var batch DNSBatch
+	for _, record := range plan.Delete {
+		batch.Deletes = append(batch.Deletes, DNSBatchDelete{ID: record.ID})
+	}
+	for _, info := range plan.Create {
+		batch.Posts = append(batch.Posts, cfClient.recordPayload(info.IP, info.Name, activeServerMetadata(info), info.Proxied, info.TTL))
+	}
+	for _, patch := range plan.Patch {
+		fields := map[string]interface{}{"id": patch.ID}
+		for key, value := range patch.Changes {
+			fields[key] = value
+		}
+		batch.Patches = append(batch.Patches, fields)
+	}
+	
+	seq := journal.send("batch", "", "", "")
+	batchResult, err := cfClient.BatchDNSRecords(ctx, batch)
+	journal.done(seq, "", err)
+	if errors.Is(err, errBatchUnsupported) {
+		return result, err
+	}
+	var apiErr *APIError
+	if err != nil && !(errors.As(err, &apiErr) && apiErr.Status >= 400) {
+		// Without a definite rejection the batch may have been applied
+		return reconcileBatch(ctx, cfClient, plan, err, result), nil
+	}
+	if err != nil {
+		// The batch is atomic, so a rejected batch made none of the changes
+		result.BatchError = err
+		for _, info := range plan.Create {
+			result.add(UpdateDetail{
+				Message: fmt.Sprintf("Failed to activate %s (%s -> %s): batch rejected", info.Name, info.Alias, info.IP),
+				Status:  "error",
+			})
+		}
+		for _, record := range plan.Delete {
+			dnsName := strings.TrimSuffix(record.Name, "."+credentials.Domain)
+			result.add(UpdateDetail{
+				Message: fmt.Sprintf("Failed to deactivate %s (%s -> %s): batch rejected", dnsName, record.Alias(), record.Content),
+				Status:  "error",
+			})
+		}
+		for _, patch := range plan.Patch {
+			result.add(UpdateDetail{
+				Message: fmt.Sprintf("Failed to update %s (%s): batch rejected", strings.TrimSuffix(patch.Name, "."+credentials.Domain), patch.IP),
+				Status:  "error",
+			})
+		}
+		return result, nil
+	}
+	
+	// Posts come back in request order
+	for i, info := range plan.Create {
+		verification := VerificationFailed
+		if i < len(batchResult.Posts) {
+			verification = cfClient.VerifyCreated(ctx, batchResult.Posts[i].ID, info.IP)
+		}
+		result.add(verifiedDetail(activatedMessage(info), verification))
+		result.Activated = append(result.Activated, info)
+	}
+	for _, record := range plan.Delete {
+		dnsName := strings.TrimSuffix(record.Name, "."+credentials.Domain)
+		verification := cfClient.VerifyDeleted(ctx, record.ID)
+		result.add(verifiedDetail(fmt.Sprintf("✓ Deactivated %s (%s -> %s)", dnsName, record.Alias(), record.Content), verification))
+		result.Deactivated = append(result.Deactivated, record)
+	}
+	for _, patch := range plan.Patch {
+		result.add(UpdateDetail{Message: patchedMessage(patch), Status: "success"})
+		result.Patched = append(result.Patched, patch)
+	}
+	return result, nil
+}
+
+// patchedMessage describes a successful record patch
+func patchedMessage(patch RecordPatch) string {
+	return fmt.Sprintf("✓ Updated %s (%s): %s", strings.TrimSuffix(patch.Name, "."+credentials.Domain), patch.IP, patch.Describe())
+}
+
+// reconcileBatch reports the outcome of a batch whose response was lost
+// (timeout, dropped connection, unreadable body) by comparing the plan with
+// the live records
+func reconcileBatch(ctx context.Context, cfClient *CloudflareClient, plan UpdatePlan, batchErr error, result PlanResult) PlanResult {
+	readCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+	invalidateRecords()
+	records, err := cfClient.GetDNSRecords(readCtx)
+	if err != nil {
+		logger.Log("ERROR", fmt.Sprintf("Outcome of DNS batch unknown: %v; reading records failed: %v", batchErr, err))
+		result.Failed = true
+		result.Unknown = batchErr
+		for _, info := range plan.Create {
+			result.add(UpdateDetail{
+				Message: fmt.Sprintf("Unknown whether %s (%s -> %s) was activated: %v; check the records and the apply journal", info.Name, info.Alias, info.IP, batchErr),
+				Status:  "error",
+			})
+		}
+		for _, record := range plan.Delete {
+			dnsName := strings.TrimSuffix(record.Name, "."+credentials.Domain)
+			result.add(UpdateDetail{
+				Message: fmt.Sprintf("Unknown whether %s (%s -> %s) was deactivated: %v; check the records and the apply journal", dnsName, record.Alias(), record.Content, batchErr),
+				Status:  "error",
+			})
+		}
+		for _, patch := range plan.Patch {
+			result.add(UpdateDetail{
+				Message: fmt.Sprintf("Unknown whether %s (%s) was updated: %v; check the records and the apply journal", strings.TrimSuffix(patch.Name, "."+credentials.Domain), patch.IP, batchErr),
+				Status:  "error",
+			})
+		}
+		return result
+	}
+	
+	live := make(map[string]bool)
+	liveIDs := make(map[string]CloudflareRecord)
+	for _, record := range records {
+		live[record.Name+" "+record.Content] = true
+		liveIDs[record.ID] = record
+	}
+	for _, info := range plan.Create {
+		if live[fullDNSName(info.Name)+" "+info.IP] {
+			result.add(verifiedDetail(activatedMessage(info), VerificationVerified))
+			result.Activated = append(result.Activated, info)
+			continue
+		}
+		result.add(UpdateDetail{
+			Message: fmt.Sprintf("Failed to activate %s (%s -> %s): %v", info.Name, info.Alias, info.IP, batchErr),
+			Status:  "error",
+		})
+		result.Failed = true
+	}
+	for _, record := range plan.Delete {
+		dnsName := strings.TrimSuffix(record.Name, "."+credentials.Domain)
+		if _, found := liveIDs[record.ID]; !found {
+			result.add(verifiedDetail(fmt.Sprintf("✓ Deactivated %s (%s -> %s)", dnsName, record.Alias(), record.Content), VerificationVerified))
+			result.Deactivated = append(result.Deactivated, record)
+			continue
+		}
+		result.add(UpdateDetail{
+			Message: fmt.Sprintf("Failed to deactivate %s (%s -> %s): %v", dnsName, record.Alias(), record.Content, batchErr),
+			Status:  "error",
+		})
+		result.Failed = true
+	}
+	for _, patch := range plan.Patch {
+		if record, found := liveIDs[patch.ID]; found && hasFields(record, patch.Changes) {
+			result.add(UpdateDetail{Message: patchedMessage(patch), Status: "success"})
+			result.Patched = append(result.Patched, patch)
+			continue
+		}
+		result.add(UpdateDetail{
+			Message: fmt.Sprintf("Failed to update %s (%s): %v", strings.TrimSuffix(patch.Name, "."+credentials.Domain), patch.IP, batchErr),
+			Status:  "error",
+		})
+		result.Failed = true
+	}
+	return result
+}
+
+// executePlanSequential creates and deletes the records of a plan one by one.
+// In -transactional mode it stops at the first failure and undoes the
+// changes that were already made.
+func executePlanSequential(ctx context.Context, cfClient *CloudflareClient, plan UpdatePlan, journal *applyJournal, progress func(UpdateDetail)) PlanResult {
+	result := PlanResult{progress: progress}
+	
+	// Add new records
+	for _, info := range plan.Create {
+		if result.Failed && *transactional {
+			result.add(UpdateDetail{
+				Message: fmt.Sprintf("Skipped activating %s (%s -> %s): update aborted", info.Name, info.Alias, info.IP),
+				Status:  "skipped",
+			})
+			continue
+		}
+		
+		detail := UpdateDetail{}
+		
+		seq := journal.send("create", fullDNSName(info.Name), info.IP, "")
+		recordID, verification, err := cfClient.CreateDNSRecord(ctx, info.IP, info.Name, activeServerMetadata(info), info.Proxied, info.TTL)
+		journal.done(seq, recordID, err)
+		if err != nil {
+			detail.Message = fmt.Sprintf("Failed to activate %s (%s -> %s): %v", info.Name, info.Alias, info.IP, err)
+			detail.Status = "error"
+			result.Failed = true
+		} else {
+			detail = verifiedDetail(activatedMessage(info), verification)
+			result.Activated = append(result.Activated, info)
+			result.Created = append(result.Created, CloudflareRecord{ID: recordID, Name: fullDNSName(info.Name), Content: info.IP, Comment: recordComment(activeServerMetadata(info))})
+		}
+		
+		result.add(detail)
+	}
+	
+	// Remove records
+	for _, record := range plan.Delete {
+		dnsName := strings.TrimSuffix(record.Name, "."+credentials.Domain)
+		if result.Failed && *transactional {
+			result.add(UpdateDetail{
+				Message: fmt.Sprintf("Skipped deactivating %s (%s -> %s): update aborted", dnsName, record.Alias(), record.Content),
+				Status:  "skipped",
+			})
+			continue
+		}
+		
+		detail := UpdateDetail{}
+		
+		seq := journal.send("delete", record.Name, record.Content, record.ID)
+		verification, err := cfClient.DeleteDNSRecord(ctx, record.ID)
+		journal.done(seq, "", err)
+		if err != nil {
+			detail.Message = fmt.Sprintf("Failed to deactivate %s (%s -> %s): %v", dnsName, record.Alias(), record.Content, err)
+			detail.Status = "error"
+			result.Failed = true
+		} else {
+			detail = verifiedDetail(fmt.Sprintf("✓ Deactivated %s (%s -> %s)", dnsName, record.Alias(), record.Content), verification)
+			result.Deactivated = append(result.Deactivated, record)
+		}
+		
+		result.add(detail)
+	}
+	
+	// Change record fields
+	for _, patch := range plan.Patch {
+		dnsName := strings.TrimSuffix(patch.Name, "."+credentials.Domain)
+		if result.Failed && *transactional {
+			result.add(UpdateDetail{
+				Message: fmt.Sprintf("Skipped updating %s (%s): update aborted", dnsName, patch.IP),
+				Status:  "skipped",
+			})
+			continue
+		}
+		
+		seq := journal.send("patch", patch.Name, patch.IP, patch.ID)
+		err := cfClient.UpdateDNSRecord(ctx, patch.ID, patch.Changes)
+		journal.done(seq, "", err)
+		if err != nil {
+			result.add(UpdateDetail{
+				Message: fmt.Sprintf("Failed to update %s (%s): %v", dnsName, patch.IP, err),
+				Status:  "error",
+			})
+			result.Failed = true
+			continue
+		}
+		result.add(UpdateDetail{Message: patchedMessage(patch), Status: "success"})
+		result.Patched = append(result.Patched, patch)
+	}
+	
+	if result.Failed && *transactional && len(result.Activated)+len(result.Deactivated)+len(result.Patched) > 0 {
+		rollbackPlan(ctx, cfClient, &result, journal)
+	}
+	
+	return result
+}
+
+// rollbackPlan undoes the completed changes of a failed plan: removed records
+// are recreated from the pre-apply state first, so no name is left without
+// records, then created records are deleted again and patched fields set
+// back. Changes that could not be undone stay in result.Activated,
+// Deactivated and Patched so they are still recorded.
+func rollbackPlan(ctx context.Context, cfClient *CloudflareClient, result *PlanResult, journal *applyJournal) {
+	// The rollback has to run even if the update was cancelled
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), *applyTimeout)
+	defer cancel()
+	
+	message := fmt.Sprintf("Rolling back %d completed changes", len(result.Activated)+len(result.Deactivated)+len(result.Patched))
+	logger.Log("WARNING", message)
+	if result.progress != nil {
+		result.progress(UpdateDetail{Message: message, Status: "warning"})
+	}
+	report := &RollbackReport{Success: true}
+	
+	var stillDeactivated []CloudflareRecord
+	for _, record := range result.Deactivated {
+		dnsName := strings.TrimSuffix(record.Name, "."+credentials.Domain)
+		seq := journal.send("restore", record.Name, record.Content, "")
+		restoredID, err := cfClient.RestoreDNSRecord(ctx, record)
+		journal.done(seq, restoredID, err)
+		if err != nil {
+			report.Success = false
+			stillDeactivated = append(stillDeactivated, record)
+			result.addRollback(report, UpdateDetail{
+				Message: fmt.Sprintf("Failed to restore %s (%s -> %s): %v", dnsName, record.Alias(), record.Content, err),
+				Status:  "error",
+			})
+			continue
+		}
+		result.addRollback(report, UpdateDetail{
+			Message: fmt.Sprintf("↺ Restored %s (%s -> %s)", dnsName, record.Alias(), record.Content),
+			Status:  "success",
+		})
+	}
+	
+	var stillActivated []ActiveServer
+	var stillCreated []CloudflareRecord
+	for i, record := range result.Created {
+		dnsName := strings.TrimSuffix(record.Name, "."+credentials.Domain)
+		seq := journal.send("undo_create", record.Name, record.Content, record.ID)
+		_, err := cfClient.DeleteDNSRecord(ctx, record.ID)
+		journal.done(seq, "", err)
+		if err != nil {
+			report.Success = false
+			stillActivated = append(stillActivated, result.Activated[i])
+			stillCreated = append(stillCreated, record)
+			result.addRollback(report, UpdateDetail{
+				Message: fmt.Sprintf("Failed to remove %s (%s -> %s) again: %v", dnsName, record.Alias(), record.Content, err),
+				Status:  "error",
+			})
+			continue
+		}
+		result.addRollback(report, UpdateDetail{
+			Message: fmt.Sprintf("↺ Removed %s (%s -> %s) again", dnsName, record.Alias(), record.Content),
+			Status:  "success",
+		})
+	}
+	
+	var stillPatched []RecordPatch
+	for _, patch := range result.Patched {
+		dnsName := strings.TrimSuffix(patch.Name, "."+credentials.Domain)
+		seq := journal.send("undo_patch", patch.Name, patch.IP, patch.ID)
+		err := cfClient.UpdateDNSRecord(ctx, patch.ID, patch.Before)
+		journal.done(seq, "", err)
+		if err != nil {
+			report.Success = false
+			stillPatched = append(stillPatched, patch)
+			result.addRollback(report, UpdateDetail{
+				Message: fmt.Sprintf("Failed to set %s (%s) back: %v", dnsName, patch.IP, err),
+				Status:  "error",
+			})
+			continue
+		}
+		result.addRollback(report, UpdateDetail{
+			Message: fmt.Sprintf("↺ Set %s (%s) back", dnsName, patch.IP),
+			Status:  "success",
+		})
+	}
+	
+	result.Activated = stillActivated
+	result.Created = stillCreated
+	result.Deactivated = stillDeactivated
+	result.Patched = stillPatched
+	result.Rollback = report
+	
+	if report.Success {
+		logger.Log("SUCCESS", "Rollback complete, every completed change was undone")
+	} else {
+		logger.Log("ERROR", "Rollback incomplete, some changes could not be undone")
+	}
+}
+// verifyRollback compares the live records with the snapshot taken before the
+// apply; a rollback only counts as complete when they match again
+func verifyRollback(ctx context.Context, cfClient *CloudflareClient, before []CloudflareRecord, result *PlanResult) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+	report := result.Rollback
+	
+	invalidateRecords()
+	after, err := cfClient.GetDNSRecords(ctx)
+	if err != nil {
+		report.Success = false
+		result.addRollback(report, UpdateDetail{
+			Message: fmt.Sprintf("Could not check the records after the rollback: %v", err),
+			Status:  "error",
+		})
+		logger.Log("ERROR", fmt.Sprintf("Could not check the records after the rollback: %v", err))
+		return
+	}
+	
+	counts := make(map[string]int)
+	for _, record := range before {
+		counts[record.Name+" -> "+record.Content]++
+	}
+	for _, record := range after {
+		counts[record.Name+" -> "+record.Content]--
+	}
+	var keys []string
+	for key, count := range counts {
+		if count != 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		report.Success = false
+		message := fmt.Sprintf("%s is missing after the rollback", key)
+		if counts[key] < 0 {
+			message = fmt.Sprintf("%s was not there before the update", key)
+		}
+		result.addRollback(report, UpdateDetail{Message: message, Status: "error"})
+	}
+	if !report.Success {
+		logger.Log("ERROR", "Records differ from their state before the update after the rollback")
+	}
+}
+
+// applyUpdate brings the live DNS records in line with the requested active set
+func applyUpdate(ctx context.Context, cfClient *CloudflareClient, req UpdateRequest, opts ApplyOptions) UpdateResponse {
+	response := UpdateResponse{Success: true}
+	
+	// Shutdown waits for running applies; -apply-timeout bounds how long one may take
+	defer trackApply()()
+	ctx, cancel := context.WithTimeout(ctx, *applyTimeout)
+	defer cancel()
+	
+	for _, server := range req.ActiveServers {
+		if _, _, err := parseExpiresIn(server.ExpiresIn); err != nil {
+			response.Success = false
+			response.Message = fmt.Sprintf("%s (%s): %v", server.Alias, server.IP, err)
+			return response
+		}
+	}
+	
+	// Get current DNS records
+	records, err := cfClient.GetDNSRecords(ctx)
+	if err != nil {
+		response.Success = false
+		response.Message = fmt.Sprintf("Failed to fetch current records: %v", err)
+		return response
+	}
+	
+	plan := planUpdate(records, req)
+	
+	// Load server config for updating timestamps
+	config, err := loadServerConfig(*environment)
+	if err != nil || config == nil {
+		if err != nil {
+			logger.Log("WARNING", fmt.Sprintf("Failed to load config for timestamp updates: %v", err))
+		}
+		// Create empty config if it doesn't exist
+		config = &ServerConfig{
+			Environment: *environment,
+			Domain:      credentials.Domain,
+			Servers:     []Server{},
+		}
+	}
+	
+	if err := checkActivations(config, plan); err != nil {
+		response.Success = false
+		response.Message = err.Error()
+		return response
+	}
+	
+	if err := enforceFreeze(config, planFreezeTargets(config, plan), req.BreakGlassReason, opts.Operator, "DNS update"); err != nil {
+		response.Success = false
+		response.Frozen = true
+		response.Message = err.Error()
+		return response
+	}
+	
+	if err := enforceBlastRadius(records, plan, req.Force, req.ForceReason, opts.Operator); err != nil {
+		response.Success = false
+		response.Guarded = true
+		response.Message = err.Error()
+		return response
+	}
+	
+	// Process changes; the journal lets an interrupted apply be recovered
+	var journal *applyJournal
+	if !plan.IsEmpty() {
+		journal = beginApply(plan, opts, req.ActiveServers)
+	}
+	result := executePlan(ctx, cfClient, plan, journal, opts.Progress)
+	if result.Rollback != nil && result.Rollback.Success {
+		verifyRollback(ctx, cfClient, records, &result)
+	}
+	response.Details = result.Details
+	response.Rollback = result.Rollback
+	changes := len(result.Activated) + len(result.Deactivated)
+	
+	expiryChanged := false
+	for _, server := range req.ActiveServers {
+		// A rolled back update keeps the previous expiries as well
+		if server.ExpiresIn != "" && result.Rollback == nil {
+			expiryChanged = true
+		}
+	}
+	
+	if result.BatchError != nil {
+		response.Success = false
+		response.Message = fmt.Sprintf("Batch rejected, no DNS records were changed: %v", result.BatchError)
+	} else if result.Unknown != nil {
+		response.Success = false
+		response.Message = fmt.Sprintf("Outcome of the batch is unknown (%v), check the DNS records and the apply journal", result.Unknown)
+	} else if result.Rollback != nil && result.Rollback.Success {
+		response.Success = false
+		response.Message = "Update failed and was rolled back, the DNS records are unchanged"
+	} else if result.Rollback != nil && changes == 0 {
+		response.Success = false
+		response.Message = "Update failed and was rolled back, but the DNS records differ from before the update"
+	} else if result.Rollback != nil {
+		response.Success = false
+		response.Message = fmt.Sprintf("Update failed and the rollback is incomplete: %d changes remain", changes)
+	} else if err := ctx.Err(); err != nil {
+		response.Success = false
+		response.Message = fmt.Sprintf("Update interrupted (%v) after %d of %d changes", err, changes, len(plan.Create)+len(plan.Delete))
+	} else if result.Failed && changes == 0 {
+		response.Success = false
+		response.Message = "Update failed, no DNS records were changed"
+	} else if result.Failed {
+		response.Success = false
+		response.Message = fmt.Sprintf("Update partially failed: %d of %d changes applied", changes, len(plan.Create)+len(plan.Delete))
+	} else if changes == 0 {
+		response.Message = "No changes required"
+	} else {
+		response.Message = fmt.Sprintf("Successfully updated %d DNS records", changes)
+	}
+	
+	if changes > 0 || expiryChanged {
+		reason := opts.Reason
+		if reason == "" {
+			reason = fmt.Sprintf("deactivated via %s", opts.Source)
+		}
+		
+		// Save updated configuration with new timestamps
+		if err := updateServerConfig(context.WithoutCancel(ctx), func(config *ServerConfig) error {
+			recordActivations(config, result.Activated, opts.Source)
+			recordDeactivations(config, result.Deactivated, reason)
+			applyExpiries(config, req.ActiveServers)
+			return nil
+		}); err != nil {
+			logger.Log("ERROR", fmt.Sprintf("Failed to save config after updates: %v", err))
+		}
+	}
+	
+	if journal != nil {
+		journal.end(applyOutcome(response))
+	}
+	publishActivations(opts, result.Activated, result.Deactivated)
+	
+	// The desired sets come from the request, so they only hold after a successful apply
+	if changes > 0 && response.Success {
+		response.PropagationID = startPropagationCheck(plan, req.ActiveServers)
+	}
+	
+	if !plan.IsEmpty() {
+		entry := AuditEntry{
+			Action:   "apply",
+			Operator: opts.Operator,
+			Approver: opts.Approver,
+			ChangeID: opts.ChangeID,
+			Source:   opts.Source,
+			Reason:   opts.Reason,
+			Success:  true,
+		}
+		for _, detail := range response.Details {
+			entry.Details = append(entry.Details, detail.Message)
+			if detail.Status == "error" {
+				entry.Success = false
+			}
+		}
+		if response.Rollback != nil {
+			entry.Success = false
+			for _, detail := range response.Rollback.Details {
+				entry.Details = append(entry.Details, "rollback: "+detail.Message)
+			}
+		}
+		logger.Audit(entry)
+	}
+	
+	return response
+}
+
+// Operation journal
+//
+// Every apply writes its plan and each Cloudflare call to an append-only
+// journal, before the call is sent and after it returns. An apply without an
+// "end" entry was interrupted (e.g. the process crashed) and is offered for
+// resume or rollback on the next start.
+
+// JournalEntry is one line of the operation journal
+type JournalEntry struct {
+	Time     time.Time `json:"time"`
+	ApplyID  string    `json:"apply_id"`
+	Event    string    `json:"event"`             // begin, send, done, failed, resolve, end
+	Seq      int       `json:"seq,omitempty"`     // Operation number within the apply
+	Op       string    `json:"op,omitempty"`      // create, delete, patch, batch, restore, undo_create, undo_patch
+	Name     string    `json:"name,omitempty"`    // Full DNS name
+	IP       string    `json:"ip,omitempty"`
+	RecordID string    `json:"record_id,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Outcome  string    `json:"outcome,omitempty"` // end: completed, failed, rolled_back, ...
+	
+	// Only set on begin
+	Plan     *UpdatePlan    `json:"plan,omitempty"`
+	Options  *ApplyOptions  `json:"options,omitempty"`
+	Expiries []ActiveServer `json:"expiries,omitempty"`
+}
+
+// UnfinishedApply is an apply that was interrupted before it ended
+type UnfinishedApply struct {
+	ID        string         `json:"id"`
+	StartedAt time.Time      `json:"started_at"`
+	Options   ApplyOptions   `json:"options"`
+	Plan      UpdatePlan     `json:"plan"`
+	Expiries  []ActiveServer `json:"expiries,omitempty"`
+	Ops       []JournalOp    `json:"operations"`
+	
+	lastSeq int
+}
+
+// JournalOp is one planned change of an unfinished apply
+type JournalOp struct {
+	Op      string `json:"op"` // create, delete, patch
+	Name    string `json:"name"`
+	IP      string `json:"ip"`
+	Journal string `json:"journal"`        // not_sent, sent (no answer recorded), done, failed
+	Live    string `json:"live,omitempty"` // applied, not_applied (from the live records)
+}
+
+// operationJournal is the journal file of this environment
+type operationJournal struct {
+	mu         sync.Mutex
+	file       *os.File
+	open       map[string]bool             // Applies currently running
+	unfinished map[string]*UnfinishedApply // Interrupted applies waiting for resume or rollback
+	unlock     chan struct{}               // Stops refreshing the lock file of this process
+}
+
+var journal = &operationJournal{open: map[string]bool{}, unfinished: map[string]*UnfinishedApply{}}
+
+// journalPath returns the journal file, which lives next to the configuration
+func journalPath(env string) string {
+	return fmt.Sprintf("journal.%s.jsonl", env)
+}
+
+// journalLockPath returns the lock file of the process that owns the journal
+func journalLockPath(env string) string {
+	return fmt.Sprintf("journal.%s.lock", env)
+}
+
+// The owner of the journal refreshes its lock file, so the lock of a crashed
+// process goes stale and can be taken over
+const (
+	journalLockRefresh = 10 * time.Second
+	journalLockStale   = 30 * time.Second
+)
+
+// lockJournal makes this process the only one that writes the journal. It
+// fails while another process (usually the running server) owns it. Closing
+// the returned channel stops refreshing the lock.
+func lockJournal(env string) (chan struct{}, error) {
+	path := journalLockPath(env)
+	if info, err := os.Stat(path); err == nil {
+		if time.Since(info.ModTime()) < journalLockStale {
+			owner, _ := os.ReadFile(path)
+			return nil, fmt.Errorf("the journal is in use by process %s; use its web interface or stop it first", strings.TrimSpace(string(owner)))
+		}
+		logger.Log("WARNING", fmt.Sprintf("Taking over the stale journal lock %s", path))
+		os.Remove(path)
+	}
+	
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("the journal is being opened by another process: %v", err)
+	}
+	fmt.Fprintf(file, "%d\n", os.Getpid())
+	file.Close()
+	
+	unlock := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(journalLockRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-unlock:
+				return
+			case <-ticker.C:
+				now := time.Now()
+				os.Chtimes(path, now, now)
+			}
+		}
+	}()
+	return unlock, nil
+}
+
+// readJournal returns the entries of applies that have not ended
+func readJournal(env string) ([]JournalEntry, error) {
+	data, err := os.ReadFile(journalPath(env))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	
+	var entries, kept []JournalEntry
+	ended := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var entry JournalEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			// A crash can leave a partly written last line
+			logger.Log("WARNING", fmt.Sprintf("Ignoring unreadable journal line: %v", err))
+			continue
+		}
+		entries = append(entries, entry)
+		if entry.Event == "end" {
+			ended[entry.ApplyID] = true
+		}
+	}
+	for _, entry := range entries {
+		if !ended[entry.ApplyID] {
+			kept = append(kept, entry)
+		}
+	}
+	return kept, nil
+}
+
+// loadJournal reads the unfinished applies without taking the journal over,
+// for command line calls that only look at it
+func loadJournal(env string) error {
+	kept, err := readJournal(env)
+	if err != nil {
+		return err
+	}
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	journal.unfinished = unfinishedFromEntries(kept)
+	return nil
+}
+
+// openJournal takes the journal over, loads unfinished applies from it,
+// drops the entries of finished ones and opens the file for appending
+func openJournal(env string) error {
+	unlock, err := lockJournal(env)
+	if err != nil {
+		return err
+	}
+	
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	journal.unlock = unlock
+	
+	kept, err := readJournal(env)
+	if err != nil {
+		return err
+	}
+	journal.unfinished = unfinishedFromEntries(kept)
+	
+	// Rewrite the journal with the unfinished applies only
+	path := journalPath(env)
+	var buf bytes.Buffer
+	for _, entry := range kept {
+		line, _ := json.Marshal(entry)
+		buf.Write(append(line, '\n'))
+	}
+	if err := os.WriteFile(path+".tmp", buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	
+	journal.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	return err
+}
+
+// closeJournal closes the journal and releases it for other processes
+func closeJournal(env string) {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	if journal.file != nil {
+		journal.file.Close()
+		journal.file = nil
+	}
+	if journal.unlock != nil {
+		close(journal.unlock)
+		journal.unlock = nil
+		os.Remove(journalLockPath(env))
+	}
+}
+
+// unfinishedFromEntries rebuilds interrupted applies from their journal entries
+func unfinishedFromEntries(entries []JournalEntry) map[string]*UnfinishedApply {
+	applies := make(map[string]*UnfinishedApply)
+	sent := make(map[string]map[string]string) // apply -> op|name|ip -> journal status
+	calls := make(map[string]map[int]string)   // apply -> seq -> op|name|ip
+	
+	for _, entry := range entries {
+		if entry.Event == "begin" {
+			apply := &UnfinishedApply{ID: entry.ApplyID, StartedAt: entry.Time, Expiries: entry.Expiries}
+			if entry.Plan != nil {
+				apply.Plan = *entry.Plan
+			}
+			if entry.Options != nil {
+				apply.Options = *entry.Options
+			}
+			applies[entry.ApplyID] = apply
+			sent[entry.ApplyID] = make(map[string]string)
+			calls[entry.ApplyID] = make(map[int]string)
+			continue
+		}
+		apply := applies[entry.ApplyID]
+		if apply == nil {
+			continue
+		}
+		if entry.Seq > apply.lastSeq {
+			apply.lastSeq = entry.Seq
+		}
+		switch entry.Event {
+		case "send":
+			key := entry.Op + "|" + entry.Name + "|" + entry.IP
+			calls[entry.ApplyID][entry.Seq] = key
+			sent[entry.ApplyID][key] = "sent"
+		case "done", "failed":
+			if key, ok := calls[entry.ApplyID][entry.Seq]; ok {
+				sent[entry.ApplyID][key] = entry.Event
+			}
+		}
+	}
+	
+	for id, apply := range applies {
+		batch := sent[id]["batch||"]
+		status := func(op, name, ip string) string {
+			if batch != "" {
+				return batch
+			}
+			if s := sent[id][op+"|"+name+"|"+ip]; s != "" {
+				return s
+			}
+			return "not_sent"
+		}
+		for _, info := range apply.Plan.Create {
+			name := fullDNSName(info.Name)
+			apply.Ops = append(apply.Ops, JournalOp{Op: "create", Name: name, IP: info.IP, Journal: status("create", name, info.IP)})
+		}
+		for _, record := range apply.Plan.Delete {
+			apply.Ops = append(apply.Ops, JournalOp{Op: "delete", Name: record.Name, IP: record.Content, Journal: status("delete", record.Name, record.Content)})
+		}
+		for _, patch := range apply.Plan.Patch {
+			apply.Ops = append(apply.Ops, JournalOp{Op: "patch", Name: patch.Name, IP: patch.IP, Journal: status("patch", patch.Name, patch.IP)})
+		}
+	}
+	return applies
+}
+
+// write appends an entry and syncs it to disk before the caller goes on
+func (j *operationJournal) write(entry JournalEntry) {
+	entry.Time = time.Now()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger.Log("ERROR", fmt.Sprintf("Failed to encode journal entry: %v", err))
+		return
+	}
+	
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	
+	switch entry.Event {
+	case "begin", "resolve":
+		j.open[entry.ApplyID] = true
+	case "end":
+		delete(j.open, entry.ApplyID)
+		delete(j.unfinished, entry.ApplyID)
+	}
+	
+	if j.file == nil {
+		return
+	}
+	if _, err = j.file.Write(append(data, '\n')); err == nil {
+		err = j.file.Sync()
+	}
+	if err != nil {
+		logger.Log("ERROR", fmt.Sprintf("Failed to write journal entry: %v", err))
+		return
+	}
+	
+	// Start over once nothing is left to recover
+	if entry.Event == "end" && len(j.open) == 0 && len(j.unfinished) == 0 {
+		if err := j.file.Truncate(0); err != nil {
+			logger.Log("WARNING", fmt.Sprintf("Failed to truncate journal: %v", err))
+		}
+	}
+}
+
+// hasUnfinishedApplies reports whether interrupted applies wait for a decision
+func hasUnfinishedApplies() bool {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	return len(journal.unfinished) > 0
+}
+
+// isUnfinishedApply reports whether id is an interrupted apply
+func isUnfinishedApply(id string) bool {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	return journal.unfinished[id] != nil
+}
+
+// reportUnfinishedApplies logs the interrupted applies found at startup,
+// reconciled against the live records
+func reportUnfinishedApplies() {
+	if !hasUnfinishedApplies() {
+		return
+	}
+	records, err := NewCloudflareClient(credentials).GetDNSRecords(workCtx)
+	if err != nil {
+		logger.Log("WARNING", fmt.Sprintf("Unfinished applies found, but the live records could not be fetched to reconcile them: %v", err))
+		return
+	}
+	for _, apply := range unfinishedApplies(records) {
+		applied := 0
+		for _, op := range apply.Ops {
+			if op.Live == "applied" {
+				applied++
+			}
+		}
+		logger.Log("WARNING", fmt.Sprintf("Apply %s from %s was interrupted with %d of %d changes live; resume or roll it back in the web interface or with -resume-apply/-rollback-apply",
+			apply.ID, apply.StartedAt.Format("2006-01-02 15:04:05"), applied, len(apply.Ops)))
+	}
+}
+
+// unfinishedApplies returns the interrupted applies, compared with the given
+// live records, oldest first
+func unfinishedApplies(records []CloudflareRecord) []UnfinishedApply {
+	live := make(map[recordKey]bool)
+	byID := make(map[string]CloudflareRecord)
+	for _, record := range records {
+		live[recordKey{name: record.Name, ip: record.Content}] = true
+		byID[record.ID] = record
+	}
+	
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	
+	var applies []UnfinishedApply
+	for _, apply := range journal.unfinished {
+		copied := *apply
+		copied.Ops = make([]JournalOp, len(apply.Ops))
+		patches := len(apply.Plan.Create) + len(apply.Plan.Delete)
+		for i, op := range apply.Ops {
+			applied := live[recordKey{name: op.Name, ip: op.IP}] == (op.Op == "create")
+			if op.Op == "patch" {
+				// A patch is live when the record has the new field values
+				patch := apply.Plan.Patch[i-patches]
+				record, found := byID[patch.ID]
+				applied = found && hasFields(record, patch.Changes)
+			}
+			op.Live = "not_applied"
+			if applied {
+				op.Live = "applied"
+			}
+			copied.Ops[i] = op
+		}
+		applies = append(applies, copied)
+	}
+	sort.Slice(applies, func(i, j int) bool {
+		return applies[i].StartedAt.Before(applies[j].StartedAt)
+	})
+	return applies
+}
+
+// applyJournal records the operations of one apply
+type applyJournal struct {
+	id  string
+	seq int
+}
+
+// beginApply journals the plan of an apply before any change is sent
+func beginApply(plan UpdatePlan, opts ApplyOptions, servers []ActiveServer) *applyJournal {
+	var expiries []ActiveServer
+	for _, server := range servers {
+		if server.ExpiresIn != "" {
+			expiries = append(expiries, server)
+		}
+	}
+	
+	a := &applyJournal{id: randomID(6)}
+	journal.write(JournalEntry{ApplyID: a.id, Event: "begin", Plan: &plan, Options: &opts, Expiries: expiries})
+	return a
+}
+
+// send journals a Cloudflare call before it is made and returns its number
+func (a *applyJournal) send(op, name, ip, recordID string) int {
+	a.seq++
+	journal.write(JournalEntry{ApplyID: a.id, Event: "send", Seq: a.seq, Op: op, Name: name, IP: ip, RecordID: recordID})
+	return a.seq
+}
+
+// done journals the result of a call made with send
+func (a *applyJournal) done(seq int, recordID string, err error) {
+	entry := JournalEntry{ApplyID: a.id, Event: "done", Seq: seq, RecordID: recordID}
+	if err != nil {
+		entry.Event = "failed"
+		entry.Error = err.Error()
+	}
+	journal.write(entry)
+}
+
+// end marks the apply as finished; nothing is left to recover
+func (a *applyJournal) end(outcome string) {
+	journal.write(JournalEntry{ApplyID: a.id, Event: "end", Outcome: outcome})
+}
+
+// journalSingle makes one Cloudflare write outside an update as its own
+// journaled apply, so an interrupted write is listed with the unfinished
+// applies and can be resumed or rolled back like an update
+func journalSingle(plan UpdatePlan, opts ApplyOptions, op, name, ip, recordID string, write func() (string, error)) error {
+	a := beginApply(plan, opts, nil)
+	seq := a.send(op, name, ip, recordID)
+	newID, err := write()
+	a.done(seq, newID, err)
+	if err != nil {
+		a.end("failed")
+	} else {
+		a.end("completed")
+	}
+	return err
+}
+
+// journaledCreate creates a record outside an update, see journalSingle
+func journaledCreate(ctx context.Context, cfClient *CloudflareClient, info ActiveServer, meta RecordMetadata, opts ApplyOptions) (string, string, error) {
+	var recordID, verification string
+	err := journalSingle(UpdatePlan{Create: []ActiveServer{info}}, opts, "create", fullDNSName(info.Name), info.IP, "", func() (string, error) {
+		var err error
+		recordID, verification, err = cfClient.CreateDNSRecord(ctx, info.IP, info.Name, meta, info.Proxied, info.TTL)
+		return recordID, err
+	})
+	return recordID, verification, err
+}
+
+// journaledDelete deletes a record outside an update, see journalSingle
+func journaledDelete(ctx context.Context, cfClient *CloudflareClient, record CloudflareRecord, opts ApplyOptions) (string, error) {
+	var verification string
+	err := journalSingle(UpdatePlan{Delete: []CloudflareRecord{record}}, opts, "delete", record.Name, record.Content, record.ID, func() (string, error) {
+		var err error
+		verification, err = cfClient.DeleteDNSRecord(ctx, record.ID)
+		return "", err
+	})
+	return verification, err
+}
+
+// journaledPatch changes fields of a record outside an update, see journalSingle
+func journaledPatch(ctx context.Context, cfClient *CloudflareClient, record CloudflareRecord, changes map[string]interface{}, opts ApplyOptions) error {
+	patch := newRecordPatch(record, changes)
+	return journalSingle(UpdatePlan{Patch: []RecordPatch{patch}}, opts, "patch", patch.Name, patch.IP, patch.ID, func() (string, error) {
+		return "", cfClient.UpdateDNSRecord(ctx, record.ID, changes)
+	})
+}
+
+// applyOutcome summarizes an apply for its journal end entry
+func applyOutcome(response UpdateResponse) string {
+	switch {
+	case response.Rollback != nil && response.Rollback.Success:
+		return "rolled_back"
+	case response.Rollback != nil:
+		return "rollback_incomplete"
+	case !response.Success:
+		return "failed"
+	}
+	return "completed"
+}
+
+// resolveUnfinishedApply finishes an interrupted apply: "resume" makes the
+// changes that were not applied yet, "rollback" undoes the applied ones.
+// Either way the configuration records what is live afterwards.
+func resolveUnfinishedApply(ctx context.Context, cfClient *CloudflareClient, id, action, operator string, overrides ApprovalOverrides, progress func(UpdateDetail)) (UpdateResponse, error) {
+	response := UpdateResponse{Success: true}
+	if action != "resume" && action != "rollback" {
+		return response, fmt.Errorf("unknown action %q (use resume or rollback)", action)
+	}
+	
+	defer trackApply()()
+	ctx, cancel := context.WithTimeout(ctx, *applyTimeout)
+	defer cancel()
+	
+	// Compare with fresh records, the cache may predate the interruption
+	invalidateRecords()
+	records, err := cfClient.GetDNSRecords(ctx)
+	if err != nil {
+		return response, fmt.Errorf("failed to fetch current records: %v", err)
+	}
+	
+	// Claim the apply so it is resolved only once
+	journal.mu.Lock()
+	pending := journal.unfinished[id]
+	running := journal.open[id]
+	if pending != nil && !running {
+		journal.open[id] = true
+	}
+	journal.mu.Unlock()
+	if pending == nil {
+		return response, fmt.Errorf("no unfinished apply %s", id)
+	}
+	if running {
+		return response, fmt.Errorf("apply %s is already being resolved", id)
+	}
+	
+	var apply UnfinishedApply
+	for _, candidate := range unfinishedApplies(records) {
+		if candidate.ID == id {
+			apply = candidate
+		}
+	}
+	
+	liveRecords := make(map[recordKey]CloudflareRecord)
+	for _, record := range records {
+		liveRecords[recordKey{name: record.Name, ip: record.Content}] = record
+	}
+	
+	// Split the plan into what already happened and what did not
+	var applied PlanResult
+	var remaining UpdatePlan
+	for i, info := range apply.Plan.Create {
+		if apply.Ops[i].Live == "applied" {
+			applied.Activated = append(applied.Activated, info)
+			applied.Created = append(applied.Created, liveRecords[recordKey{name: fullDNSName(info.Name), ip: info.IP}])
+		} else {
+			remaining.Create = append(remaining.Create, info)
+		}
+	}
+	for i, record := range apply.Plan.Delete {
+		if apply.Ops[len(apply.Plan.Create)+i].Live == "applied" {
+			applied.Deactivated = append(applied.Deactivated, record)
+		} else {
+			remaining.Delete = append(remaining.Delete, liveRecords[recordKey{name: record.Name, ip: record.Content}])
+		}
+	}
+	patches := len(apply.Plan.Create) + len(apply.Plan.Delete)
+	for i, patch := range apply.Plan.Patch {
+		if apply.Ops[patches+i].Live == "applied" {
+			applied.Patched = append(applied.Patched, patch)
+		} else {
+			remaining.Patch = append(remaining.Patch, patch)
+		}
+	}
+	
+	// Freeze windows and the blast-radius guard are checked against what is
+	// live now; both may have changed since the apply was interrupted
+	if action == "resume" {
+		config, _ := loadServerConfig(*environment)
+		err := enforceFreeze(config, planFreezeTargets(config, remaining), overrides.BreakGlassReason, operator, "resume of apply "+id)
+		if err == nil {
+			err = enforceBlastRadius(records, remaining, overrides.Force, overrides.ForceReason, operator)
+		}
+		if err != nil {
+			journal.mu.Lock()
+			delete(journal.open, id)
+			journal.mu.Unlock()
+			return response, err
+		}
+	}
+	
+	a := &applyJournal{id: id, seq: pending.lastSeq}
+	journal.write(JournalEntry{ApplyID: id, Event: "resolve", Outcome: action})
+	logger.Log("INFO", fmt.Sprintf("Resolving unfinished apply %s by %s (%s)", id, operator, action))
+	
+	activated, deactivated := applied.Activated, applied.Deactivated
+	outcome := ""
+	if action == "resume" {
+		result := executePlan(ctx, cfClient, remaining, a, progress)
+		response.Details = result.Details
+		response.Rollback = result.Rollback
+		activated = append(activated, result.Activated...)
+		deactivated = append(deactivated, result.Deactivated...)
+		made := len(result.Activated) + len(result.Deactivated) + len(result.Patched)
+		
+		switch {
+		case result.BatchError != nil || result.Failed:
+			response.Success = false
+			response.Message = fmt.Sprintf("Resuming apply %s failed, %d of %d remaining changes made", id, made, len(remaining.Create)+len(remaining.Delete)+len(remaining.Patch))
+			outcome = "resume_failed"
+		default:
+			response.Message = fmt.Sprintf("Apply %s resumed, %d remaining changes made", id, made)
+			outcome = "resumed"
+		}
+	} else {
+		if len(applied.Activated)+len(applied.Deactivated)+len(applied.Patched) > 0 {
+			applied.progress = progress
+			rollbackPlan(ctx, cfClient, &applied, a)
+			response.Rollback = applied.Rollback
+		}
+		activated, deactivated = applied.Activated, applied.Deactivated
+		
+		if response.Rollback != nil && !response.Rollback.Success {
+			response.Success = false
+			response.Message = fmt.Sprintf("Rollback of apply %s is incomplete: %d changes remain", id, len(activated)+len(deactivated)+len(applied.Patched))
+			outcome = "rollback_incomplete"
+		} else {
+			response.Message = fmt.Sprintf("Apply %s rolled back, the DNS records are in their original state", id)
+			outcome = "rolled_back"
+		}
+	}
+	
+	// The interrupted apply never saved its changes, so record everything that is live now
+	reason := apply.Options.Reason
+	if reason == "" {
+		reason = fmt.Sprintf("deactivated via %s", apply.Options.Source)
+	}
+	if err := updateServerConfig(context.WithoutCancel(ctx), func(config *ServerConfig) error {
+		recordActivations(config, activated, apply.Options.Source)
+		recordDeactivations(config, deactivated, reason)
+		if action == "resume" {
+			applyExpiries(config, apply.Expiries)
+		}
+		return nil
+	}); err != nil {
+		logger.Log("ERROR", fmt.Sprintf("Failed to save config after resolving apply %s: %v", id, err))
+	}
+	
+	a.end(outcome)
+	
+	entry := AuditEntry{
+		Action:   "apply_" + action,
+		Operator: operator,
+		ChangeID: apply.Options.ChangeID,
+		Source:   apply.Options.Source,
+		Reason:   fmt.Sprintf("unfinished apply %s from %s", id, apply.StartedAt.Format(time.RFC3339)),
+		Success:  response.Success,
+	}
+	for _, detail := range response.Details {
+		entry.Details = append(entry.Details, detail.Message)
+	}
+	if response.Rollback != nil {
+		for _, detail := range response.Rollback.Details {
+			entry.Details = append(entry.Details, "rollback: "+detail.Message)
+		}
+	}
+	logger.Audit(entry)
+	return response, nil
+}
+
+// journalHandler lists unfinished applies and how far they got
+func journalHandler(w http.ResponseWriter, r *http.Request) {
+	cached, err := NewCloudflareClient(credentials).GetCachedDNSRecords(r.Context())
+	if err != nil {
+		writeAPIError(w, http.StatusBadGateway, fmt.Sprintf("Failed to fetch DNS records: %v", err))
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"unfinished": unfinishedApplies(cached.Records),
+	})
+}
+
+// resolveApplyHandler resumes or rolls back an unfinished apply
+func resolveApplyHandler(action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID               string `json:"id"`
+			BreakGlassReason string `json:"break_glass_reason"`
+			Force            bool   `json:"force"`
+			ForceReason      string `json:"force_reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" {
+			writeAPIError(w, http.StatusBadRequest, "Apply ID is required")
+			return
+		}
+		overrides := ApprovalOverrides{BreakGlassReason: req.BreakGlassReason, Force: req.Force, ForceReason: req.ForceReason}
+		
+		operator := operatorFromRequest(r)
+		if operator == "" {
+			writeAPIError(w, http.StatusBadRequest, operatorRequiredMessage())
+			return
+		}
+		
+		runAsJob(w, r, action, func(ctx context.Context, progress func(UpdateDetail)) (bool, string, interface{}) {
+			response, err := resolveUnfinishedApply(ctx, NewCloudflareClient(credentials), req.ID, action, operator, overrides, progress)
+			if err != nil {
+				var freezeErr *FreezeError
+				var guardErr *BlastRadiusError
+				return false, err.Error(), map[string]interface{}{
+					"success": false,
+					"message": err.Error(),
+					"error":   err.Error(),
+					"frozen":  errors.As(err, &freezeErr),
+					"guarded": errors.As(err, &guardErr),
+				}
+			}
+			return updateResult(response)
+		})
+	}
+}
+
+// runJournalCommand handles the -list-unfinished, -resume-apply and
+// -rollback-apply command line options
+func runJournalCommand() error {
+	cfClient := NewCloudflareClient(credentials)
+	
+	if *resumeApplyID != "" || *rollbackApplyID != "" {
+		id, action := *resumeApplyID, "resume"
+		if *rollbackApplyID != "" {
+			id, action = *rollbackApplyID, "rollback"
+		}
+		operator := cliOperator()
+		if operator == "" {
+			return fmt.Errorf("an operator is required to %s an apply; set -operator", action)
+		}
+		
+		// With approvals required the change waits for a second operator and
+		// is made by the server that owns the journal
+		if approvalRequired() {
+			if err := loadJournal(*environment); err != nil {
+				return err
+			}
+			if !isUnfinishedApply(id) {
+				return fmt.Errorf("apply %s is not unfinished", id)
+			}
+			body, _ := json.Marshal(map[string]interface{}{
+				"id":                 id,
+				"break_glass_reason": *breakGlassReason,
+				"force":              *forceReason != "",
+				"force_reason":       *forceReason,
+			})
+			change, err := submitActionRequest("/api/journal/"+action, body, operator)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Change request %s submitted, waiting for approval by another operator\n", change.ID)
+			return nil
+		}
+		
+		if err := openJournal(*environment); err != nil {
+			return err
+		}
+		overrides := ApprovalOverrides{BreakGlassReason: *breakGlassReason, Force: *forceReason != "", ForceReason: *forceReason}
+		response, err := resolveUnfinishedApply(workCtx, cfClient, id, action, operator, overrides, nil)
+		if err != nil {
+			return err
+		}
+		for _, detail := range response.Details {
+			fmt.Printf("  [%s] %s\n", detail.Status, detail.Message)
+		}
+		if response.Rollback != nil {
+			for _, detail := range response.Rollback.Details {
+				fmt.Printf("  [rollback %s] %s\n", detail.Status, detail.Message)
+			}
+		}
+		fmt.Println(response.Message)
+		if !response.Success {
+			return fmt.Errorf("%s of apply %s failed", action, id)
+		}
+		return nil
+	}
+	
+	if err := loadJournal(*environment); err != nil {
+		return err
+	}
+	records, err := cfClient.GetDNSRecords(workCtx)
+	if err != nil {
+		return err
+	}
+	applies := unfinishedApplies(records)
+	if len(applies) == 0 {
+		fmt.Printf("No unfinished applies for %s environment\n", *environment)
+		return nil
+	}
+	
+	fmt.Printf("\nUnfinished applies for %s environment:\n", *environment)
+	fmt.Println(strings.Repeat("-", 80))
+	for _, apply := range applies {
+		fmt.Printf("%s started %s via %s", apply.ID, apply.StartedAt.Format("2006-01-02 15:04:05"), apply.Options.Source)
+		if apply.Options.Operator != "" {
+			fmt.Printf(" by %s", apply.Options.Operator)
+		}
+		fmt.Println()
+		for _, op := range apply.Ops {
+			fmt.Printf("    %-6s %s -> %s: journal %s, live %s\n", op.Op, op.Name, op.IP, op.Journal, op.Live)
+		}
+	}
+	fmt.Println("\nUse -resume-apply <id> or -rollback-apply <id> to finish them.")
+	return nil
+}
+
+// recordActivations updates activation timestamps and adds servers that are
+// not yet part of the configuration
+func recordActivations(config *ServerConfig, activated []ActiveServer, source string) {
+	for _, info := range activated {
+		found := false
+		for i := range config.Servers {
+			if config.Servers[i].Content == info.IP && config.Servers[i].Name == fullDNSName(info.Name) {
+				config.Servers[i].LastActivatedOn = time.Now().Format(time.RFC3339)
+				config.Servers[i].Drain = nil
+				setState(&config.Servers[i], "active", fmt.Sprintf("activated via %s", source))
+				found = true
+				break
+			}
+		}
+		if !found {
+			// Add new server to config
+			now := time.Now().Format(time.RFC3339)
+			fullName := fullDNSName(info.Name)
+			description := fmt.Sprintf("Added via web UI on %s", time.Now().Format("2006-01-02"))
+			if source != "" && source != "ui" {
+				description = fmt.Sprintf("Added via %s on %s", source, time.Now().Format("2006-01-02"))
+			}
+			config.Servers = append(config.Servers, Server{
+				UniqueID:        generateServerID(fullName, info.IP),
+				Alias:           info.Alias,
+				Account:         info.Account,
+				Container:       info.Container,
+				Description:     description,
+				FirstSeenOn:     now,
+				LastActivatedOn: now,
+				Type:            "A",
+				Name:            fullName,
+				Content:         info.IP,
+				TTL:             info.TTL,
+				Proxied:         info.Proxied,
+				Comment:         info.Alias,
+				State:           "active",
+				StateChangedOn:  now,
+			})
+		}
+	}
+}
+
+func updateHandler(w http.ResponseWriter, r *http.Request) {
+	var req UpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	
+	cfClient := NewCloudflareClient(credentials)
+	operator := operatorFromRequest(r)
+	
+	if approvalRequired() {
+		response := submitChangeRequest(r.Context(), cfClient, req, operator)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	
+	runAsJob(w, r, "apply", func(ctx context.Context, progress func(UpdateDetail)) (bool, string, interface{}) {
+		return updateResult(applyUpdate(ctx, cfClient, req, ApplyOptions{Operator: operator, Source: "ui", Progress: progress, ClientID: clientFromRequest(r)}))
+	})
+}
+
+// Blast-radius guard
+
+// BlastRadiusError is returned when a plan removes more records than allowed
+type BlastRadiusError struct {
+	Violations []string
+}
+
+func (e *BlastRadiusError) Error() string {
+	return fmt.Sprintf("blast-radius guard: %s", strings.Join(e.Violations, "; "))
+}
+
+// checkBlastRadius lists the guard violations of a plan against the live records
+func checkBlastRadius(records []CloudflareRecord, plan UpdatePlan) []string {
+	var violations []string
+	removals := len(plan.Delete)
+	if removals == 0 {
+		return nil
+	}
+	
+	if *maxRemovals > 0 && removals > *maxRemovals {
+		violations = append(violations, fmt.Sprintf("%d records would be removed (limit %d)", removals, *maxRemovals))
+	}
+	if *maxRemovalPercent > 0 && len(records) > 0 {
+		percent := float64(removals) * 100 / float64(len(records))
+		if percent > *maxRemovalPercent {
+			violations = append(violations, fmt.Sprintf("%.0f%% of records would be removed (limit %.0f%%)", percent, *maxRemovalPercent))
+		}
+	}
+	
+	// Never leave a DNS name without any record
+	remaining := make(map[string]int)
+	for _, record := range records {
+		remaining[record.Name]++
+	}
+	for _, server := range plan.Create {
+		remaining[fullDNSName(server.Name)]++
+	}
+	emptied := make(map[string]bool)
+	for _, record := range plan.Delete {
+		remaining[record.Name]--
+		if remaining[record.Name] <= 0 {
+			emptied[record.Name] = true
+		}
+	}
+	var names []string
+	for name := range emptied {
+		// Canary names only exist while a new server is tried out
+		if strings.HasPrefix(shortDNSName(name), *canaryPrefix+".") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		violations = append(violations, fmt.Sprintf("%s would be left without any record", name))
+	}
+	
+	return violations
+}
+
+// enforceBlastRadius rejects plans violating the guards unless forced with a reason
+func enforceBlastRadius(records []CloudflareRecord, plan UpdatePlan, force bool, reason, operator string) error {
+	violations := checkBlastRadius(records, plan)
+	if len(violations) == 0 {
+		return nil
+	}
+	
+	guardErr := &BlastRadiusError{Violations: violations}
+	if !force || strings.TrimSpace(reason) == "" {
+		logger.Log("WARNING", fmt.Sprintf("Rejected update: %v", guardErr))
+		return guardErr
+	}
+	
+	logger.Log("WARNING", fmt.Sprintf("Blast-radius guard overridden by %s: %s (%v)", operator, reason, guardErr))
+	logger.Audit(AuditEntry{
+		Action:   "force_override",
+		Operator: operator,
+		Reason:   reason,
+		Success:  true,
+		Details:  violations,
+	})
+	return nil
+}
+
+// Change requests (two-person approval for production)
+
+// ChangeRequest is a production update waiting for a second operator's approval
+type ChangeRequest struct {
+	ID          string          `json:"id"`
+	Status      string          `json:"status"` // pending, applying, applied, rejected, expired, stale
+	RequestedBy string          `json:"requested_by"`
+	CreatedAt   time.Time       `json:"created_at"`
+	ExpiresAt   time.Time       `json:"expires_at"`
+	Request     UpdateRequest   `json:"request"`
+	Plan        []string        `json:"plan"`
+	Fingerprint string          `json:"fingerprint"` // Live record set the plan was computed against
+	DecidedBy   string          `json:"decided_by,omitempty"`
+	DecidedAt   *time.Time      `json:"decided_at,omitempty"`
+	Reason      string          `json:"reason,omitempty"`
+	Result      *UpdateResponse `json:"result,omitempty"`
+	
+	// Requests to other endpoints are stored as they were sent and replayed
+	// through the endpoint's handler once approved
+	Action       string          `json:"action,omitempty"` // Endpoint path; empty for updates
+	Params       json.RawMessage `json:"params,omitempty"`
+	ActionResult json.RawMessage `json:"action_result,omitempty"`
+}
+
+var changesMutex sync.Mutex
+
+// approvalRequired reports whether updates must go through a change request
+func approvalRequired() bool {
+	return *environment == "production" && *requireApproval
+}
+
+func changeRequestsFile(env string) string {
+	return fmt.Sprintf("changes.%s.json", env)
+}
+
+// loadChangeRequests reads all change requests and marks overdue ones as expired.
+// Callers must hold changesMutex.
+func loadChangeRequests(env string) ([]ChangeRequest, error) {
+	data, err := os.ReadFile(changeRequestsFile(env))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []ChangeRequest{}, nil
+		}
+		return nil, err
+	}
+	
+	var changes []ChangeRequest
+	if err := json.Unmarshal(data, &changes); err != nil {
+		return nil, err
+	}
+	
+	now := time.Now()
+	expired := false
+	for i := range changes {
+		if changes[i].Status == "pending" && now.After(changes[i].ExpiresAt) {
+			changes[i].Status = "expired"
+			changes[i].DecidedAt = &now
+			expired = true
+			logger.Log("INFO", fmt.Sprintf("Change request %s expired without approval", changes[i].ID))
+			logger.Audit(AuditEntry{
+				Action:   "change_expired",
+				Operator: changes[i].RequestedBy,
+				ChangeID: changes[i].ID,
+				Details:  changes[i].Plan,
+			})
+		}
+	}
+	if expired {
+		if err := saveChangeRequests(env, changes); err != nil {
+			logger.Log("WARNING", fmt.Sprintf("Failed to save expired change requests: %v", err))
+		}
+	}
+	
+	return changes, nil
+}
+
+// saveChangeRequests persists change requests, keeping decided ones for a week.
+// Callers must hold changesMutex.
+func saveChangeRequests(env string, changes []ChangeRequest) error {
+	cutoff := time.Now().Add(-7 * 24 * time.Hour)
+	kept := []ChangeRequest{}
+	for _, change := range changes {
+		if change.Status != "pending" && change.DecidedAt != nil && change.DecidedAt.Before(cutoff) {
+			continue
+		}
+		kept = append(kept, change)
+	}
+	
+	data, err := json.MarshalIndent(kept, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(changeRequestsFile(env), data, 0644)
+}
+
+// submitChangeRequest stores the plan for the requested active set as a pending
+// change request instead of applying it
+func submitChangeRequest(ctx context.Context, cfClient *CloudflareClient, req UpdateRequest, operator string) UpdateResponse {
+	response := UpdateResponse{Success: true}
+	
+	if operator == "" {
+		response.Success = false
+		response.Message = operatorRequiredMessage()
+		return response
+	}
+	
+	records, err := cfClient.GetDNSRecords(ctx)
+	if err != nil {
+		response.Success = false
+		response.Message = fmt.Sprintf("Failed to fetch current records: %v", err)
+		return response
+	}
+	
+	plan := planUpdate(records, req)
+	if plan.IsEmpty() {
+		response.Message = "No changes required"
+		return response
+	}
+	
+	config, err := loadServerConfig(*environment)
+	if err != nil {
+		logger.Log("WARNING", fmt.Sprintf("Failed to load config for freeze check: %v", err))
+	}
+	if err := checkActivations(config, plan); err != nil {
+		response.Success = false
+		response.Message = err.Error()
+		return response
+	}
+	if err := enforceFreeze(config, planFreezeTargets(config, plan), req.BreakGlassReason, operator, "change request"); err != nil {
+		response.Success = false
+		response.Frozen = true
+		response.Message = err.Error()
+		return response
+	}
+	
+	// Check the guard up front; the override is audited again when the change is applied
+	if violations := checkBlastRadius(records, plan); len(violations) > 0 && (!req.Force || strings.TrimSpace(req.ForceReason) == "") {
+		response.Success = false
+		response.Guarded = true
+		response.Message = (&BlastRadiusError{Violations: violations}).Error()
+		return response
+	}
+	
+	now := time.Now()
+	change := ChangeRequest{
+		ID:          randomID(6),
+		Status:      "pending",
+		RequestedBy: operator,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(*approvalTTL),
+		Request:     req,
+		Plan:        plan.Describe(),
+		Fingerprint: recordsFingerprint(records),
+	}
+	
+	changesMutex.Lock()
+	defer changesMutex.Unlock()
+	
+	changes, err := loadChangeRequests(*environment)
+	if err != nil {
+		response.Success = false
+		response.Message = fmt.Sprintf("Failed to load change requests: %v", err)
+		return response
+	}
+	changes = append(changes, change)
+	if err := saveChangeRequests(*environment, changes); err != nil {
+		response.Success = false
+		response.Message = fmt.Sprintf("Failed to save change request: %v", err)
+		return response
+	}
+	
+	logger.Log("INFO", fmt.Sprintf("Change request %s submitted by %s (%d operations)", change.ID, operator, len(change.Plan)))
+	logger.Audit(AuditEntry{
+		Action:   "change_requested",
+		Operator: operator,
+		ChangeID: change.ID,
+		Source:   "ui",
+		Success:  true,
+		Details:  change.Plan,
+	})
+	
+	response.Pending = true
+	response.ChangeID = change.ID
+	response.Message = fmt.Sprintf("Change request %s submitted, waiting for approval by another operator", change.ID)
+	for _, line := range change.Plan {
+		response.Details = append(response.Details, UpdateDetail{Message: "Pending: " + line, Status: "info"})
+	}
+	return response
+}
+
+// ApprovalOverrides are the overrides an approver adds when applying a change
+type ApprovalOverrides struct {
+	BreakGlassReason string `json:"break_glass_reason"`
+	Force            bool   `json:"force"`
+	ForceReason      string `json:"force_reason"`
+}
+
+// decideChangeRequest approves (and applies) or rejects a pending change request
+func decideChangeRequest(ctx context.Context, id, operator string, approve bool, reason string, overrides ApprovalOverrides, progress func(UpdateDetail)) (*ChangeRequest, error) {
+	// Claim the request under the lock; the apply itself runs without it, so
+	// listings do not wait for Cloudflare
+	change, err := updateChangeRequest(id, func(change *ChangeRequest) error {
+		if change.Status != "pending" {
+			return fmt.Errorf("change request %s is %s", id, change.Status)
+		}
+		if approve && strings.EqualFold(change.RequestedBy, operator) {
+			return fmt.Errorf("change request %s must be approved by a different operator than %s", id, change.RequestedBy)
+		}
+		
+		now := time.Now()
+		change.DecidedBy = operator
+		change.DecidedAt = &now
+		change.Reason = reason
+		change.Status = "applying"
+		if !approve {
+			change.Status = "rejected"
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	
+	if !approve {
+		logger.Log("INFO", fmt.Sprintf("Change request %s rejected by %s", id, operator))
+		logger.Audit(AuditEntry{
+			Action:   "change_rejected",
+			Operator: change.RequestedBy,
+			Approver: operator,
+			ChangeID: id,
+			Reason:   reason,
+			Success:  true,
+			Details:  change.Plan,
+		})
+		return change, nil
+	}
+	
+	if change.Action != "" {
+		err = replayChangeRequest(ctx, change, operator, overrides)
+	} else {
+		err = applyChangeRequest(ctx, change, operator, overrides, progress)
+	}
+	if err != nil {
+		// Nothing was changed, so the request can be decided again
+		if _, resetErr := updateChangeRequest(id, func(change *ChangeRequest) error {
+			change.Status = "pending"
+			change.DecidedBy = ""
+			change.DecidedAt = nil
+			change.Reason = ""
+			return nil
+		}); resetErr != nil {
+			logger.Log("ERROR", fmt.Sprintf("Failed to reopen change request %s: %v", id, resetErr))
+		}
+		return nil, err
+	}
+	
+	decided := *change
+	return updateChangeRequest(id, func(change *ChangeRequest) error {
+		change.Status = decided.Status
+		change.Request = decided.Request
+		change.Result = decided.Result
+		change.ActionResult = decided.ActionResult
+		return nil
+	})
+}
+
+// applyChangeRequest applies an approved update that has been claimed as
+// applying and records the outcome in change; an error means nothing was changed
+func applyChangeRequest(ctx context.Context, change *ChangeRequest, operator string, overrides ApprovalOverrides, progress func(UpdateDetail)) error {
+	cfClient := NewCloudflareClient(credentials)
+	
+	// Refuse to apply a plan that was computed against a different zone state
+	records, err := cfClient.GetDNSRecords(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch current records: %v", err)
+	}
+	// Freeze windows may have started since the change was requested
+	if strings.TrimSpace(overrides.BreakGlassReason) == "" {
+		config, _ := loadServerConfig(*environment)
+		plan := planUpdate(records, change.Request)
+		if err := enforceFreeze(config, planFreezeTargets(config, plan), "", operator, "approval of change request "+change.ID); err != nil {
+			return err
+		}
+	} else {
+		change.Request.BreakGlassReason = overrides.BreakGlassReason
+	}
+	if overrides.Force {
+		change.Request.Force = true
+		change.Request.ForceReason = overrides.ForceReason
+	}
+	
+	if recordsFingerprint(records) != change.Fingerprint {
+		logger.Log("WARNING", fmt.Sprintf("Change request %s is stale: DNS records changed since it was submitted", change.ID))
+		logger.Audit(AuditEntry{
+			Action:   "change_stale",
+			Operator: change.RequestedBy,
+			Approver: operator,
+			ChangeID: change.ID,
+			Details:  change.Plan,
+		})
+		change.Status = "stale"
+		return nil
+	}
+	
+	logger.Log("INFO", fmt.Sprintf("Change request %s approved by %s, applying", change.ID, operator))
+	result := applyUpdate(ctx, cfClient, change.Request, ApplyOptions{
+		Operator: change.RequestedBy,
+		Approver: operator,
+		ChangeID: change.ID,
+		Source:   "approval",
+		Progress: progress,
+	})
+	change.Status = "applied"
+	change.Result = &result
+	return nil
+}
+
+// updateChangeRequest modifies one change request under changesMutex and
+// returns a copy of the result
+func updateChangeRequest(id string, modify func(change *ChangeRequest) error) (*ChangeRequest, error) {
+	changesMutex.Lock()
+	defer changesMutex.Unlock()
+	
+	changes, err := loadChangeRequests(*environment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load change requests: %v", err)
+	}
+	
+	for i := range changes {
+		if changes[i].ID != id {
+			continue
+		}
+		if err := modify(&changes[i]); err != nil {
+			return nil, err
+		}
+		if err := saveChangeRequests(*environment, changes); err != nil {
+			logger.Log("ERROR", fmt.Sprintf("Failed to save change requests: %v", err))
+		}
+		updated := changes[i]
+		return &updated, nil
+	}
+	return nil, fmt.Errorf("change request %s not found", id)
+}
+
+// Approval of other changes
+
+// gatedActions holds the handlers behind approvalGate, keyed by endpoint path
+var gatedActions = make(map[string]http.HandlerFunc)
+
+// approvedChangeKey is the context key of a change request being replayed
+type approvedChangeKey struct{}
+
+// approvalGate stores requests to a mutating endpoint as pending change
+// requests while approvals are required. The approval replays the stored
+// request through handler on behalf of the requester.
+func approvalGate(path string, handler http.HandlerFunc) http.HandlerFunc {
+	gatedActions[path] = handler
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !approvalRequired() {
+			handler(w, r)
+			return
+		}
+		
+		operator := operatorFromRequest(r)
+		if operator == "" {
+			writeAPIError(w, http.StatusForbidden, operatorRequiredMessage())
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil || !json.Valid(body) {
+			writeAPIError(w, http.StatusBadRequest, "Invalid request")
+			return
+		}
+		
+		change, err := submitActionRequest(path, body, operator)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":   true,
+			"pending":   true,
+			"change_id": change.ID,
+			"message":   fmt.Sprintf("Change request %s submitted, waiting for approval by another operator", change.ID),
+		})
+	}
+}
+
+// submitActionRequest stores a request to a gated endpoint as a pending change request
+func submitActionRequest(path string, body []byte, operator string) (*ChangeRequest, error) {
+	now := time.Now()
+	change := ChangeRequest{
+		ID:          randomID(6),
+		Status:      "pending",
+		RequestedBy: operator,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(*approvalTTL),
+		Plan:        describeAction(path, body),
+		Action:      path,
+		Params:      body,
+	}
+	
+	changesMutex.Lock()
+	defer changesMutex.Unlock()
+	
+	changes, err := loadChangeRequests(*environment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load change requests: %v", err)
+	}
+	changes = append(changes, change)
+	if err := saveChangeRequests(*environment, changes); err != nil {
+		return nil, fmt.Errorf("failed to save change request: %v", err)
+	}
+	
+	logger.Log("INFO", fmt.Sprintf("Change request %s submitted by %s (%s)", change.ID, operator, path))
+	logger.Audit(AuditEntry{
+		Action:   "change_requested",
+		Operator: operator,
+		ChangeID: change.ID,
+		Source:   "ui",
+		Success:  true,
+		Details:  change.Plan,
+	})
+	return &change, nil
+}
+
+// describeAction summarizes a gated request for the approval panel
+func describeAction(path string, body []byte) []string {
+	var fields map[string]interface{}
+	json.Unmarshal(body, &fields)
+	
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	
+	var parts []string
+	for _, key := range keys {
+		value := fmt.Sprintf("%v", fields[key])
+		if value == "" || value == "false" || value == "<nil>" {
+			continue
+		}
+		parts = append(parts, key+"="+value)
+	}
+	
+	line := "POST " + path
+	if id, ok := fields["unique_id"].(string); ok && id != "" {
+		if config, err := loadServerConfig(*environment); err == nil && config != nil {
+			for _, server := range config.Servers {
+				if server.UniqueID == id {
+					line += fmt.Sprintf(" for %s (%s)", server.Alias, server.Content)
+					break
+				}
+			}
+		}
+	}
+	if len(parts) > 0 {
+		line += ": " + strings.Join(parts, ", ")
+	}
+	return []string{line}
+}
+
+// ReplayError is returned when the handler refused an approved request;
+// nothing was changed
+type ReplayError struct {
+	Result map[string]interface{}
+}
+
+func (e *ReplayError) Error() string {
+	if message, ok := e.Result["message"].(string); ok && message != "" {
+		return message
+	}
+	return "request refused"
+}
+
+// replayRecorder captures the response of a replayed request
+type replayRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *replayRecorder) Header() http.Header { return rec.header }
+
+func (rec *replayRecorder) Write(data []byte) (int, error) { return rec.body.Write(data) }
+
+func (rec *replayRecorder) WriteHeader(status int) { rec.status = status }
+
+// replayChangeRequest sends an approved request to its endpoint's handler,
+// waiting for jobs, and records the response in change
+func replayChangeRequest(ctx context.Context, change *ChangeRequest, operator string, overrides ApprovalOverrides) error {
+	handler := gatedActions[change.Action]
+	if handler == nil {
+		return fmt.Errorf("change request %s targets unknown endpoint %s", change.ID, change.Action)
+	}
+	
+	// Overrides of the approver are added to the stored request
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(change.Params, &fields); err != nil || fields == nil {
+		fields = make(map[string]json.RawMessage)
+	}
+	if reason := strings.TrimSpace(overrides.BreakGlassReason); reason != "" {
+		fields["break_glass_reason"], _ = json.Marshal(reason)
+	}
+	if overrides.Force {
+		fields["force"] = json.RawMessage("true")
+		fields["force_reason"], _ = json.Marshal(overrides.ForceReason)
+	}
+	body, _ := json.Marshal(fields)
+	
+	req, err := http.NewRequestWithContext(context.WithValue(ctx, approvedChangeKey{}, change), http.MethodPost, change.Action+"?wait=1", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	
+	logger.Log("INFO", fmt.Sprintf("Change request %s approved by %s, replaying %s", change.ID, operator, change.Action))
+	rec := &replayRecorder{header: make(http.Header), status: http.StatusOK}
+	handler(rec, req)
+	
+	var result map[string]interface{}
+	json.Unmarshal(rec.body.Bytes(), &result)
+	if result == nil {
+		result = map[string]interface{}{"success": false, "message": strings.TrimSpace(rec.body.String())}
+	}
+	success, _ := result["success"].(bool)
+	if !success && (rec.status >= 400 || result["frozen"] == true || result["guarded"] == true) {
+		return &ReplayError{Result: result}
+	}
+	
+	details := append([]string{}, change.Plan...)
+	if message, _ := result["message"].(string); message != "" {
+		details = append(details, message)
+	}
+	logger.Audit(AuditEntry{
+		Action:   "change_applied",
+		Operator: change.RequestedBy,
+		Approver: operator,
+		ChangeID: change.ID,
+		Source:   "approval",
+		Success:  success,
+		Details:  details,
+	})
+	change.Status = "applied"
+	change.ActionResult = json.RawMessage(rec.body.Bytes())
+	return nil
+}
+
+// pendingChanges returns the change requests still waiting for approval
+func pendingChanges() []ChangeRequest {
+	changesMutex.Lock()
+	defer changesMutex.Unlock()
+	
+	changes, err := loadChangeRequests(*environment)
+	if err != nil {
+		logger.Log("WARNING", fmt.Sprintf("Failed to load change requests: %v", err))
+		return nil
+	}
+	
+	var pending []ChangeRequest
+	for _, change := range changes {
+		if change.Status == "pending" {
+			pending = append(pending, change)
+		}
+	}
+	return pending
+}
+
+// changesHandler lists change requests
+func changesHandler(w http.ResponseWriter, r *http.Request) {
+	changesMutex.Lock()
+	changes, err := loadChangeRequests(*environment)
+	changesMutex.Unlock()
+	
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to load change requests: %v", err))
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"changes": changes,
+	})
+}
+
+// decideChangeHandler returns a handler approving or rejecting a change request
+func decideChangeHandler(approve bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     string `json:"id"`
+			Reason string `json:"reason"`
+			ApprovalOverrides
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" {
+			writeAPIError(w, http.StatusBadRequest, "Change request ID is required")
+			return
+		}
+		
+		operator := operatorFromRequest(r)
+		if operator == "" {
+			writeAPIError(w, http.StatusBadRequest, operatorRequiredMessage())
+			return
+		}
+		
+		// An approval applies the change, so it runs as a job
+		if approve {
+			runAsJob(w, r, "approval", func(ctx context.Context, progress func(UpdateDetail)) (bool, string, interface{}) {
+				change, err := decideChangeRequest(ctx, req.ID, operator, true, req.Reason, req.ApprovalOverrides, progress)
+				if err != nil {
+					var replayErr *ReplayError
+					if errors.As(err, &replayErr) {
+						return false, err.Error(), replayErr.Result
+					}
+					result := map[string]interface{}{"success": false, "message": err.Error(), "error": err.Error()}
+					var freezeErr *FreezeError
+					if errors.As(err, &freezeErr) {
+						result["frozen"] = true
+					}
+					return false, err.Error(), result
+				}
+				return changeDecisionResult(change)
+			})
+			return
+		}
+		
+		change, err := decideChangeRequest(r.Context(), req.ID, operator, false, req.Reason, ApprovalOverrides{}, nil)
+		if err != nil {
+			writeAPIError(w, http.StatusConflict, err.Error())
+			return
+		}
+		
+		_, _, result := changeDecisionResult(change)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// changeDecisionResult builds the response to an approved or rejected change request
+func changeDecisionResult(change *ChangeRequest) (bool, string, interface{}) {
+	message := fmt.Sprintf("Change request %s %s", change.ID, change.Status)
+	if change.Status == "stale" {
+		message = fmt.Sprintf("Change request %s is stale because DNS records changed since it was submitted; please resubmit", change.ID)
+	}
+	success := change.Status != "stale" && (change.Result == nil || change.Result.Success)
+	if len(change.ActionResult) > 0 {
+		var outcome struct {
+			Success bool   `json:"success"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(change.ActionResult, &outcome) == nil {
+			success = success && outcome.Success
+			if outcome.Message != "" {
+				message += ": " + outcome.Message
+			}
+		}
+	}
+	return success, message, map[string]interface{}{
+		"success": success,
+		"message": message,
+		"change":  change,
+	}
+}
+
+// Cron expressions
+
+// cronSchedule is a parsed five-field cron expression (minute hour day-of-month month day-of-week)
+type cronSchedule struct {
+	minutes  [60]bool
+	hours    [24]bool
+	days     [32]bool
+	months   [13]bool
+	weekdays [7]bool
+	anyDay   bool // day-of-month field was "*"
+	anyWeek  bool // day-of-week field was "*"
+}
+
+var cronMacros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// parseCron parses a cron expression such as "*/15 8-18 * * 1-5"
+func parseCron(expr string) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[expr]; ok {
+		expr = macro
+	}
+	
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields", expr)
+	}
+	
+	sched := &cronSchedule{
+		anyDay:  fields[2] == "*",
+		anyWeek: fields[4] == "*",
+	}
+	if err := parseCronField(fields[0], 0, 59, sched.minutes[:]); err != nil {
+		return nil, fmt.Errorf("minute: %v", err)
+	}
+	if err := parseCronField(fields[1], 0, 23, sched.hours[:]); err != nil {
+		return nil, fmt.Errorf("hour: %v", err)
+	}
+	if err := parseCronField(fields[2], 1, 31, sched.days[:]); err != nil {
+		return nil, fmt.Errorf("day of month: %v", err)
+	}
+	if err := parseCronField(fields[3], 1, 12, sched.months[:]); err != nil {
+		return nil, fmt.Errorf("month: %v", err)
+	}
+	var weekdays [8]bool
+	if err := parseCronField(fields[4], 0, 7, weekdays[:]); err != nil {
+		return nil, fmt.Errorf("day of week: %v", err)
+	}
+	copy(sched.weekdays[:], weekdays[:7])
+	if weekdays[7] {
+		sched.weekdays[0] = true // 7 is an alias for Sunday
+	}
+	
+	return sched, nil
+}
+
+// parseCronField marks all values matched by one comma-separated cron field
+func parseCronField(field string, min, max int, set []bool) error {
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			if _, err := fmt.Sscanf(part[i+1:], "%d", &step); err != nil || step <= 0 {
+				return fmt.Errorf("invalid step in %q", part)
+			}
+			part = part[:i]
+		}
+		
+		lo, hi := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			if _, err := fmt.Sscanf(part, "%d-%d", &lo, &hi); err != nil {
+				return fmt.Errorf("invalid range %q", part)
+			}
+		default:
+			if _, err := fmt.Sscanf(part, "%d", &lo); err != nil {
+				return fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if step > 1 {
+				hi = max
+			}
+		}
+		
+		if lo < min || hi > max || lo > hi {
+			return fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return nil
+}
+
+// dayMatches applies the usual cron rule: if both day fields are restricted,
+// either of them matching is enough
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	day := c.days[t.Day()]
+	week := c.weekdays[int(t.Weekday())]
+	switch {
+	case c.anyDay && c.anyWeek:
+		return true
+	case c.anyDay:
+		return week
+	case c.anyWeek:
+		return day
+	default:
+		return day || week
+	}
+}
+
+// Matches reports whether the schedule fires in the minute containing t
+func (c *cronSchedule) Matches(t time.Time) bool {
+	return c.minutes[t.Minute()] && c.hours[t.Hour()] && c.months[int(t.Month())] && c.dayMatches(t)
+}
+
+// Next returns the first time strictly after t at which the schedule fires
+func (c *cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if !c.months[int(t.Month())] || !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.hours[t.Hour()] {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if c.minutes[t.Minute()] {
+			return t
+		}
+		t = t.Add(time.Minute)
+	}
+	return time.Time{}
+}
+
+// Freeze windows
+
+// FreezeWindow blocks DNS changes during a one-off period or a recurring
+// cron-defined period, optionally only for some accounts/containers
+type FreezeWindow struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Start      *time.Time `json:"start,omitempty"`    // One-off window start
+	End        *time.Time `json:"end,omitempty"`      // One-off window end
+	Cron       string     `json:"cron,omitempty"`     // Recurring window start, e.g. "55 23 * * *"
+	Duration   string     `json:"duration,omitempty"` // Length of a recurring window, e.g. "30m"
+	Accounts   []string   `json:"accounts,omitempty"`   // Limit to these accounts (empty = all)
+	Containers []string   `json:"containers,omitempty"` // Limit to these containers (empty = all)
+	CreatedBy  string     `json:"created_by,omitempty"`
+}
+
+// maxFreezeDuration bounds recurring windows so activity checks stay cheap
+const maxFreezeDuration = 7 * 24 * time.Hour
+
+// Validate checks that the window is either a valid one-off or recurring window
+func (fw *FreezeWindow) Validate() error {
+	if fw.Cron != "" {
+		if _, err := parseCron(fw.Cron); err != nil {
+			return err
+		}
+		duration, err := time.ParseDuration(fw.Duration)
+		if err != nil || duration <= 0 {
+			return fmt.Errorf("recurring freeze windows need a positive duration")
+		}
+		if duration > maxFreezeDuration {
+			return fmt.Errorf("freeze window duration must not exceed %v", maxFreezeDuration)
+		}
+		return nil
+	}
+	if fw.Start == nil || fw.End == nil {
+		return fmt.Errorf("freeze window needs either start and end or cron and duration")
+	}
+	if !fw.End.After(*fw.Start) {
+		return fmt.Errorf("freeze window end must be after start")
+	}
+	return nil
+}
+
+// IsActive reports whether the window is in effect at the given time
+func (fw *FreezeWindow) IsActive(now time.Time) bool {
+	if fw.Cron == "" {
+		return fw.Start != nil && fw.End != nil && !now.Before(*fw.Start) && now.Before(*fw.End)
+	}
+	
+	sched, err := parseCron(fw.Cron)
+	if err != nil {
+		return false
+	}
+	duration, err := time.ParseDuration(fw.Duration)
+	if err != nil || duration <= 0 || duration > maxFreezeDuration {
+		return false
+	}
+	
+	// Look for a start time within the last <duration>
+	start := now.Truncate(time.Minute)
+	for t := start; now.Sub(t) < duration; t = t.Add(-time.Minute) {
+		if sched.Matches(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers reports whether a server with the given tags is affected by the window
+func (fw *FreezeWindow) Covers(account, container string) bool {
+	if len(fw.Accounts) == 0 && len(fw.Containers) == 0 {
+		return true
+	}
+	for _, a := range fw.Accounts {
+		if a == account {
+			return true
+		}
+	}
+	for _, c := range fw.Containers {
+		if c == container {
+			return true
+		}
+	}
+	return false
+}
+
+// Describe returns a short human readable summary of the window
+func (fw *FreezeWindow) Describe() string {
+	var when string
+	if fw.Cron != "" {
+		when = fmt.Sprintf("cron %q for %s", fw.Cron, fw.Duration)
+	} else if fw.Start != nil && fw.End != nil {
+		when = fmt.Sprintf("%s - %s", fw.Start.Format("2006-01-02 15:04"), fw.End.Format("2006-01-02 15:04"))
+	}
+	scope := "all servers"
+	if len(fw.Accounts) > 0 || len(fw.Containers) > 0 {
+		scope = strings.Join(append(append([]string{}, fw.Accounts...), fw.Containers...), ", ")
+	}
+	return fmt.Sprintf("%s (%s, %s)", fw.Name, when, scope)
+}
+
+// freezeTarget is a server affected by a change, identified by its tags
+type freezeTarget struct {
+	Account   string
+	Container string
+}
+
+// FreezeError is returned when a change is blocked by a freeze window
+type FreezeError struct {
+	Windows []FreezeWindow
+}
+
+func (e *FreezeError) Error() string {
+	var names []string
+	for _, fw := range e.Windows {
+		names = append(names, fw.Describe())
+	}
+	return fmt.Sprintf("changes are frozen: %s", strings.Join(names, "; "))
+}
+
+// enforceFreeze blocks changes to the given targets during active freeze windows,
+// unless a break-glass reason is provided
+func enforceFreeze(config *ServerConfig, targets []freezeTarget, breakGlassReason, operator, action string) error {
+	if config == nil || len(targets) == 0 {
+		return nil
+	}
+	
+	now := time.Now()
+	var blocking []FreezeWindow
+	for _, fw := range config.FreezeWindows {
+		if !fw.IsActive(now) {
+			continue
+		}
+		for _, target := range targets {
+			if fw.Covers(target.Account, target.Container) {
+				blocking = append(blocking, fw)
+				break
+			}
+		}
+	}
+	if len(blocking) == 0 {
+		return nil
+	}
+	
+	freezeErr := &FreezeError{Windows: blocking}
+	if strings.TrimSpace(breakGlassReason) == "" {
+		logger.Log("WARNING", fmt.Sprintf("Rejected %s: %v", action, freezeErr))
+		return freezeErr
+	}
+	
+	logger.Log("WARNING", fmt.Sprintf("Break-glass override by %s for %s during freeze: %s", operator, action, breakGlassReason))
+	logger.Audit(AuditEntry{
+		Action:   "break_glass",
+		Operator: operator,
+		Reason:   breakGlassReason,
+		Success:  true,
+		Details:  []string{action, freezeErr.Error()},
+	})
+	return nil
+}
+
+// serverTags looks up account and container of a configured server
+func serverTags(config *ServerConfig, fullName, ip string) freezeTarget {
+	if config != nil {
+		for _, server := range config.Servers {
+			if server.Name == fullName && server.Content == ip {
+				return freezeTarget{Account: server.Account, Container: server.Container}
+			}
+		}
+	}
+	return freezeTarget{}
+}
+
+// planFreezeTargets lists the tags of all servers touched by a plan
+func planFreezeTargets(config *ServerConfig, plan UpdatePlan) []freezeTarget {
+	var targets []freezeTarget
+	for _, server := range plan.Create {
+		target := serverTags(config, fullDNSName(server.Name), server.IP)
+		if server.Account != "" {
+			target.Account = server.Account
+		}
+		if server.Container != "" {
+			target.Container = server.Container
+		}
+		targets = append(targets, target)
+	}
+	for _, record := range plan.Delete {
+		targets = append(targets, serverTags(config, record.Name, record.Content))
+	}
+	for _, patch := range plan.Patch {
+		targets = append(targets, serverTags(config, patch.Name, patch.IP))
+	}
+	return targets
+}
+
+// writeFrozenError reports a change rejected by a freeze window
+func writeFrozenError(w http.ResponseWriter, err *FreezeError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusLocked)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"frozen":  true,
+		"message": err.Error(),
+		"error":   err.Error(),
+	})
+}
+
+// writeChangeError reports a rejected change, flagging freeze windows and the
+// blast-radius guard so clients can offer the matching override
+func writeChangeError(w http.ResponseWriter, err error) {
+	var freezeErr *FreezeError
+	var guardErr *BlastRadiusError
+	switch {
+	case errors.As(err, &freezeErr):
+		writeFrozenError(w, freezeErr)
+	case errors.As(err, &guardErr):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"guarded": true,
+			"message": err.Error(),
+			"error":   err.Error(),
+		})
+	default:
+		writeAPIError(w, http.StatusConflict, err.Error())
+	}
+}
+
+// freezeHandler lists freeze windows and whether they are currently active
+func freezeHandler(w http.ResponseWriter, r *http.Request) {
+	config, err := loadServerConfig(*environment)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to load configuration: %v", err))
+		return
+	}
+	
+	type windowStatus struct {
+		FreezeWindow
+		Active bool `json:"active"`
+	}
+	windows := []windowStatus{}
+	if config != nil {
+		now := time.Now()
+		for _, fw := range config.FreezeWindows {
+			windows = append(windows, windowStatus{FreezeWindow: fw, Active: fw.IsActive(now)})
+		}
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"windows": windows,
+	})
+}
+
+// addFreezeHandler defines a new freeze window
+func addFreezeHandler(w http.ResponseWriter, r *http.Request) {
+	operator := operatorFromRequest(r)
+	if !isAdmin(operator) {
+		writeAPIError(w, http.StatusForbidden, adminRequiredMessage())
+		return
+	}
+	
+	var fw FreezeWindow
+	if err := json.NewDecoder(r.Body).Decode(&fw); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	
+	fw.Name = strings.TrimSpace(fw.Name)
+	if fw.Name == "" {
+		writeAPIError(w, http.StatusBadRequest, "Freeze window name is required")
+		return
+	}
+	if err := fw.Validate(); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	fw.ID = randomID(4)
+	fw.CreatedBy = operator
+	
+	if err := updateServerConfig(r.Context(), func(config *ServerConfig) error {
+		config.FreezeWindows = append(config.FreezeWindows, fw)
+		return nil
+	}); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save configuration: %v", err))
+		return
+	}
+	
+	logger.Log("INFO", fmt.Sprintf("Added freeze window %s", fw.Describe()))
+	logger.Audit(AuditEntry{Action: "freeze_added", Operator: fw.CreatedBy, Success: true, Details: []string{fw.Describe()}})
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("Freeze window %s added", fw.Name),
+		"window":  fw,
+	})
+}
+
+// isAdmin reports whether operator is listed in -admins
+func isAdmin(operator string) bool {
+	if operator == "" {
+		return false
+	}
+	for _, name := range strings.Split(*adminNames, ",") {
+		if strings.TrimSpace(name) == operator {
+			return true
+		}
+	}
+	return false
+}
+
+// adminRequiredMessage explains who may change freeze windows
+func adminRequiredMessage() string {
+	if strings.TrimSpace(*adminNames) == "" {
+		return "Freeze windows can only be changed by admins, and none are configured (see -admins)"
+	}
+	return "Only admins may add or remove freeze windows (see -admins)"
+}
+
+// deleteFreezeHandler removes a freeze window. Removing a window that is
+// active lifts the freeze, so it needs a break-glass reason.
+func deleteFreezeHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID               string `json:"id"`
+		BreakGlassReason string `json:"break_glass_reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" {
+		writeAPIError(w, http.StatusBadRequest, "Freeze window ID is required")
+		return
+	}
+	
+	operator := operatorFromRequest(r)
+	if !isAdmin(operator) {
+		writeAPIError(w, http.StatusForbidden, adminRequiredMessage())
+		return
+	}
+	var removed *FreezeWindow
+	err := updateServerConfig(r.Context(), func(config *ServerConfig) error {
+		for i, fw := range config.FreezeWindows {
+			if fw.ID != req.ID {
+				continue
+			}
+			if fw.IsActive(time.Now()) {
+				freezeErr := &FreezeError{Windows: []FreezeWindow{fw}}
+				if strings.TrimSpace(req.BreakGlassReason) == "" {
+					logger.Log("WARNING", fmt.Sprintf("Rejected removal of active freeze window by %s: %v", operator, freezeErr))
+					return freezeErr
+				}
+				logger.Log("WARNING", fmt.Sprintf("Break-glass removal of active freeze window by %s: %s", operator, req.BreakGlassReason))
+				logger.Audit(AuditEntry{
+					Action:   "break_glass",
+					Operator: operator,
+					Reason:   req.BreakGlassReason,
+					Success:  true,
+					Details:  []string{"remove freeze window", freezeErr.Error()},
+				})
+			}
+			removed = &fw
+			config.FreezeWindows = append(config.FreezeWindows[:i], config.FreezeWindows[i+1:]...)
+			return nil
+		}
+		return fmt.Errorf("freeze window not found")
+	})
+	var freezeErr *FreezeError
+	switch {
+	case errors.As(err, &freezeErr):
+		writeFrozenError(w, freezeErr)
+		return
+	case removed == nil:
+		writeAPIError(w, http.StatusNotFound, "Freeze window not found")
+		return
+	case err != nil:
+		writeAPIError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save configuration: %v", err))
+		return
+	}
+	
+	logger.Log("INFO", fmt.Sprintf("Removed freeze window %s", removed.Describe()))
+	logger.Audit(AuditEntry{Action: "freeze_removed", Operator: operator, Reason: req.BreakGlassReason, Success: true, Details: []string{removed.Describe()}})
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("Freeze window %s removed", removed.Name),
+	})
+}
+
+// Active set helpers
+
+// activeServerFromConfig converts a configured server into an entry of the active set
+func activeServerFromConfig(server Server) ActiveServer {
+	ttl := server.TTL
+	if ttl <= 0 {
+		ttl = 60
+	}
+	return ActiveServer{
+		IP:        server.Content,
+		Name:      strings.TrimSuffix(server.Name, "."+credentials.Domain),
+		Alias:     server.Alias,
+		Account:   server.Account,
+		Container: server.Container,
+		Proxied:   server.Proxied,
+		TTL:       ttl,
+		Active:    true,
+	}
+}
+
+// currentActiveSet converts the live records into an active set, enriched with
+// the tags from the configuration
+func currentActiveSet(config *ServerConfig, records []CloudflareRecord) []ActiveServer {
+	var set []ActiveServer
+	for _, record := range records {
+		entry := ActiveServer{
+			IP:      record.Content,
+			Name:    strings.TrimSuffix(record.Name, "."+credentials.Domain),
+			Alias:   record.Alias(),
+			Proxied: record.Proxied,
+			TTL:     record.TTL,
+			Active:  true,
+		}
+		if config != nil {
+			for _, server := range config.Servers {
+				if server.Name == record.Name && server.Content == record.Content {
+					entry.Account = server.Account
+					entry.Container = server.Container
+					if server.Alias != "" {
+						entry.Alias = server.Alias
+					}
+					break
+				}
+			}
+		}
+		set = append(set, entry)
+	}
+	return set
+}
+
+// applyServerChange activates or deactivates the given servers on top of the
+// live state, leaving all other records untouched
+func applyServerChange(ctx context.Context, cfClient *CloudflareClient, servers []Server, activate bool, opts ApplyOptions) UpdateResponse {
+	records, err := cfClient.GetDNSRecords(ctx)
+	if err != nil {
+		return UpdateResponse{Success: false, Message: fmt.Sprintf("Failed to fetch current records: %v", err)}
+	}
+	config, _ := loadServerConfig(*environment)
+	
+	targets := make(map[recordKey]Server)
+	for _, server := range servers {
+		targets[recordKey{name: shortDNSName(server.Name), ip: server.Content}] = server
+	}
+	
+	var req UpdateRequest
+	for _, entry := range currentActiveSet(config, records) {
+		if _, isTarget := targets[recordKey{name: entry.Name, ip: entry.IP}]; isTarget && !activate {
+			continue
+		}
+		req.ActiveServers = append(req.ActiveServers, entry)
+	}
+	if activate {
+		live := make(map[recordKey]bool)
+		for _, entry := range req.ActiveServers {
+			live[recordKey{name: entry.Name, ip: entry.IP}] = true
+		}
+		for key, server := range targets {
+			if !live[key] {
+				req.ActiveServers = append(req.ActiveServers, activeServerFromConfig(server))
+			}
+		}
+	}
+	if opts.ForceReason != "" {
+		req.Force = true
+		req.ForceReason = opts.ForceReason
+	}
+	req.BreakGlassReason = opts.BreakGlassReason
+	
+	return applyUpdate(ctx, cfClient, req, opts)
+}
+
+// Time-limited activations
+
+// parseExpiresIn interprets an expires_in value: "" keeps the current expiry,
+// "0" removes it, anything else is a duration like "6h"
+func parseExpiresIn(value string) (duration time.Duration, clear bool, err error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false, nil
+	}
+	if value == "0" || value == "none" {
+		return 0, true, nil
+	}
+	duration, err = time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, false, fmt.Errorf("invalid expiry %q (use e.g. 30m, 6h)", value)
+	}
+	return duration, false, nil
+}
+
+// setServerExpiry updates the expiry of a configured server from an expires_in value
+func setServerExpiry(server *Server, expiresIn string, now time.Time) {
+	duration, clear, err := parseExpiresIn(expiresIn)
+	if err != nil {
+		return
+	}
+	if clear {
+		server.ExpiresAt = ""
+		server.ExpiryBlocked = ""
+	} else if duration > 0 {
+		server.ExpiresAt = now.Add(duration).Format(time.RFC3339)
+		server.ExpiryBlocked = ""
+	}
+}
+
+// applyExpiries stores the expiry requested for entries of the active set
+func applyExpiries(config *ServerConfig, servers []ActiveServer) {
+	now := time.Now()
+	for _, info := range servers {
+		if info.ExpiresIn == "" {
+			continue
+		}
+		for i := range config.Servers {
+			if config.Servers[i].Content == info.IP && config.Servers[i].Name == fullDNSName(info.Name) {
+				setServerExpiry(&config.Servers[i], info.ExpiresIn, now)
+				break
+			}
+		}
+	}
+}
+
+// recordDeactivations clears the expiry of deleted servers and remembers why
+// they were deactivated
+func recordDeactivations(config *ServerConfig, deleted []CloudflareRecord, reason string) {
+	now := time.Now().Format(time.RFC3339)
+	for _, record := range deleted {
+		for i := range config.Servers {
+			if config.Servers[i].Name == record.Name && config.Servers[i].Content == record.Content {
+				config.Servers[i].ExpiresAt = ""
+				config.Servers[i].LastDeactivatedOn = now
+				config.Servers[i].DeactivationReason = reason
+				// Draining servers become standby once the drain completes
+				if config.Servers[i].State == "" || config.Servers[i].State == "active" {
+					setState(&config.Servers[i], "standby", reason)
+				}
+				break
+			}
+		}
+	}
+}
+
+// expireActivations deactivates all servers whose activation has expired
+func expireActivations(ctx context.Context, now time.Time) {
+	config, err := loadServerConfig(*environment)
+	if err != nil || config == nil {
+		return
+	}
+	
+	cfClient := NewCloudflareClient(credentials)
+	for _, server := range config.Servers {
+		if server.ExpiresAt == "" {
+			continue
+		}
+		expiresAt, err := time.Parse(time.RFC3339, server.ExpiresAt)
+		if err == nil && expiresAt.After(now) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		expireActivation(ctx, cfClient, server)
+	}
+}
+
+// expireActivation deactivates one expired server. Each server is applied on
+// its own, so a guard or freeze blocking one does not hold back the others;
+// the reason is kept on the server and shown in the web interface.
+func expireActivation(ctx context.Context, cfClient *CloudflareClient, server Server) {
+	response := applyServerChange(ctx, cfClient, []Server{server}, false, ApplyOptions{
+		Operator: "system",
+		Source:   "expiry",
+		Reason:   "activation expired",
+	})
+	
+	blocked := ""
+	if !response.Success {
+		blocked = response.Message
+	}
+	for _, detail := range response.Details {
+		if detail.Status == "error" && blocked == "" {
+			blocked = detail.Message
+		}
+	}
+	
+	if blocked == "" {
+		logger.Log("INFO", fmt.Sprintf("Activation of %s (%s) expired, deactivated", server.Alias, server.Content))
+	} else if blocked == server.ExpiryBlocked {
+		// Already reported, the worker retries every minute
+		return
+	} else {
+		logger.Log("WARNING", fmt.Sprintf("Activation of %s (%s) expired but could not be ended: %s", server.Alias, server.Content, blocked))
+	}
+	
+	if err := updateServerConfig(context.WithoutCancel(ctx), func(config *ServerConfig) error {
+		for i := range config.Servers {
+			if config.Servers[i].UniqueID != server.UniqueID || config.Servers[i].ExpiresAt != server.ExpiresAt {
+				continue
+			}
+			if blocked != "" {
+				config.Servers[i].ExpiryBlocked = blocked
+				return nil
+			}
+			// Also clears the expiry of servers that were no longer active anyway
+			config.Servers[i].ExpiresAt = ""
+			config.Servers[i].ExpiryBlocked = ""
+			if config.Servers[i].DeactivationReason == "" {
+				config.Servers[i].DeactivationReason = "activation expired"
+			}
+		}
+		return nil
+	}); err != nil {
+		logger.Log("ERROR", fmt.Sprintf("Failed to update expired activation of %s (%s): %v", server.Alias, server.Content, err))
+	}
+}
+
+// startExpiryWorker deactivates expired activations in the background
+func startExpiryWorker() {
+	runWorker(time.Minute, false, expireActivations)
+	logger.Log("INFO", "Expiry worker started")
+}
+
+// expiryHandler sets or clears the expiry of an active server
+func expiryHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UniqueID  string `json:"unique_id"`
+		ExpiresIn string `json:"expires_in"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UniqueID == "" {
+		writeAPIError(w, http.StatusBadRequest, "unique_id and expires_in are required")
+		return
+	}
+	if _, _, err := parseExpiresIn(req.ExpiresIn); err != nil || req.ExpiresIn == "" {
+		writeAPIError(w, http.StatusBadRequest, "expires_in must be a duration like 6h, or 0 to remove the expiry")
+		return
+	}
+	
+	var updated *Server
+	err := updateServerConfig(r.Context(), func(config *ServerConfig) error {
+		for i := range config.Servers {
+			if config.Servers[i].UniqueID == req.UniqueID {
+				setServerExpiry(&config.Servers[i], req.ExpiresIn, time.Now())
+				server := config.Servers[i]
+				updated = &server
+				return nil
+			}
+		}
+		return fmt.Errorf("server not found")
+	})
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	
+	message := fmt.Sprintf("Expiry removed for %s (%s)", updated.Alias, updated.Content)
+	if updated.ExpiresAt != "" {
+		message = fmt.Sprintf("%s (%s) will be deactivated at %s", updated.Alias, updated.Content, updated.ExpiresAt)
+	}
+	logger.Log("INFO", message)
+	logger.Audit(AuditEntry{Action: "expiry_set", Operator: operatorFromRequest(r), Success: true, Details: []string{message}})
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"message":    message,
+		"expires_at": updated.ExpiresAt,
+	})
+}
+
+// Server lifecycle
+
+// lifecycleStates lists the lifecycle states of a server in display order
+var lifecycleStates = []string{"provisioning", "standby", "active", "draining", "maintenance", "retired"}
+
+// lifecycleTransitions lists the states a server may move to from each state
+var lifecycleTransitions = map[string][]string{
+	"provisioning": {"standby", "active", "retired"},
+	"standby":      {"provisioning", "active", "maintenance", "retired"},
+	"active":       {"standby", "draining", "maintenance"},
+	"draining":     {"active", "standby", "maintenance"},
+	"maintenance":  {"standby", "retired"},
+	"retired":      {"standby"},
+}
+
+// canTransition reports whether a server may move from one lifecycle state to another
+func canTransition(from, to string) bool {
+	for _, state := range lifecycleTransitions[from] {
+		if state == to {
+			return true
+		}
+	}
+	return false
+}
+
+// effectiveState returns the lifecycle state of a server; servers saved before
+// states existed are active when they have a live record and standby otherwise
+func effectiveState(server Server, records []CloudflareRecord) string {
+	if server.State != "" {
+		return server.State
+	}
+	if server.Drain != nil {
+		return "draining"
+	}
+	if findLiveRecord(records, server) != nil {
+		return "active"
+	}
+	return "standby"
+}
+
+// setState moves a server to a new lifecycle state and remembers when and why
+func setState(server *Server, to, reason string) {
+	if server.State == to {
+		return
+	}
+	server.State = to
+	server.StateChangedOn = time.Now().Format(time.RFC3339)
+	server.StateReason = reason
+}
+
+// retireServer moves a server whose record is gone towards retired along the
+// allowed transitions: servers that may not retire directly (active, draining)
+// are deactivated to standby first. It returns the state reached.
+func retireServer(server *Server, from, reason string) string {
+	server.State = from
+	if !canTransition(from, "retired") && canTransition(from, "standby") {
+		setState(server, "standby", reason)
+	}
+	if canTransition(server.State, "retired") {
+		setState(server, "retired", reason)
+	}
+	return server.State
+}
+
+// manualStates returns the states an operator can move a server to directly;
+// activating and draining go through their own actions
+func manualStates(from string) []string {
+	var states []string
+	for _, state := range lifecycleTransitions[from] {
+		if state != "active" && state != "draining" {
+			states = append(states, state)
+		}
+	}
+	return states
+}
+
+// activationBlocked returns why a configured server may not be activated, or ""
+func activationBlocked(server Server) string {
+	switch server.State {
+	case "maintenance":
+		if server.Maintenance != nil {
+			return fmt.Sprintf("%s (%s) is in maintenance %s", server.Alias, server.Content, server.Maintenance.Describe())
+		}
+		return fmt.Sprintf("%s (%s) is in maintenance", server.Alias, server.Content)
+	case "retired":
+		return fmt.Sprintf("%s (%s) is retired", server.Alias, server.Content)
+	}
+	return ""
+}
+
+// checkActivations rejects plans that would activate retired servers or
+// servers in maintenance
+func checkActivations(config *ServerConfig, plan UpdatePlan) error {
+	if config == nil {
+		return nil
+	}
+	var blocked []string
+	for _, info := range plan.Create {
+		for _, server := range config.Servers {
+			if server.Name == fullDNSName(info.Name) && server.Content == info.IP {
+				if reason := activationBlocked(server); reason != "" {
+					blocked = append(blocked, reason)
+				}
+				break
+			}
+		}
+	}
+	if len(blocked) > 0 {
+		return fmt.Errorf("cannot activate %s; move to standby first", strings.Join(blocked, ", "))
+	}
+	return nil
+}
+
+// changeServerState moves a server to another lifecycle state on request of an operator
+func changeServerState(ctx context.Context, cfClient *CloudflareClient, uniqueID, to, reason, operator string) (*Server, error) {
+	valid := false
+	for _, state := range lifecycleStates {
+		valid = valid || state == to
+	}
+	if !valid {
+		return nil, fmt.Errorf("unknown state %q", to)
+	}
+	if to == "active" || to == "draining" {
+		return nil, fmt.Errorf("use Update DNS Records to activate and Drain to drain a server")
+	}
+	
+	records, err := cfClient.GetDNSRecords(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch current records: %v", err)
+	}
+	
+	var changed Server
+	var from string
+	err = updateServerConfig(ctx, func(config *ServerConfig) error {
+		for i := range config.Servers {
+			server := &config.Servers[i]
+			if server.UniqueID != uniqueID {
+				continue
+			}
+			from = effectiveState(*server, records)
+			if !canTransition(from, to) {
+				return fmt.Errorf("%s (%s) cannot move from %s to %s", server.Alias, server.Content, from, to)
+			}
+			if findLiveRecord(records, *server) != nil {
+				return fmt.Errorf("%s (%s) still has a live record; deactivate or drain it first", server.Alias, server.Content)
+			}
+			if server.Canary != nil && server.Canary.IsRunning() {
+				return fmt.Errorf("%s (%s) has a running canary; abort it first", server.Alias, server.Content)
+			}
+			if to == "maintenance" {
+				enterMaintenance(server, operator, reason, nil)
+			} else {
+				server.Maintenance = nil
+				setState(server, to, reason)
+			}
+			changed = *server
+			return nil
+		}
+		return fmt.Errorf("server not found")
+	})
+	if err != nil {
+		return nil, err
+	}
+	
+	message := fmt.Sprintf("%s (%s) moved from %s to %s", changed.Alias, changed.Content, from, to)
+	logger.Log("INFO", message)
+	logger.Audit(AuditEntry{Action: "state_changed", Operator: operator, Reason: reason, Success: true, Details: []string{message}})
+	return &changed, nil
+}
+
+// stateHandler moves a server to another lifecycle state
+func stateHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UniqueID string `json:"unique_id"`
+		State    string `json:"state"`
+		Reason   string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UniqueID == "" || req.State == "" {
+		writeAPIError(w, http.StatusBadRequest, "unique_id and state are required")
+		return
+	}
+	
+	server, err := changeServerState(r.Context(), NewCloudflareClient(credentials), req.UniqueID, req.State, strings.TrimSpace(req.Reason), operatorFromRequest(r))
+	if err != nil {
+		writeAPIError(w, http.StatusConflict, err.Error())
+		return
+	}
+	publishState(r, *server, fmt.Sprintf("%s moved %s (%s) to %s", operatorFromRequest(r), server.Alias, server.Content, server.State))
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("%s (%s) is now %s", server.Alias, server.Content, server.State),
+		"state":   server.State,
+	})
+}
+
+// Maintenance mode
+
+// MaintenanceInfo records who put a server into maintenance, why and until when
+type MaintenanceInfo struct {
+	Owner       string     `json:"owner"`
+	Reason      string     `json:"reason"`
+	StartedAt   time.Time  `json:"started_at"`
+	ExpectedEnd *time.Time `json:"expected_end,omitempty"`
+}
+
+// IsOverdue reports whether the expected end of the maintenance has passed
+func (m *MaintenanceInfo) IsOverdue() bool {
+	return m.ExpectedEnd != nil && time.Now().After(*m.ExpectedEnd)
+}
+
+// Describe returns a short human readable summary of the maintenance
+func (m *MaintenanceInfo) Describe() string {
+	summary := fmt.Sprintf("by %s since %s: %s", m.Owner, m.StartedAt.Format("2006-01-02 15:04"), m.Reason)
+	if m.ExpectedEnd != nil {
+		summary += fmt.Sprintf(" (expected end %s)", m.ExpectedEnd.Format("2006-01-02 15:04"))
+	}
+	return summary
+}
+
+// enterMaintenance moves a server into maintenance and records the details
+func enterMaintenance(server *Server, operator, reason string, expectedEnd *time.Time) {
+	if server.Maintenance == nil {
+		server.Maintenance = &MaintenanceInfo{StartedAt: time.Now()}
+	}
+	server.Maintenance.Owner = operator
+	server.Maintenance.Reason = reason
+	server.Maintenance.ExpectedEnd = expectedEnd
+	server.Drain = nil
+	server.ExpiresAt = ""
+	setState(server, "maintenance", reason)
+}
+
+// startMaintenance puts a server into maintenance and deactivates its record
+func startMaintenance(ctx context.Context, cfClient *CloudflareClient, uniqueID, reason, duration, operator, breakGlassReason, forceReason string) (*Server, UpdateResponse, error) {
+	var response UpdateResponse
+	if operator == "" {
+		return nil, response, fmt.Errorf("operator name required for maintenance")
+	}
+	if strings.TrimSpace(reason) == "" {
+		return nil, response, fmt.Errorf("a reason is required for maintenance")
+	}
+	var expectedEnd *time.Time
+	if duration != "" {
+		d, err := time.ParseDuration(duration)
+		if err != nil || d <= 0 {
+			return nil, response, fmt.Errorf("invalid expected duration %q (use e.g. 2h)", duration)
+		}
+		end := time.Now().Add(d)
+		expectedEnd = &end
+	}
+	
+	records, err := cfClient.GetDNSRecords(ctx)
+	if err != nil {
+		return nil, response, fmt.Errorf("failed to fetch current records: %v", err)
+	}
+	
+	// Enter maintenance first so nothing can re-activate the server meanwhile
+	var server Server
+	err = updateServerConfig(ctx, func(config *ServerConfig) error {
+		for i := range config.Servers {
+			if config.Servers[i].UniqueID != uniqueID {
+				continue
+			}
+			from := effectiveState(config.Servers[i], records)
+			if from != "maintenance" && !canTransition(from, "maintenance") {
+				return fmt.Errorf("%s (%s) cannot move from %s to maintenance", config.Servers[i].Alias, config.Servers[i].Content, from)
+			}
+			if config.Servers[i].Canary != nil && config.Servers[i].Canary.IsRunning() {
+				return fmt.Errorf("%s (%s) has a running canary; abort it first", config.Servers[i].Alias, config.Servers[i].Content)
+			}
+			
+			// Check freeze windows and the guard against the configuration being
+			// written, so a window added meanwhile is not missed; overrides are
+			// audited when the record is removed
+			if record := findLiveRecord(records, config.Servers[i]); record != nil {
+				if strings.TrimSpace(breakGlassReason) == "" {
+					if err := enforceFreeze(config, []freezeTarget{serverTags(config, record.Name, record.Content)}, "", operator, "maintenance of "+config.Servers[i].Alias); err != nil {
+						return err
+					}
+				}
+				if strings.TrimSpace(forceReason) == "" {
+					if violations := checkBlastRadius(records, UpdatePlan{Delete: []CloudflareRecord{*record}}); len(violations) > 0 {
+						return &BlastRadiusError{Violations: violations}
+					}
+				}
+			}
+			enterMaintenance(&config.Servers[i], operator, strings.TrimSpace(reason), expectedEnd)
+			server = config.Servers[i]
+			return nil
+		}
+		return fmt.Errorf("server not found")
+	})
+	if err != nil {
+		return nil, response, err
+	}
+	
+	message := fmt.Sprintf("%s (%s) in maintenance %s", server.Alias, server.Content, server.Maintenance.Describe())
+	logger.Log("WARNING", message)
+	logger.Audit(AuditEntry{Action: "maintenance_started", Operator: operator, Reason: server.Maintenance.Reason, Success: true, Details: []string{message}})
+	
+	response = UpdateResponse{Success: true, Message: message}
+	if findLiveRecord(records, server) != nil {
+		response = applyServerChange(ctx, cfClient, []Server{server}, false, ApplyOptions{
+			Operator:         operator,
+			Source:           "maintenance",
+			Reason:           "maintenance: " + server.Maintenance.Reason,
+			BreakGlassReason: breakGlassReason,
+			ForceReason:      forceReason,
+		})
+		if !response.Success {
+			response.Message = fmt.Sprintf("%s is in maintenance but its record could not be removed: %s", server.Alias, response.Message)
+		}
+	}
+	return &server, response, nil
+}
+
+// endMaintenance moves a server from maintenance back to standby
+func endMaintenance(ctx context.Context, uniqueID, operator string) (*Server, error) {
+	var server Server
+	var info *MaintenanceInfo
+	err := updateServerConfig(ctx, func(config *ServerConfig) error {
+		for i := range config.Servers {
+			if config.Servers[i].UniqueID != uniqueID {
+				continue
+			}
+			if config.Servers[i].State != "maintenance" {
+				return fmt.Errorf("%s (%s) is not in maintenance", config.Servers[i].Alias, config.Servers[i].Content)
+			}
+			info = config.Servers[i].Maintenance
+			config.Servers[i].Maintenance = nil
+			setState(&config.Servers[i], "standby", "maintenance ended")
+			server = config.Servers[i]
+			return nil
+		}
+		return fmt.Errorf("server not found")
+	})
+	if err != nil {
+		return nil, err
+	}
+	
+	message := fmt.Sprintf("Maintenance of %s (%s) ended", server.Alias, server.Content)
+	if info != nil {
+		message += fmt.Sprintf(" (started %s)", info.Describe())
+	}
+	logger.Log("INFO", message)
+	logger.Audit(AuditEntry{Action: "maintenance_ended", Operator: operator, Success: true, Details: []string{message}})
+	return &server, nil
+}
+
+// maintenanceHandler puts a server into maintenance
+func maintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UniqueID         string `json:"unique_id"`
+		Reason           string `json:"reason"`
+		ExpectedDuration string `json:"expected_duration"`
+		BreakGlassReason string `json:"break_glass_reason"`
+		Force            bool   `json:"force"`
+		ForceReason      string `json:"force_reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UniqueID == "" {
+		writeAPIError(w, http.StatusBadRequest, "unique_id and reason are required")
+		return
+	}
+	
+	forceReason := ""
+	if req.Force {
+		forceReason = req.ForceReason
+	}
+	server, response, err := startMaintenance(r.Context(), NewCloudflareClient(credentials), req.UniqueID, req.Reason, strings.TrimSpace(req.ExpectedDuration), operatorFromRequest(r), req.BreakGlassReason, forceReason)
+	if err != nil {
+		writeChangeError(w, err)
+		return
+	}
+	publishState(r, *server, fmt.Sprintf("%s put %s (%s) into maintenance", operatorFromRequest(r), server.Alias, server.Content))
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// endMaintenanceHandler ends the maintenance of a server
+func endMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UniqueID string `json:"unique_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UniqueID == "" {
+		writeAPIError(w, http.StatusBadRequest, "unique_id is required")
+		return
+	}
+	
+	server, err := endMaintenance(r.Context(), req.UniqueID, operatorFromRequest(r))
+	if err != nil {
+		writeAPIError(w, http.StatusConflict, err.Error())
+		return
+	}
+	publishState(r, *server, fmt.Sprintf("%s ended the maintenance of %s (%s)", operatorFromRequest(r), server.Alias, server.Content))
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("Maintenance of %s (%s) ended, server is on standby", server.Alias, server.Content),
+	})
+}
+
+// Graceful draining
+
+// DrainState tracks a server that is being drained: its TTL is stepped down
+// first, the record is removed once the old TTL has run out, and the server
+// only counts as inactive after resolvers had time to forget the record
+type DrainState struct {
+	Phase       string    `json:"phase"`                  // ttl (waiting for the old TTL), removed (waiting for caches)
+	StartedAt   time.Time `json:"started_at"`
+	NextStepAt  time.Time `json:"next_step_at"`           // When the drain moves on to the next phase
+	TTL         int       `json:"ttl"`                    // TTL resolvers may still cache after the removal
+	OriginalTTL int       `json:"original_ttl"`           // TTL restored when the drain is cancelled
+	Operator    string    `json:"operator,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	ForceReason string    `json:"force_reason,omitempty"` // Blast-radius override given when the drain was started
+	BreakGlassReason string `json:"break_glass_reason,omitempty"` // Freeze override given when the drain was started
+	Error       string    `json:"error,omitempty"`        // Why the last step failed, retried on the next run
+}
+
+// DrainRequest starts draining an active server
+type DrainRequest struct {
+	UniqueID         string `json:"unique_id"`
+	Reason           string `json:"reason,omitempty"`
+	BreakGlassReason string `json:"break_glass_reason,omitempty"` // Override active freeze windows
+	Force            bool   `json:"force,omitempty"`              // Override the blast-radius guard
+	ForceReason      string `json:"force_reason,omitempty"`       // Required together with Force
+}
+
+// effectiveTTL returns the TTL resolvers see for a record (1 means automatic, i.e. 300s)
+func effectiveTTL(ttl int) int {
+	if ttl <= 1 {
+		return 300
+	}
+	return ttl
+}
+
+// findLiveRecord returns the live record of a configured server, if any
+func findLiveRecord(records []CloudflareRecord, server Server) *CloudflareRecord {
+	for i := range records {
+		if records[i].Name == server.Name && records[i].Content == server.Content {
+			return &records[i]
+		}
+	}
+	return nil
+}
+
+// startDrain lowers the TTL of an active server's record and schedules its removal
+func startDrain(ctx context.Context, cfClient *CloudflareClient, req DrainRequest, operator string) (*Server, error) {
+	config, err := loadServerConfig(*environment)
+	if err != nil || config == nil {
+		return nil, fmt.Errorf("failed to load configuration")
+	}
+	
+	var server *Server
+	for i := range config.Servers {
+		if config.Servers[i].UniqueID == req.UniqueID {
+			server = &config.Servers[i]
+			break
+		}
+	}
+	if server == nil {
+		return nil, fmt.Errorf("server not found")
+	}
+	if server.Drain != nil {
+		return nil, fmt.Errorf("%s (%s) is already draining", server.Alias, server.Content)
+	}
+	
+	records, err := cfClient.GetDNSRecords(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch current records: %v", err)
+	}
+	record := findLiveRecord(records, *server)
+	if record == nil {
+		return nil, fmt.Errorf("%s (%s) is not active", server.Alias, server.Content)
+	}
+	
+	// Check up front so a drain is not started only to be blocked at the end
+	action := fmt.Sprintf("drain %s -> %s", shortDNSName(record.Name), record.Content)
+	if err := enforceFreeze(config, []freezeTarget{serverTags(config, record.Name, record.Content)}, req.BreakGlassReason, operator, action); err != nil {
+		return nil, err
+	}
+	if err := enforceBlastRadius(records, UpdatePlan{Delete: []CloudflareRecord{*record}}, req.Force, req.ForceReason, operator); err != nil {
+		return nil, err
+	}
+	
+	now := time.Now()
+	drain := &DrainState{
+		Phase:       "ttl",
+		StartedAt:   now,
+		NextStepAt:  now,
+		TTL:         effectiveTTL(record.TTL),
+		OriginalTTL: record.TTL,
+		Operator:    operator,
+		Reason:      strings.TrimSpace(req.Reason),
+	}
+	if req.Force {
+		drain.ForceReason = req.ForceReason
+	}
+	drain.BreakGlassReason = strings.TrimSpace(req.BreakGlassReason)
+	
+	// Proxied records resolve to Cloudflare, so removing them takes effect at once
+	if record.Proxied {
+		drain.TTL = 0
+	} else if effectiveTTL(record.TTL) > *drainTTL {
+		if err := journaledPatch(ctx, cfClient, *record, map[string]interface{}{"ttl": *drainTTL}, ApplyOptions{Operator: operator, Source: "drain", Reason: drain.Reason}); err != nil {
+			return nil, fmt.Errorf("failed to lower TTL: %v", err)
+		}
+		drain.TTL = *drainTTL
+		drain.NextStepAt = now.Add(time.Duration(effectiveTTL(record.TTL)) * time.Second)
+	}
+	
+	var drained Server
+	if err := updateServerConfig(context.WithoutCancel(ctx), func(config *ServerConfig) error {
+		for i := range config.Servers {
+			if config.Servers[i].UniqueID == req.UniqueID {
+				config.Servers[i].Drain = drain
+				config.Servers[i].ExpiresAt = ""
+				setState(&config.Servers[i], "draining", drain.Reason)
+				drained = config.Servers[i]
+				return nil
+			}
+		}
+		return fmt.Errorf("server not found")
+	}); err != nil {
+		return nil, err
+	}
+	
+	message := fmt.Sprintf("Draining %s (%s): TTL %d -> %d, record removed after %s", drained.Alias, drained.Content, effectiveTTL(record.TTL), drain.TTL, drain.NextStepAt.Format("15:04:05"))
+	logger.Log("INFO", message)
+	logger.Audit(AuditEntry{Action: "drain_started", Operator: operator, Reason: drain.Reason, Success: true, Details: []string{message}})
+	return &drained, nil
+}
+
+// cancelDrain stops a drain that has not removed the record yet and restores its TTL
+func cancelDrain(ctx context.Context, cfClient *CloudflareClient, uniqueID, operator string) (*Server, error) {
+	config, err := loadServerConfig(*environment)
+	if err != nil || config == nil {
+		return nil, fmt.Errorf("failed to load configuration")
+	}
+	
+	var server *Server
+	for i := range config.Servers {
+		if config.Servers[i].UniqueID == uniqueID {
+			server = &config.Servers[i]
+			break
+		}
+	}
+	if server == nil || server.Drain == nil {
+		return nil, fmt.Errorf("server is not draining")
+	}
+	if server.Drain.Phase != "ttl" {
+		return nil, fmt.Errorf("the record of %s (%s) has already been removed; activate it again instead", server.Alias, server.Content)
+	}
+	
+	records, err := cfClient.GetDNSRecords(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch current records: %v", err)
+	}
+	if record := findLiveRecord(records, *server); record != nil && !record.Proxied && record.TTL != server.Drain.OriginalTTL {
+		if err := journaledPatch(ctx, cfClient, *record, map[string]interface{}{"ttl": server.Drain.OriginalTTL}, ApplyOptions{Operator: operator, Source: "drain"}); err != nil {
+			return nil, fmt.Errorf("failed to restore TTL: %v", err)
+		}
+	}
+	
+	var cancelled Server
+	if err := updateServerConfig(context.WithoutCancel(ctx), func(config *ServerConfig) error {
+		for i := range config.Servers {
+			if config.Servers[i].UniqueID == uniqueID {
+				config.Servers[i].Drain = nil
+				setState(&config.Servers[i], "active", "drain cancelled")
+				cancelled = config.Servers[i]
+				return nil
+			}
+		}
+		return fmt.Errorf("server not found")
+	}); err != nil {
+		return nil, err
+	}
+	
+	message := fmt.Sprintf("Drain of %s (%s) cancelled", cancelled.Alias, cancelled.Content)
+	logger.Log("INFO", message)
+	logger.Audit(AuditEntry{Action: "drain_cancelled", Operator: operator, Success: true, Details: []string{message}})
+	return &cancelled, nil
+}
+
+// updateDrain applies a change to the drain state of a server, if it is still draining
+func updateDrain(ctx context.Context, uniqueID string, modify func(server *Server)) {
+	if err := updateServerConfig(context.WithoutCancel(ctx), func(config *ServerConfig) error {
+		for i := range config.Servers {
+			if config.Servers[i].UniqueID == uniqueID && config.Servers[i].Drain != nil {
+				modify(&config.Servers[i])
+				return nil
+			}
+		}
+		return nil
+	}); err != nil {
+		logger.Log("ERROR", fmt.Sprintf("Failed to save drain state: %v", err))
+	}
+}
+
+// removeDrainedRecord deletes the record of a draining server whose old TTL has run out
+func removeDrainedRecord(ctx context.Context, cfClient *CloudflareClient, server Server, now time.Time) {
+	reason := "drained"
+	if server.Drain.Reason != "" {
+		reason = "drained: " + server.Drain.Reason
+	}
+	
+	response := applyServerChange(ctx, cfClient, []Server{server}, false, ApplyOptions{
+		Operator:         server.Drain.Operator,
+		Source:           "drain",
+		Reason:           reason,
+		ForceReason:      server.Drain.ForceReason,
+		BreakGlassReason: server.Drain.BreakGlassReason,
+	})
+	
+	failure := ""
+	if !response.Success {
+		failure = response.Message
+	}
+	for _, detail := range response.Details {
+		if detail.Status == "error" {
+			failure = detail.Message
+		}
+	}
+	
+	if failure != "" {
+		// Only log and save changes so a long freeze neither floods the log
+		// nor rotates out the configuration backups
+		if failure != server.Drain.Error {
+			logger.Log("WARNING", fmt.Sprintf("Drain of %s (%s) is waiting: %s", server.Alias, server.Content, failure))
+			updateDrain(ctx, server.UniqueID, func(s *Server) {
+				s.Drain.Error = failure
+			})
+		}
+		return
+	}
+	
+	logger.Log("INFO", fmt.Sprintf("Drain of %s (%s): record removed, waiting %ds for resolver caches", server.Alias, server.Content, server.Drain.TTL))
+	updateDrain(ctx, server.UniqueID, func(s *Server) {
+		s.Drain.Phase = "removed"
+		s.Drain.NextStepAt = now.Add(time.Duration(s.Drain.TTL) * time.Second)
+		s.Drain.Error = ""
+	})
+}
+
+// processDrains moves every draining server whose next step is due forward
+func processDrains(ctx context.Context, now time.Time) {
+	config, err := loadServerConfig(*environment)
+	if err != nil || config == nil {
+		return
+	}
+	
+	cfClient := NewCloudflareClient(credentials)
+	for _, server := range config.Servers {
+		if server.Drain == nil || server.Drain.NextStepAt.After(now) {
+			continue
+		}
+		
+		switch server.Drain.Phase {
+		case "ttl":
+			removeDrainedRecord(ctx, cfClient, server, now)
+		case "removed":
+			message := fmt.Sprintf("%s (%s) drained and inactive", server.Alias, server.Content)
+			logger.Log("SUCCESS", message)
+			logger.Audit(AuditEntry{
+				Action:   "drain_completed",
+				Operator: server.Drain.Operator,
+				Source:   "drain",
+				Reason:   server.Drain.Reason,
+				Success:  true,
+				Details:  []string{message},
+			})
+			updateDrain(ctx, server.UniqueID, func(s *Server) {
+				s.Drain = nil
+				if s.State == "draining" {
+					setState(s, "standby", "drained")
+				}
+			})
+			publishEvent(UIEvent{
+				Type:     "state",
+				Operator: server.Drain.Operator,
+				Message:  message,
+				Servers:  []ServerEvent{{UniqueID: server.UniqueID, Name: server.Name, IP: server.Content, Alias: server.Alias, State: "standby"}},
+			})
+		}
+	}
+}
+
+// startDrainWorker advances drains in the background
+func startDrainWorker() {
+	runWorker(10*time.Second, false, processDrains)
+	logger.Log("INFO", "Drain worker started")
+}
+
+// drainHandler starts draining an active server
+func drainHandler(w http.ResponseWriter, r *http.Request) {
+	var req DrainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UniqueID == "" {
+		writeAPIError(w, http.StatusBadRequest, "unique_id is required")
+		return
+	}
+	
+	server, err := startDrain(r.Context(), NewCloudflareClient(credentials), req, operatorFromRequest(r))
+	if err != nil {
+		writeChangeError(w, err)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("Draining %s (%s), record is removed after %s", server.Alias, server.Content, server.Drain.NextStepAt.Format("15:04:05")),
+		"drain":   server.Drain,
+	})
+}
+
+// cancelDrainHandler stops a drain before the record is removed
+func cancelDrainHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UniqueID string `json:"unique_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UniqueID == "" {
+		writeAPIError(w, http.StatusBadRequest, "unique_id is required")
+		return
+	}
+	
+	server, err := cancelDrain(r.Context(), NewCloudflareClient(credentials), req.UniqueID, operatorFromRequest(r))
+	if err != nil {
+		writeAPIError(w, http.StatusConflict, err.Error())
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("Drain of %s (%s) cancelled", server.Alias, server.Content),
+	})
+}
+
+// serverStatus returns active, draining or inactive for a configured server
+func serverStatus(server Server, records []CloudflareRecord) string {
+	if server.Drain != nil {
+		return "draining"
+	}
+	if server.Canary != nil && server.Canary.IsRunning() {
+		return "canary"
+	}
+	if findLiveRecord(records, server) != nil {
+		return "active"
+	}
+	return "inactive"
+}
+
+// serversHandler lists the configured servers together with their status
+func serversHandler(w http.ResponseWriter, r *http.Request) {
+	config, err := loadServerConfig(*environment)
+	if err != nil || config == nil {
+		writeAPIError(w, http.StatusInternalServerError, "Failed to load configuration")
+		return
+	}
+	cached, err := NewCloudflareClient(credentials).GetCachedDNSRecords(r.Context())
+	if err != nil {
+		writeAPIError(w, http.StatusBadGateway, fmt.Sprintf("Failed to fetch DNS records: %v", err))
+		return
+	}
+	records := cached.Records
+	
+	type ServerView struct {
+		Server
+		State  string `json:"state"`  // Lifecycle state
+		Status string `json:"status"` // Live status
+	}
+	servers := []ServerView{}
+	for _, server := range config.Servers {
+		server.Canary = withLatestProbe(server.UniqueID, server.Canary)
+		servers = append(servers, ServerView{Server: server, State: effectiveState(server, records), Status: serverStatus(server, records)})
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"servers": servers,
+	})
+}
+
+// Canary activations
+
+// CanaryTransition is one step of a canary's state machine
+type CanaryTransition struct {
+	At     time.Time `json:"at"`
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// CanaryState tracks a new server that is tried out under a canary name before
+// it joins its main name. States: probing -> healthy -> promoted, with
+// healthy -> probing when a probe fails and failed/aborted as final states.
+type CanaryState struct {
+	State         string             `json:"state"`
+	CanaryName    string             `json:"canary_name"` // Full DNS name of the canary record
+	StartedAt     time.Time          `json:"started_at"`
+	HealthySince  *time.Time         `json:"healthy_since,omitempty"`
+	Period        string             `json:"period"`                   // How long probes have to pass before promotion
+	ProbePort     int                `json:"probe_port"`               // TCP port that has to accept connections
+	HashrateURL   string             `json:"hashrate_url,omitempty"`   // Optional JSON endpoint reporting the hashrate
+	HashrateField string             `json:"hashrate_field,omitempty"` // Dotted path of the hashrate in the response
+	MinHashrate   float64            `json:"min_hashrate,omitempty"`
+	Operator      string             `json:"operator,omitempty"`
+	LastProbeAt   *time.Time         `json:"last_probe_at,omitempty"`
+	LastResult    string             `json:"last_result,omitempty"`
+	Transitions   []CanaryTransition `json:"transitions,omitempty"`
+}
+
+// IsRunning reports whether the canary has not reached a final state yet
+func (c *CanaryState) IsRunning() bool {
+	return c.State == "probing" || c.State == "healthy"
+}
+
+// transition moves the canary to a new state and records why
+func (c *CanaryState) transition(server Server, to, reason string, now time.Time) {
+	c.Transitions = append(c.Transitions, CanaryTransition{At: now, From: c.State, To: to, Reason: reason})
+	if len(c.Transitions) > 20 {
+		c.Transitions = c.Transitions[len(c.Transitions)-20:]
+	}
+	
+	message := fmt.Sprintf("Canary %s (%s): %s -> %s", server.Alias, server.Content, c.State, to)
+	if reason != "" {
+		message += " (" + reason + ")"
+	}
+	level := "INFO"
+	switch to {
+	case "promoted":
+		level = "SUCCESS"
+	case "failed", "aborted":
+		level = "WARNING"
+	}
+	logger.Log(level, message)
+	logger.Audit(AuditEntry{Action: "canary_" + to, Operator: c.Operator, Source: "canary", Reason: reason, Success: true, Details: []string{message}})
+	
+	c.State = to
+	if to != "healthy" {
+		c.HealthySince = nil
+	}
+}
+
+// CanaryRequest adds a new server under a canary name first
+type CanaryRequest struct {
+	Name             string  `json:"name"`
+	IP               string  `json:"ip"`
+	Alias            string  `json:"alias"`
+	TTL              int     `json:"ttl"`
+	Proxied          bool    `json:"proxied"`
+	ProbePort        int     `json:"probe_port"`
+	Period           string  `json:"period"`
+	HashrateURL      string  `json:"hashrate_url,omitempty"`
+	HashrateField    string  `json:"hashrate_field,omitempty"`
+	MinHashrate      float64 `json:"min_hashrate,omitempty"`
+	BreakGlassReason string  `json:"break_glass_reason,omitempty"`
+}
+
+// canaryName returns the full canary DNS name for a main name
+func canaryName(name string) string {
+	return fullDNSName(*canaryPrefix + "." + shortDNSName(name))
+}
+
+// startCanary creates the canary record for a new server and stores its state
+func startCanary(ctx context.Context, cfClient *CloudflareClient, req CanaryRequest, operator string) (*Server, error) {
+	if req.Name == "" || req.IP == "" {
+		return nil, fmt.Errorf("name and IP are required")
+	}
+	if req.TTL <= 0 {
+		req.TTL = 60
+	}
+	if req.Alias == "" {
+		req.Alias = req.Name
+	}
+	if req.ProbePort <= 0 || req.ProbePort > 65535 {
+		return nil, fmt.Errorf("a valid probe port is required")
+	}
+	if req.Period == "" {
+		req.Period = "1h"
+	}
+	if period, err := time.ParseDuration(req.Period); err != nil || period <= 0 {
+		return nil, fmt.Errorf("invalid period %q (use e.g. 30m, 1h)", req.Period)
+	}
+	if req.HashrateURL != "" && req.HashrateField == "" {
+		req.HashrateField = "hashrate.total.0"
+	}
+	
+	mainName := fullDNSName(req.Name)
+	canary := canaryName(req.Name)
+	uniqueID := generateServerID(mainName, req.IP)
+	
+	records, err := cfClient.GetDNSRecords(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch current records: %v", err)
+	}
+	for _, record := range records {
+		if record.Content == req.IP && (record.Name == mainName || record.Name == canary) {
+			return nil, fmt.Errorf("%s is already active under %s", req.IP, record.Name)
+		}
+	}
+	
+	config, _ := loadServerConfig(*environment)
+	if config != nil {
+		for _, server := range config.Servers {
+			if server.UniqueID != uniqueID {
+				continue
+			}
+			if server.Canary != nil && server.Canary.IsRunning() {
+				return nil, fmt.Errorf("a canary for %s is already running", req.IP)
+			}
+			if server.State != "" && !canTransition(server.State, "provisioning") && server.State != "provisioning" {
+				return nil, fmt.Errorf("%s (%s) cannot be provisioned from state %s", server.Alias, server.Content, server.State)
+			}
+		}
+	}
+	if err := enforceFreeze(config, []freezeTarget{serverTags(config, mainName, req.IP)}, req.BreakGlassReason, operator, fmt.Sprintf("canary %s -> %s", shortDNSName(canary), req.IP)); err != nil {
+		return nil, err
+	}
+	
+	info := ActiveServer{IP: req.IP, Name: shortDNSName(canary), Alias: req.Alias, Proxied: req.Proxied, TTL: req.TTL}
+	if _, _, err := journaledCreate(ctx, cfClient, info, RecordMetadata{Alias: req.Alias}, ApplyOptions{Operator: operator, Source: "canary"}); err != nil {
+		return nil, fmt.Errorf("failed to create canary record: %v", err)
+	}
+	
+	now := time.Now()
+	state := &CanaryState{
+		State:         "probing",
+		CanaryName:    canary,
+		StartedAt:     now,
+		Period:        req.Period,
+		ProbePort:     req.ProbePort,
+		HashrateURL:   req.HashrateURL,
+		HashrateField: req.HashrateField,
+		MinHashrate:   req.MinHashrate,
+		Operator:      operator,
+		Transitions:   []CanaryTransition{{At: now, To: "probing", Reason: "canary record " + canary + " created"}},
+	}
+	
+	var started Server
+	err = updateServerConfig(context.WithoutCancel(ctx), func(config *ServerConfig) error {
+		for i := range config.Servers {
+			if config.Servers[i].UniqueID == uniqueID {
+				config.Servers[i].Canary = state
+				setState(&config.Servers[i], "provisioning", "canary started")
+				started = config.Servers[i]
+				return nil
+			}
+		}
+		config.Servers = append(config.Servers, Server{
+			UniqueID:       uniqueID,
+			Alias:          req.Alias,
+			Description:    fmt.Sprintf("Added as canary on %s", now.Format("2006-01-02")),
+			FirstSeenOn:    now.Format(time.RFC3339),
+			Type:           "A",
+			Name:           mainName,
+			Content:        req.IP,
+			TTL:            req.TTL,
+			Proxied:        req.Proxied,
+			Comment:        req.Alias,
+			State:          "provisioning",
+			StateChangedOn: now.Format(time.RFC3339),
+			StateReason:    "canary started",
+			Canary:         state,
+		})
+		started = config.Servers[len(config.Servers)-1]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	
+	message := fmt.Sprintf("Canary %s (%s) started under %s, promoted to %s after %s of passing probes", req.Alias, req.IP, canary, mainName, req.Period)
+	logger.Log("INFO", message)
+	logger.Audit(AuditEntry{Action: "canary_started", Operator: operator, Source: "canary", Success: true, Details: []string{message}})
+	return &started, nil
+}
+
+// fetchHashrate reads a number from a JSON document at a dotted path such as
+// "hashrate.total.0" (the XMRig summary API)
+func fetchHashrate(ctx context.Context, url, field string) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	
+	var value interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&value); err != nil {
+		return 0, err
+	}
+	for _, key := range strings.Split(field, ".") {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			value = node[key]
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(node) {
+				return 0, fmt.Errorf("no element %s in %s", key, field)
+			}
+			value = node[index]
+		default:
+			return 0, fmt.Errorf("no field %s in %s", key, field)
+		}
+	}
+	hashrate, ok := value.(float64)
+	if !ok {
+		return 0, fmt.Errorf("%s is not a number", field)
+	}
+	return hashrate, nil
+}
+
+// probeCanary checks that the server accepts connections and, if configured,
+// reports enough hashrate
+func probeCanary(ctx context.Context, server Server) (bool, string) {
+	canary := server.Canary
+	address := net.JoinHostPort(server.Content, strconv.Itoa(canary.ProbePort))
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return false, fmt.Sprintf("%s unreachable: %v", address, err)
+	}
+	conn.Close()
+	
+	if canary.HashrateURL == "" {
+		return true, fmt.Sprintf("%s reachable", address)
+	}
+	hashrate, err := fetchHashrate(ctx, canary.HashrateURL, canary.HashrateField)
+	if err != nil {
+		return false, fmt.Sprintf("hashrate check failed: %v", err)
+	}
+	if hashrate < canary.MinHashrate {
+		return false, fmt.Sprintf("hashrate %.0f H/s below %.0f H/s", hashrate, canary.MinHashrate)
+	}
+	return true, fmt.Sprintf("%s reachable, hashrate %.0f H/s", address, hashrate)
+}
+
+// removeCanaryRecord deletes the canary record of a server, if it still exists
+func removeCanaryRecord(ctx context.Context, cfClient *CloudflareClient, server Server) error {
+	records, err := cfClient.GetDNSRecords(ctx)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if record.Name == server.Canary.CanaryName && record.Content == server.Content {
+			_, err := journaledDelete(ctx, cfClient, record, ApplyOptions{Operator: server.Canary.Operator, Source: "canary"})
+			return err
+		}
+	}
+	return nil
+}
 
-// CloudflareClient handles all API interactions
-type CloudflareClient struct {
-	credentials *Credentials
-	httpClient  *http.Client
+// promoteCanary adds the server to its main name and removes the canary record
+func promoteCanary(ctx context.Context, cfClient *CloudflareClient, server Server) error {
+	config, _ := loadServerConfig(*environment)
+	if err := enforceFreeze(config, []freezeTarget{serverTags(config, server.Name, server.Content)}, "", "system", fmt.Sprintf("canary promotion %s -> %s", shortDNSName(server.Name), server.Content)); err != nil {
+		return err
+	}
+	
+	records, err := cfClient.GetDNSRecords(ctx)
+	if err != nil {
+		return err
+	}
+	if findLiveRecord(records, server) == nil {
+		info := ActiveServer{IP: server.Content, Name: shortDNSName(server.Name), Alias: server.Alias, Account: server.Account, Container: server.Container, Proxied: server.Proxied, TTL: server.TTL}
+		if _, _, err := journaledCreate(ctx, cfClient, info, serverMetadata(server), ApplyOptions{Operator: "system", Source: "canary"}); err != nil {
+			return err
+		}
+	}
+	if err := removeCanaryRecord(ctx, cfClient, server); err != nil {
+		logger.Log("WARNING", fmt.Sprintf("Canary %s promoted but canary record not removed: %v", server.Alias, err))
+	}
+	return nil
 }
 
-func NewCloudflareClient(creds *Credentials) *CloudflareClient {
-	return &CloudflareClient{
-		credentials: creds,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+// updateCanary applies a change to the canary of a server if it is still in the expected state
+func updateCanary(ctx context.Context, uniqueID, expected string, modify func(server *Server)) {
+	if err := updateServerConfig(context.WithoutCancel(ctx), func(config *ServerConfig) error {
+		for i := range config.Servers {
+			if config.Servers[i].UniqueID == uniqueID && config.Servers[i].Canary != nil && config.Servers[i].Canary.State == expected {
+				modify(&config.Servers[i])
+				return nil
+			}
+		}
+		return nil
+	}); err != nil {
+		logger.Log("ERROR", fmt.Sprintf("Failed to save canary state: %v", err))
 	}
 }
 
-func (c *CloudflareClient) makeRequest(method, endpoint string, body io.Reader) (*http.Request, error) {
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s%s", c.credentials.ZoneID, endpoint)
-	req, err := http.NewRequest(method, url, body)
+// advanceCanary probes one running canary and moves its state machine forward
+func advanceCanary(ctx context.Context, cfClient *CloudflareClient, server Server, records []CloudflareRecord, now time.Time) {
+	canary := server.Canary
+	state := canary.State
+	
+	live := false
+	for _, record := range records {
+		if record.Name == canary.CanaryName && record.Content == server.Content {
+			live = true
+			break
+		}
+	}
+	if !live {
+		updateCanary(ctx, server.UniqueID, state, func(s *Server) {
+			s.Canary.transition(*s, "aborted", "canary record was removed", now)
+		})
+		return
+	}
+	
+	if now.Sub(canary.StartedAt) > *canaryTimeout {
+		if err := removeCanaryRecord(ctx, cfClient, server); err != nil {
+			logger.Log("ERROR", fmt.Sprintf("Failed to remove canary record of %s: %v", server.Alias, err))
+			return
+		}
+		updateCanary(ctx, server.UniqueID, state, func(s *Server) {
+			s.Canary.transition(*s, "failed", fmt.Sprintf("not promoted within %s", *canaryTimeout), now)
+		})
+		return
+	}
+	
+	healthy, result := probeCanary(ctx, server)
+	period, _ := time.ParseDuration(canary.Period)
+	
+	next, reason := "", result
+	switch {
+	case !healthy && state == "healthy":
+		next = "probing"
+	case healthy && state == "probing":
+		next = "healthy"
+	case healthy && state == "healthy" && canary.HealthySince != nil && now.Sub(*canary.HealthySince) >= period:
+		if err := promoteCanary(ctx, cfClient, server); err != nil {
+			result = fmt.Sprintf("promotion pending: %v", err)
+			break
+		}
+		next, reason = "promoted", fmt.Sprintf("probes passed for %s", canary.Period)
+	}
+	
+	// Probe results stay in memory; the configuration (and a backup) is only
+	// written when the canary changes state
+	recordCanaryProbe(server.UniqueID, now, result)
+	if next == "" {
+		return
+	}
+	updateCanary(ctx, server.UniqueID, state, func(s *Server) {
+		s.Canary.transition(*s, next, reason, now)
+		switch next {
+		case "healthy":
+			s.Canary.HealthySince = &now
+		case "promoted":
+			s.LastActivatedOn = now.Format(time.RFC3339)
+			setState(s, "active", "canary promoted")
+		}
+		s.Canary.LastProbeAt = &now
+		s.Canary.LastResult = result
+	})
+}
+
+// canaryProbes keeps the latest probe of each running canary by server
+var canaryProbes struct {
+	mu     sync.Mutex
+	probes map[string]canaryProbe
+}
+
+type canaryProbe struct {
+	at     time.Time
+	result string
+}
+
+// recordCanaryProbe remembers the latest probe of a canary
+func recordCanaryProbe(uniqueID string, at time.Time, result string) {
+	canaryProbes.mu.Lock()
+	defer canaryProbes.mu.Unlock()
+	if canaryProbes.probes == nil {
+		canaryProbes.probes = make(map[string]canaryProbe)
+	}
+	canaryProbes.probes[uniqueID] = canaryProbe{at: at, result: result}
+}
+
+// withLatestProbe returns the canary with the latest probe result of its
+// server, which may be newer than the one saved with the last state change
+func withLatestProbe(uniqueID string, canary *CanaryState) *CanaryState {
+	if canary == nil {
+		return nil
+	}
+	canaryProbes.mu.Lock()
+	probe, ok := canaryProbes.probes[uniqueID]
+	canaryProbes.mu.Unlock()
+	if !ok || (canary.LastProbeAt != nil && !probe.at.After(*canary.LastProbeAt)) {
+		return canary
+	}
+	copied := *canary
+	copied.LastProbeAt = &probe.at
+	copied.LastResult = probe.result
+	return &copied
+}
+
+// processCanaries advances all running canaries
+func processCanaries(ctx context.Context, now time.Time) {
+	config, err := loadServerConfig(*environment)
+	if err != nil || config == nil {
+		return
+	}
+	
+	var running []Server
+	for _, server := range config.Servers {
+		if server.Canary != nil && server.Canary.IsRunning() {
+			running = append(running, server)
+		}
+	}
+	if len(running) == 0 {
+		return
+	}
+	
+	cfClient := NewCloudflareClient(credentials)
+	records, err := cfClient.GetDNSRecords(ctx)
 	if err != nil {
-		return nil, err
+		logger.Log("WARNING", fmt.Sprintf("Skipping canary probes: %v", err))
+		return
+	}
+	for _, server := range running {
+		advanceCanary(ctx, cfClient, server, records, now)
+	}
+}
+
+// startCanaryWorker probes canaries in the background
+func startCanaryWorker() {
+	runWorker(30*time.Second, false, processCanaries)
+	logger.Log("INFO", "Canary worker started")
+}
+
+// canaryHandler adds a new server as a canary
+func canaryHandler(w http.ResponseWriter, r *http.Request) {
+	var req CanaryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "Invalid request body")
+		return
 	}
 	
-	req.Header.Set("Authorization", "Bearer "+c.credentials.Token)
-	req.Header.Set("Content-Type", "application/json")
+	server, err := startCanary(r.Context(), NewCloudflareClient(credentials), req, operatorFromRequest(r))
+	if err != nil {
+		var freezeErr *FreezeError
+		if errors.As(err, &freezeErr) {
+			writeFrozenError(w, freezeErr)
+			return
+		}
+		writeAPIError(w, http.StatusConflict, err.Error())
+		return
+	}
 	
-	return req, nil
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"message":   fmt.Sprintf("Canary %s (%s) started under %s", server.Alias, server.Content, server.Canary.CanaryName),
+		"unique_id": server.UniqueID,
+		"canary":    server.Canary,
+	})
+}
+
+// abortCanaryHandler stops a running canary and removes its record
+func abortCanaryHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UniqueID string `json:"unique_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UniqueID == "" {
+		writeAPIError(w, http.StatusBadRequest, "unique_id is required")
+		return
+	}
+	
+	config, err := loadServerConfig(*environment)
+	if err != nil || config == nil {
+		writeAPIError(w, http.StatusInternalServerError, "Failed to load configuration")
+		return
+	}
+	var server *Server
+	for i := range config.Servers {
+		if config.Servers[i].UniqueID == req.UniqueID && config.Servers[i].Canary != nil && config.Servers[i].Canary.IsRunning() {
+			server = &config.Servers[i]
+			break
+		}
+	}
+	if server == nil {
+		writeAPIError(w, http.StatusNotFound, "No running canary for this server")
+		return
+	}
+	
+	if err := removeCanaryRecord(r.Context(), NewCloudflareClient(credentials), *server); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to remove canary record: %v", err))
+		return
+	}
+	operator := operatorFromRequest(r)
+	updateCanary(r.Context(), server.UniqueID, server.Canary.State, func(s *Server) {
+		reason := "aborted"
+		if operator != "" {
+			reason = "aborted by " + operator
+		}
+		s.Canary.transition(*s, "aborted", reason, time.Now())
+	})
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("Canary %s (%s) aborted", server.Alias, server.Content),
+	})
+}
+
+// Drift detection
+
+// DriftItem is one difference between the configuration and the live records
+type DriftItem struct {
+	Kind     string   `json:"kind"` // unknown_record, changed_record, missing_record, unexpected_record
+	UniqueID string   `json:"unique_id,omitempty"`
+	Name     string   `json:"name"`
+	IP       string   `json:"ip"`
+	Details  []string `json:"details,omitempty"`
+	Action   string   `json:"action,omitempty"` // What the drift policy did about it
+	FirstSeen time.Time `json:"first_seen"`     // When the difference was first detected
+}
+
+// key identifies the same difference across checks
+func (d DriftItem) key() string {
+	return d.Kind + "|" + d.Name + "|" + d.IP
+}
+
+// Describe returns a short human readable summary of the drift
+func (d DriftItem) Describe() string {
+	summary := fmt.Sprintf("%s: %s -> %s", d.Kind, shortDNSName(d.Name), d.IP)
+	if len(d.Details) > 0 {
+		summary += " (" + strings.Join(d.Details, ", ") + ")"
+	}
+	return summary
+}
+
+// DriftReport is the result of one reconciliation run
+type DriftReport struct {
+	CheckedAt time.Time   `json:"checked_at"`
+	Policy    string      `json:"policy"`
+	Items     []DriftItem `json:"items"`
+	Error     string      `json:"error,omitempty"`
+}
+
+var (
+	driftMutex sync.Mutex
+	lastDrift  *DriftReport
+	
+	// driftRunMutex serializes checks; driftSightings (guarded by it) remembers
+	// when each open difference was first detected
+	driftRunMutex  sync.Mutex
+	driftSightings = make(map[string]time.Time)
+)
+
+// detectDrift compares the configuration with the live records
+func detectDrift(config *ServerConfig, records []CloudflareRecord) []DriftItem {
+	items := []DriftItem{}
+	
+	known := make(map[recordKey]bool)
+	for _, server := range config.Servers {
+		known[recordKey{name: server.Name, ip: server.Content}] = true
+		if server.Canary != nil {
+			known[recordKey{name: server.Canary.CanaryName, ip: server.Content}] = true
+		}
+	}
+	for _, record := range records {
+		if !known[recordKey{name: record.Name, ip: record.Content}] {
+			items = append(items, DriftItem{
+				Kind:    "unknown_record",
+				Name:    record.Name,
+				IP:      record.Content,
+				Details: []string{fmt.Sprintf("TTL %d, proxied %t, comment %q", record.TTL, record.Proxied, record.Comment)},
+			})
+		}
+	}
+	
+	for _, server := range config.Servers {
+		record := findLiveRecord(records, server)
+		state := effectiveState(server, records)
+		
+		if record == nil {
+			if state == "active" {
+				items = append(items, DriftItem{Kind: "missing_record", UniqueID: server.UniqueID, Name: server.Name, IP: server.Content, Details: []string{"server is active but has no record"}})
+			}
+			continue
+		}
+		
+		switch state {
+		case "standby", "maintenance", "retired":
+			items = append(items, DriftItem{Kind: "unexpected_record", UniqueID: server.UniqueID, Name: server.Name, IP: server.Content, Details: []string{"server is " + state + " but has a record"}})
+			continue
+		}
+		
+		var changes []string
+		// Draining lowers the TTL on purpose
+		if server.TTL > 0 && record.TTL != server.TTL && server.Drain == nil {
+			changes = append(changes, fmt.Sprintf("TTL %d -> %d", server.TTL, record.TTL))
+		}
+		if record.Proxied != server.Proxied {
+			changes = append(changes, fmt.Sprintf("proxied %t -> %t", server.Proxied, record.Proxied))
+		}
+		if *syncMetadata {
+			// Gaps are closed by syncRecordMetadata, only disagreements are drift
+			if meta, structured := recordMetadata(*record); structured {
+				changes = append(changes, metadataConflicts(serverMetadata(server), meta)...)
+			}
+		} else if server.Comment != "" && record.Comment != server.Comment {
+			changes = append(changes, fmt.Sprintf("comment %q -> %q", server.Comment, record.Comment))
+		}
+		if len(changes) > 0 {
+			items = append(items, DriftItem{Kind: "changed_record", UniqueID: server.UniqueID, Name: server.Name, IP: server.Content, Details: changes})
+		}
+	}
+	
+	return items
 }
 
-func (c *CloudflareClient) GetDNSRecords() ([]CloudflareRecord, error) {
-	// Get all A records that end with the domain (including subdomains like us.xmr)
-	req, err := c.makeRequest("GET", fmt.Sprintf("/dns_records?type=A&name~end=%s", c.credentials.Domain), nil)
+// adoptDrift brings the configuration in line with the live record
+func adoptDrift(ctx context.Context, item DriftItem, records []CloudflareRecord) string {
+	err := updateServerConfig(ctx, func(config *ServerConfig) error {
+		if item.Kind == "unknown_record" {
+			for _, record := range records {
+				if record.Name == item.Name && record.Content == item.IP {
+					server := importedServer(record)
+					server.Description = fmt.Sprintf("Adopted from Cloudflare on %s", time.Now().Format("2006-01-02"))
+					server.StateReason = "adopted from Cloudflare"
+					addTagOptions(config, server.Account, server.Container)
+					config.Servers = append(config.Servers, server)
+					return nil
+				}
+			}
+			return fmt.Errorf("record disappeared")
+		}
+		
+		for i := range config.Servers {
+			server := &config.Servers[i]
+			if server.UniqueID != item.UniqueID {
+				continue
+			}
+			switch item.Kind {
+			case "missing_record":
+				setState(server, "standby", "record removed outside the manager")
+			case "unexpected_record":
+				if server.State != "standby" {
+					return fmt.Errorf("server is %s, not adopting", server.State)
+				}
+				setState(server, "active", "record created outside the manager")
+			case "changed_record":
+				if record := findLiveRecord(records, *server); record != nil {
+					if server.Drain == nil {
+						server.TTL = record.TTL
+					}
+					server.Proxied = record.Proxied
+					server.Comment = record.Comment
+					if meta, structured := recordMetadata(*record); structured {
+						if meta.Alias != "" && !strings.HasSuffix(meta.Alias, "…") {
+							server.Alias = meta.Alias
+						}
+						if meta.Account != "" {
+							server.Account = meta.Account
+						}
+						if meta.Container != "" {
+							server.Container = meta.Container
+						}
+						addTagOptions(config, server.Account, server.Container)
+					}
+				}
+			}
+			return nil
+		}
+		return fmt.Errorf("server not found")
+	})
 	if err != nil {
-		return nil, err
+		return fmt.Sprintf("not adopted: %v", err)
+	}
+	return "adopted"
+}
+
+// revertDrift brings the live record back in line with the configuration
+func revertDrift(ctx context.Context, cfClient *CloudflareClient, item DriftItem, config *ServerConfig, records []CloudflareRecord) string {
+	opts := ApplyOptions{Operator: "system", Source: "drift", Reason: "reverted drift"}
+	
+	var server Server
+	for _, s := range config.Servers {
+		if s.UniqueID == item.UniqueID {
+			server = s
+			break
+		}
 	}
 	
-	logger.Log("INFO", fmt.Sprintf("Fetching DNS records ending with %s", c.credentials.Domain))
+	var response UpdateResponse
+	switch item.Kind {
+	case "unknown_record":
+		response = applyServerChange(ctx, cfClient, []Server{{Name: item.Name, Content: item.IP}}, false, opts)
+	case "unexpected_record":
+		response = applyServerChange(ctx, cfClient, []Server{server}, false, opts)
+	case "missing_record":
+		response = applyServerChange(ctx, cfClient, []Server{server}, true, opts)
+	case "changed_record":
+		record := findLiveRecord(records, server)
+		if record == nil {
+			return "not reverted: record disappeared"
+		}
+		if err := enforceFreeze(config, []freezeTarget{serverTags(config, server.Name, server.Content)}, "", "system", "drift revert of "+server.Alias); err != nil {
+			return fmt.Sprintf("not reverted: %v", err)
+		}
+		changes := map[string]interface{}{"proxied": server.Proxied}
+		if server.TTL > 0 && server.Drain == nil && !server.Proxied {
+			changes["ttl"] = server.TTL
+		}
+		if *syncMetadata {
+			for key, value := range metadataFields(serverMetadata(server), record.Tags) {
+				changes[key] = value
+			}
+		} else if server.Comment != "" {
+			changes["comment"] = server.Comment
+		}
+		if err := journaledPatch(ctx, cfClient, *record, changes, ApplyOptions{Operator: "system", Source: "drift", Reason: "drift revert"}); err != nil {
+			return fmt.Sprintf("not reverted: %v", err)
+		}
+		logger.Audit(AuditEntry{Action: "drift_reverted", Operator: "system", Source: "drift", Success: true, Details: []string{item.Describe()}})
+		return "reverted"
+	}
 	
-	resp, err := c.httpClient.Do(req)
+	if !response.Success {
+		return fmt.Sprintf("not reverted: %s", response.Message)
+	}
+	for _, detail := range response.Details {
+		if detail.Status == "error" {
+			return fmt.Sprintf("not reverted: %s", detail.Message)
+		}
+	}
+	return "reverted"
+}
+
+// driftConfirmDelay is how long a difference has to persist before the drift
+// policy acts on it
+func driftConfirmDelay() time.Duration {
+	if *driftInterval > 0 {
+		return *driftInterval
+	}
+	return time.Minute
+}
+
+// checkDrift runs one reconciliation and applies the drift policy
+func checkDrift(ctx context.Context) *DriftReport {
+	// A manual check must not act on the same difference as a running one
+	driftRunMutex.Lock()
+	defer driftRunMutex.Unlock()
+	
+	report := &DriftReport{CheckedAt: time.Now(), Policy: *driftPolicy, Items: []DriftItem{}}
+	defer func() {
+		driftMutex.Lock()
+		lastDrift = report
+		driftMutex.Unlock()
+	}()
+	
+	config, err := loadServerConfig(*environment)
+	if err != nil || config == nil {
+		report.Error = "failed to load configuration"
+		return report
+	}
+	cfClient := NewCloudflareClient(credentials)
+	records, err := cfClient.GetDNSRecords(ctx)
 	if err != nil {
-		logger.Log("ERROR", fmt.Sprintf("Failed to fetch DNS records: %v", err))
-		return nil, err
+		report.Error = fmt.Sprintf("failed to fetch DNS records: %v", err)
+		return report
 	}
-	defer resp.Body.Close()
 	
-	var cfResp CloudflareResponse
-	if err := json.NewDecoder(resp.Body).Decode(&cfResp); err != nil {
-		return nil, err
+	// A report-only check changes neither the configuration nor the records
+	if *syncMetadata && *driftPolicy != "report" && !hasUnfinishedApplies() {
+		records = syncRecordMetadata(ctx, cfClient, records, *writeMetadata)
+		if synced, err := loadServerConfig(*environment); err == nil && synced != nil {
+			config = synced
+		}
 	}
 	
-	if !cfResp.Success {
-		return nil, fmt.Errorf("cloudflare API error: %v", cfResp.Errors)
+	report.Items = detectDrift(config, records)
+	
+	// Only act on differences that persisted for a whole interval, so changes
+	// made by the manager itself have time to reach the configuration
+	sightings := make(map[string]time.Time)
+	for i := range report.Items {
+		item := &report.Items[i]
+		item.FirstSeen = report.CheckedAt
+		if first, ok := driftSightings[item.key()]; ok {
+			item.FirstSeen = first
+		}
+		sightings[item.key()] = item.FirstSeen
+	}
+	driftSightings = sightings
+	if len(report.Items) == 0 {
+		return report
 	}
 	
-	// Filter to only include records ending with our domain
-	var filteredRecords []CloudflareRecord
-	for _, record := range cfResp.Result {
-		if strings.HasSuffix(record.Name, c.credentials.Domain) {
-			filteredRecords = append(filteredRecords, record)
+	for i := range report.Items {
+		item := &report.Items[i]
+		// A second of slack keeps ticker jitter from skipping a whole interval
+		if *driftPolicy != "report" && report.CheckedAt.Sub(item.FirstSeen) < driftConfirmDelay()-time.Second {
+			item.Action = fmt.Sprintf("waiting for confirmation (acted on once it persists for %s)", driftConfirmDelay())
+		} else if *driftPolicy != "report" && hasUnfinishedApplies() {
+			item.Action = "held until the unfinished apply is resumed or rolled back"
+		} else {
+			switch *driftPolicy {
+			case "adopt":
+				item.Action = adoptDrift(ctx, *item, records)
+			case "revert":
+				item.Action = revertDrift(ctx, cfClient, *item, config, records)
+			}
+		}
+		
+		message := "Drift detected: " + item.Describe()
+		if item.Action != "" {
+			message += " [" + item.Action + "]"
 		}
+		logger.Log("WARNING", message)
 	}
 	
-	logger.Log("INFO", fmt.Sprintf("Found %d DNS records for domain %s", len(filteredRecords), c.credentials.Domain))
-	return filteredRecords, nil
+	entry := AuditEntry{Action: "drift_detected", Operator: "system", Source: "drift", Reason: "policy " + *driftPolicy, Success: true}
+	for _, item := range report.Items {
+		line := item.Describe()
+		if item.Action != "" {
+			line += " [" + item.Action + "]"
+		}
+		entry.Details = append(entry.Details, line)
+	}
+	logger.Audit(entry)
+	publishEvent(UIEvent{
+		Type:     "drift",
+		Operator: "system",
+		Message:  fmt.Sprintf("%d differences between the configuration and Cloudflare", len(report.Items)),
+		Data:     report.Items,
+	})
+	return report
+}
+
+// currentDrift returns the last drift report, if any
+func currentDrift() *DriftReport {
+	driftMutex.Lock()
+	defer driftMutex.Unlock()
+	return lastDrift
+}
+
+// startDriftWorker reconciles the configuration with Cloudflare in the background
+func startDriftWorker() {
+	if *driftInterval <= 0 {
+		logger.Log("INFO", "Drift detection disabled")
+		return
+	}
+	runWorker(*driftInterval, true, func(ctx context.Context, now time.Time) {
+		checkDrift(ctx)
+	})
+	logger.Log("INFO", fmt.Sprintf("Drift detection started (every %s, policy %s)", *driftInterval, *driftPolicy))
+}
+
+// driftHandler returns the last drift report. It never runs a check, since
+// the adopt and revert policies change the configuration or the records;
+// that is left to POST /api/drift/check.
+func driftHandler(w http.ResponseWriter, r *http.Request) {
+	report := currentDrift()
+	
+	w.Header().Set("Content-Type", "application/json")
+	if report == nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"drift":   nil,
+			"message": "No drift check has run yet",
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": report.Error == "",
+		"drift":   report,
+	})
+}
+
+// checkDriftHandler runs a drift check right away
+func checkDriftHandler(w http.ResponseWriter, r *http.Request) {
+	report := checkDrift(r.Context())
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": report.Error == "",
+		"drift":   report,
+	})
+}
+
+// Activation profiles
+
+// Profile is a named snapshot of the active set
+type Profile struct {
+	Name      string         `json:"name"`
+	CreatedAt time.Time      `json:"created_at"`
+	CreatedBy string         `json:"created_by,omitempty"`
+	Servers   []ActiveServer `json:"servers"`
+}
+
+// ProfileSummary describes a profile and how it differs from the live state
+type ProfileSummary struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	Servers   int       `json:"servers"`
+	ToCreate  int       `json:"to_create"`
+	ToDelete  int       `json:"to_delete"`
+	IsCurrent bool      `json:"is_current"` // Live state matches the profile
+	Changes   []string  `json:"changes,omitempty"`
 }
 
-func (c *CloudflareClient) CreateDNSRecord(ip, dnsName, alias string, proxied bool, ttl int) (string, error) {
-	if ttl <= 0 {
-		ttl = 60 // Default to 1 minute
+// findProfile returns the profile with the given name
+func findProfile(config *ServerConfig, name string) *Profile {
+	if config == nil {
+		return nil
 	}
-	
-	// Construct full DNS name
-	fullName := dnsName
-	if !strings.Contains(dnsName, ".") {
-		fullName = dnsName + "." + c.credentials.Domain
-	} else if !strings.HasSuffix(dnsName, c.credentials.Domain) {
-		fullName = dnsName + "." + c.credentials.Domain
+	for i := range config.Profiles {
+		if strings.EqualFold(config.Profiles[i].Name, name) {
+			return &config.Profiles[i]
+		}
 	}
-	
-	payload := map[string]interface{}{
-		"type":    "A",
-		"name":    fullName,
-		"content": ip,
-		"ttl":     ttl,
-		"proxied": proxied,
-		"comment": alias,
+	return nil
+}
+
+// summarizeProfile diffs a profile against the live records
+func summarizeProfile(profile Profile, records []CloudflareRecord) ProfileSummary {
+	plan := planUpdate(records, UpdateRequest{ActiveServers: profile.Servers})
+	return ProfileSummary{
+		Name:      profile.Name,
+		CreatedAt: profile.CreatedAt,
+		CreatedBy: profile.CreatedBy,
+		Servers:   len(profile.Servers),
+		ToCreate:  len(plan.Create),
+		ToDelete:  len(plan.Delete),
+		IsCurrent: plan.IsEmpty(),
+		Changes:   plan.Describe(),
 	}
-	
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return "", err
+}
+
+// saveProfile stores the live active set under the given name, replacing an
+// existing profile with the same name
+func saveProfile(ctx context.Context, cfClient *CloudflareClient, name, operator string) (*Profile, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("profile name is required")
 	}
 	
-	req, err := c.makeRequest("POST", "/dns_records", bytes.NewBuffer(jsonData))
+	records, err := cfClient.GetDNSRecords(ctx)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("failed to fetch current records: %v", err)
 	}
 	
-	logger.Log("INFO", fmt.Sprintf("Creating DNS record for %s (%s)", alias, ip))
-	
-	// Retry logic with exponential backoff
-	var resp *http.Response
-	maxRetries := 3
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		if attempt > 0 {
-			delay := time.Duration(1<<uint(attempt)) * time.Second
-			logger.Log("INFO", fmt.Sprintf("Retrying after %v (attempt %d/%d)", delay, attempt+1, maxRetries))
-			time.Sleep(delay)
-		}
-		
-		resp, err = c.httpClient.Do(req)
-		if err == nil && resp.StatusCode != 429 {
-			break
+	var profile Profile
+	err = updateServerConfig(ctx, func(config *ServerConfig) error {
+		profile = Profile{
+			Name:      name,
+			CreatedAt: time.Now(),
+			CreatedBy: operator,
+			Servers:   currentActiveSet(config, records),
 		}
-		
-		if resp != nil {
-			resp.Body.Close()
+		if existing := findProfile(config, name); existing != nil {
+			*existing = profile
+		} else {
+			config.Profiles = append(config.Profiles, profile)
+			sort.Slice(config.Profiles, func(i, j int) bool {
+				return config.Profiles[i].Name < config.Profiles[j].Name
+			})
 		}
-	}
-	
+		return nil
+	})
 	if err != nil {
-		logger.Log("ERROR", fmt.Sprintf("Failed to create DNS record after %d attempts: %v", maxRetries, err))
-		return "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
 	
-	var cfResp CloudflareCreateResponse
-	if err := json.NewDecoder(resp.Body).Decode(&cfResp); err != nil {
-		return "", err
+	logger.Log("INFO", fmt.Sprintf("Saved profile %s with %d active entries", name, len(profile.Servers)))
+	logger.Audit(AuditEntry{Action: "profile_saved", Operator: operator, Success: true, Details: []string{fmt.Sprintf("%s (%d entries)", name, len(profile.Servers))}})
+	return &profile, nil
+}
+
+// switchToProfile makes the profile's active set live, going through the same
+// approval, freeze and guard checks as a manual update
+func switchToProfile(ctx context.Context, cfClient *CloudflareClient, name string, req UpdateRequest, operator, source string, progress func(UpdateDetail)) UpdateResponse {
+	config, err := loadServerConfig(*environment)
+	if err != nil {
+		return UpdateResponse{Success: false, Message: fmt.Sprintf("Failed to load configuration: %v", err)}
 	}
-	
-	if !cfResp.Success {
-		logger.Log("ERROR", fmt.Sprintf("Cloudflare API error: %v", cfResp.Errors))
-		return "", fmt.Errorf("cloudflare API error: %v", cfResp.Errors)
+	profile := findProfile(config, name)
+	if profile == nil {
+		return UpdateResponse{Success: false, Message: fmt.Sprintf("Profile %s not found", name)}
 	}
 	
-	// Verify creation
-	recordID := cfResp.Result.ID
-	logger.Log("INFO", fmt.Sprintf("Created record with ID: %s, verifying...", recordID))
-	
-	time.Sleep(2 * time.Second)
+	req.ActiveServers = profile.Servers
+	logger.Log("INFO", fmt.Sprintf("Switching to profile %s (requested by %s)", profile.Name, operator))
 	
-	if verified := c.VerifyRecord(recordID, ip); verified {
-		logger.Log("SUCCESS", fmt.Sprintf("DNS record for %s (%s) created and verified", alias, ip))
-		return recordID, nil
+	if approvalRequired() {
+		return submitChangeRequest(ctx, cfClient, req, operator)
 	}
-	
-	logger.Log("WARNING", "Record created but verification failed")
-	return recordID, nil
+	return applyUpdate(ctx, cfClient, req, ApplyOptions{
+		Operator: operator,
+		Source:   source,
+		Reason:   fmt.Sprintf("switched to profile %s", profile.Name),
+		Progress: progress,
+	})
 }
 
-func (c *CloudflareClient) DeleteDNSRecord(recordID string) error {
-	req, err := c.makeRequest("DELETE", fmt.Sprintf("/dns_records/%s", recordID), nil)
+// profilesHandler lists profiles with their difference to the live state
+func profilesHandler(w http.ResponseWriter, r *http.Request) {
+	config, err := loadServerConfig(*environment)
 	if err != nil {
-		return err
+		writeAPIError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to load configuration: %v", err))
+		return
 	}
 	
-	logger.Log("INFO", fmt.Sprintf("Deleting DNS record %s", recordID))
-	
-	resp, err := c.httpClient.Do(req)
+	cached, err := NewCloudflareClient(credentials).GetCachedDNSRecords(r.Context())
 	if err != nil {
-		logger.Log("ERROR", fmt.Sprintf("Failed to delete DNS record: %v", err))
-		return err
-	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("failed to delete record: status %d", resp.StatusCode)
+		writeAPIError(w, http.StatusBadGateway, fmt.Sprintf("Failed to fetch DNS records: %v", err))
+		return
 	}
+	records := cached.Records
 	
-	// Verify deletion
-	time.Sleep(2 * time.Second)
-	records, err := c.GetDNSRecords()
-	if err == nil {
-		for _, record := range records {
-			if record.ID == recordID {
-				logger.Log("WARNING", "Record deletion not yet propagated")
-				return nil
+	name := r.URL.Query().Get("name")
+	summaries := []ProfileSummary{}
+	if config != nil {
+		for _, profile := range config.Profiles {
+			if name != "" && !strings.EqualFold(profile.Name, name) {
+				continue
 			}
+			summaries = append(summaries, summarizeProfile(profile, records))
 		}
 	}
+	if name != "" && len(summaries) == 0 {
+		writeAPIError(w, http.StatusNotFound, fmt.Sprintf("Profile %s not found", name))
+		return
+	}
 	
-	logger.Log("SUCCESS", fmt.Sprintf("DNS record %s deleted and verified", recordID))
-	return nil
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"profiles": summaries,
+	})
 }
 
-func (c *CloudflareClient) VerifyRecord(recordID, expectedIP string) bool {
-	records, err := c.GetDNSRecords()
-	if err != nil {
-		return false
+// saveProfileHandler stores the live active set as a profile
+func saveProfileHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "Invalid request body")
+		return
 	}
 	
-	for _, record := range records {
-		if record.ID == recordID && record.Content == expectedIP {
-			return true
-		}
+	profile, err := saveProfile(r.Context(), NewCloudflareClient(credentials), req.Name, operatorFromRequest(r))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 	
-	return false
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("Profile %s saved with %d active entries", profile.Name, len(profile.Servers)),
+	})
 }
 
-// Credential management
-func getCredentials(env string) (*Credentials, error) {
-	creds := &Credentials{}
-	
-	// 1. Try command-line config file
-	if *configFile != "" {
-		logger.Log("INFO", fmt.Sprintf("Loading credentials from custom file: %s", *configFile))
-		if err := godotenv.Load(*configFile); err == nil {
-			creds.Token = os.Getenv("CF_API_TOKEN")
-			creds.ZoneID = os.Getenv("CF_ZONE_ID")
-			creds.Domain = os.Getenv("DNS_NAME")
-			if creds.Token != "" && creds.ZoneID != "" && creds.Domain != "" {
-				return creds, nil
-			}
-		}
+// applyProfileHandler switches the zone to a profile
+func applyProfileHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+		UpdateRequest
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		writeAPIError(w, http.StatusBadRequest, "Profile name is required")
+		return
 	}
 	
-	// 2. Try environment variables
-	if token := os.Getenv("CF_API_TOKEN"); token != "" {
-		logger.Log("INFO", "Loading credentials from environment variables")
-		creds.Token = token
-		creds.ZoneID = os.Getenv("CF_ZONE_ID")
-		creds.Domain = os.Getenv("DNS_NAME")
-		if creds.Token != "" && creds.ZoneID != "" && creds.Domain != "" {
-			return creds, nil
-		}
+	operator := operatorFromRequest(r)
+	runAsJob(w, r, "profile", func(ctx context.Context, progress func(UpdateDetail)) (bool, string, interface{}) {
+		return updateResult(switchToProfile(ctx, NewCloudflareClient(credentials), req.Name, req.UpdateRequest, operator, "profile", progress))
+	})
+}
+
+// deleteProfileHandler removes a profile
+func deleteProfileHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		writeAPIError(w, http.StatusBadRequest, "Profile name is required")
+		return
 	}
 	
-	// 3. Try .env file
-	envFile := fmt.Sprintf(".env.%s", env)
-	if _, err := os.Stat(envFile); err == nil {
-		logger.Log("INFO", fmt.Sprintf("Loading credentials from %s", envFile))
-		if err := godotenv.Load(envFile); err == nil {
-			creds.Token = os.Getenv("CF_API_TOKEN")
-			creds.ZoneID = os.Getenv("CF_ZONE_ID")
-			creds.Domain = os.Getenv("DNS_NAME")
-			if creds.Token != "" && creds.ZoneID != "" && creds.Domain != "" {
-				return creds, nil
+	err := updateServerConfig(r.Context(), func(config *ServerConfig) error {
+		for i := range config.Profiles {
+			if strings.EqualFold(config.Profiles[i].Name, req.Name) {
+				config.Profiles = append(config.Profiles[:i], config.Profiles[i+1:]...)
+				return nil
 			}
 		}
+		return fmt.Errorf("profile %s not found", req.Name)
+	})
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, err.Error())
+		return
 	}
 	
-	// 4. Interactive setup
-	logger.Log("INFO", "No credentials found, starting interactive setup")
-	return interactiveSetup(env)
+	logger.Log("INFO", fmt.Sprintf("Deleted profile %s", req.Name))
+	logger.Audit(AuditEntry{Action: "profile_deleted", Operator: operatorFromRequest(r), Success: true, Details: []string{req.Name}})
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("Profile %s deleted", req.Name),
+	})
 }
 
-func interactiveSetup(env string) (*Credentials, error) {
-	reader := bufio.NewReader(os.Stdin)
-	creds := &Credentials{}
-	
-	fmt.Printf("\n=== Cloudflare Credentials Setup for %s ===\n", strings.ToUpper(env))
-	fmt.Println("You can find these values in your Cloudflare dashboard")
-	fmt.Println("API Token: https://dash.cloudflare.com/profile/api-tokens")
-	fmt.Println("Zone ID: Domain Overview page -> API section\n")
-	
-	fmt.Print("Enter Cloudflare API Token: ")
-	token, _ := reader.ReadString('\n')
-	creds.Token = strings.TrimSpace(token)
+// runProfileCommand handles the -list-profiles, -save-profile and -apply-profile
+// command line options
+func runProfileCommand() error {
+	cfClient := NewCloudflareClient(credentials)
+	operator := cliOperator()
 	
-	fmt.Print("Enter Zone ID: ")
-	zoneID, _ := reader.ReadString('\n')
-	creds.ZoneID = strings.TrimSpace(zoneID)
+	switch {
+	case *saveProfileName != "":
+		profile, err := saveProfile(workCtx, cfClient, *saveProfileName, operator)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Profile %s saved with %d active entries\n", profile.Name, len(profile.Servers))
+		return nil
+		
+	case *applyProfileName != "":
+		if !approvalRequired() {
+			if err := openJournal(*environment); err != nil {
+				return err
+			}
+		}
+		response := switchToProfile(workCtx, cfClient, *applyProfileName, UpdateRequest{
+			BreakGlassReason: *breakGlassReason,
+			Force:            *forceReason != "",
+			ForceReason:      *forceReason,
+		}, operator, "cli", nil)
+		for _, detail := range response.Details {
+			fmt.Printf("  [%s] %s\n", detail.Status, detail.Message)
+		}
+		fmt.Println(response.Message)
+		if !response.Success {
+			return fmt.Errorf("switching to profile %s failed", *applyProfileName)
+		}
+		return nil
+	}
 	
-	fmt.Print("Enter DNS Name (e.g., xmr.qubic.li): ")
-	domain, _ := reader.ReadString('\n')
-	creds.Domain = strings.TrimSpace(domain)
+	// List profiles with their difference to the live state
+	config, err := loadServerConfig(*environment)
+	if err != nil {
+		return err
+	}
+	records, err := cfClient.GetDNSRecords(workCtx)
+	if err != nil {
+		return err
+	}
 	
-	// Save to .env file
-	envFile := fmt.Sprintf(".env.%s", env)
-	fmt.Printf("\nSave these credentials to %s? (y/n): ", envFile)
-	save, _ := reader.ReadString('\n')
+	if config == nil || len(config.Profiles) == 0 {
+		fmt.Printf("No profiles defined for %s environment\n", *environment)
+		return nil
+	}
 	
-	if strings.ToLower(strings.TrimSpace(save)) == "y" {
-		content := fmt.Sprintf("CF_API_TOKEN=%s\nCF_ZONE_ID=%s\nDNS_NAME=%s\n", 
-			creds.Token, creds.ZoneID, creds.Domain)
-		
-		if err := os.WriteFile(envFile, []byte(content), 0600); err != nil {
-			logger.Log("ERROR", fmt.Sprintf("Failed to save credentials: %v", err))
-		} else {
-			logger.Log("INFO", fmt.Sprintf("Credentials saved to %s", envFile))
+	fmt.Printf("\nProfiles for %s environment:\n", *environment)
+	fmt.Println(strings.Repeat("-", 80))
+	for _, profile := range config.Profiles {
+		summary := summarizeProfile(profile, records)
+		status := "differs from live state"
+		if summary.IsCurrent {
+			status = "CURRENT"
+		}
+		fmt.Printf("%s (%d entries, saved %s) - %s\n", summary.Name, summary.Servers, summary.CreatedAt.Format("2006-01-02 15:04"), status)
+		for _, change := range summary.Changes {
+			fmt.Printf("    %s\n", change)
 		}
 	}
-	
-	return creds, nil
+	return nil
 }
 
-// Server configuration management
-func loadServerConfig(env string) (*ServerConfig, error) {
-	configFile := fmt.Sprintf("servers.%s.json", env)
-	
-	data, err := os.ReadFile(configFile)
+// cliOperator identifies the operator for command line changes
+func cliOperator() string {
+	if *operatorName != "" {
+		return *operatorName
+	}
+	if user := os.Getenv("USER"); user != "" {
+		return user
+	}
+	return os.Getenv("USERNAME")
+}
+
+// Scheduler
+
+// Schedule activates or deactivates a server or a group of servers at a given
+// time or on a cron expression
+type Schedule struct {
+	ID          string     `json:"id"`
+	Action      string     `json:"action"`      // activate, deactivate
+	TargetType  string     `json:"target_type"` // server, account, container, name
+	Target      string     `json:"target"`      // UniqueID, tag or DNS name
+	At          *time.Time `json:"at,omitempty"`
+	Cron        string     `json:"cron,omitempty"`
+	Status      string     `json:"status"` // pending_approval, active, done, cancelled
+	CreatedBy   string     `json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ApprovedBy  string     `json:"approved_by,omitempty"`
+	NextRun     *time.Time `json:"next_run,omitempty"`
+	LastRun     *time.Time `json:"last_run,omitempty"`
+	LastSuccess bool       `json:"last_success"`
+	LastResult  string     `json:"last_result,omitempty"`
+}
+
+var schedulesMutex sync.Mutex
+
+func schedulesFile(env string) string {
+	return fmt.Sprintf("schedules.%s.json", env)
+}
+
+// loadSchedules reads all schedules. Callers must hold schedulesMutex.
+func loadSchedules(env string) ([]Schedule, error) {
+	data, err := os.ReadFile(schedulesFile(env))
 	if err != nil {
 		if os.IsNotExist(err) {
-			logger.Log("INFO", fmt.Sprintf("No server configuration found at %s", configFile))
-			return nil, nil
+			return []Schedule{}, nil
 		}
 		return nil, err
 	}
 	
-	var config ServerConfig
-	if err := json.Unmarshal(data, &config); err != nil {
+	var schedules []Schedule
+	if err := json.Unmarshal(data, &schedules); err != nil {
 		return nil, err
 	}
-	
-	// Initialize default available tags if not present
-	if len(config.AvailableAccounts) == 0 {
-		config.AvailableAccounts = []string{"Pool1", "Pool2", "Pool3", "Zgirt", "Jetski"}
-	}
-	if len(config.AvailableContainers) == 0 {
-		config.AvailableContainers = []string{"Group1", "Group2", "Test"}
-	}
-	
-	// Migrate: Add unique IDs to servers that don't have them
-	modified := false
-	for i := range config.Servers {
-		if config.Servers[i].UniqueID == "" {
-			config.Servers[i].UniqueID = generateServerID(config.Servers[i].Name, config.Servers[i].Content)
-			modified = true
-			logger.Log("INFO", fmt.Sprintf("Generated UniqueID for server %s (%s): %s", 
-				config.Servers[i].Name, config.Servers[i].Content, config.Servers[i].UniqueID))
-		}
+	return schedules, nil
+}
+
+// saveSchedules persists schedules. Callers must hold schedulesMutex.
+func saveSchedules(env string, schedules []Schedule) error {
+	data, err := json.MarshalIndent(schedules, "", "  ")
+	if err != nil {
+		return err
 	}
-	
-	// Save if we modified the config
-	if modified {
-		if err := saveServerConfig(env, &config); err != nil {
-			logger.Log("WARNING", fmt.Sprintf("Failed to save migrated config: %v", err))
-		} else {
-			logger.Log("INFO", "Saved config with generated unique IDs")
+	return os.WriteFile(schedulesFile(env), data, 0644)
+}
+
+// Describe returns a short human readable summary of the schedule
+func (s *Schedule) Describe() string {
+	when := ""
+	if s.Cron != "" {
+		when = fmt.Sprintf("cron %q", s.Cron)
+	} else if s.At != nil {
+		when = s.At.Format("2006-01-02 15:04")
+	}
+	return fmt.Sprintf("%s %s %s (%s)", s.Action, s.TargetType, s.Target, when)
+}
+
+// computeNextRun determines when the schedule fires next after the given time
+func (s *Schedule) computeNextRun(after time.Time) *time.Time {
+	if s.Cron != "" {
+		sched, err := parseCron(s.Cron)
+		if err != nil {
+			return nil
+		}
+		next := sched.Next(after)
+		if next.IsZero() {
+			return nil
 		}
+		return &next
 	}
-	
-	logger.Log("INFO", fmt.Sprintf("Loaded %d servers from %s", len(config.Servers), configFile))
-	return &config, nil
+	if s.At != nil && s.LastRun == nil {
+		at := *s.At
+		return &at
+	}
+	return nil
 }
 
-// Backup management functions
-func getBackupDir(configFile string) string {
-	if *backupDir != "" {
-		return *backupDir
+// scheduleTargets resolves the servers a schedule applies to
+func scheduleTargets(config *ServerConfig, s *Schedule) []Server {
+	var targets []Server
+	if config == nil {
+		return targets
 	}
-	return filepath.Dir(configFile)
+	for _, server := range config.Servers {
+		switch s.TargetType {
+		case "server":
+			if server.UniqueID == s.Target {
+				targets = append(targets, server)
+			}
+		case "account":
+			if server.Account == s.Target {
+				targets = append(targets, server)
+			}
+		case "container":
+			if server.Container == s.Target {
+				targets = append(targets, server)
+			}
+		case "name":
+			if server.Name == s.Target {
+				targets = append(targets, server)
+			}
+		}
+	}
+	return targets
 }
 
-func getBackupFiles(env string) ([]string, error) {
-	configFile := fmt.Sprintf("servers.%s.json", env)
-	dir := getBackupDir(configFile)
-	pattern := fmt.Sprintf("%s.backup-*", filepath.Base(configFile))
-	
-	files, err := filepath.Glob(filepath.Join(dir, pattern))
+// runSchedule executes one schedule and returns a summary of the outcome
+func runSchedule(ctx context.Context, s Schedule) (bool, string) {
+	config, err := loadServerConfig(*environment)
 	if err != nil {
-		return nil, err
+		return false, fmt.Sprintf("Failed to load configuration: %v", err)
 	}
 	
-	// Sort by modification time (newest first)
-	sort.Slice(files, func(i, j int) bool {
-		fi, _ := os.Stat(files[i])
-		fj, _ := os.Stat(files[j])
-		return fi.ModTime().After(fj.ModTime())
+	targets := scheduleTargets(config, &s)
+	if len(targets) == 0 {
+		return false, fmt.Sprintf("No servers match %s %s", s.TargetType, s.Target)
+	}
+	
+	// Groups may contain retired servers or servers in maintenance; leave those out
+	if s.Action == "activate" && s.TargetType != "server" {
+		var allowed []Server
+		for _, server := range targets {
+			if reason := activationBlocked(server); reason != "" {
+				logger.Log("INFO", fmt.Sprintf("Schedule %s skips %s", s.ID, reason))
+				continue
+			}
+			allowed = append(allowed, server)
+		}
+		if len(allowed) == 0 {
+			return false, fmt.Sprintf("No server of %s %s can be activated", s.TargetType, s.Target)
+		}
+		targets = allowed
+	}
+	
+	logger.Log("INFO", fmt.Sprintf("Running schedule %s: %s (%d servers)", s.ID, s.Describe(), len(targets)))
+	
+	cfClient := NewCloudflareClient(credentials)
+	response := applyServerChange(ctx, cfClient, targets, s.Action == "activate", ApplyOptions{
+		Operator: s.CreatedBy,
+		Approver: s.ApprovedBy,
+		ChangeID: "schedule-" + s.ID,
+		Source:   "schedule",
 	})
 	
-	return files, nil
+	success := response.Success
+	for _, detail := range response.Details {
+		if detail.Status == "error" {
+			success = false
+		}
+	}
+	return success, response.Message
 }
 
-func cleanOldBackups(env string) error {
-	if *keepBackups <= 0 {
-		return nil // Unlimited backups
-	}
-	
-	backups, err := getBackupFiles(env)
+// runDueSchedules executes all schedules whose next run time has passed
+func runDueSchedules(ctx context.Context, now time.Time) {
+	schedulesMutex.Lock()
+	schedules, err := loadSchedules(*environment)
 	if err != nil {
-		return err
+		schedulesMutex.Unlock()
+		logger.Log("ERROR", fmt.Sprintf("Failed to load schedules: %v", err))
+		return
 	}
 	
-	if len(backups) <= *keepBackups {
-		return nil
+	var due []Schedule
+	for i := range schedules {
+		s := &schedules[i]
+		if s.Status != "active" || s.NextRun == nil || s.NextRun.After(now) {
+			continue
+		}
+		
+		runAt := *s.NextRun
+		s.LastRun = &now
+		s.NextRun = s.computeNextRun(now)
+		if s.Cron == "" {
+			s.Status = "done"
+		}
+		
+		// Don't fire runs that were missed by a long time (e.g. while the manager was down)
+		if now.Sub(runAt) > *scheduleGrace {
+			s.LastSuccess = false
+			s.LastResult = fmt.Sprintf("Missed run at %s", runAt.Format("2006-01-02 15:04"))
+			logger.Log("WARNING", fmt.Sprintf("Schedule %s missed its run at %s, skipping", s.ID, runAt.Format(time.RFC3339)))
+			continue
+		}
+		due = append(due, *s)
 	}
+	if err := saveSchedules(*environment, schedules); err != nil {
+		logger.Log("ERROR", fmt.Sprintf("Failed to save schedules: %v", err))
+	}
+	schedulesMutex.Unlock()
 	
-	// Remove old backups
-	for i := *keepBackups; i < len(backups); i++ {
-		if err := os.Remove(backups[i]); err != nil {
-			logger.Log("ERROR", fmt.Sprintf("Failed to remove old backup %s: %v", backups[i], err))
-		} else {
-			logger.Log("INFO", fmt.Sprintf("Removed old backup: %s", filepath.Base(backups[i])))
+	for _, s := range due {
+		success, result := runSchedule(ctx, s)
+		
+		level := "SUCCESS"
+		if !success {
+			level = "ERROR"
 		}
+		logger.Log(level, fmt.Sprintf("Schedule %s finished: %s", s.ID, result))
+		
+		schedulesMutex.Lock()
+		if schedules, err := loadSchedules(*environment); err == nil {
+			for i := range schedules {
+				if schedules[i].ID == s.ID {
+					schedules[i].LastSuccess = success
+					schedules[i].LastResult = result
+				}
+			}
+			if err := saveSchedules(*environment, schedules); err != nil {
+				logger.Log("ERROR", fmt.Sprintf("Failed to save schedules: %v", err))
+			}
+		}
+		schedulesMutex.Unlock()
 	}
-	
-	return nil
 }
 
-func createBackup(env string) (string, error) {
-	configFile := fmt.Sprintf("servers.%s.json", env)
+// startScheduler runs due schedules in the background
+func startScheduler() {
+	runWorker(30*time.Second, false, runDueSchedules)
+	logger.Log("INFO", "Scheduler started")
+}
+
+// visibleSchedules returns the schedules shown in the web interface: all open
+// ones plus those that finished during the last day
+func visibleSchedules() []Schedule {
+	schedulesMutex.Lock()
+	defer schedulesMutex.Unlock()
 	
-	// Check if config exists
-	data, err := os.ReadFile(configFile)
+	schedules, err := loadSchedules(*environment)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return "", fmt.Errorf("no configuration file to backup: %s", configFile)
-		}
-		return "", err
+		logger.Log("WARNING", fmt.Sprintf("Failed to load schedules: %v", err))
+		return nil
 	}
 	
-	// Create backup filename
-	dir := getBackupDir(configFile)
-	backupFile := filepath.Join(dir, fmt.Sprintf("%s.backup-%s", filepath.Base(configFile), time.Now().Format("20060102-150405")))
-	
-	// Ensure backup directory exists
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return "", err
+	cutoff := time.Now().Add(-24 * time.Hour)
+	var visible []Schedule
+	for _, s := range schedules {
+		if s.Status == "active" || s.Status == "pending_approval" || (s.LastRun != nil && s.LastRun.After(cutoff)) {
+			visible = append(visible, s)
+		}
 	}
+	return visible
+}
+
+// schedulesHandler lists schedules
+func schedulesHandler(w http.ResponseWriter, r *http.Request) {
+	schedulesMutex.Lock()
+	schedules, err := loadSchedules(*environment)
+	schedulesMutex.Unlock()
 	
-	// Write backup
-	if err := os.WriteFile(backupFile, data, 0644); err != nil {
-		return "", err
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to load schedules: %v", err))
+		return
 	}
 	
-	logger.Log("INFO", fmt.Sprintf("Backup created: %s", backupFile))
-	
-	// Clean old backups
-	cleanOldBackups(env)
-	
-	return backupFile, nil
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"schedules": schedules,
+	})
 }
 
-func restoreBackup(backupFile string, env string) error {
-	// Read backup file
-	data, err := os.ReadFile(backupFile)
-	if err != nil {
-		return fmt.Errorf("failed to read backup file: %v", err)
+// addScheduleHandler creates a new schedule
+func addScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	var s Schedule
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "Invalid request body")
+		return
 	}
 	
-	// Validate it's valid JSON
-	var config ServerConfig
-	if err := json.Unmarshal(data, &config); err != nil {
-		return fmt.Errorf("invalid backup file format: %v", err)
+	if s.Action != "activate" && s.Action != "deactivate" {
+		writeAPIError(w, http.StatusBadRequest, "Action must be activate or deactivate")
+		return
 	}
-	
-	// Create a backup of current config before restoring
-	configFile := fmt.Sprintf("servers.%s.json", env)
-	if _, err := os.Stat(configFile); err == nil {
-		if _, err := createBackup(env); err != nil {
-			logger.Log("WARNING", fmt.Sprintf("Failed to backup current config: %v", err))
+	switch s.TargetType {
+	case "server", "account", "container", "name":
+	default:
+		writeAPIError(w, http.StatusBadRequest, "Target type must be server, account, container or name")
+		return
+	}
+	if s.Target == "" {
+		writeAPIError(w, http.StatusBadRequest, "Target is required")
+		return
+	}
+	if s.Cron != "" {
+		if _, err := parseCron(s.Cron); err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("Invalid cron expression: %v", err))
+			return
 		}
+		s.At = nil
+	} else if s.At == nil || s.At.Before(time.Now()) {
+		writeAPIError(w, http.StatusBadRequest, "Either a future time or a cron expression is required")
+		return
 	}
 	
-	// Restore the backup
-	if err := os.WriteFile(configFile, data, 0644); err != nil {
-		return fmt.Errorf("failed to restore backup: %v", err)
+	config, _ := loadServerConfig(*environment)
+	if len(scheduleTargets(config, &s)) == 0 {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("No servers match %s %s", s.TargetType, s.Target))
+		return
 	}
 	
-	logger.Log("INFO", fmt.Sprintf("Configuration restored from %s", backupFile))
-	return nil
-}
-
-func listBackupFiles(env string) error {
-	backups, err := getBackupFiles(env)
-	if err != nil {
-		return err
+	s.ID = randomID(4)
+	s.CreatedBy = operatorFromRequest(r)
+	s.CreatedAt = time.Now()
+	s.ApprovedBy = ""
+	s.LastRun = nil
+	s.LastResult = ""
+	s.NextRun = s.computeNextRun(time.Now())
+	s.Status = "active"
+	if approvalRequired() {
+		if s.CreatedBy == "" {
+			writeAPIError(w, http.StatusBadRequest, operatorRequiredMessage())
+			return
+		}
+		s.Status = "pending_approval"
 	}
 	
-	if len(backups) == 0 {
-		fmt.Printf("No backups found for %s environment\n", env)
-		return nil
+	schedulesMutex.Lock()
+	schedules, err := loadSchedules(*environment)
+	if err == nil {
+		schedules = append(schedules, s)
+		err = saveSchedules(*environment, schedules)
+	}
+	schedulesMutex.Unlock()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save schedule: %v", err))
+		return
 	}
 	
-	fmt.Printf("\nAvailable backups for %s environment:\n", env)
-	fmt.Println(strings.Repeat("-", 80))
+	logger.Log("INFO", fmt.Sprintf("Schedule %s created by %s: %s", s.ID, s.CreatedBy, s.Describe()))
+	logger.Audit(AuditEntry{Action: "schedule_created", Operator: s.CreatedBy, ChangeID: "schedule-" + s.ID, Success: true, Details: []string{s.Describe()}})
 	
-	for i, backup := range backups {
-		info, err := os.Stat(backup)
+	message := fmt.Sprintf("Schedule created: %s", s.Describe())
+	if s.Status == "pending_approval" {
+		message += " (waiting for approval by another operator)"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"message":  message,
+		"schedule": s,
+	})
+}
+
+// updateScheduleHandler returns a handler that cancels or approves a schedule
+func updateScheduleHandler(action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" {
+			writeAPIError(w, http.StatusBadRequest, "Schedule ID is required")
+			return
+		}
+		operator := operatorFromRequest(r)
+		
+		schedulesMutex.Lock()
+		defer schedulesMutex.Unlock()
+		
+		schedules, err := loadSchedules(*environment)
 		if err != nil {
-			continue
+			writeAPIError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to load schedules: %v", err))
+			return
 		}
 		
-		// Extract timestamp from filename
-		base := filepath.Base(backup)
+		var s *Schedule
+		for i := range schedules {
+			if schedules[i].ID == req.ID {
+				s = &schedules[i]
+				break
+			}
+		}
+		if s == nil {
+			writeAPIError(w, http.StatusNotFound, "Schedule not found")
+			return
+		}
 		
-		fmt.Printf("%2d. %s\n", i+1, base)
-		fmt.Printf("    Size: %d bytes | Modified: %s\n", 
-			info.Size(), 
-			info.ModTime().Format("2006-01-02 15:04:05"))
+		switch action {
+		case "cancel":
+			if s.Status != "active" && s.Status != "pending_approval" {
+				writeAPIError(w, http.StatusConflict, fmt.Sprintf("Schedule is %s", s.Status))
+				return
+			}
+			s.Status = "cancelled"
+			s.NextRun = nil
+		case "approve":
+			if s.Status != "pending_approval" {
+				writeAPIError(w, http.StatusConflict, fmt.Sprintf("Schedule is %s", s.Status))
+				return
+			}
+			if operator == "" || strings.EqualFold(operator, s.CreatedBy) {
+				writeAPIError(w, http.StatusConflict, "Schedule must be approved by a different operator")
+				return
+			}
+			s.Status = "active"
+			s.ApprovedBy = operator
+			s.NextRun = s.computeNextRun(time.Now())
+		}
 		
-		if i < *keepBackups {
-			fmt.Printf("    Status: KEPT (within retention limit)\n")
-		} else {
-			fmt.Printf("    Status: TO BE REMOVED (exceeds retention limit)\n")
+		if err := saveSchedules(*environment, schedules); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save schedules: %v", err))
+			return
 		}
-		fmt.Println()
+		
+		logger.Log("INFO", fmt.Sprintf("Schedule %s %s by %s", s.ID, s.Status, operator))
+		logger.Audit(AuditEntry{Action: "schedule_" + action, Operator: s.CreatedBy, Approver: s.ApprovedBy, ChangeID: "schedule-" + s.ID, Success: true, Details: []string{s.Describe()}})
+		
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":  true,
+			"message":  fmt.Sprintf("Schedule %s is now %s", s.ID, s.Status),
+			"schedule": s,
+		})
+	}
+}
+
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	health := map[string]interface{}{
+		"status":      "healthy",
+		"version":     Version,
+		"build_time":  BuildTime,
+		"environment": *environment,
+		"uptime":      time.Since(startTime).String(),
 	}
 	
-	fmt.Printf("Retention policy: Keep %d most recent backups\n", *keepBackups)
-	fmt.Printf("Backup directory: %s\n", getBackupDir(fmt.Sprintf("servers.%s.json", env)))
+	// Cloudflare connection, as seen by the last fetch of the record cache
+	cfClient := NewCloudflareClient(credentials)
+	cached, err := cfClient.GetCachedDNSRecords(r.Context())
+	health["cloudflare_connected"] = err == nil && cached.Error == nil
+	if err == nil {
+		health["records_fetched_at"] = cached.FetchedAt
+		health["records_stale"] = cached.Stale
+		health["records_total"] = cached.Total
+		health["records_complete"] = cached.Total.Complete()
+	}
+	
+	// Servers in maintenance
+	maintenance := []map[string]interface{}{}
+	if config, err := loadServerConfig(*environment); err == nil && config != nil {
+		for _, server := range config.Servers {
+			if server.State != "maintenance" || server.Maintenance == nil {
+				continue
+			}
+			maintenance = append(maintenance, map[string]interface{}{
+				"unique_id":    server.UniqueID,
+				"alias":        server.Alias,
+				"name":         server.Name,
+				"ip":           server.Content,
+				"owner":        server.Maintenance.Owner,
+				"reason":       server.Maintenance.Reason,
+				"started_at":   server.Maintenance.StartedAt,
+				"expected_end": server.Maintenance.ExpectedEnd,
+				"overdue":      server.Maintenance.IsOverdue(),
+			})
+		}
+	}
+	health["maintenance"] = maintenance
 	
-	return nil
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(health)
 }
 
-func saveServerConfig(env string, config *ServerConfig) error {
-	configFile := fmt.Sprintf("servers.%s.json", env)
+var startTime = time.Now()
+
+// createDNSHandler handles creating new DNS entries
+func createDNSHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	var req struct {
+		Name             string `json:"name"`
+		IP               string `json:"ip"`
+		Alias            string `json:"alias"`
+		TTL              int    `json:"ttl"`
+		Proxied          bool   `json:"proxied"`
+		ExpiresIn        string `json:"expires_in"`
+		BreakGlassReason string `json:"break_glass_reason"`
+	}
 	
-	// Create backup if file exists
-	if _, err := os.Stat(configFile); err == nil {
-		if _, err := createBackup(env); err != nil {
-			logger.Log("WARNING", fmt.Sprintf("Failed to create backup: %v", err))
-		}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Invalid request body",
+		})
+		return
 	}
 	
-	config.LastSync = time.Now()
+	// Validate inputs
+	if req.Name == "" || req.IP == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Name and IP are required",
+		})
+		return
+	}
 	
-	data, err := json.MarshalIndent(config, "", "  ")
-	if err != nil {
-		return err
+	if _, _, err := parseExpiresIn(req.ExpiresIn); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
 	}
 	
-	if err := os.WriteFile(configFile, data, 0644); err != nil {
-		return err
+	// Set default TTL if not provided
+	if req.TTL <= 0 {
+		req.TTL = 60
 	}
 	
-	logger.Log("INFO", fmt.Sprintf("Server configuration saved to %s", configFile))
-	return nil
-}
-
-func importFromCloudflare(env string, records []CloudflareRecord) (*ServerConfig, error) {
-	config := &ServerConfig{
-		Environment: env,
-		Domain:      credentials.Domain,
-		Servers:     []Server{},
+	// Set alias to name if not provided
+	if req.Alias == "" {
+		req.Alias = req.Name
 	}
 	
-	for _, record := range records {
-		// Use comment as alias, or generate one
-		alias := record.Comment
-		if alias == "" {
-			alias = fmt.Sprintf("server-%s", strings.ReplaceAll(record.Content, ".", "-"))
-		}
-		
-		now := time.Now().Format(time.RFC3339)
-		server := Server{
-			// Unique identifier
-			UniqueID:        generateServerID(record.Name, record.Content),
-			
-			// Custom fields
-			Alias:           alias,
-			Description:     fmt.Sprintf("Imported from Cloudflare on %s", time.Now().Format("2006-01-02")),
-			FirstSeenOn:     now,
-			LastActivatedOn: now, // It's active when we import it
-			
-			// Cloudflare configuration
-			Type:    record.Type,
-			Name:    record.Name,
-			Content: record.Content,
-			TTL:     record.TTL,
-			Proxied: record.Proxied,
-			Comment: record.Comment,
-			Tags:    record.Tags,
-			
-			// Transient fields (set but not saved)
-			ID:         record.ID,
-			CreatedOn:  record.CreatedOn,
-			ModifiedOn: record.ModifiedOn,
-			Proxiable:  record.Proxiable,
-		}
-		
-		config.Servers = append(config.Servers, server)
+	// Check freeze windows; a server recreated by hand keeps its configured tags
+	freezeConfig, _ := loadServerConfig(*environment)
+	if err := checkActivations(freezeConfig, UpdatePlan{Create: []ActiveServer{{Name: req.Name, IP: req.IP}}}); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+	target := serverTags(freezeConfig, fullDNSName(req.Name), req.IP)
+	if err := enforceFreeze(freezeConfig, []freezeTarget{target}, req.BreakGlassReason, operatorFromRequest(r), fmt.Sprintf("create %s -> %s", req.Name, req.IP)); err != nil {
+		writeFrozenError(w, err.(*FreezeError))
+		return
 	}
 	
-	return config, nil
-}
-
-// Web handlers
-func indexHandler(w http.ResponseWriter, r *http.Request) {
+	// Create Cloudflare client
 	cfClient := NewCloudflareClient(credentials)
 	
-	// Load server configuration
-	config, err := loadServerConfig(*environment)
+	// Create DNS record
+	info := ActiveServer{IP: req.IP, Name: req.Name, Alias: req.Alias, Proxied: req.Proxied, TTL: req.TTL}
+	recordID, verification, err := journaledCreate(r.Context(), cfClient, info, RecordMetadata{Alias: req.Alias}, ApplyOptions{Operator: operatorFromRequest(r), Source: "create"})
 	if err != nil {
-		http.Error(w, "Failed to load configuration", http.StatusInternalServerError)
+		logger.Log("ERROR", fmt.Sprintf("Failed to create DNS record: %v", err))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to create DNS record: %v", err),
+		})
 		return
 	}
 	
-	// Get current DNS records
-	records, err := cfClient.GetDNSRecords()
-	if err != nil {
-		http.Error(w, "Failed to fetch DNS records", http.StatusInternalServerError)
-		return
+	// Add new server to config
+	fullName := req.Name
+	if !strings.Contains(req.Name, ".") {
+		fullName = req.Name + "." + credentials.Domain
+	} else if !strings.HasSuffix(req.Name, credentials.Domain) {
+		fullName = req.Name + "." + credentials.Domain
 	}
 	
-	// If no config exists, offer to import
-	if config == nil {
-		if len(records) > 0 {
-			// Auto-import from Cloudflare
-			config, err = importFromCloudflare(*environment, records)
-			if err != nil {
-				http.Error(w, "Failed to import configuration", http.StatusInternalServerError)
-				return
-			}
-			
-			if err := saveServerConfig(*environment, config); err != nil {
-				logger.Log("ERROR", fmt.Sprintf("Failed to save imported config: %v", err))
-			}
-		} else {
-			// Create empty config
-			config = &ServerConfig{
-				Environment: *environment,
-				Domain:      credentials.Domain,
-				Servers:     []Server{},
-				AvailableAccounts: []string{"Pool1", "Pool2", "Pool3", "Zgirt", "Jetski"},
-				AvailableContainers: []string{"Group1", "Group2", "Test"},
-			}
-		}
+	now := time.Now().Format(time.RFC3339)
+	newServer := Server{
+		UniqueID:        generateServerID(fullName, req.IP),
+		Alias:           req.Alias,
+		Type:            "A",
+		Name:            fullName,
+		Content:         req.IP,
+		TTL:             req.TTL,
+		Proxied:         req.Proxied,
+		FirstSeenOn:     now,
+		LastActivatedOn: now,
+		State:           "active",
+		StateChangedOn:  now,
 	}
 	
-	// Build active IP map
-	activeIPs := make(map[string]CloudflareRecord)
-	for _, record := range records {
-		activeIPs[record.Content] = record
-	}
+	setServerExpiry(&newServer, req.ExpiresIn, time.Now())
 	
-	// Prepare template data
-	type DNSEntry struct {
-		UniqueID    string // Unique identifier for this entry
-		Name        string // The DNS name (e.g., "xmr", "us.xmr")
-		IP          string // The IP address for this entry
-		Alias       string // The descriptive alias from config
-		Account     string // Account tag
-		Container   string // Container tag
-		Proxied     bool
-		TTL         int
-		IsActive    bool
-		RecordID    string
-		FirstSeenOn string // Creation date for sorting
+	if err := updateServerConfig(context.WithoutCancel(r.Context()), func(config *ServerConfig) error {
+		// Check if server already exists in config
+		for i, server := range config.Servers {
+			if server.UniqueID == newServer.UniqueID {
+				config.Servers[i].LastActivatedOn = now
+				setState(&config.Servers[i], "active", "created via web UI")
+				setServerExpiry(&config.Servers[i], req.ExpiresIn, time.Now())
+				return nil
+			}
+		}
+		config.Servers = append(config.Servers, newServer)
+		return nil
+	}); err != nil {
+		logger.Log("WARNING", fmt.Sprintf("DNS record created but failed to save config: %v", err))
 	}
 	
-	type ServerGroup struct {
-		Name             string // DNS name (primary grouping key)
-		Alias            string // Display alias for the group
-		IPs              string // Concatenated IPs separated by semicolon
-		Notes            string // Editable notes for this server
-		Entries          []DNSEntry
-		HasActiveEntries bool
-	}
+	logger.Log("INFO", fmt.Sprintf("Created DNS record: %s -> %s (ID: %s)", req.Name, req.IP, recordID))
+	active := true
+	publishEvent(UIEvent{
+		Type:     "activation",
+		Operator: operatorFromRequest(r),
+		Client:   clientFromRequest(r),
+		Message:  fmt.Sprintf("%s created %s -> %s", operatorFromRequest(r), fullName, req.IP),
+		Servers:  []ServerEvent{{UniqueID: newServer.UniqueID, Name: fullName, IP: req.IP, Alias: req.Alias, Active: &active, State: "active"}},
+	})
 	
-	// First, create a map of all known servers from config indexed by UniqueID
-	configByID := make(map[string]Server)
-	for _, server := range config.Servers {
-		if server.UniqueID != "" {
-			configByID[server.UniqueID] = server
-		}
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":      true,
+		"message":      fmt.Sprintf("DNS record created successfully: %s -> %s", req.Name, req.IP),
+		"id":           recordID,
+		"verification": verification,
+	})
+}
+
+// deleteDNSHandler handles deleting DNS entries
+func deleteDNSHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	var req struct {
+		Name             string `json:"name"`
+		IP               string `json:"ip"`
+		BreakGlassReason string `json:"break_glass_reason"`
+		Force            bool   `json:"force"`
+		ForceReason      string `json:"force_reason"`
 	}
 	
-	// Also create a fallback map indexed by IP+Name for servers without UniqueID
-	type serverKey struct {
-		ip   string
-		name string
-	}
-	configByKey := make(map[serverKey]Server)
-	for _, server := range config.Servers {
-		// Extract DNS name for the key
-		dnsName := strings.TrimSuffix(server.Name, "."+credentials.Domain)
-		key := serverKey{ip: server.Content, name: dnsName}
-		configByKey[key] = server
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Invalid request body",
+		})
+		return
 	}
 	
-	// Group all DNS records by NAME
-	serverGroupsMap := make(map[string]*ServerGroup)
-	activeCount := 0
-	
-	// Process all active DNS records from Cloudflare
-	for _, record := range records {
-		ip := record.Content
-		
-		// Use the full domain name as the grouping key
-		dnsName := record.Name
-		
-		// Get or create server group for this NAME
-		if _, exists := serverGroupsMap[dnsName]; !exists {
-			serverGroupsMap[dnsName] = &ServerGroup{
-				Name:    dnsName,
-				Alias:   "",
-				IPs:     "",
-				Notes:   "",
-				Entries: []DNSEntry{},
-			}
-		}
-		
-		// Generate unique ID for this entry
-		uniqueID := generateServerID(record.Name, ip)
-		
-		// Get alias, account, and container from config if available
-		alias := record.Comment
-		account := ""
-		container := ""
-		
-		// First try to find by UniqueID
-		if configServer, exists := configByID[uniqueID]; exists {
-			if configServer.Alias != "" {
-				alias = configServer.Alias
-			}
-			account = configServer.Account
-			container = configServer.Container
-		} else {
-			// Fallback to key-based lookup
-			key := serverKey{ip: ip, name: dnsName}
-			if configServer, exists := configByKey[key]; exists {
-				if configServer.Alias != "" {
-					alias = configServer.Alias
-				}
-				account = configServer.Account
-				container = configServer.Container
-			}
-		}
-		
-		if alias == "" {
-			alias = dnsName
-		}
-		
-		// Get FirstSeenOn from config if available
-		firstSeenOn := ""
-		if configServer, exists := configByID[uniqueID]; exists {
-			firstSeenOn = configServer.FirstSeenOn
-		}
-		
-		entry := DNSEntry{
-			UniqueID:    uniqueID,
-			Name:        dnsName,
-			IP:          ip,
-			Alias:       alias,
-			Account:     account,
-			Container:   container,
-			Proxied:     record.Proxied,
-			TTL:         record.TTL,
-			IsActive:    true,
-			RecordID:    record.ID,
-			FirstSeenOn: firstSeenOn,
-		}
-		
-		serverGroupsMap[dnsName].Entries = append(serverGroupsMap[dnsName].Entries, entry)
-		serverGroupsMap[dnsName].HasActiveEntries = true
-		activeCount++
-		
-		// Set or update the group's alias
-		if serverGroupsMap[dnsName].Alias == "" {
-			serverGroupsMap[dnsName].Alias = alias
-		}
-		
-		// Add IP to the group's IP list
-		if serverGroupsMap[dnsName].IPs == "" {
-			serverGroupsMap[dnsName].IPs = ip
-		} else if !strings.Contains(serverGroupsMap[dnsName].IPs, ip) {
-			serverGroupsMap[dnsName].IPs += ", " + ip
-		}
-		
-		// Get notes from config if available (use the first non-empty notes found)
-		if serverGroupsMap[dnsName].Notes == "" {
-			if cfgServer, exists := configByID[uniqueID]; exists && cfgServer.Notes != "" {
-				serverGroupsMap[dnsName].Notes = cfgServer.Notes
-			} else {
-				key := serverKey{ip: ip, name: dnsName}
-				if cfgServer, exists := configByKey[key]; exists && cfgServer.Notes != "" {
-					serverGroupsMap[dnsName].Notes = cfgServer.Notes
-				}
-			}
+	// Validate inputs
+	if req.Name == "" || req.IP == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Name and IP are required",
+		})
+		return
+	}
+	
+	// Create Cloudflare client
+	cfClient := NewCloudflareClient(credentials)
+	
+	// Get all DNS records to find the one to delete
+	records, err := cfClient.GetDNSRecords(r.Context())
+	if err != nil {
+		logger.Log("ERROR", fmt.Sprintf("Failed to fetch DNS records: %v", err))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Failed to fetch DNS records",
+		})
+		return
+	}
+	
+	// Find the record to delete
+	var recordToDelete *CloudflareRecord
+	fullName := req.Name
+	if !strings.HasSuffix(req.Name, credentials.Domain) {
+		fullName = req.Name + "." + credentials.Domain
+	}
+	
+	for _, record := range records {
+		if record.Name == fullName && record.Content == req.IP {
+			recordToDelete = &record
+			break
 		}
 	}
 	
-	// Add inactive servers from config
-	for _, server := range config.Servers {
-		if _, isActive := activeIPs[server.Content]; !isActive {
-			ip := server.Content
-			
-			// Use full domain name for consistency
-			dnsName := server.Name
-			
-			// Get or create server group by NAME
-			if _, exists := serverGroupsMap[dnsName]; !exists {
-				serverGroupsMap[dnsName] = &ServerGroup{
-					Name:    dnsName,
-					Alias:   server.Alias,
-					IPs:     ip,
-					Notes:   server.Notes,
-					Entries: []DNSEntry{},
-				}
-			} else {
-				// Add IP if not already present
-				if !strings.Contains(serverGroupsMap[dnsName].IPs, ip) {
-					if serverGroupsMap[dnsName].IPs == "" {
-						serverGroupsMap[dnsName].IPs = ip
-					} else {
-						serverGroupsMap[dnsName].IPs += ", " + ip
-					}
-				}
-				// Add notes if not already present
-				if serverGroupsMap[dnsName].Notes == "" && server.Notes != "" {
-					serverGroupsMap[dnsName].Notes = server.Notes
-				}
-			}
-			
-			// Generate unique ID if not present
-			uniqueID := server.UniqueID
-			if uniqueID == "" {
-				uniqueID = generateServerID(server.Name, server.Content)
-			}
-			
-			entry := DNSEntry{
-				UniqueID:    uniqueID,
-				Name:        dnsName,
-				IP:          ip,
-				Alias:       server.Alias,
-				Account:     server.Account,
-				Container:   server.Container,
-				Proxied:     server.Proxied,
-				TTL:         server.TTL,
-				IsActive:    false,
-				RecordID:    "",
-				FirstSeenOn: server.FirstSeenOn,
+	if recordToDelete == nil {
+		// Also try without domain suffix
+		shortName := strings.TrimSuffix(req.Name, "."+credentials.Domain)
+		for _, record := range records {
+			recordName := strings.TrimSuffix(record.Name, "."+credentials.Domain)
+			if recordName == shortName && record.Content == req.IP {
+				recordToDelete = &record
+				break
 			}
-			
-			serverGroupsMap[dnsName].Entries = append(serverGroupsMap[dnsName].Entries, entry)
 		}
 	}
 	
-	// Convert map to sorted slice
-	var serverGroups []ServerGroup
-	for _, group := range serverGroupsMap {
-		serverGroups = append(serverGroups, *group)
+	if recordToDelete == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "DNS record not found",
+		})
+		return
 	}
 	
-	// Sort server groups by Name
-	sort.Slice(serverGroups, func(i, j int) bool {
-		return serverGroups[i].Name < serverGroups[j].Name
-	})
-	
-	// Count total unique servers (by IP)
-	totalServers := len(serverGroupsMap)
+	// Check freeze windows
+	freezeConfig, _ := loadServerConfig(*environment)
+	if err := enforceFreeze(freezeConfig, []freezeTarget{serverTags(freezeConfig, recordToDelete.Name, req.IP)}, req.BreakGlassReason, operatorFromRequest(r), fmt.Sprintf("delete %s -> %s", req.Name, req.IP)); err != nil {
+		writeFrozenError(w, err.(*FreezeError))
+		return
+	}
 	
-	// Count total entries and inactive entries
-	totalEntries := 0
-	for _, group := range serverGroups {
-		totalEntries += len(group.Entries)
+	// Check the blast-radius guard (never leave a name without records)
+	if err := enforceBlastRadius(records, UpdatePlan{Delete: []CloudflareRecord{*recordToDelete}}, req.Force, req.ForceReason, operatorFromRequest(r)); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"guarded": true,
+			"error":   err.Error(),
+		})
+		return
 	}
-	inactiveCount := totalEntries - activeCount
-	if inactiveCount < 0 {
-		inactiveCount = 0
+	
+	// Delete the DNS record
+	verification, err := journaledDelete(r.Context(), cfClient, *recordToDelete, ApplyOptions{Operator: operatorFromRequest(r), Source: "delete"})
+	if err != nil {
+		logger.Log("ERROR", fmt.Sprintf("Failed to delete DNS record: %v", err))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Failed to delete DNS record: %v", err),
+		})
+		return
 	}
 	
-	data := map[string]interface{}{
-		"Environment":        *environment,
-		"Domain":             config.Domain,
-		"ServerGroups":       serverGroups,
-		"TotalServers":       totalServers,
-		"ActiveCount":        activeCount,
-		"InactiveCount":      inactiveCount,
-		"LastUpdate":         time.Now().Format("2006-01-02 15:04:05"),
-		"AvailableAccounts":  config.AvailableAccounts,
-		"AvailableContainers": config.AvailableContainers,
+	// Update server config - keep the server as retired so its history is not lost
+	state := "retired"
+	if err := updateServerConfig(context.WithoutCancel(r.Context()), func(config *ServerConfig) error {
+		for i := range config.Servers {
+			if config.Servers[i].Name == recordToDelete.Name && config.Servers[i].Content == req.IP {
+				config.Servers[i].ExpiresAt = ""
+				config.Servers[i].Drain = nil
+				config.Servers[i].LastDeactivatedOn = time.Now().Format(time.RFC3339)
+				config.Servers[i].DeactivationReason = "deleted"
+				state = retireServer(&config.Servers[i], effectiveState(config.Servers[i], records), "record deleted")
+				break
+			}
+		}
+		return nil
+	}); err != nil {
+		logger.Log("WARNING", fmt.Sprintf("DNS record deleted but failed to update config: %v", err))
 	}
 	
-	tmpl := template.Must(template.New("index").Funcs(template.FuncMap{
-		"toUpper": strings.ToUpper,
-	}).Parse(indexHTML))
+	logger.Log("INFO", fmt.Sprintf("Deleted DNS record: %s -> %s", req.Name, req.IP))
+	inactive := false
+	publishEvent(UIEvent{
+		Type:     "activation",
+		Operator: operatorFromRequest(r),
+		Client:   clientFromRequest(r),
+		Message:  fmt.Sprintf("%s deleted %s -> %s", operatorFromRequest(r), recordToDelete.Name, req.IP),
+		Servers:  []ServerEvent{{Name: recordToDelete.Name, IP: req.IP, Active: &inactive, State: state}},
+	})
 	
-	if err := tmpl.Execute(w, data); err != nil {
-		http.Error(w, "Failed to render template", http.StatusInternalServerError)
-	}
-}
-
-type UpdateRequest struct {
-	ActiveServers []struct {
-		IP        string `json:"ip"`
-		Name      string `json:"name"`      // DNS name like "xmr" or "us.xmr"
-		Alias     string `json:"alias"`
-		Account   string `json:"account"`   // Account tag
-		Container string `json:"container"` // Container tag
-		Proxied   bool   `json:"proxied"`
-		TTL       int    `json:"ttl"`
-		Active    bool   `json:"active"`
-	} `json:"active_servers"`
-}
-
-type UpdateResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-	Details []struct {
-		Message string `json:"message"`
-		Status  string `json:"status"`
-	} `json:"details"`
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":      true,
+		"message":      fmt.Sprintf("DNS record deleted successfully: %s -> %s", req.Name, req.IP),
+		"verification": verification,
+	})
 }
 
-func updateHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// Tag update handler
+func updateTagHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UniqueID string `json:"unique_id"`
+		IP       string `json:"ip"`
+		Name     string `json:"name"`
+		TagType  string `json:"tag_type"`
+		Value    string `json:"value"`
 	}
 	
-	var req UpdateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
 	
-	cfClient := NewCloudflareClient(credentials)
-	response := UpdateResponse{Success: true}
+	// Find and update the server
+	found := false
+	var updated Server
+	err := updateServerConfig(r.Context(), func(config *ServerConfig) error {
+		// First try to find by UniqueID
+		if req.UniqueID != "" {
+			for i := range config.Servers {
+				if config.Servers[i].UniqueID == req.UniqueID {
+					if req.TagType == "account" {
+						config.Servers[i].Account = req.Value
+					} else if req.TagType == "container" {
+						config.Servers[i].Container = req.Value
+					}
+					found = true
+					logger.Log("INFO", fmt.Sprintf("Found and updated server by UniqueID: %s (%s)", config.Servers[i].Name, req.IP))
+					break
+				}
+			}
+		}
+		
+		// If not found by UniqueID, try fallback method
+		if !found {
+			for i := range config.Servers {
+				// Extract DNS name from full name for comparison
+				serverDNSName := strings.TrimSuffix(config.Servers[i].Name, "."+credentials.Domain)
+			
+				if config.Servers[i].Content == req.IP && serverDNSName == req.Name {
+					// Generate and save UniqueID if missing
+					if config.Servers[i].UniqueID == "" {
+						config.Servers[i].UniqueID = generateServerID(config.Servers[i].Name, config.Servers[i].Content)
+					}
+				
+					if req.TagType == "account" {
+						config.Servers[i].Account = req.Value
+					} else if req.TagType == "container" {
+						config.Servers[i].Container = req.Value
+					}
+					found = true
+					logger.Log("INFO", fmt.Sprintf("Found and updated server by IP+Name: %s (%s)", config.Servers[i].Name, req.IP))
+					break
+				}
+			}
+		}
+		
+		// If not found in config but it's an active DNS record, add it
+		if !found {
+			cfClient := NewCloudflareClient(credentials)
+			records, err := cfClient.GetDNSRecords(r.Context())
+			if err == nil {
+				for _, record := range records {
+					dnsName := strings.TrimSuffix(record.Name, "."+credentials.Domain)
+					if record.Content == req.IP && dnsName == req.Name {
+						// Add to config
+						now := time.Now().Format(time.RFC3339)
+						newServer := Server{
+							UniqueID:        generateServerID(record.Name, record.Content),
+							Alias:           record.Alias(),
+							Description:     fmt.Sprintf("Added via tag update on %s", time.Now().Format("2006-01-02")),
+							FirstSeenOn:     now,
+							LastActivatedOn: now,
+							Type:            "A",
+							Name:            record.Name,
+							Content:         record.Content,
+							TTL:             record.TTL,
+							Proxied:         record.Proxied,
+							Comment:         record.Comment,
+						}
+					
+						if req.TagType == "account" {
+							newServer.Account = req.Value
+						} else if req.TagType == "container" {
+							newServer.Container = req.Value
+						}
+					
+						config.Servers = append(config.Servers, newServer)
+						found = true
+						break
+					}
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf("server not found")
+		}
+		
+		for _, server := range config.Servers {
+			if (req.UniqueID != "" && server.UniqueID == req.UniqueID) || (server.Content == req.IP && server.Name == fullDNSName(req.Name)) {
+				updated = server
+				break
+			}
+		}
+		return nil
+	})
 	
-	// Get current DNS records
-	records, err := cfClient.GetDNSRecords()
+	if !found {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "Server not found",
+		})
+		return
+	}
 	if err != nil {
-		response.Success = false
-		response.Message = fmt.Sprintf("Failed to fetch current records: %v", err)
-		json.NewEncoder(w).Encode(response)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("Failed to save configuration: %v", err),
+		})
 		return
 	}
 	
-	// Build map of current records by key (name+ip)
-	type recordKey struct {
-		name string
-		ip   string
-	}
-	currentRecords := make(map[recordKey]CloudflareRecord)
-	for _, record := range records {
-		// Extract subdomain
-		dnsName := strings.TrimSuffix(record.Name, "."+credentials.Domain)
-		key := recordKey{name: dnsName, ip: record.Content}
-		currentRecords[key] = record
+	logger.Log("INFO", fmt.Sprintf("Updated %s tag to '%s' for %s (%s)", req.TagType, req.Value, req.Name, req.IP))
+	
+	// Keep the metadata stored with the record in sync
+	message := "Tag updated successfully"
+	if err := writeServerMetadata(r.Context(), NewCloudflareClient(credentials), updated, operatorFromRequest(r)); err != nil {
+		logger.Log("WARNING", fmt.Sprintf("Failed to write metadata of %s (%s) to its record: %v", updated.Alias, updated.Content, err))
+		message = fmt.Sprintf("Tag updated, but the record comment could not be updated: %v", err)
 	}
+	changed := ServerEvent{UniqueID: req.UniqueID, Name: fullDNSName(req.Name), IP: req.IP}
+	if req.TagType == "account" {
+		changed.Account = &req.Value
+	} else if req.TagType == "container" {
+		changed.Container = &req.Value
+	}
+	publishEvent(UIEvent{
+		Type:     "tags",
+		Operator: operatorFromRequest(r),
+		Client:   clientFromRequest(r),
+		Message:  fmt.Sprintf("%s set %s of %s (%s) to '%s'", operatorFromRequest(r), req.TagType, req.Name, req.IP, req.Value),
+		Servers:  []ServerEvent{changed},
+	})
 	
-	// Build map of requested records
-	requestedRecords := make(map[recordKey]struct {
-		alias     string
-		account   string
-		container string
-		proxied   bool
-		ttl       int
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": message,
 	})
-	for _, server := range req.ActiveServers {
-		key := recordKey{name: server.Name, ip: server.IP}
-		requestedRecords[key] = struct {
-			alias     string
-			account   string
-			container string
-			proxied   bool
-			ttl       int
-		}{
-			alias:     server.Alias,
-			account:   server.Account,
-			container: server.Container,
-			proxied:   server.Proxied,
-			ttl:       server.TTL,
-		}
+}
+
+// Notes update handler
+func updateNotesHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name  string `json:"name"`  // Now grouped by name instead of IP
+		Notes string `json:"notes"`
 	}
 	
-	// Load server config for updating timestamps
-	config, err := loadServerConfig(*environment)
-	if err != nil {
-		logger.Log("WARNING", fmt.Sprintf("Failed to load config for timestamp updates: %v", err))
-		// Create empty config if it doesn't exist
-		config = &ServerConfig{
-			Environment: *environment,
-			Domain:      credentials.Domain,
-			Servers:     []Server{},
-		}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
 	}
 	
-	// Process changes
-	changes := 0
-	
-	// Add new records
-	for key, info := range requestedRecords {
-		if _, exists := currentRecords[key]; !exists {
-			detail := struct {
-				Message string `json:"message"`
-				Status  string `json:"status"`
-			}{}
-			
-			_, err := cfClient.CreateDNSRecord(key.ip, key.name, info.alias, info.proxied, info.ttl)
-			if err != nil {
-				detail.Message = fmt.Sprintf("Failed to activate %s (%s -> %s): %v", key.name, info.alias, key.ip, err)
-				detail.Status = "error"
-			} else {
-				proxyStatus := "DNS-only"
-				if info.proxied {
-					proxyStatus = "proxied"
-				}
-				detail.Message = fmt.Sprintf("✓ Activated %s (%s -> %s) [%s, TTL: %d]", key.name, info.alias, key.ip, proxyStatus, info.ttl)
-				detail.Status = "success"
-				changes++
-				
-				// Update or add to config
-				found := false
-				for i := range config.Servers {
-					if config.Servers[i].Content == key.ip && config.Servers[i].Name == key.name+"."+credentials.Domain {
-						config.Servers[i].LastActivatedOn = time.Now().Format(time.RFC3339)
-						found = true
-						break
-					}
-				}
-				if !found {
-					// Add new server to config
-					now := time.Now().Format(time.RFC3339)
-					fullName := key.name + "." + credentials.Domain
-					config.Servers = append(config.Servers, Server{
-						UniqueID:        generateServerID(fullName, key.ip),
-						Alias:           info.alias,
-						Account:         info.account,
-						Container:       info.container,
-						Description:     fmt.Sprintf("Added via web UI on %s", time.Now().Format("2006-01-02")),
-						FirstSeenOn:     now,
-						LastActivatedOn: now,
-						Type:            "A",
-						Name:            fullName,
-						Content:         key.ip,
-						TTL:             info.ttl,
-						Proxied:         info.proxied,
-						Comment:         info.alias,
-					})
-				}
+	// Update notes for all servers with this name
+	updated := false
+	err := updateServerConfig(r.Context(), func(config *ServerConfig) error {
+		for i := range config.Servers {
+			if config.Servers[i].Name == req.Name {
+				config.Servers[i].Notes = req.Notes
+				updated = true
+				logger.Log("INFO", fmt.Sprintf("Updated notes for server %s", config.Servers[i].Name))
 			}
-			
-			response.Details = append(response.Details, detail)
 		}
-	}
-	
-	// Remove records
-	for key, record := range currentRecords {
-		if _, shouldExist := requestedRecords[key]; !shouldExist {
-			detail := struct {
-				Message string `json:"message"`
-				Status  string `json:"status"`
-			}{}
-			
-			err := cfClient.DeleteDNSRecord(record.ID)
-			if err != nil {
-				detail.Message = fmt.Sprintf("Failed to deactivate %s (%s -> %s): %v", key.name, record.Comment, key.ip, err)
-				detail.Status = "error"
-			} else {
-				detail.Message = fmt.Sprintf("✓ Deactivated %s (%s -> %s)", key.name, record.Comment, key.ip)
-				detail.Status = "success"
-				changes++
-			}
-			
-			response.Details = append(response.Details, detail)
+		if !updated {
+			return fmt.Errorf("no servers found with this name")
 		}
-	}
+		return nil
+	})
 	
-	if changes == 0 {
-		response.Message = "No changes required"
-	} else {
-		response.Message = fmt.Sprintf("Successfully updated %d DNS records", changes)
-		
-		// Save updated configuration with new timestamps
-		if err := saveServerConfig(*environment, config); err != nil {
-			logger.Log("ERROR", fmt.Sprintf("Failed to save config after updates: %v", err))
-		}
+	if !updated {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "No servers found with this name",
+		})
+		return
 	}
-	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
-
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	health := map[string]interface{}{
-		"status":      "healthy",
-		"version":     Version,
-		"build_time":  BuildTime,
-		"environment": *environment,
-		"uptime":      time.Since(startTime).String(),
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("Failed to save configuration: %v", err),
+		})
+		return
 	}
 	
-	// Test Cloudflare connection
-	cfClient := NewCloudflareClient(credentials)
-	_, err := cfClient.GetDNSRecords()
-	health["cloudflare_connected"] = err == nil
+	logger.Log("INFO", fmt.Sprintf("Updated notes for name %s", req.Name))
+	publishEvent(UIEvent{
+		Type:     "notes",
+		Operator: operatorFromRequest(r),
+		Client:   clientFromRequest(r),
+		Message:  fmt.Sprintf("%s updated the notes of %s", operatorFromRequest(r), req.Name),
+		Servers:  []ServerEvent{{Name: req.Name, Notes: &req.Notes}},
+	})
 	
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(health)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Notes updated successfully",
+	})
 }
 
-var startTime = time.Now()
-
-// createDNSHandler handles creating new DNS entries
-func createDNSHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	
-	// Parse request body
+// addTagHandler handles adding new tags
+func addTagHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Name    string `json:"name"`
-		IP      string `json:"ip"`
-		Alias   string `json:"alias"`
-		TTL     int    `json:"ttl"`
-		Proxied bool   `json:"proxied"`
+		TagType string `json:"tag_type"`
+		TagName string `json:"tag_name"`
 	}
 	
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "Invalid request body",
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "Invalid request format",
 		})
 		return
 	}
 	
-	// Validate inputs
-	if req.Name == "" || req.IP == "" {
+	// Validate tag type
+	if req.TagType != "account" && req.TagType != "container" {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "Name and IP are required",
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "Invalid tag type",
 		})
 		return
 	}
 	
-	// Set default TTL if not provided
-	if req.TTL <= 0 {
-		req.TTL = 60
-	}
-	
-	// Set alias to name if not provided
-	if req.Alias == "" {
-		req.Alias = req.Name
+	// Validate tag name
+	req.TagName = strings.TrimSpace(req.TagName)
+	if req.TagName == "" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "Tag name cannot be empty",
+		})
+		return
 	}
 	
-	// Create Cloudflare client
-	cfClient := NewCloudflareClient(credentials)
+	// Add the new tag if it doesn't already exist
+	err := updateServerConfig(r.Context(), func(config *ServerConfig) error {
+		if req.TagType == "account" {
+			// Check if already exists
+			exists := false
+			for _, tag := range config.AvailableAccounts {
+				if tag == req.TagName {
+					exists = true
+					break
+				}
+			}
+			if !exists {
+				config.AvailableAccounts = append(config.AvailableAccounts, req.TagName)
+				sort.Strings(config.AvailableAccounts)
+			}
+		} else {
+			// Container
+			exists := false
+			for _, tag := range config.AvailableContainers {
+				if tag == req.TagName {
+					exists = true
+					break
+				}
+			}
+			if !exists {
+				config.AvailableContainers = append(config.AvailableContainers, req.TagName)
+				sort.Strings(config.AvailableContainers)
+			}
+		}
+		return nil
+	})
 	
-	// Create DNS record
-	recordID, err := cfClient.CreateDNSRecord(req.IP, req.Name, req.Alias, req.Proxied, req.TTL)
 	if err != nil {
-		logger.Log("ERROR", fmt.Sprintf("Failed to create DNS record: %v", err))
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": fmt.Sprintf("Failed to create DNS record: %v", err),
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("Failed to save configuration: %v", err),
 		})
 		return
 	}
 	
-	// Update server config
-	config, err := loadServerConfig(*environment)
-	if err != nil {
-		// Create new config if it doesn't exist
-		config = &ServerConfig{
-			Environment: *environment,
-			Domain:      credentials.Domain,
-			Servers:     []Server{},
+	logger.Log("INFO", fmt.Sprintf("Added new %s tag: %s", req.TagType, req.TagName))
+	publishEvent(UIEvent{
+		Type:     "tags",
+		Operator: operatorFromRequest(r),
+		Client:   clientFromRequest(r),
+		Message:  fmt.Sprintf("%s added the %s option %s", operatorFromRequest(r), req.TagType, req.TagName),
+		Data:     map[string]string{"tag_type": req.TagType, "tag_name": req.TagName},
+	})
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("Added new %s: %s", req.TagType, req.TagName),
+	})
+}
+
+// Request protection
+
+// generateCSRFToken creates the per-process token that the web interface
+// has to send back with every mutating request
+func generateCSRFToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// isAllowedHost reports whether the given host (without port) may be used to
+// reach the web interface. This protects against DNS rebinding.
+func isAllowedHost(host string) bool {
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	switch host {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	if hostname, err := os.Hostname(); err == nil && strings.EqualFold(host, hostname) {
+		return true
+	}
+	for _, allowed := range strings.Split(*allowedHosts, ",") {
+		if allowed = strings.TrimSpace(allowed); allowed != "" && strings.EqualFold(host, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostOnly strips the port from a host[:port] value
+func hostOnly(hostport string) string {
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		return h
+	}
+	return hostport
+}
+
+// operatorFromRequest identifies the operator behind a request: the common name
+// of a verified client certificate, or the name sent by the web interface.
+// When approvals are required the header is not trusted, since anyone can
+// send it to approve their own change under another name.
+func operatorFromRequest(r *http.Request) string {
+	// An approved change is replayed on behalf of the operator who requested it
+	if change, ok := r.Context().Value(approvedChangeKey{}).(*ChangeRequest); ok {
+		return change.RequestedBy
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		if cn := r.TLS.VerifiedChains[0][0].Subject.CommonName; cn != "" {
+			return cn
+		}
+	}
+	if approvalRequired() {
+		return ""
+	}
+	return strings.TrimSpace(r.Header.Get("X-Operator"))
+}
+
+// operatorRequiredMessage explains how to identify when no operator was found
+func operatorRequiredMessage() string {
+	if approvalRequired() {
+		return "A verified client certificate is required to identify the operator when approvals are required (see -tls-client-ca)"
+	}
+	return "Operator name required"
+}
+
+// writeAPIError writes a JSON error response in the format used by the API
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"message": message,
+		"error":   message,
+	})
+}
+
+// hostCheckMiddleware rejects requests addressed to an unexpected Host header
+func hostCheckMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAllowedHost(hostOnly(r.Host)) {
+			logger.Log("WARNING", fmt.Sprintf("Rejected request for unexpected host %q from %s", r.Host, r.RemoteAddr))
+			http.Error(w, "Invalid host", http.StatusForbidden)
+			return
 		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkSameOrigin verifies that a browser request originates from the page
+// served by this process
+func checkSameOrigin(r *http.Request) error {
+	if site := r.Header.Get("Sec-Fetch-Site"); site == "cross-site" || site == "same-site" {
+		return fmt.Errorf("cross-site request rejected")
 	}
 	
-	// Add new server to config
-	fullName := req.Name
-	if !strings.Contains(req.Name, ".") {
-		fullName = req.Name + "." + credentials.Domain
-	} else if !strings.HasSuffix(req.Name, credentials.Domain) {
-		fullName = req.Name + "." + credentials.Domain
+	source := r.Header.Get("Origin")
+	if source == "" || source == "null" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		// Non-browser clients (curl, scripts) do not send Origin/Referer;
+		// they are still required to present the CSRF token
+		return nil
 	}
 	
-	now := time.Now().Format(time.RFC3339)
-	newServer := Server{
-		UniqueID:        generateServerID(fullName, req.IP),
-		Alias:           req.Alias,
-		Type:            "A",
-		Name:            fullName,
-		Content:         req.IP,
-		TTL:             req.TTL,
-		Proxied:         req.Proxied,
-		FirstSeenOn:     now,
-		LastActivatedOn: now,
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return fmt.Errorf("invalid origin %q", source)
+	}
+	rest := source[strings.Index(source, "://")+3:]
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		rest = rest[:i]
+	}
+	if !strings.EqualFold(rest, r.Host) {
+		return fmt.Errorf("origin %q does not match host %q", source, r.Host)
+	}
+	return nil
+}
+
+// protectAPI wraps a mutating endpoint with method, content type, origin and
+// CSRF token checks
+func protectAPI(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeAPIError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		
+		if mediaType := strings.TrimSpace(strings.Split(r.Header.Get("Content-Type"), ";")[0]); !strings.EqualFold(mediaType, "application/json") {
+			writeAPIError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+			return
+		}
+		
+		if err := checkSameOrigin(r); err != nil {
+			logger.Log("WARNING", fmt.Sprintf("Rejected %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err))
+			writeAPIError(w, http.StatusForbidden, "Cross-origin request rejected")
+			return
+		}
+		
+		token := r.Header.Get("X-CSRF-Token")
+		if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(csrfToken)) != 1 {
+			logger.Log("WARNING", fmt.Sprintf("Rejected %s %s from %s: missing or invalid CSRF token", r.Method, r.URL.Path, r.RemoteAddr))
+			writeAPIError(w, http.StatusForbidden, "Missing or invalid CSRF token")
+			return
+		}
+		
+		next(w, r)
+	}
+}
+
+// csrfTokenHandler hands out the CSRF token to scripted API clients. Browsers
+// on other origins cannot read the response because of the same-origin policy.
+func csrfTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"token": csrfToken})
+}
+
+// TLS management
+
+// tlsRequested reports whether the web interface should be served over HTTPS
+func tlsRequested() bool {
+	return *tlsEnabled || *tlsCert != "" || *tlsKey != "" || *tlsClientCA != ""
+}
+
+// selfSignedCertPaths returns where the generated certificate and key are stored,
+// next to the server configuration of the given environment
+func selfSignedCertPaths(env string) (string, string) {
+	dir := filepath.Dir(fmt.Sprintf("servers.%s.json", env))
+	return filepath.Join(dir, fmt.Sprintf("tls.%s.crt", env)), filepath.Join(dir, fmt.Sprintf("tls.%s.key", env))
+}
+
+// loadOrCreateSelfSignedCert reuses a previously generated certificate if it is still
+// valid, otherwise it generates a new one and persists it
+func loadOrCreateSelfSignedCert(env string) (string, string, error) {
+	certFile, keyFile := selfSignedCertPaths(env)
+	
+	if data, err := os.ReadFile(certFile); err == nil {
+		if block, _ := pem.Decode(data); block != nil {
+			if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+				if _, err := os.Stat(keyFile); err == nil && time.Now().Add(24*time.Hour).Before(cert.NotAfter) {
+					logger.Log("INFO", fmt.Sprintf("Using self-signed certificate %s (valid until %s)", certFile, cert.NotAfter.Format("2006-01-02")))
+					return certFile, keyFile, nil
+				}
+			}
+		}
+		logger.Log("INFO", fmt.Sprintf("Self-signed certificate %s is invalid or about to expire, regenerating", certFile))
+	}
+	
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate key: %v", err)
 	}
 	
-	// Check if server already exists in config
-	found := false
-	for i, server := range config.Servers {
-		if server.UniqueID == newServer.UniqueID {
-			config.Servers[i].LastActivatedOn = now
-			found = true
-			break
-		}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate serial number: %v", err)
 	}
 	
-	if !found {
-		config.Servers = append(config.Servers, newServer)
+	dnsNames := []string{"localhost"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" && hostname != "localhost" {
+		dnsNames = append(dnsNames, hostname)
 	}
 	
-	// Save updated config
-	if err := saveServerConfig(*environment, config); err != nil {
-		logger.Log("WARNING", fmt.Sprintf("DNS record created but failed to save config: %v", err))
+	now := time.Now()
+	certTemplate := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "XMR Server Manager", Organization: []string{"XMR Server Manager"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              dnsNames,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
 	}
 	
-	logger.Log("INFO", fmt.Sprintf("Created DNS record: %s -> %s (ID: %s)", req.Name, req.IP, recordID))
+	der, err := x509.CreateCertificate(rand.Reader, &certTemplate, &certTemplate, &key.PublicKey, key)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create certificate: %v", err)
+	}
 	
-	// Return success response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": fmt.Sprintf("DNS record created successfully: %s -> %s", req.Name, req.IP),
-		"id":      recordID,
-	})
-}
-
-// deleteDNSHandler handles deleting DNS entries
-func deleteDNSHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode key: %v", err)
 	}
 	
-	// Parse request body
-	var req struct {
-		Name string `json:"name"`
-		IP   string `json:"ip"`
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return "", "", err
 	}
 	
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "Invalid request body",
-		})
-		return
+	logger.Log("INFO", fmt.Sprintf("Generated self-signed certificate %s (valid until %s)", certFile, certTemplate.NotAfter.Format("2006-01-02")))
+	return certFile, keyFile, nil
+}
+
+// buildTLSConfig prepares the server TLS configuration, including client
+// certificate verification when -tls-client-ca is set
+func buildTLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
 	}
 	
-	// Validate inputs
-	if req.Name == "" || req.IP == "" {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "Name and IP are required",
-		})
-		return
+	if *tlsClientCA != "" {
+		caData, err := os.ReadFile(*tlsClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("no certificates found in %s", *tlsClientCA)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		logger.Log("INFO", fmt.Sprintf("Mutual TLS enabled (client CA: %s)", *tlsClientCA))
 	}
 	
-	// Create Cloudflare client
-	cfClient := NewCloudflareClient(credentials)
+	return tlsConfig, nil
+}
+
+// startHTTPRedirect runs a plain HTTP listener that redirects every request to HTTPS
+func startHTTPRedirect(redirectPort, httpsPort int) *http.Server {
+	addr := fmt.Sprintf(":%d", redirectPort)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		target := fmt.Sprintf("https://%s%s", net.JoinHostPort(host, fmt.Sprintf("%d", httpsPort)), r.URL.RequestURI())
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+	
+	logger.Log("INFO", fmt.Sprintf("HTTP redirect listener starting on %s", addr))
+	server := &http.Server{Addr: addr, Handler: handler}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Log("ERROR", fmt.Sprintf("HTTP redirect listener failed: %v", err))
+		}
+	}()
+	return server
+}
+
+// openBrowser opens the default browser to the specified URL
+func openBrowser(url string) error {
+	var err error
+	
+	switch runtime.GOOS {
+	case "linux":
+		err = exec.Command("xdg-open", url).Start()
+	case "windows":
+		err = exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	case "darwin":
+		err = exec.Command("open", url).Start()
+	default:
+		err = fmt.Errorf("unsupported platform")
+	}
 	
-	// Get all DNS records to find the one to delete
-	records, err := cfClient.GetDNSRecords()
 	if err != nil {
-		logger.Log("ERROR", fmt.Sprintf("Failed to fetch DNS records: %v", err))
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "Failed to fetch DNS records",
-		})
-		return
+		logger.Log("WARNING", fmt.Sprintf("Failed to open browser: %v", err))
+	} else {
+		logger.Log("INFO", fmt.Sprintf("Opening browser at %s", url))
 	}
 	
-	// Find the record to delete
-	var recordToDelete *CloudflareRecord
-	fullName := req.Name
-	if !strings.HasSuffix(req.Name, credentials.Domain) {
-		fullName = req.Name + "." + credentials.Domain
+	return err
+}
+
+// Propagation checks
+
+// ResolverResult is the answer of one nameserver for one name
+type ResolverResult struct {
+	Resolver string   `json:"resolver"`
+	Kind     string   `json:"kind"` // authoritative or recursive
+	IPs      []string `json:"ips"`
+	Match    bool     `json:"match"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// NamePropagation tracks one changed name across all nameservers
+type NamePropagation struct {
+	Name      string           `json:"name"`
+	Desired   []string         `json:"desired"`
+	Skipped   string           `json:"skipped,omitempty"` // Why the name is not checked
+	Results   []ResolverResult `json:"results"`
+	Converged bool             `json:"converged"`
+}
+
+// PropagationCheck follows the names changed by one update until every
+// nameserver returns the desired A set or -propagation-timeout passes
+type PropagationCheck struct {
+	ID        string            `json:"id"`
+	StartedAt time.Time         `json:"started_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	Rounds    int               `json:"rounds"`
+	Names     []NamePropagation `json:"names"`
+	Converged bool              `json:"converged"`
+	Done      bool              `json:"done"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// nameserver is a DNS server queried by a propagation check
+type nameserver struct {
+	label   string
+	address string // host:port
+	kind    string
+}
+
+// propagationChecks keeps the most recent checks in memory
+var propagationChecks struct {
+	mu     sync.Mutex
+	checks map[string]*PropagationCheck
+	order  []string
+}
+
+const maxPropagationChecks = 20 // Checks kept for the API
+
+// propagationInterval is the pause between query rounds
+var propagationInterval = 10 * time.Second
+
+// startPropagationCheck begins checking the names touched by a plan in the
+// background and returns the check ID, or "" if checks are disabled
+func startPropagationCheck(plan UpdatePlan, active []ActiveServer) string {
+	if *propagationTimeout <= 0 {
+		return ""
 	}
 	
-	for _, record := range records {
-		if record.Name == fullName && record.Content == req.IP {
-			recordToDelete = &record
-			break
-		}
+	changed := make(map[string]bool)
+	for _, server := range plan.Create {
+		changed[fullDNSName(server.Name)] = true
+	}
+	for _, record := range plan.Delete {
+		changed[record.Name] = true
 	}
 	
-	if recordToDelete == nil {
-		// Also try without domain suffix
-		shortName := strings.TrimSuffix(req.Name, "."+credentials.Domain)
-		for _, record := range records {
-			recordName := strings.TrimSuffix(record.Name, "."+credentials.Domain)
-			if recordName == shortName && record.Content == req.IP {
-				recordToDelete = &record
-				break
+	var names []NamePropagation
+	for name := range changed {
+		entry := NamePropagation{Name: name, Desired: []string{}}
+		for _, server := range active {
+			if fullDNSName(server.Name) != name {
+				continue
+			}
+			entry.Desired = append(entry.Desired, server.IP)
+			if server.Proxied {
+				entry.Skipped = "proxied through Cloudflare, resolvers return Cloudflare addresses"
 			}
 		}
+		sort.Strings(entry.Desired)
+		names = append(names, entry)
 	}
+	sort.Slice(names, func(i, j int) bool { return names[i].Name < names[j].Name })
 	
-	if recordToDelete == nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "DNS record not found",
-		})
-		return
+	check := &PropagationCheck{ID: randomID(4), StartedAt: time.Now(), UpdatedAt: time.Now(), Names: names}
+	propagationChecks.mu.Lock()
+	if propagationChecks.checks == nil {
+		propagationChecks.checks = make(map[string]*PropagationCheck)
+	}
+	propagationChecks.checks[check.ID] = check
+	propagationChecks.order = append(propagationChecks.order, check.ID)
+	if len(propagationChecks.order) > maxPropagationChecks {
+		delete(propagationChecks.checks, propagationChecks.order[0])
+		propagationChecks.order = propagationChecks.order[1:]
 	}
+	propagationChecks.mu.Unlock()
 	
-	// Delete the DNS record
-	if err := cfClient.DeleteDNSRecord(recordToDelete.ID); err != nil {
-		logger.Log("ERROR", fmt.Sprintf("Failed to delete DNS record: %v", err))
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": fmt.Sprintf("Failed to delete DNS record: %v", err),
+	go runPropagationCheck(workCtx, check.ID, names)
+	return check.ID
+}
+
+// getPropagationCheck returns a copy of a check
+func getPropagationCheck(id string) (PropagationCheck, bool) {
+	propagationChecks.mu.Lock()
+	defer propagationChecks.mu.Unlock()
+	check, ok := propagationChecks.checks[id]
+	if !ok {
+		return PropagationCheck{}, false
+	}
+	return *check, true
+}
+
+// updatePropagationCheck applies a change to a stored check
+func updatePropagationCheck(id string, modify func(check *PropagationCheck)) {
+	propagationChecks.mu.Lock()
+	defer propagationChecks.mu.Unlock()
+	if check, ok := propagationChecks.checks[id]; ok {
+		modify(check)
+		check.UpdatedAt = time.Now()
+	}
+}
+
+// runPropagationCheck queries all nameservers in rounds until every name
+// converges, the timeout passes or the process shuts down
+func runPropagationCheck(ctx context.Context, id string, names []NamePropagation) {
+	ctx, cancel := context.WithTimeout(ctx, *propagationTimeout)
+	defer cancel()
+	
+	servers, err := propagationNameservers(ctx)
+	if err != nil {
+		logger.Log("WARNING", fmt.Sprintf("Propagation check %s: %v", id, err))
+		updatePropagationCheck(id, func(check *PropagationCheck) {
+			check.Error = err.Error()
+			check.Done = true
 		})
 		return
 	}
 	
-	// Update server config - remove or mark as inactive
-	config, err := loadServerConfig(*environment)
-	if err == nil && config != nil {
-		// Find and remove the server from config
-		for i, server := range config.Servers {
-			if server.Name == fullName && server.Content == req.IP {
-				// Remove the server from the slice
-				config.Servers = append(config.Servers[:i], config.Servers[i+1:]...)
-				break
+	for round := 1; ; round++ {
+		converged := true
+		var current []NamePropagation
+		for _, name := range names {
+			entry := name
+			entry.Results = nil
+			if entry.Skipped == "" {
+				entry.Converged = true
+				for _, server := range servers {
+					result := queryNameserver(ctx, server, entry.Name, entry.Desired)
+					entry.Results = append(entry.Results, result)
+					if !result.Match {
+						entry.Converged = false
+					}
+				}
+				if !entry.Converged {
+					converged = false
+				}
 			}
+			current = append(current, entry)
+		}
+		
+		updatePropagationCheck(id, func(check *PropagationCheck) {
+			check.Names = current
+			check.Rounds = round
+			check.Converged = converged
+			check.Done = converged
+		})
+		if converged {
+			logger.Log("SUCCESS", fmt.Sprintf("Propagation check %s: all nameservers return the new records (round %d)", id, round))
+			return
 		}
 		
-		// Save updated config
-		if err := saveServerConfig(*environment, config); err != nil {
-			logger.Log("WARNING", fmt.Sprintf("DNS record deleted but failed to update config: %v", err))
+		select {
+		case <-ctx.Done():
+			logger.Log("WARNING", fmt.Sprintf("Propagation check %s did not converge within %s", id, *propagationTimeout))
+			updatePropagationCheck(id, func(check *PropagationCheck) {
+				check.Error = fmt.Sprintf("not converged after %s", *propagationTimeout)
+				check.Done = true
+			})
+			return
+		case <-stopping:
+			updatePropagationCheck(id, func(check *PropagationCheck) {
+				check.Error = "stopped by shutdown"
+				check.Done = true
+			})
+			return
+		case <-time.After(propagationInterval):
 		}
 	}
+}
+
+// propagationNameservers lists the authoritative and recursive servers to query
+func propagationNameservers(ctx context.Context) ([]nameserver, error) {
+	var servers []nameserver
 	
-	logger.Log("INFO", fmt.Sprintf("Deleted DNS record: %s -> %s", req.Name, req.IP))
+	if *authoritativeNS != "" {
+		for _, host := range splitList(*authoritativeNS) {
+			servers = append(servers, nameserver{label: host, address: withDNSPort(host), kind: "authoritative"})
+		}
+	} else {
+		authoritative, err := lookupAuthoritative(ctx, credentials.Domain)
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, authoritative...)
+	}
 	
-	// Return success response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": fmt.Sprintf("DNS record deleted successfully: %s -> %s", req.Name, req.IP),
-	})
+	for _, host := range splitList(*recursiveResolvers) {
+		servers = append(servers, nameserver{label: host, address: withDNSPort(host), kind: "recursive"})
+	}
+	return servers, nil
 }
 
-// Tag update handler
-func updateTagHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// lookupAuthoritative finds the NS records of the zone containing domain and
+// resolves them to IPv4 addresses
+func lookupAuthoritative(ctx context.Context, domain string) ([]nameserver, error) {
+	for zone := domain; strings.Contains(zone, "."); zone = zone[strings.Index(zone, ".")+1:] {
+		records, err := net.DefaultResolver.LookupNS(ctx, zone)
+		if err != nil || len(records) == 0 {
+			continue
+		}
+		
+		var servers []nameserver
+		for _, ns := range records {
+			host := strings.TrimSuffix(ns.Host, ".")
+			ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+			if err != nil || len(ips) == 0 {
+				continue
+			}
+			servers = append(servers, nameserver{
+				label:   fmt.Sprintf("%s (%s)", host, ips[0]),
+				address: net.JoinHostPort(ips[0].String(), "53"),
+				kind:    "authoritative",
+			})
+		}
+		if len(servers) > 0 {
+			return servers, nil
+		}
+	}
+	return nil, fmt.Errorf("no authoritative nameservers found for %s", domain)
+}
+
+// queryNameserver asks one server for the A records of a name
+func queryNameserver(ctx context.Context, server nameserver, name string, desired []string) ResolverResult {
+	result := ResolverResult{Resolver: server.label, Kind: server.kind, IPs: []string{}}
+	
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, server.address)
+		},
 	}
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
 	
-	var req struct {
-		UniqueID string `json:"unique_id"`
-		IP       string `json:"ip"`
-		Name     string `json:"name"`
-		TagType  string `json:"tag_type"`
-		Value    string `json:"value"`
+	// The trailing dot keeps the local search domains out of the query
+	ips, err := resolver.LookupIP(ctx, "ip4", name+".")
+	var dnsErr *net.DNSError
+	if err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+		result.Error = err.Error()
+		return result
+	}
+	for _, ip := range ips {
+		result.IPs = append(result.IPs, ip.String())
+	}
+	sort.Strings(result.IPs)
+	result.Match = strings.Join(result.IPs, ",") == strings.Join(desired, ",")
+	return result
+}
+
+// withDNSPort adds the default DNS port to a host without one
+func withDNSPort(host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, "53")
+}
+
+// splitList splits a comma-separated flag value
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
+}
+
+// propagationHandler returns one propagation check (?id=) or the recent ones
+func propagationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 	
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+	if id := r.URL.Query().Get("id"); id != "" {
+		check, ok := getPropagationCheck(id)
+		if !ok {
+			writeAPIError(w, http.StatusNotFound, "Propagation check not found")
+			return
+		}
+		json.NewEncoder(w).Encode(check)
 		return
 	}
 	
-	// Load configuration
-	config, err := loadServerConfig(*environment)
-	if err != nil || config == nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "Failed to load configuration",
-		})
+	propagationChecks.mu.Lock()
+	checks := []PropagationCheck{}
+	for i := len(propagationChecks.order) - 1; i >= 0; i-- {
+		checks = append(checks, *propagationChecks.checks[propagationChecks.order[i]])
+	}
+	propagationChecks.mu.Unlock()
+	json.NewEncoder(w).Encode(checks)
+}
+
+// propagationStreamHandler streams a propagation check as Server-Sent Events:
+// a "progress" event after every round and a final "done" event
+func propagationStreamHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if _, ok := getPropagationCheck(id); !ok {
+		writeAPIError(w, http.StatusNotFound, "Propagation check not found")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError, "Streaming not supported")
 		return
 	}
 	
-	// Find and update the server
-	found := false
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
 	
-	// First try to find by UniqueID
-	if req.UniqueID != "" {
-		for i := range config.Servers {
-			if config.Servers[i].UniqueID == req.UniqueID {
-				if req.TagType == "account" {
-					config.Servers[i].Account = req.Value
-				} else if req.TagType == "container" {
-					config.Servers[i].Container = req.Value
-				}
-				found = true
-				logger.Log("INFO", fmt.Sprintf("Found and updated server by UniqueID: %s (%s)", config.Servers[i].Name, req.IP))
-				break
-			}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var sent time.Time
+	for {
+		check, ok := getPropagationCheck(id)
+		if !ok {
+			return
 		}
-	}
-	
-	// If not found by UniqueID, try fallback method
-	if !found {
-		for i := range config.Servers {
-			// Extract DNS name from full name for comparison
-			serverDNSName := strings.TrimSuffix(config.Servers[i].Name, "."+credentials.Domain)
-			
-			if config.Servers[i].Content == req.IP && serverDNSName == req.Name {
-				// Generate and save UniqueID if missing
-				if config.Servers[i].UniqueID == "" {
-					config.Servers[i].UniqueID = generateServerID(config.Servers[i].Name, config.Servers[i].Content)
-				}
-				
-				if req.TagType == "account" {
-					config.Servers[i].Account = req.Value
-				} else if req.TagType == "container" {
-					config.Servers[i].Container = req.Value
-				}
-				found = true
-				logger.Log("INFO", fmt.Sprintf("Found and updated server by IP+Name: %s (%s)", config.Servers[i].Name, req.IP))
-				break
+		if check.UpdatedAt.After(sent) {
+			sent = check.UpdatedAt
+			data, _ := json.Marshal(check)
+			event := "progress"
+			if check.Done {
+				event = "done"
 			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+			flusher.Flush()
+			if check.Done {
+				return
+			}
+		}
+		
+		select {
+		case <-r.Context().Done():
+			return
+		case <-stopping:
+			return
+		case <-ticker.C:
 		}
 	}
-	
-	// If not found in config but it's an active DNS record, add it
-	if !found {
-		cfClient := NewCloudflareClient(credentials)
-		records, err := cfClient.GetDNSRecords()
-		if err == nil {
-			for _, record := range records {
-				dnsName := strings.TrimSuffix(record.Name, "."+credentials.Domain)
-				if record.Content == req.IP && dnsName == req.Name {
-					// Add to config
-					now := time.Now().Format(time.RFC3339)
-					newServer := Server{
-						UniqueID:        generateServerID(record.Name, record.Content),
-						Alias:           record.Comment,
-						Description:     fmt.Sprintf("Added via tag update on %s", time.Now().Format("2006-01-02")),
-						FirstSeenOn:     now,
-						LastActivatedOn: now,
-						Type:            "A",
-						Name:            record.Name,
-						Content:         record.Content,
-						TTL:             record.TTL,
-						Proxied:         record.Proxied,
-						Comment:         record.Comment,
-					}
-					
-					if req.TagType == "account" {
-						newServer.Account = req.Value
-					} else if req.TagType == "container" {
-						newServer.Container = req.Value
-					}
-					
-					config.Servers = append(config.Servers, newServer)
-					found = true
-					break
-				}
+}
+
+// Live UI events
+
+// UIEvent is a state change broadcast to every open browser
+type UIEvent struct {
+	ID       int64         `json:"id"`
+	Time     time.Time     `json:"time"`
+	Type     string        `json:"type"` // activation, notes, tags, state, health, drift
+	Operator string        `json:"operator,omitempty"`
+	Client   string        `json:"client,omitempty"` // X-Client-ID of the page that made the change
+	Message  string        `json:"message"`
+	Servers  []ServerEvent `json:"servers,omitempty"` // Entries whose cards changed
+	Data     interface{}   `json:"data,omitempty"`   // Type specific details
+}
+
+// ServerEvent describes the changed parts of one entry card
+type ServerEvent struct {
+	UniqueID  string  `json:"unique_id,omitempty"`
+	Name      string  `json:"name"` // Full DNS name
+	IP        string  `json:"ip,omitempty"`
+	Alias     string  `json:"alias,omitempty"`
+	Active    *bool   `json:"active,omitempty"`
+	State     string  `json:"state,omitempty"`
+	Notes     *string `json:"notes,omitempty"`
+	Account   *string `json:"account,omitempty"`
+	Container *string `json:"container,omitempty"`
+}
+
+var uiEvents struct {
+	mu          sync.Mutex
+	nextID      int64
+	recent      []UIEvent // Replayed to clients that reconnect with Last-Event-ID
+	subscribers map[chan UIEvent]bool
+}
+
+const maxRecentEvents = 100
+
+// publishEvent broadcasts an event to all connected browsers
+func publishEvent(event UIEvent) {
+	uiEvents.mu.Lock()
+	defer uiEvents.mu.Unlock()
+	
+	uiEvents.nextID++
+	event.ID = uiEvents.nextID
+	event.Time = time.Now()
+	uiEvents.recent = append(uiEvents.recent, event)
+	if len(uiEvents.recent) > maxRecentEvents {
+		uiEvents.recent = uiEvents.recent[len(uiEvents.recent)-maxRecentEvents:]
+	}
+	
+	for ch := range uiEvents.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// A client that falls behind is disconnected and catches up
+			// from the recent events when it reconnects
+			delete(uiEvents.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribeEvents registers a listener and returns the recent events after
+// lastID, so nothing is missed between replay and subscription
+func subscribeEvents(lastID int64) (chan UIEvent, []UIEvent) {
+	uiEvents.mu.Lock()
+	defer uiEvents.mu.Unlock()
+	
+	if uiEvents.subscribers == nil {
+		uiEvents.subscribers = make(map[chan UIEvent]bool)
+	}
+	ch := make(chan UIEvent, 32)
+	uiEvents.subscribers[ch] = true
+	
+	var missed []UIEvent
+	if lastID > 0 {
+		for _, event := range uiEvents.recent {
+			if event.ID > lastID {
+				missed = append(missed, event)
 			}
 		}
 	}
-	
-	if !found {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "Server not found",
-		})
-		return
+	return ch, missed
+}
+
+// unsubscribeEvents removes a listener that is still registered
+func unsubscribeEvents(ch chan UIEvent) {
+	uiEvents.mu.Lock()
+	defer uiEvents.mu.Unlock()
+	if uiEvents.subscribers[ch] {
+		delete(uiEvents.subscribers, ch)
+		close(ch)
 	}
-	
-	// Save configuration
-	if err := saveServerConfig(*environment, config); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": fmt.Sprintf("Failed to save configuration: %v", err),
-		})
+}
+
+// clientFromRequest returns the page ID a browser sends with its changes
+func clientFromRequest(r *http.Request) string {
+	client := strings.TrimSpace(r.Header.Get("X-Client-ID"))
+	if len(client) > 64 {
+		client = client[:64]
+	}
+	return client
+}
+
+// publishActivations announces the entries an apply activated and deactivated
+func publishActivations(opts ApplyOptions, activated []ActiveServer, deactivated []CloudflareRecord) {
+	if len(activated)+len(deactivated) == 0 {
 		return
 	}
+	active, inactive := true, false
+	var servers []ServerEvent
+	for _, info := range activated {
+		servers = append(servers, ServerEvent{Name: fullDNSName(info.Name), IP: info.IP, Alias: info.Alias, Active: &active})
+	}
+	for _, record := range deactivated {
+		servers = append(servers, ServerEvent{Name: record.Name, IP: record.Content, Active: &inactive})
+	}
 	
-	logger.Log("INFO", fmt.Sprintf("Updated %s tag to '%s' for %s (%s)", req.TagType, req.Value, req.Name, req.IP))
-	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": "Tag updated successfully",
+	who := opts.Operator
+	if who == "" {
+		who = opts.Source
+	}
+	publishEvent(UIEvent{
+		Type:     "activation",
+		Operator: opts.Operator,
+		Client:   opts.ClientID,
+		Message:  fmt.Sprintf("%s activated %d and deactivated %d entries", who, len(activated), len(deactivated)),
+		Servers:  servers,
 	})
 }
 
-// Notes update handler
-func updateNotesHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// publishState announces a lifecycle change of one server
+func publishState(r *http.Request, server Server, message string) {
+	publishEvent(UIEvent{
+		Type:     "state",
+		Operator: operatorFromRequest(r),
+		Client:   clientFromRequest(r),
+		Message:  message,
+		Servers:  []ServerEvent{{UniqueID: server.UniqueID, Name: server.Name, IP: server.Content, Alias: server.Alias, State: server.State}},
+	})
+}
+
+// eventsHandler streams UI events as Server-Sent Events. Each event carries
+// its ID, so a reconnecting browser gets what it missed via Last-Event-ID.
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError, "Streaming not supported")
 		return
 	}
 	
-	var req struct {
-		Name  string `json:"name"`  // Now grouped by name instead of IP
-		Notes string `json:"notes"`
-	}
+	lastID, _ := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64)
+	ch, missed := subscribeEvents(lastID)
+	defer unsubscribeEvents(ch)
 	
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
-		return
-	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
 	
-	// Load configuration
-	config, err := loadServerConfig(*environment)
-	if err != nil || config == nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "Failed to load configuration",
-		})
-		return
+	send := func(event UIEvent) {
+		data, _ := json.Marshal(event)
+		fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
 	}
+	for _, event := range missed {
+		send(event)
+	}
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
 	
-	// Update notes for all servers with this name
-	updated := false
-	for i := range config.Servers {
-		if config.Servers[i].Name == req.Name {
-			config.Servers[i].Notes = req.Notes
-			updated = true
-			logger.Log("INFO", fmt.Sprintf("Updated notes for server %s", config.Servers[i].Name))
+	// Comments keep proxies from closing an idle stream
+	keepAlive := time.NewTicker(25 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			send(event)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-stopping:
+			return
 		}
 	}
-	
-	if !updated {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "No servers found with this name",
-		})
-		return
+}
+
+// Background jobs
+
+// Job is a long-running operation (apply, profile switch, import, ...) that
+// runs in the background while clients follow its progress
+type Job struct {
+	ID         string      `json:"id"`
+	Kind       string      `json:"kind"`   // apply, profile, resume, rollback, import, restore
+	Status     string      `json:"status"` // running, succeeded, failed
+	Operator   string      `json:"operator,omitempty"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+	Message    string      `json:"message,omitempty"`
+	Events     []JobEvent  `json:"events"`
+	Result     interface{} `json:"result,omitempty"` // The endpoint's response once the job is done
+	
+	done chan struct{} // Closed when the job finished
+}
+
+// JobEvent is one progress line of a job, usually the result of one record change
+type JobEvent struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+	Status  string    `json:"status"` // info, success, warning, error, skipped
+}
+
+// JobFunc does the work of a job. progress reports each record change as it
+// happens; result is what the endpoint answers once the job is done.
+type JobFunc func(ctx context.Context, progress func(UpdateDetail)) (success bool, message string, result interface{})
+
+var jobs struct {
+	mu    sync.Mutex
+	jobs  map[string]*Job
+	order []string
+}
+
+const maxJobs = 50 // Finished jobs kept for the API
+
+// startJob runs work in the background and returns the new job
+func startJob(kind, operator string, work JobFunc) *Job {
+	job := &Job{ID: randomID(6), Kind: kind, Status: "running", Operator: operator, StartedAt: time.Now(), Events: []JobEvent{}, done: make(chan struct{})}
+	
+	jobs.mu.Lock()
+	if jobs.jobs == nil {
+		jobs.jobs = make(map[string]*Job)
+	}
+	jobs.jobs[job.ID] = job
+	jobs.order = append(jobs.order, job.ID)
+	// Drop the oldest finished jobs; running ones are kept until they finish
+	for i := 0; len(jobs.order) > maxJobs && i < len(jobs.order); {
+		if jobs.jobs[jobs.order[i]].Status == "running" {
+			i++
+			continue
+		}
+		delete(jobs.jobs, jobs.order[i])
+		jobs.order = append(jobs.order[:i], jobs.order[i+1:]...)
 	}
+	jobs.mu.Unlock()
 	
-	// Save configuration
-	if err := saveServerConfig(*environment, config); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": fmt.Sprintf("Failed to save configuration: %v", err),
+	logger.Log("INFO", fmt.Sprintf("Job %s (%s) started by %s", job.ID, kind, operator))
+	
+	// Shutdown waits for every job, including imports and restores
+	finished := trackApply()
+	go func() {
+		defer finished()
+		// The job outlives the request that started it
+		success, message, result := work(workCtx, func(detail UpdateDetail) {
+			jobs.mu.Lock()
+			job.Events = append(job.Events, JobEvent{Time: time.Now(), Message: detail.Message, Status: detail.Status})
+			jobs.mu.Unlock()
 		})
+		
+		now := time.Now()
+		jobs.mu.Lock()
+		job.Status = "succeeded"
+		if !success {
+			job.Status = "failed"
+		}
+		job.Message = message
+		job.Result = result
+		job.FinishedAt = &now
+		jobs.mu.Unlock()
+		close(job.done)
+		
+		logger.Log("INFO", fmt.Sprintf("Job %s (%s) %s: %s", job.ID, kind, job.Status, message))
+	}()
+	return job
+}
+
+// getJob returns a copy of a job that is safe to encode
+func getJob(id string) (Job, bool) {
+	jobs.mu.Lock()
+	defer jobs.mu.Unlock()
+	job, ok := jobs.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	copied := *job
+	copied.Events = append([]JobEvent(nil), job.Events...)
+	return copied, true
+}
+
+// runAsJob starts work as a job and answers with the job ID (202 Accepted).
+// With ?wait=1 the request blocks until the job is done and answers with its
+// result instead, for scripts that expect the synchronous response.
+func runAsJob(w http.ResponseWriter, r *http.Request, kind string, work JobFunc) {
+	job := startJob(kind, operatorFromRequest(r), work)
+	
+	w.Header().Set("Content-Type", "application/json")
+	if wait := r.URL.Query().Get("wait"); wait != "" && wait != "0" && wait != "false" {
+		select {
+		case <-job.done:
+		case <-r.Context().Done():
+			return
+		}
+		finished, _ := getJob(job.ID)
+		json.NewEncoder(w).Encode(finished.Result)
 		return
 	}
 	
-	logger.Log("INFO", fmt.Sprintf("Updated notes for name %s", req.Name))
-	
-	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
-		"message": "Notes updated successfully",
+		"job_id":  job.ID,
+		"message": fmt.Sprintf("Job %s started", job.ID),
 	})
 }
 
-// addTagHandler handles adding new tags
-func addTagHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	
-	var req struct {
-		TagType string `json:"tag_type"`
-		TagName string `json:"tag_name"`
-	}
-	
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+// updateResult converts an UpdateResponse into a job result
+func updateResult(response UpdateResponse) (bool, string, interface{}) {
+	return response.Success, response.Message, response
+}
+
+// jobsHandler lists recent jobs (GET /api/jobs), returns one job
+// (GET /api/jobs/{id}) or streams its progress (GET /api/jobs/{id}/stream)
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/jobs"), "/")
+	if path == "" {
+		jobs.mu.Lock()
+		list := []Job{}
+		for i := len(jobs.order) - 1; i >= 0; i-- {
+			job := *jobs.jobs[jobs.order[i]]
+			job.Events = nil
+			job.Result = nil
+			list = append(list, job)
+		}
+		jobs.mu.Unlock()
+		
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "Invalid request format",
+			"success": true,
+			"jobs":    list,
 		})
 		return
 	}
 	
-	// Validate tag type
-	if req.TagType != "account" && req.TagType != "container" {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "Invalid tag type",
-		})
+	id, stream := strings.CutSuffix(path, "/stream")
+	job, ok := getJob(id)
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "Job not found")
 		return
 	}
-	
-	// Validate tag name
-	req.TagName = strings.TrimSpace(req.TagName)
-	if req.TagName == "" {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "Tag name cannot be empty",
-		})
+	if stream {
+		jobStream(w, r, id)
 		return
 	}
 	
-	// Load current configuration
-	config, err := loadServerConfig(*environment)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": fmt.Sprintf("Failed to load configuration: %v", err),
-		})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"job":     job,
+	})
+}
+
+// jobStream sends each job event as a Server-Sent "progress" event, then the
+// finished job as "done". Event IDs are event indexes, so a reconnecting
+// client resumes after Last-Event-ID.
+func jobStream(w http.ResponseWriter, r *http.Request, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError, "Streaming not supported")
 		return
 	}
 	
-	// Initialize if nil
-	if config == nil {
-		config = &ServerConfig{
-			Environment: *environment,
-			Domain:      credentials.Domain,
-			Servers:     []Server{},
-			AvailableAccounts: []string{},
-			AvailableContainers: []string{},
-		}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	
+	sent := 0
+	if last, err := strconv.Atoi(r.Header.Get("Last-Event-ID")); err == nil {
+		sent = last + 1
 	}
 	
-	// Add the new tag if it doesn't already exist
-	if req.TagType == "account" {
-		// Check if already exists
-		exists := false
-		for _, tag := range config.AvailableAccounts {
-			if tag == req.TagName {
-				exists = true
-				break
-			}
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		job, ok := getJob(id)
+		if !ok {
+			return
 		}
-		if !exists {
-			config.AvailableAccounts = append(config.AvailableAccounts, req.TagName)
-			sort.Strings(config.AvailableAccounts)
+		for ; sent < len(job.Events); sent++ {
+			data, _ := json.Marshal(job.Events[sent])
+			fmt.Fprintf(w, "id: %d\nevent: progress\ndata: %s\n\n", sent, data)
 		}
-	} else {
-		// Container
-		exists := false
-		for _, tag := range config.AvailableContainers {
-			if tag == req.TagName {
-				exists = true
-				break
-			}
+		if job.Status != "running" {
+			data, _ := json.Marshal(job)
+			fmt.Fprintf(w, "event: done\ndata: %s\n\n", data)
+			flusher.Flush()
+			return
 		}
-		if !exists {
-			config.AvailableContainers = append(config.AvailableContainers, req.TagName)
-			sort.Strings(config.AvailableContainers)
+		flusher.Flush()
+		
+		select {
+		case <-r.Context().Done():
+			return
+		case <-stopping:
+			return
+		case <-ticker.C:
 		}
 	}
+}
+
+// Graceful shutdown
+
+var (
+	// workCtx is the parent of every request and background operation. It is
+	// only cancelled when in-flight work did not finish within -shutdown-timeout.
+	workCtx, cancelWork = context.WithCancel(context.Background())
 	
-	// Save configuration
-	if err := saveServerConfig(*environment, config); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": fmt.Sprintf("Failed to save configuration: %v", err),
-		})
-		return
-	}
-	
-	logger.Log("INFO", fmt.Sprintf("Added new %s tag: %s", req.TagType, req.TagName))
+	// stopping is closed when a shutdown signal arrives; workers stop starting new runs
+	stopping = make(chan struct{})
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": fmt.Sprintf("Added new %s: %s", req.TagType, req.TagName),
-	})
+	// workers tracks running background workers so shutdown can wait for them
+	workers sync.WaitGroup
+)
+
+// activeApplies counts applies that are running right now, whether started
+// by a request or by a worker
+var activeApplies struct {
+	mu    sync.Mutex
+	count int
 }
 
-// openBrowser opens the default browser to the specified URL
-func openBrowser(url string) error {
-	var err error
-	
-	switch runtime.GOOS {
-	case "linux":
-		err = exec.Command("xdg-open", url).Start()
-	case "windows":
-		err = exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
-	case "darwin":
-		err = exec.Command("open", url).Start()
-	default:
-		err = fmt.Errorf("unsupported platform")
+// trackApply registers a running apply; call the returned func when it ends
+func trackApply() func() {
+	activeApplies.mu.Lock()
+	activeApplies.count++
+	activeApplies.mu.Unlock()
+	return func() {
+		activeApplies.mu.Lock()
+		activeApplies.count--
+		activeApplies.mu.Unlock()
 	}
+}
+
+// appliesRunning returns the number of applies in progress
+func appliesRunning() int {
+	activeApplies.mu.Lock()
+	defer activeApplies.mu.Unlock()
+	return activeApplies.count
+}
+
+// runWorker calls work on every tick until shutdown starts. A run that is in
+// progress when the signal arrives is allowed to finish.
+func runWorker(interval time.Duration, immediate bool, work func(ctx context.Context, now time.Time)) {
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		if immediate {
+			work(workCtx, time.Now())
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopping:
+				return
+			case now := <-ticker.C:
+				work(workCtx, now)
+			}
+		}
+	}()
+}
+
+// shutdown stops the HTTP servers and workers. In-flight requests and worker
+// runs get -shutdown-timeout to finish; after that their contexts are
+// cancelled, so applies stop before the next Cloudflare call.
+func shutdown(servers ...*http.Server) {
+	close(stopping)
 	
-	if err != nil {
-		logger.Log("WARNING", fmt.Sprintf("Failed to open browser: %v", err))
-	} else {
-		logger.Log("INFO", fmt.Sprintf("Opening browser at %s", url))
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	
+	done := make(chan struct{})
+	go func() {
+		var wg sync.WaitGroup
+		for _, server := range servers {
+			wg.Add(1)
+			go func(server *http.Server) {
+				defer wg.Done()
+				server.Shutdown(ctx)
+			}(server)
+		}
+		wg.Wait()
+		workers.Wait()
+		for appliesRunning() > 0 {
+			time.Sleep(100 * time.Millisecond)
+		}
+		close(done)
+	}()
+	
+	select {
+	case <-done:
+		logger.Log("SUCCESS", "All in-flight operations finished")
+		return
+	case <-ctx.Done():
 	}
 	
-	return err
+	logger.Log("WARNING", fmt.Sprintf("In-flight operations did not finish within %s, cancelling them", *shutdownTimeout))
+	cancelWork()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		logger.Log("ERROR", "Operations still running after cancellation, exiting anyway")
+	}
 }
 
 func main() {
@@ -2985,6 +12547,20 @@ func main() {
 	logger.Log("INFO", fmt.Sprintf("Environment: %s", *environment))
 	logger.Log("INFO", fmt.Sprintf("Platform: %s/%s", runtime.GOOS, runtime.GOARCH))
 	
+	if *pageSize < 5 || *pageSize > 5000000 {
+		logger.Log("ERROR", fmt.Sprintf("Invalid -page-size %d (Cloudflare accepts 5-5000000)", *pageSize))
+		os.Exit(1)
+	}
+	if *apiRetries < 0 {
+		*apiRetries = 0
+	}
+	
+	switch *driftPolicy {
+	case "report", "adopt", "revert":
+	default:
+		logger.Log("ERROR", fmt.Sprintf("Invalid -drift-policy %q (use report, adopt or revert)", *driftPolicy))
+		os.Exit(1)
+	}
 	// Handle backup-related commands first
 	if *listBackups {
 		if err := listBackupFiles(*environment); err != nil {
@@ -3027,30 +12603,157 @@ func main() {
 	}
 	logger.Log("INFO", fmt.Sprintf("Credentials loaded (token: %s)", maskedToken))
 	
+	// Handle journal commands
+	if *listUnfinished || *resumeApplyID != "" || *rollbackApplyID != "" {
+		err := runJournalCommand()
+		closeJournal(*environment)
+		if err != nil {
+			logger.Log("ERROR", fmt.Sprintf("Journal command failed: %v", err))
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	
+	// Handle profile commands
+	if *listProfiles || *saveProfileName != "" || *applyProfileName != "" {
+		err := runProfileCommand()
+		closeJournal(*environment)
+		if err != nil {
+			logger.Log("ERROR", fmt.Sprintf("Profile command failed: %v", err))
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	
+	// Approvals identify operators by their client certificate; without one
+	// the server would refuse every change
+	if approvalRequired() && *tlsClientCA == "" {
+		logger.Log("ERROR", "Approvals are required but -tls-client-ca is not set, so operators cannot be identified")
+		log.Fatalf("Approvals are required but -tls-client-ca is not set; enable mutual TLS or start with -require-approval=false")
+	}
+	
+	// Open the operation journal; applies interrupted by a crash are kept for recovery
+	if err := openJournal(*environment); err != nil {
+		logger.Log("ERROR", fmt.Sprintf("Failed to open operation journal: %v", err))
+		log.Fatalf("Failed to open operation journal: %v", err)
+	}
+	reportUnfinishedApplies()
+	
+	// Generate CSRF token for this process
+	csrfToken, err = generateCSRFToken()
+	if err != nil {
+		log.Fatalf("Failed to generate CSRF token: %v", err)
+	}
+	
 	// Setup routes
 	http.HandleFunc("/", indexHandler)
-	http.HandleFunc("/api/update", updateHandler)
-	http.HandleFunc("/api/update-tag", updateTagHandler)
-	http.HandleFunc("/api/update-notes", updateNotesHandler)
-	http.HandleFunc("/api/add-tag", addTagHandler)
-	http.HandleFunc("/api/dns/create", createDNSHandler)
-	http.HandleFunc("/api/dns/delete", deleteDNSHandler)
+	http.HandleFunc("/api/csrf-token", csrfTokenHandler)
+	http.HandleFunc("/api/update", protectAPI(updateHandler))
+	http.HandleFunc("/api/update-tag", protectAPI(approvalGate("/api/update-tag", updateTagHandler)))
+	http.HandleFunc("/api/update-notes", protectAPI(updateNotesHandler))
+	http.HandleFunc("/api/add-tag", protectAPI(approvalGate("/api/add-tag", addTagHandler)))
+	http.HandleFunc("/api/dns/create", protectAPI(approvalGate("/api/dns/create", createDNSHandler)))
+	http.HandleFunc("/api/dns/delete", protectAPI(approvalGate("/api/dns/delete", deleteDNSHandler)))
+	http.HandleFunc("/api/changes", changesHandler)
+	http.HandleFunc("/api/changes/approve", protectAPI(decideChangeHandler(true)))
+	http.HandleFunc("/api/changes/reject", protectAPI(decideChangeHandler(false)))
+	http.HandleFunc("/api/freeze", freezeHandler)
+	http.HandleFunc("/api/freeze/add", protectAPI(addFreezeHandler))
+	http.HandleFunc("/api/freeze/delete", protectAPI(deleteFreezeHandler))
+	http.HandleFunc("/api/expiry", protectAPI(approvalGate("/api/expiry", expiryHandler)))
+	http.HandleFunc("/api/servers", serversHandler)
+	http.HandleFunc("/api/state", protectAPI(approvalGate("/api/state", stateHandler)))
+	http.HandleFunc("/api/maintenance/start", protectAPI(approvalGate("/api/maintenance/start", maintenanceHandler)))
+	http.HandleFunc("/api/maintenance/end", protectAPI(endMaintenanceHandler))
+	http.HandleFunc("/api/drain", protectAPI(approvalGate("/api/drain", drainHandler)))
+	http.HandleFunc("/api/drain/cancel", protectAPI(approvalGate("/api/drain/cancel", cancelDrainHandler)))
+	http.HandleFunc("/api/canary", protectAPI(approvalGate("/api/canary", canaryHandler)))
+	http.HandleFunc("/api/canary/abort", protectAPI(approvalGate("/api/canary/abort", abortCanaryHandler)))
+	http.HandleFunc("/api/drift", driftHandler)
+	http.HandleFunc("/api/drift/check", protectAPI(approvalGate("/api/drift/check", checkDriftHandler)))
+	http.HandleFunc("/api/profiles", profilesHandler)
+	http.HandleFunc("/api/profiles/save", protectAPI(saveProfileHandler))
+	http.HandleFunc("/api/profiles/apply", protectAPI(applyProfileHandler))
+	http.HandleFunc("/api/profiles/delete", protectAPI(deleteProfileHandler))
+	http.HandleFunc("/api/schedules", schedulesHandler)
+	http.HandleFunc("/api/schedules/add", protectAPI(addScheduleHandler))
+	http.HandleFunc("/api/schedules/cancel", protectAPI(updateScheduleHandler("cancel")))
+	http.HandleFunc("/api/schedules/approve", protectAPI(updateScheduleHandler("approve")))
+	http.HandleFunc("/api/propagation", propagationHandler)
+	http.HandleFunc("/api/propagation/stream", propagationStreamHandler)
+	http.HandleFunc("/api/events", eventsHandler)
+	http.HandleFunc("/api/jobs", jobsHandler)
+	http.HandleFunc("/api/jobs/", jobsHandler)
+	http.HandleFunc("/api/import", protectAPI(approvalGate("/api/import", importHandler)))
+	http.HandleFunc("/api/backups", backupsHandler)
+	http.HandleFunc("/api/backups/restore", protectAPI(approvalGate("/api/backups/restore", restoreHandler)))
+	http.HandleFunc("/api/journal", journalHandler)
+	http.HandleFunc("/api/journal/resume", protectAPI(approvalGate("/api/journal/resume", resolveApplyHandler("resume"))))
+	http.HandleFunc("/api/journal/rollback", protectAPI(approvalGate("/api/journal/rollback", resolveApplyHandler("rollback"))))
 	http.HandleFunc("/health", healthHandler)
 	
+	// Start background workers
+	startScheduler()
+	startExpiryWorker()
+	startDrainWorker()
+	startCanaryWorker()
+	startDriftWorker()
+	
 	// Start server
 	addr := fmt.Sprintf(":%d", *port)
-	url := fmt.Sprintf("http://localhost%s", addr)
+	scheme := "http"
+	server := &http.Server{
+		Addr:    addr,
+		Handler: hostCheckMiddleware(http.DefaultServeMux),
+		// Request contexts derive from workCtx so a shutdown can cancel them
+		BaseContext: func(net.Listener) context.Context { return workCtx },
+	}
+	servers := []*http.Server{server}
+	
+	var certFile, keyFile string
+	if tlsRequested() {
+		scheme = "https"
+		certFile, keyFile = *tlsCert, *tlsKey
+		if certFile == "" && keyFile == "" {
+			certFile, keyFile, err = loadOrCreateSelfSignedCert(*environment)
+			if err != nil {
+				logger.Log("ERROR", fmt.Sprintf("Failed to prepare self-signed certificate: %v", err))
+				log.Fatalf("Failed to prepare self-signed certificate: %v", err)
+			}
+		} else if certFile == "" || keyFile == "" {
+			log.Fatalf("Both -tls-cert and -tls-key must be provided")
+		}
+		
+		server.TLSConfig, err = buildTLSConfig()
+		if err != nil {
+			logger.Log("ERROR", fmt.Sprintf("Failed to configure TLS: %v", err))
+			log.Fatalf("Failed to configure TLS: %v", err)
+		}
+		
+		if *httpRedirectPort > 0 {
+			servers = append(servers, startHTTPRedirect(*httpRedirectPort, *port))
+		}
+	}
+	
+	url := fmt.Sprintf("%s://localhost%s", scheme, addr)
 	logger.Log("INFO", fmt.Sprintf("Server starting on %s", url))
 	
 	if *environment == "production" {
 		fmt.Println("\n⚠️  WARNING: Running in PRODUCTION mode!")
 		fmt.Printf("Managing domain: %s\n", credentials.Domain)
-		fmt.Println("Press Ctrl+C to stop\n")
+		fmt.Println("Press Ctrl+C to stop")
+		fmt.Println()
 	}
 	
 	// Start server in a goroutine so we can open the browser
 	go func() {
-		if err := http.ListenAndServe(addr, nil); err != nil {
+		var err error
+		if scheme == "https" {
+			err = server.ListenAndServeTLS(certFile, keyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logger.Log("ERROR", fmt.Sprintf("Server failed: %v", err))
 			log.Fatalf("Server failed: %v", err)
 		}
@@ -3067,6 +12770,12 @@ func main() {
 	fmt.Printf("\n🌐 Web interface available at: %s\n", url)
 	fmt.Println("Press Ctrl+C to stop")
 	
-	// Keep the main goroutine alive
-	select {}
+	// Run until SIGINT/SIGTERM, then let in-flight applies finish
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	sig := <-signals
+	logger.Log("INFO", fmt.Sprintf("Received %s, shutting down (waiting up to %s for in-flight operations)", sig, *shutdownTimeout))
+	shutdown(servers...)
+	closeJournal(*environment)
+	logger.Log("INFO", "Server stopped")
 }
@@ -0,0 +1,2156 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeZone is an in-memory Cloudflare zone served through the shared HTTP client
+type fakeZone struct {
+	mu      sync.Mutex
+	records map[string]CloudflareRecord
+	next    int
+
+	failPost  func(record CloudflareRecord) bool // Reject matching creates
+	failGet   func() error                       // Fail single record reads
+	getDelay  time.Duration                      // Delay single record reads
+	listTotal int                                // Reported total_count, if set
+	onList    func()                             // Called while a list request is served
+	batch     string                             // "" answers batches with 405, "lost" applies them and garbles the reply, "dropped" only garbles it
+	lostDels  int                                // Deletes that go through but answer 502
+	calls     []string                           // METHOD path of every call
+}
+
+func newFakeZone() *fakeZone {
+	return &fakeZone{records: make(map[string]CloudflareRecord)}
+}
+
+// add stores a live record and returns its ID
+func (z *fakeZone) add(name, ip, comment string) string {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.next++
+	id := fmt.Sprintf("rec%03d", z.next)
+	z.records[id] = CloudflareRecord{ID: id, Type: "A", Name: name, Content: ip, TTL: 60, Comment: comment}
+	return id
+}
+
+// live returns the records in creation order
+func (z *fakeZone) live() []CloudflareRecord {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	var records []CloudflareRecord
+	for _, record := range z.records {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	return records
+}
+
+func (z *fakeZone) RoundTrip(r *http.Request) (*http.Response, error) {
+	w := httptest.NewRecorder()
+	z.serve(w, r)
+	return w.Result(), nil
+}
+
+func (z *fakeZone) serve(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	rest := strings.TrimPrefix(path[strings.Index(path, "/dns_records"):], "/dns_records")
+	rest = strings.TrimPrefix(rest, "/")
+
+	if r.Method == "GET" && rest != "" && z.getDelay > 0 {
+		select {
+		case <-time.After(z.getDelay):
+		case <-r.Context().Done():
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.calls = append(z.calls, r.Method+" "+rest)
+
+	reply := func(result interface{}, extra map[string]interface{}) {
+		body := map[string]interface{}{"success": true, "result": result, "errors": []interface{}{}}
+		for key, value := range extra {
+			body[key] = value
+		}
+		json.NewEncoder(w).Encode(body)
+	}
+	fail := func(status int) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "errors": []map[string]interface{}{{"code": 1004, "message": "rejected"}}})
+	}
+
+	switch {
+	case r.Method == "GET" && rest == "":
+		if z.onList != nil {
+			z.onList()
+		}
+		var list []CloudflareRecord
+		for _, record := range z.records {
+			list = append(list, record)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+		total := len(list)
+		if z.listTotal > 0 {
+			total = z.listTotal
+		}
+		pages := (total + perPage - 1) / perPage
+		start, end := (page-1)*perPage, page*perPage
+		if start > len(list) {
+			start = len(list)
+		}
+		if end > len(list) {
+			end = len(list)
+		}
+		reply(list[start:end], map[string]interface{}{"result_info": map[string]int{"page": page, "per_page": perPage, "count": end - start, "total_count": total, "total_pages": pages}})
+	case r.Method == "GET":
+		if z.failGet != nil {
+			if err := z.failGet(); err != nil {
+				fail(http.StatusInternalServerError)
+				return
+			}
+		}
+		record, found := z.records[rest]
+		if !found {
+			fail(http.StatusNotFound)
+			return
+		}
+		reply(record, nil)
+	case r.Method == "POST" && rest == "batch":
+		if z.batch == "" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if z.batch == "lost" {
+			body, _ := io.ReadAll(r.Body)
+			var batch DNSBatch
+			json.Unmarshal(body, &batch)
+			for _, del := range batch.Deletes {
+				delete(z.records, del.ID)
+			}
+			for _, post := range batch.Posts {
+				z.next++
+				id := fmt.Sprintf("rec%03d", z.next)
+				z.records[id] = CloudflareRecord{ID: id, Type: "A", Name: post["name"].(string), Content: post["content"].(string)}
+			}
+		}
+		w.Write([]byte("{"))
+	case r.Method == "POST":
+		body, _ := io.ReadAll(r.Body)
+		var record CloudflareRecord
+		json.Unmarshal(body, &record)
+		if z.failPost != nil && z.failPost(record) {
+			fail(http.StatusBadRequest)
+			return
+		}
+		z.next++
+		record.ID = fmt.Sprintf("rec%03d", z.next)
+		z.records[record.ID] = record
+		reply(record, nil)
+	case r.Method == "PATCH":
+		record, found := z.records[rest]
+		if !found {
+			fail(http.StatusNotFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &record)
+		z.records[rest] = record
+		reply(record, nil)
+	case r.Method == "DELETE":
+		if _, found := z.records[rest]; !found {
+			fail(http.StatusNotFound)
+			return
+		}
+		delete(z.records, rest)
+		if z.lostDels > 0 {
+			z.lostDels--
+			fail(http.StatusBadGateway)
+			return
+		}
+		reply(map[string]string{"id": rest}, nil)
+	default:
+		fail(http.StatusInternalServerError)
+	}
+}
+
+// setupTest runs a test in its own directory against a fake zone
+func setupTest(t *testing.T) *fakeZone {
+	t.Helper()
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	zone := newFakeZone()
+	transport := cloudflareHTTPClient.Transport
+	rate, retries, verify, propagation := *apiRate, *apiRetries, *verifyTimeout, *propagationTimeout
+	cloudflareHTTPClient.Transport = zone
+	*apiRate, *apiRetries, *verifyTimeout, *propagationTimeout = 0, 0, time.Second, 0
+
+	logger, _ = NewLogger("test")
+	credentials = &Credentials{Token: "token", ZoneID: "zone", Domain: "example.com"}
+	invalidateRecords()
+
+	t.Cleanup(func() {
+		cloudflareHTTPClient.Transport = transport
+		*apiRate, *apiRetries, *verifyTimeout, *propagationTimeout = rate, retries, verify, propagation
+		os.Chdir(dir)
+	})
+	return zone
+}
+
+func TestVerifyCreated(t *testing.T) {
+	zone := setupTest(t)
+	id := zone.add("xmr.example.com", "1.1.1.1", "")
+	cfClient := NewCloudflareClient(credentials)
+
+	if status := cfClient.VerifyCreated(context.Background(), id, "1.1.1.1"); status != VerificationVerified {
+		t.Errorf("matching record: got %s, want %s", status, VerificationVerified)
+	}
+	if status := cfClient.VerifyCreated(context.Background(), id, "2.2.2.2"); status != VerificationFailed {
+		t.Errorf("different IP: got %s, want %s", status, VerificationFailed)
+	}
+	if status := cfClient.VerifyCreated(context.Background(), "missing", "1.1.1.1"); status != VerificationPending {
+		t.Errorf("record not visible yet: got %s, want %s", status, VerificationPending)
+	}
+}
+
+func TestVerifyDeleted(t *testing.T) {
+	zone := setupTest(t)
+	id := zone.add("xmr.example.com", "1.1.1.1", "")
+	cfClient := NewCloudflareClient(credentials)
+
+	if status := cfClient.VerifyDeleted(context.Background(), "missing"); status != VerificationVerified {
+		t.Errorf("deleted record: got %s, want %s", status, VerificationVerified)
+	}
+	if status := cfClient.VerifyDeleted(context.Background(), id); status != VerificationPending {
+		t.Errorf("record still listed: got %s, want %s", status, VerificationPending)
+	}
+}
+
+func TestVerifyReadErrors(t *testing.T) {
+	zone := setupTest(t)
+	cfClient := NewCloudflareClient(credentials)
+
+	zone.failGet = func() error { return fmt.Errorf("unavailable") }
+	if status := cfClient.VerifyCreated(context.Background(), "any", "1.1.1.1"); status != VerificationFailed {
+		t.Errorf("unreadable record: got %s, want %s", status, VerificationFailed)
+	}
+
+	// A read cut off by the deadline only means time ran out
+	zone.failGet = nil
+	zone.getDelay = 5 * time.Second
+	if status := cfClient.VerifyCreated(context.Background(), "any", "1.1.1.1"); status != VerificationPending {
+		t.Errorf("deadline during a read: got %s, want %s", status, VerificationPending)
+	}
+}
+
+// withApproval turns on the production approval flow for one test
+func withApproval(t *testing.T) {
+	t.Helper()
+	env, required := *environment, *requireApproval
+	*environment, *requireApproval = "production", true
+	t.Cleanup(func() {
+		*environment, *requireApproval = env, required
+	})
+}
+
+// requestFrom builds an API request from an operator with a verified client certificate
+func requestFrom(operator, path, body string) *http.Request {
+	r := httptest.NewRequest("POST", path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	if operator != "" {
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: operator}}}}}
+	}
+	return r
+}
+
+func TestApprovalGateReplaysApprovedRequest(t *testing.T) {
+	setupTest(t)
+	withApproval(t)
+
+	var calls []string
+	var replayed map[string]interface{}
+	gate := approvalGate("/api/test-action", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, operatorFromRequest(r))
+		json.NewDecoder(r.Body).Decode(&replayed)
+		if replayed["break_glass_reason"] == nil {
+			writeFrozenError(w, &FreezeError{})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": "done"})
+	})
+	t.Cleanup(func() { delete(gatedActions, "/api/test-action") })
+
+	// Header-only identities are not trusted while approvals are required
+	anonymous := requestFrom("", "/api/test-action", `{"unique_id":"abc"}`)
+	anonymous.Header.Set("X-Operator", "mallory")
+	w := httptest.NewRecorder()
+	gate(w, anonymous)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("header-only operator: got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	w = httptest.NewRecorder()
+	gate(w, requestFrom("alice", "/api/test-action", `{"unique_id":"abc"}`))
+	var submitted struct {
+		Pending  bool   `json:"pending"`
+		ChangeID string `json:"change_id"`
+	}
+	json.NewDecoder(w.Body).Decode(&submitted)
+	if !submitted.Pending || submitted.ChangeID == "" || len(calls) != 0 {
+		t.Fatalf("request was not held for approval: %s, %d calls", w.Body.String(), len(calls))
+	}
+
+	if _, err := decideChangeRequest(context.Background(), submitted.ChangeID, "alice", true, "", ApprovalOverrides{}, nil); err == nil {
+		t.Errorf("requester approved their own change")
+	}
+
+	// A refused replay changes nothing and leaves the request open
+	_, err := decideChangeRequest(context.Background(), submitted.ChangeID, "bob", true, "", ApprovalOverrides{}, nil)
+	var replayErr *ReplayError
+	if !errors.As(err, &replayErr) || replayErr.Result["frozen"] != true {
+		t.Fatalf("frozen replay: got %v, want a frozen ReplayError", err)
+	}
+	if pending := pendingChanges(); len(pending) != 1 || pending[0].ID != submitted.ChangeID {
+		t.Fatalf("refused change request was not reopened: %+v", pending)
+	}
+
+	change, err := decideChangeRequest(context.Background(), submitted.ChangeID, "bob", true, "", ApprovalOverrides{BreakGlassReason: "incident"}, nil)
+	if err != nil {
+		t.Fatalf("approval failed: %v", err)
+	}
+	if change.Status != "applied" || len(calls) != 2 || calls[1] != "alice" {
+		t.Errorf("got status %s and operators %v, want applied on behalf of alice", change.Status, calls)
+	}
+	if replayed["unique_id"] != "abc" || replayed["break_glass_reason"] != "incident" {
+		t.Errorf("replayed body %v lost the request or the override", replayed)
+	}
+	if success, _, _ := changeDecisionResult(change); !success {
+		t.Errorf("successful replay reported as failed")
+	}
+}
+
+// issueCert signs a certificate for template with parent, or self-signs it
+// if parent is nil
+func issueCert(t *testing.T, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, tls.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore, template.NotAfter = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, key
+}
+
+func TestMutualTLS(t *testing.T) {
+	setupTest(t)
+
+	// The generated server certificate is kept and reused
+	certFile, keyFile, err := loadOrCreateSelfSignedCert("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated, _ := os.ReadFile(certFile)
+	if again, _, err := loadOrCreateSelfSignedCert("test"); err != nil || again != certFile {
+		t.Fatalf("second load: %v", err)
+	}
+	if reused, _ := os.ReadFile(certFile); string(reused) != string(generated) {
+		t.Error("a valid certificate was regenerated")
+	}
+	serverCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca, _, caKey := issueCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "operators"}, IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}, nil, nil)
+	_, clientCert, _ := issueCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, ca, caKey)
+	os.WriteFile("clients-ca.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), 0600)
+	clientCA := *tlsClientCA
+	*tlsClientCA = "clients-ca.pem"
+	t.Cleanup(func() { *tlsClientCA = clientCA })
+
+	tlsConfig, err := buildTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig.Certificates = []tls.Certificate{serverCert}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, operatorFromRequest(r))
+	}))
+	server.TLS = tlsConfig
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(generated)
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+	}
+
+	if resp, err := client().Get(server.URL); err == nil {
+		resp.Body.Close()
+		t.Fatal("a client without a certificate was accepted")
+	}
+	_, foreign, _ := issueCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "mallory"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, nil, nil)
+	if resp, err := client(foreign).Get(server.URL); err == nil {
+		resp.Body.Close()
+		t.Fatal("a certificate from another CA was accepted")
+	}
+
+	resp, err := client(clientCert).Get(server.URL)
+	if err != nil {
+		t.Fatalf("client with a certificate: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "alice" {
+		t.Errorf("operator: got %q, want alice from the certificate", body)
+	}
+}
+
+func TestProtectAPI(t *testing.T) {
+	setupTest(t)
+	token := csrfToken
+	csrfToken = "secret"
+	t.Cleanup(func() { csrfToken = token })
+
+	for _, tc := range []struct {
+		name    string
+		method  string
+		headers map[string]string
+		status  int
+	}{
+		{name: "same origin", headers: map[string]string{"Origin": "http://localhost:9876"}, status: http.StatusOK},
+		{name: "missing origin", status: http.StatusOK},
+		{name: "same origin referer", headers: map[string]string{"Referer": "http://localhost:9876/"}, status: http.StatusOK},
+		{name: "cross origin", headers: map[string]string{"Origin": "http://evil.example"}, status: http.StatusForbidden},
+		{name: "cross origin referer", headers: map[string]string{"Referer": "http://evil.example/page"}, status: http.StatusForbidden},
+		{name: "other port", headers: map[string]string{"Origin": "http://localhost:8080"}, status: http.StatusForbidden},
+		{name: "cross site fetch", headers: map[string]string{"Sec-Fetch-Site": "cross-site"}, status: http.StatusForbidden},
+		{name: "missing token", headers: map[string]string{"X-CSRF-Token": ""}, status: http.StatusForbidden},
+		{name: "wrong token", headers: map[string]string{"X-CSRF-Token": "guess"}, status: http.StatusForbidden},
+		{name: "form post", headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, status: http.StatusUnsupportedMediaType},
+		{name: "get", method: "GET", status: http.StatusMethodNotAllowed},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			method := tc.method
+			if method == "" {
+				method = "POST"
+			}
+			r := httptest.NewRequest(method, "http://localhost:9876/api/update", strings.NewReader("{}"))
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("X-CSRF-Token", "secret")
+			for key, value := range tc.headers {
+				r.Header.Set(key, value)
+			}
+
+			w := httptest.NewRecorder()
+			called := false
+			protectAPI(func(w http.ResponseWriter, r *http.Request) { called = true })(w, r)
+			if w.Code != tc.status || called != (tc.status == http.StatusOK) {
+				t.Errorf("got status %d (handler called %v), want %d", w.Code, called, tc.status)
+			}
+		})
+	}
+}
+
+func TestHostCheck(t *testing.T) {
+	setupTest(t)
+	hostname, _ := os.Hostname()
+	for _, tc := range []struct {
+		host    string
+		allowed string
+		ok      bool
+	}{
+		{host: "localhost:9876", ok: true},
+		{host: "127.0.0.1:9876", ok: true},
+		{host: "[::1]:9876", ok: true},
+		{host: hostname, ok: true},
+		{host: "evil.example", ok: false},
+		{host: "192.168.1.10:9876", ok: false},
+		{host: "192.168.1.10:9876", allowed: "dns.internal, 192.168.1.10", ok: true},
+		{host: "DNS.internal", allowed: "dns.internal, 192.168.1.10", ok: true},
+	} {
+		t.Run(tc.host, func(t *testing.T) {
+			hosts := *allowedHosts
+			*allowedHosts = tc.allowed
+			t.Cleanup(func() { *allowedHosts = hosts })
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Host = tc.host
+			w := httptest.NewRecorder()
+			hostCheckMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+			if ok := w.Code == http.StatusOK; ok != tc.ok {
+				t.Errorf("host %q with -allowed-hosts %q: got status %d, want allowed %v", tc.host, tc.allowed, w.Code, tc.ok)
+			}
+		})
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	at := func(s string) time.Time {
+		parsed, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	tests := []struct {
+		expr    string
+		valid   bool
+		matches []string
+		misses  []string
+	}{
+		{expr: "55 23 * * *", valid: true, matches: []string{"2026-10-18 23:55"}, misses: []string{"2026-10-18 23:54", "2026-10-18 22:55"}},
+		{expr: "*/15 8-18 * * 1-5", valid: true, matches: []string{"2026-10-19 08:00", "2026-10-19 18:45"}, misses: []string{"2026-10-19 08:05", "2026-10-18 09:00"}},
+		{expr: "0 0 * * 7", valid: true, matches: []string{"2026-10-18 00:00"}, misses: []string{"2026-10-19 00:00"}},
+		{expr: "0 12 1 * 1", valid: true, matches: []string{"2026-10-01 12:00", "2026-10-19 12:00"}, misses: []string{"2026-10-20 12:00"}},
+		{expr: "30 9,17 * 10 *", valid: true, matches: []string{"2026-10-05 09:30", "2026-10-05 17:30"}, misses: []string{"2026-11-05 09:30"}},
+		{expr: "@daily", valid: true, matches: []string{"2026-10-18 00:00"}, misses: []string{"2026-10-18 01:00"}},
+		{expr: "* * * *"},
+		{expr: "60 * * * *"},
+		{expr: "* 24 * * *"},
+		{expr: "* * 0 * *"},
+		{expr: "5-1 * * * *"},
+		{expr: "*/0 * * * *"},
+		{expr: "x * * * *"},
+	}
+	for _, tt := range tests {
+		sched, err := parseCron(tt.expr)
+		if (err == nil) != tt.valid {
+			t.Errorf("parseCron(%q): got error %v, want valid=%v", tt.expr, err, tt.valid)
+			continue
+		}
+		for _, s := range tt.matches {
+			if !sched.Matches(at(s)) {
+				t.Errorf("%q should fire at %s", tt.expr, s)
+			}
+		}
+		for _, s := range tt.misses {
+			if sched.Matches(at(s)) {
+				t.Errorf("%q should not fire at %s", tt.expr, s)
+			}
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	sched, err := parseCron("0 3 * * 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2026, 10, 18, 3, 0, 0, 0, time.UTC) // Sunday
+	if next := sched.Next(from); !next.Equal(time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC)) {
+		t.Errorf("got %v, want Monday 03:00", next)
+	}
+	if next := sched.Next(time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC)); !next.Equal(time.Date(2026, 10, 26, 3, 0, 0, 0, time.UTC)) {
+		t.Errorf("Next must be strictly after t, got %v", next)
+	}
+}
+
+func TestFreezeWindow(t *testing.T) {
+	now := time.Date(2026, 10, 18, 23, 58, 0, 0, time.UTC)
+	start, end := now.Add(-time.Hour), now.Add(time.Hour)
+	tests := []struct {
+		name   string
+		window FreezeWindow
+		valid  bool
+		active bool
+	}{
+		{name: "one-off covering now", window: FreezeWindow{Start: &start, End: &end}, valid: true, active: true},
+		{name: "one-off ending at its start", window: FreezeWindow{Start: &start, End: &start}, valid: false, active: false},
+		{name: "recurring started 3m ago", window: FreezeWindow{Cron: "55 23 * * *", Duration: "30m"}, valid: true, active: true},
+		{name: "recurring already over", window: FreezeWindow{Cron: "55 23 * * *", Duration: "2m"}, valid: true, active: false},
+		{name: "recurring without duration", window: FreezeWindow{Cron: "55 23 * * *"}},
+		{name: "recurring longer than a week", window: FreezeWindow{Cron: "0 0 * * *", Duration: "200h"}},
+		{name: "neither", window: FreezeWindow{}},
+	}
+	for _, tt := range tests {
+		if err := tt.window.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: Validate() = %v, want valid=%v", tt.name, err, tt.valid)
+		}
+		if active := tt.window.IsActive(now); active != tt.active {
+			t.Errorf("%s: IsActive() = %v, want %v", tt.name, active, tt.active)
+		}
+	}
+}
+
+// withAdmins lists the operators allowed to change freeze windows
+func withAdmins(t *testing.T, names string) {
+	t.Helper()
+	admins := *adminNames
+	*adminNames = names
+	t.Cleanup(func() { *adminNames = admins })
+}
+
+func TestDeleteActiveFreezeWindowNeedsBreakGlass(t *testing.T) {
+	setupTest(t)
+	withAdmins(t, "alice")
+	start, end := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	if err := updateServerConfig(context.Background(), func(config *ServerConfig) error {
+		config.FreezeWindows = []FreezeWindow{{ID: "f1", Name: "release", Start: &start, End: &end}}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	deleteFreezeHandler(w, requestFrom("alice", "/api/freeze/delete", `{"id":"f1"}`))
+	if w.Code != http.StatusLocked {
+		t.Fatalf("without a reason: got status %d, want %d", w.Code, http.StatusLocked)
+	}
+
+	w = httptest.NewRecorder()
+	deleteFreezeHandler(w, requestFrom("alice", "/api/freeze/delete", `{"id":"f1","break_glass_reason":"outage"}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("with a reason: got status %d: %s", w.Code, w.Body.String())
+	}
+	config, _ := loadServerConfig(*environment)
+	if len(config.FreezeWindows) != 0 {
+		t.Errorf("freeze window was not removed: %+v", config.FreezeWindows)
+	}
+}
+
+func TestFreezeWindowsAreChangedByAdminsOnly(t *testing.T) {
+	setupTest(t)
+	withAdmins(t, "alice, carol")
+	add := `{"name":"payout","cron":"55 23 * * *","duration":"30m"}`
+
+	w := httptest.NewRecorder()
+	addFreezeHandler(w, requestFrom("bob", "/api/freeze/add", add))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("add by a non-admin: got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	w = httptest.NewRecorder()
+	addFreezeHandler(w, requestFrom("carol", "/api/freeze/add", add))
+	if w.Code != http.StatusOK {
+		t.Fatalf("add by an admin: got status %d: %s", w.Code, w.Body.String())
+	}
+	config, _ := loadServerConfig(*environment)
+	if len(config.FreezeWindows) != 1 || config.FreezeWindows[0].CreatedBy != "carol" {
+		t.Fatalf("freeze windows: got %+v, want one by carol", config.FreezeWindows)
+	}
+	id := config.FreezeWindows[0].ID
+
+	w = httptest.NewRecorder()
+	deleteFreezeHandler(w, requestFrom("bob", "/api/freeze/delete", `{"id":"`+id+`"}`))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("delete by a non-admin: got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if config, _ := loadServerConfig(*environment); len(config.FreezeWindows) != 1 {
+		t.Fatal("a non-admin removed the freeze window")
+	}
+}
+
+func TestManualCreateRespectsScopedFreeze(t *testing.T) {
+	zone := setupTest(t)
+	start, end := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	if err := updateServerConfig(context.Background(), func(config *ServerConfig) error {
+		config.Servers = []Server{{UniqueID: "s1", Name: "xmr.example.com", Content: "2.2.2.2", Account: "Pool1", State: "standby"}}
+		config.FreezeWindows = []FreezeWindow{{ID: "f1", Name: "payout", Start: &start, End: &end, Accounts: []string{"Pool1"}}}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	createDNSHandler(w, requestFrom("alice", "/api/dns/create", `{"name":"xmr","ip":"2.2.2.2"}`))
+	if w.Code != http.StatusLocked {
+		t.Fatalf("create of a frozen account: got status %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	createDNSHandler(w, requestFrom("alice", "/api/dns/create", `{"name":"xmr","ip":"3.3.3.3"}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("create outside the frozen account: got status %d: %s", w.Code, w.Body.String())
+	}
+	if live := zone.live(); len(live) != 1 || live[0].Content != "3.3.3.3" {
+		t.Errorf("live records: got %+v, want only 3.3.3.3", live)
+	}
+}
+
+func TestPlanUpdate(t *testing.T) {
+	setupTest(t)
+	records := []CloudflareRecord{
+		{ID: "a", Name: "xmr.example.com", Content: "1.1.1.1"},
+		{ID: "b", Name: "xmr.example.com", Content: "2.2.2.2"},
+		{ID: "c", Name: "eu.xmr.example.com", Content: "3.3.3.3"},
+	}
+	active := func(servers ...string) UpdateRequest {
+		var req UpdateRequest
+		for _, server := range servers {
+			parts := strings.SplitN(server, "/", 2)
+			req.ActiveServers = append(req.ActiveServers, ActiveServer{Name: parts[0], IP: parts[1]})
+		}
+		return req
+	}
+	tests := []struct {
+		name   string
+		req    UpdateRequest
+		create []string
+		delete []string
+	}{
+		{name: "unchanged", req: active("xmr/1.1.1.1", "xmr/2.2.2.2", "eu.xmr/3.3.3.3")},
+		{name: "full names match short ones", req: active("xmr.example.com/1.1.1.1", "xmr/2.2.2.2", "eu.xmr.example.com/3.3.3.3")},
+		{name: "activate", req: active("xmr/1.1.1.1", "xmr/2.2.2.2", "eu.xmr/3.3.3.3", "xmr/4.4.4.4"), create: []string{"xmr/4.4.4.4"}},
+		{name: "deactivate", req: active("xmr/2.2.2.2", "eu.xmr/3.3.3.3"), delete: []string{"xmr.example.com/1.1.1.1"}},
+		{name: "move to another name", req: active("xmr/1.1.1.1", "xmr/2.2.2.2", "us.xmr/3.3.3.3"), create: []string{"us.xmr/3.3.3.3"}, delete: []string{"eu.xmr.example.com/3.3.3.3"}},
+		{name: "empty set", req: active(), delete: []string{"eu.xmr.example.com/3.3.3.3", "xmr.example.com/1.1.1.1", "xmr.example.com/2.2.2.2"}},
+		{name: "duplicates count once", req: active("xmr/1.1.1.1", "xmr/2.2.2.2", "eu.xmr/3.3.3.3", "xmr/5.5.5.5", "xmr/5.5.5.5"), create: []string{"xmr/5.5.5.5"}},
+	}
+	for _, tt := range tests {
+		plan := planUpdate(records, tt.req)
+		var create, remove []string
+		for _, server := range plan.Create {
+			create = append(create, server.Name+"/"+server.IP)
+		}
+		for _, record := range plan.Delete {
+			remove = append(remove, record.Name+"/"+record.Content)
+		}
+		if fmt.Sprint(create) != fmt.Sprint(tt.create) || fmt.Sprint(remove) != fmt.Sprint(tt.delete) {
+			t.Errorf("%s: got create %v delete %v, want create %v delete %v", tt.name, create, remove, tt.create, tt.delete)
+		}
+		if plan.IsEmpty() != (len(tt.create) == 0 && len(tt.delete) == 0) {
+			t.Errorf("%s: IsEmpty() = %v", tt.name, plan.IsEmpty())
+		}
+	}
+}
+
+func TestCheckBlastRadius(t *testing.T) {
+	setupTest(t)
+	removals, percent := *maxRemovals, *maxRemovalPercent
+	t.Cleanup(func() { *maxRemovals, *maxRemovalPercent = removals, percent })
+
+	var records []CloudflareRecord
+	for i := 1; i <= 10; i++ {
+		records = append(records, CloudflareRecord{Name: "xmr.example.com", Content: fmt.Sprintf("10.0.0.%d", i)})
+	}
+	records = append(records,
+		CloudflareRecord{Name: "eu.xmr.example.com", Content: "10.0.1.1"},
+		CloudflareRecord{Name: "canary.xmr.example.com", Content: "10.0.2.1"},
+	)
+
+	tests := []struct {
+		name        string
+		limit       int
+		percent     float64
+		plan        UpdatePlan
+		violations  int
+		wantMessage string
+	}{
+		{name: "nothing removed", limit: 1, percent: 1, plan: UpdatePlan{Create: []ActiveServer{{Name: "xmr", IP: "10.0.0.99"}}}},
+		{name: "within limits", limit: 5, percent: 50, plan: UpdatePlan{Delete: records[:2]}},
+		{name: "too many records", limit: 2, percent: 0, plan: UpdatePlan{Delete: records[:3]}, violations: 1, wantMessage: "3 records would be removed (limit 2)"},
+		{name: "too large a share", limit: 0, percent: 20, plan: UpdatePlan{Delete: records[:3]}, violations: 1, wantMessage: "25% of records would be removed (limit 20%)"},
+		{name: "name left empty", limit: 0, percent: 0, plan: UpdatePlan{Delete: records[10:11]}, violations: 1, wantMessage: "eu.xmr.example.com would be left without any record"},
+		{name: "name refilled by the plan", limit: 0, percent: 0, plan: UpdatePlan{Create: []ActiveServer{{Name: "eu.xmr", IP: "10.0.1.2"}}, Delete: records[10:11]}},
+		{name: "canary names may empty", limit: 0, percent: 0, plan: UpdatePlan{Delete: records[11:12]}},
+		{name: "everything", limit: 5, percent: 50, plan: UpdatePlan{Delete: records}, violations: 4},
+	}
+	for _, tt := range tests {
+		*maxRemovals, *maxRemovalPercent = tt.limit, tt.percent
+		violations := checkBlastRadius(records, tt.plan)
+		if len(violations) != tt.violations {
+			t.Errorf("%s: got %v, want %d violations", tt.name, violations, tt.violations)
+			continue
+		}
+		if tt.wantMessage != "" && violations[0] != tt.wantMessage {
+			t.Errorf("%s: got %q, want %q", tt.name, violations[0], tt.wantMessage)
+		}
+	}
+}
+
+func TestExpireActivationsPerServer(t *testing.T) {
+	zone := setupTest(t)
+	zone.add("xmr.example.com", "1.1.1.1", "")
+	zone.add("xmr.example.com", "2.2.2.2", "")
+	zone.add("eu.xmr.example.com", "3.3.3.3", "")
+
+	past := time.Now().Add(-time.Minute).Format(time.RFC3339)
+	if err := updateServerConfig(context.Background(), func(config *ServerConfig) error {
+		config.Servers = []Server{
+			{UniqueID: "s1", Alias: "one", Type: "A", Name: "xmr.example.com", Content: "1.1.1.1", ExpiresAt: past},
+			{UniqueID: "s2", Alias: "two", Type: "A", Name: "xmr.example.com", Content: "2.2.2.2"},
+			{UniqueID: "s3", Alias: "three", Type: "A", Name: "eu.xmr.example.com", Content: "3.3.3.3", ExpiresAt: past},
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The guard keeps eu.xmr from losing its last record, xmr still expires
+	expireActivations(context.Background(), time.Now())
+
+	var live []string
+	for _, record := range zone.live() {
+		live = append(live, record.Content)
+	}
+	if fmt.Sprint(live) != "[2.2.2.2 3.3.3.3]" {
+		t.Errorf("live records after expiry: %v", live)
+	}
+	config, _ := loadServerConfig(*environment)
+	for _, server := range config.Servers {
+		switch server.UniqueID {
+		case "s1":
+			if server.ExpiresAt != "" || server.ExpiryBlocked != "" {
+				t.Errorf("expired server kept its expiry: %+v", server)
+			}
+		case "s3":
+			if server.ExpiresAt == "" || !strings.Contains(server.ExpiryBlocked, "without any record") {
+				t.Errorf("blocked expiry was not recorded: %+v", server)
+			}
+		}
+	}
+}
+
+func TestDrainKeepsBreakGlassForRemoval(t *testing.T) {
+	zone := setupTest(t)
+	zone.add("xmr.example.com", "1.1.1.1", "")
+	zone.add("xmr.example.com", "2.2.2.2", "")
+	start, end := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	if err := updateServerConfig(context.Background(), func(config *ServerConfig) error {
+		config.Servers = []Server{
+			{UniqueID: "s1", Alias: "one", Type: "A", Name: "xmr.example.com", Content: "1.1.1.1", State: "active"},
+			{UniqueID: "s2", Alias: "two", Type: "A", Name: "xmr.example.com", Content: "2.2.2.2", State: "active"},
+		}
+		config.FreezeWindows = []FreezeWindow{{ID: "f1", Name: "release", Start: &start, End: &end}}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfClient := NewCloudflareClient(credentials)
+	if _, err := startDrain(context.Background(), cfClient, DrainRequest{UniqueID: "s1"}, "alice"); err == nil {
+		t.Fatal("drain started during a freeze without break-glass")
+	}
+	server, err := startDrain(context.Background(), cfClient, DrainRequest{UniqueID: "s1", BreakGlassReason: "hardware failure"}, "alice")
+	if err != nil {
+		t.Fatalf("drain with break-glass: %v", err)
+	}
+
+	removeDrainedRecord(context.Background(), cfClient, *server, time.Now())
+	if live := zone.live(); len(live) != 1 || live[0].Content != "2.2.2.2" {
+		t.Errorf("drained record was not removed during the freeze: %+v", live)
+	}
+}
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		allowed  bool
+	}{
+		{"provisioning", "active", true},
+		{"provisioning", "maintenance", false},
+		{"standby", "retired", true},
+		{"active", "draining", true},
+		{"active", "retired", false},
+		{"draining", "retired", false},
+		{"maintenance", "active", false},
+		{"maintenance", "retired", true},
+		{"retired", "active", false},
+		{"retired", "standby", true},
+		{"unknown", "standby", false},
+	}
+	for _, tt := range tests {
+		if got := canTransition(tt.from, tt.to); got != tt.allowed {
+			t.Errorf("canTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.allowed)
+		}
+	}
+}
+
+func TestRetireServer(t *testing.T) {
+	for from, want := range map[string]string{
+		"active":       "retired",
+		"draining":     "retired",
+		"standby":      "retired",
+		"maintenance":  "retired",
+		"provisioning": "retired",
+		"retired":      "retired",
+	} {
+		server := Server{State: from}
+		if got := retireServer(&server, from, "record deleted"); got != want || server.State != want {
+			t.Errorf("retiring a %s server: got %s, want %s", from, got, want)
+		}
+	}
+}
+
+func TestDriftActsOnlyAfterAnInterval(t *testing.T) {
+	zone := setupTest(t)
+	policy, interval, sync := *driftPolicy, *driftInterval, *syncMetadata
+	*driftPolicy, *driftInterval, *syncMetadata = "adopt", time.Hour, false
+	t.Cleanup(func() {
+		*driftPolicy, *driftInterval, *syncMetadata = policy, interval, sync
+		driftSightings = make(map[string]time.Time)
+	})
+	driftSightings = make(map[string]time.Time)
+	zone.add("xmr.example.com", "1.1.1.1", "")
+	if err := updateServerConfig(context.Background(), func(config *ServerConfig) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		report := checkDrift(context.Background())
+		if len(report.Items) != 1 || !strings.HasPrefix(report.Items[0].Action, "waiting") {
+			t.Fatalf("check %d acted too early: %+v", i+1, report)
+		}
+	}
+
+	for key := range driftSightings {
+		driftSightings[key] = time.Now().Add(-2 * time.Hour)
+	}
+	report := checkDrift(context.Background())
+	if len(report.Items) != 1 || report.Items[0].Action != "adopted" {
+		t.Fatalf("persistent drift was not adopted: %+v", report)
+	}
+}
+
+func TestDriftReadDoesNotRunACheck(t *testing.T) {
+	zone := setupTest(t)
+	policy := *driftPolicy
+	*driftPolicy = "revert"
+	t.Cleanup(func() {
+		*driftPolicy = policy
+		lastDrift = nil
+		driftSightings = make(map[string]time.Time)
+	})
+	lastDrift = nil
+	zone.add("xmr.example.com", "1.1.1.1", "")
+
+	read := func() map[string]interface{} {
+		rec := httptest.NewRecorder()
+		driftHandler(rec, httptest.NewRequest("GET", "/api/drift", nil))
+		var result map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		return result
+	}
+	if result := read(); result["drift"] != nil || len(zone.calls) != 0 {
+		t.Fatalf("reading before any check: got %v with calls %v, want no report and no calls", result, zone.calls)
+	}
+
+	checkDrift(context.Background())
+	calls := len(zone.calls)
+	result := read()
+	if drift, _ := result["drift"].(map[string]interface{}); drift == nil || len(zone.calls) != calls {
+		t.Fatalf("reading after a check: got %v with %d new calls, want the stored report", result, len(zone.calls)-calls)
+	}
+}
+
+func TestRecordCacheDropsFetchesOverlappingAWrite(t *testing.T) {
+	zone := setupTest(t)
+	zone.add("xmr.example.com", "1.1.1.1", "")
+	cfClient := NewCloudflareClient(credentials)
+
+	// A write lands while the list is in flight
+	zone.onList = func() {
+		zone.onList = nil
+		invalidateRecords()
+	}
+	if _, err := cfClient.GetDNSRecords(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	recordCache.mu.Lock()
+	valid := recordCache.valid
+	recordCache.mu.Unlock()
+	if valid {
+		t.Fatal("a fetch that overlapped an invalidation was cached")
+	}
+
+	// The next cached read goes back to Cloudflare, and that result is kept
+	listed := func() int {
+		count := 0
+		for _, call := range zone.calls {
+			if call == "GET " {
+				count++
+			}
+		}
+		return count
+	}
+	before := listed()
+	for i := 0; i < 2; i++ {
+		if _, err := cfClient.GetCachedDNSRecords(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fetched := listed() - before; fetched != 1 {
+		t.Errorf("got %d list requests after the invalidation, want 1", fetched)
+	}
+}
+
+func TestBatchWithLostResponseReportsLiveRecords(t *testing.T) {
+	unsupported := batchUnsupported.value
+	t.Cleanup(func() { batchUnsupported.value = unsupported })
+
+	for _, tc := range []struct {
+		mode        string
+		activated   int
+		deactivated int
+		failed      bool
+	}{
+		{mode: "lost", activated: 1, deactivated: 1},
+		{mode: "dropped", failed: true},
+	} {
+		t.Run(tc.mode, func(t *testing.T) {
+			zone := setupTest(t)
+			zone.batch = tc.mode
+			batchUnsupported.value = false
+			old := zone.add("xmr.example.com", "1.1.1.1", "")
+			plan := UpdatePlan{
+				Create: []ActiveServer{{IP: "2.2.2.2", Name: "xmr", Alias: "new"}},
+				Delete: []CloudflareRecord{{ID: old, Name: "xmr.example.com", Content: "1.1.1.1"}},
+			}
+
+			result, err := executePlanBatch(context.Background(), NewCloudflareClient(credentials), plan, &applyJournal{id: "test"}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.BatchError != nil {
+				t.Errorf("a lost response was reported as a rejection: %v", result.BatchError)
+			}
+			if len(result.Activated) != tc.activated || len(result.Deactivated) != tc.deactivated || result.Failed != tc.failed {
+				t.Errorf("got %d activated, %d deactivated, failed %v; want %d, %d, %v",
+					len(result.Activated), len(result.Deactivated), result.Failed, tc.activated, tc.deactivated, tc.failed)
+			}
+		})
+	}
+}
+
+func TestVerifyRollbackComparesWithSnapshot(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		stray    bool
+		complete bool
+	}{
+		{name: "restored", complete: true},
+		{name: "changed meanwhile", stray: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			zone := setupTest(t)
+			zone.add("xmr.example.com", "1.1.1.1", "")
+			zone.failPost = func(record CloudflareRecord) bool {
+				if record.Content != "3.3.3.3" {
+					return false
+				}
+				if tc.stray {
+					// The lock is held while a request is served
+					zone.records["stray"] = CloudflareRecord{ID: "stray", Type: "A", Name: "xmr.example.com", Content: "9.9.9.9"}
+				}
+				return true
+			}
+			cfClient := NewCloudflareClient(credentials)
+			before, err := cfClient.GetDNSRecords(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			plan := UpdatePlan{Create: []ActiveServer{{IP: "2.2.2.2", Name: "xmr"}, {IP: "3.3.3.3", Name: "xmr"}}}
+			result := executePlanSequential(context.Background(), cfClient, plan, &applyJournal{id: "test"}, nil)
+			if result.Rollback == nil || !result.Rollback.Success {
+				t.Fatalf("rollback did not undo the changes: %+v", result.Rollback)
+			}
+			verifyRollback(context.Background(), cfClient, before, &result)
+			if result.Rollback.Success != tc.complete {
+				t.Errorf("rollback success %v, want %v: %+v", result.Rollback.Success, tc.complete, result.Rollback.Details)
+			}
+		})
+	}
+}
+
+// interruptApply journals an apply that stops before its first change and
+// reloads the journal as a restart would
+func interruptApply(t *testing.T, plan UpdatePlan) string {
+	t.Helper()
+	t.Cleanup(func() {
+		closeJournal("test")
+		journal.open = map[string]bool{}
+		journal.unfinished = map[string]*UnfinishedApply{}
+	})
+	if err := openJournal("test"); err != nil {
+		t.Fatal(err)
+	}
+	a := beginApply(plan, ApplyOptions{Operator: "alice", Source: "test"}, nil)
+	closeJournal("test")
+	journal.open = map[string]bool{}
+	if err := openJournal("test"); err != nil {
+		t.Fatal(err)
+	}
+	return a.id
+}
+
+func TestResumeChecksBlastRadiusAgain(t *testing.T) {
+	zone := setupTest(t)
+	id := zone.add("xmr.example.com", "1.1.1.1", "")
+	cfClient := NewCloudflareClient(credentials)
+	apply := interruptApply(t, UpdatePlan{Delete: []CloudflareRecord{{ID: id, Name: "xmr.example.com", Content: "1.1.1.1"}}})
+
+	_, err := resolveUnfinishedApply(context.Background(), cfClient, apply, "resume", "bob", ApprovalOverrides{}, nil)
+	var guardErr *BlastRadiusError
+	if !errors.As(err, &guardErr) {
+		t.Fatalf("resume removing the last record: got %v, want the blast-radius guard", err)
+	}
+	if len(zone.live()) != 1 {
+		t.Fatal("a guarded resume changed the records")
+	}
+
+	response, err := resolveUnfinishedApply(context.Background(), cfClient, apply, "resume", "bob", ApprovalOverrides{Force: true, ForceReason: "planned"}, nil)
+	if err != nil || !response.Success {
+		t.Fatalf("forced resume: %v %+v", err, response)
+	}
+	if len(zone.live()) != 0 {
+		t.Errorf("forced resume left %v", zone.live())
+	}
+}
+
+func TestInterruptedPatchCanBeResumedOrRolledBack(t *testing.T) {
+	for _, tc := range []struct {
+		action  string
+		applied bool // The PATCH reached Cloudflare before the interruption
+		ttl     int
+	}{
+		{action: "resume", ttl: 30},
+		{action: "rollback", applied: true, ttl: 300},
+	} {
+		t.Run(tc.action, func(t *testing.T) {
+			zone := setupTest(t)
+			id := zone.add("xmr.example.com", "1.1.1.1", "")
+			zone.records[id] = CloudflareRecord{ID: id, Type: "A", Name: "xmr.example.com", Content: "1.1.1.1", TTL: 300}
+			patch := newRecordPatch(zone.records[id], map[string]interface{}{"ttl": 30})
+			apply := interruptApply(t, UpdatePlan{Patch: []RecordPatch{patch}})
+			if tc.applied {
+				record := zone.records[id]
+				record.TTL = 30
+				zone.records[id] = record
+			}
+
+			cfClient := NewCloudflareClient(credentials)
+			records, _ := cfClient.GetDNSRecords(context.Background())
+			unfinished := unfinishedApplies(records)
+			want := "not_applied"
+			if tc.applied {
+				want = "applied"
+			}
+			if len(unfinished) != 1 || len(unfinished[0].Ops) != 1 || unfinished[0].Ops[0].Live != want {
+				t.Fatalf("unfinished applies: got %+v, want one patch %s", unfinished, want)
+			}
+
+			response, err := resolveUnfinishedApply(context.Background(), cfClient, apply, tc.action, "bob", ApprovalOverrides{}, nil)
+			if err != nil || !response.Success {
+				t.Fatalf("%s: %v %+v", tc.action, err, response)
+			}
+			if ttl := zone.live()[0].TTL; ttl != tc.ttl {
+				t.Errorf("TTL after %s: got %d, want %d", tc.action, ttl, tc.ttl)
+			}
+		})
+	}
+}
+
+func TestJournalLockKeepsOneWriter(t *testing.T) {
+	setupTest(t)
+	if err := openJournal("test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lockJournal("test"); err == nil {
+		t.Fatal("a second process took over an owned journal")
+	}
+	closeJournal("test")
+	if _, err := os.Stat(journalLockPath("test")); !os.IsNotExist(err) {
+		t.Fatalf("closing the journal left the lock: %v", err)
+	}
+
+	// The lock of a crashed owner is no longer refreshed
+	os.WriteFile(journalLockPath("test"), []byte("1\n"), 0600)
+	stale := time.Now().Add(-journalLockStale - time.Second)
+	os.Chtimes(journalLockPath("test"), stale, stale)
+	if err := openJournal("test"); err != nil {
+		t.Fatalf("stale lock: %v", err)
+	}
+	closeJournal("test")
+}
+
+func TestCLIResumeWaitsForApproval(t *testing.T) {
+	zone := setupTest(t)
+	id := zone.add("xmr.example.com", "1.1.1.1", "")
+	apply := interruptApply(t, UpdatePlan{Delete: []CloudflareRecord{{ID: id, Name: "xmr.example.com", Content: "1.1.1.1"}}})
+	closeJournal("test")
+	data, _ := os.ReadFile(journalPath("test"))
+	withApproval(t)
+	os.WriteFile(journalPath(*environment), data, 0600)
+
+	resume, operator := *resumeApplyID, *operatorName
+	*resumeApplyID, *operatorName = apply, "alice"
+	t.Cleanup(func() { *resumeApplyID, *operatorName = resume, operator })
+
+	if err := runJournalCommand(); err != nil {
+		t.Fatal(err)
+	}
+	if len(zone.live()) != 1 {
+		t.Fatal("the resume ran without approval")
+	}
+	if _, err := os.Stat(journalLockPath(*environment)); !os.IsNotExist(err) {
+		t.Fatal("submitting the resume took over the journal")
+	}
+	changes, _ := loadChangeRequests(*environment)
+	if len(changes) != 1 || changes[0].Action != "/api/journal/resume" || changes[0].RequestedBy != "alice" {
+		t.Fatalf("change requests: got %+v, want a resume by alice", changes)
+	}
+}
+
+// dnsStub answers A queries over UDP with the IPs answer returns for a name;
+// names it returns nil for get NXDOMAIN. It returns the stub's address.
+func dnsStub(t *testing.T, answer func(name string) []string) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			query := buf[:n]
+
+			// The question follows the 12 byte header: labels, then type and class
+			end := 12
+			var labels []string
+			for end < n && query[end] != 0 {
+				labels = append(labels, string(query[end+1:end+1+int(query[end])]))
+				end += 1 + int(query[end])
+			}
+			end += 5
+			ips := answer(strings.Join(labels, "."))
+
+			reply := append([]byte{}, query[:12]...)
+			binary.BigEndian.PutUint16(reply[2:], 0x8180) // Response, recursion available
+			if ips == nil {
+				binary.BigEndian.PutUint16(reply[2:], 0x8183) // NXDOMAIN
+			}
+			binary.BigEndian.PutUint16(reply[4:], 1)
+			binary.BigEndian.PutUint16(reply[6:], uint16(len(ips)))
+			binary.BigEndian.PutUint32(reply[8:], 0)
+			reply = append(reply, query[12:end]...)
+			for _, ip := range ips {
+				// Pointer to the question name, A, IN, TTL 60, 4 bytes
+				reply = append(reply, 0xc0, 0x0c, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+				reply = append(reply, net.ParseIP(ip).To4()...)
+			}
+			conn.WriteTo(reply, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestQueryNameserver(t *testing.T) {
+	address := dnsStub(t, func(name string) []string {
+		if name == "xmr.example.com" {
+			return []string{"2.2.2.2", "1.1.1.1"}
+		}
+		return nil
+	})
+	server := nameserver{label: "stub", address: address, kind: "authoritative"}
+
+	for _, tc := range []struct {
+		name    string
+		query   string
+		desired []string
+		ips     string
+		match   bool
+	}{
+		{name: "match", query: "xmr.example.com", desired: []string{"1.1.1.1", "2.2.2.2"}, ips: "1.1.1.1,2.2.2.2", match: true},
+		{name: "mismatch", query: "xmr.example.com", desired: []string{"1.1.1.1"}, ips: "1.1.1.1,2.2.2.2"},
+		{name: "nxdomain removed", query: "old.example.com", desired: []string{}, ips: "", match: true},
+		{name: "nxdomain expected", query: "old.example.com", desired: []string{"3.3.3.3"}, ips: ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			result := queryNameserver(context.Background(), server, tc.query, tc.desired)
+			if result.Error != "" {
+				t.Fatalf("query failed: %s", result.Error)
+			}
+			if ips := strings.Join(result.IPs, ","); ips != tc.ips || result.Match != tc.match {
+				t.Errorf("got %q match %v, want %q match %v", ips, result.Match, tc.ips, tc.match)
+			}
+		})
+	}
+}
+
+func TestPropagationCheckConverges(t *testing.T) {
+	var mu sync.Mutex
+	queries := 0
+	address := dnsStub(t, func(name string) []string {
+		mu.Lock()
+		defer mu.Unlock()
+		// The old answer is served for the first rounds
+		queries++
+		if queries < 3 {
+			return []string{"1.1.1.1"}
+		}
+		return []string{"2.2.2.2"}
+	})
+
+	setupTest(t)
+	authoritative, resolvers, timeout, interval := *authoritativeNS, *recursiveResolvers, *propagationTimeout, propagationInterval
+	*authoritativeNS, *recursiveResolvers, *propagationTimeout, propagationInterval = address, "", 5*time.Second, 10*time.Millisecond
+	t.Cleanup(func() {
+		*authoritativeNS, *recursiveResolvers, *propagationTimeout, propagationInterval = authoritative, resolvers, timeout, interval
+	})
+
+	names := []NamePropagation{{Name: "xmr.example.com", Desired: []string{"2.2.2.2"}}}
+	propagationChecks.mu.Lock()
+	propagationChecks.checks = map[string]*PropagationCheck{"test": {ID: "test", Names: names}}
+	propagationChecks.mu.Unlock()
+
+	runPropagationCheck(context.Background(), "test", names)
+	check, _ := getPropagationCheck("test")
+	if !check.Converged || !check.Done || check.Rounds != 3 {
+		t.Errorf("got converged %v, done %v after %d rounds; want convergence in round 3 (%s)", check.Converged, check.Done, check.Rounds, check.Error)
+	}
+}
+
+func TestFailedUpdateStartsNoPropagationCheck(t *testing.T) {
+	zone := setupTest(t)
+	// A partial update keeps the change that went through
+	wasTransactional := *transactional
+	t.Cleanup(func() { *transactional = wasTransactional })
+	*transactional, *propagationTimeout = false, time.Minute
+	zone.add("xmr.example.com", "1.1.1.1", "")
+	zone.failPost = func(record CloudflareRecord) bool { return record.Content == "3.3.3.3" }
+
+	req := UpdateRequest{ActiveServers: []ActiveServer{
+		{IP: "1.1.1.1", Name: "xmr", Active: true},
+		{IP: "2.2.2.2", Name: "xmr", Active: true},
+		{IP: "3.3.3.3", Name: "xmr", Active: true},
+	}}
+	response := applyUpdate(context.Background(), NewCloudflareClient(credentials), req, ApplyOptions{Source: "test"})
+	if response.Success {
+		t.Fatalf("update succeeded: %+v", response)
+	}
+	if response.PropagationID != "" {
+		t.Errorf("failed update started propagation check %s", response.PropagationID)
+	}
+}
+
+// scheduleActivation stores a standby server and a schedule that activates it
+// at the given time
+func scheduleActivation(t *testing.T, at time.Time, cron string) {
+	t.Helper()
+	if err := updateServerConfig(context.Background(), func(config *ServerConfig) error {
+		config.Servers = []Server{{UniqueID: "s1", Name: "xmr.example.com", Alias: "node1", Content: "2.2.2.2", State: "standby"}}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	s := Schedule{ID: "sch1", Action: "activate", TargetType: "server", Target: "s1", Cron: cron, Status: "active", CreatedBy: "alice", CreatedAt: at}
+	if cron == "" {
+		s.At = &at
+	}
+	s.NextRun = s.computeNextRun(at.Add(-time.Minute))
+	if err := saveSchedules(*environment, []Schedule{s}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func loadedSchedule(t *testing.T) Schedule {
+	t.Helper()
+	schedules, err := loadSchedules(*environment)
+	if err != nil || len(schedules) != 1 {
+		t.Fatalf("schedules: %v %+v", err, schedules)
+	}
+	return schedules[0]
+}
+
+func TestScheduledRunFires(t *testing.T) {
+	zone := setupTest(t)
+	now := time.Now()
+	scheduleActivation(t, now.Add(-time.Minute), "")
+
+	runDueSchedules(context.Background(), now)
+	if live := zone.live(); len(live) != 1 || live[0].Content != "2.2.2.2" {
+		t.Fatalf("live records: got %+v, want the scheduled server", live)
+	}
+	s := loadedSchedule(t)
+	if s.Status != "done" || !s.LastSuccess || s.NextRun != nil {
+		t.Errorf("schedule after its run: %+v", s)
+	}
+}
+
+func TestScheduledRunIsSkippedDuringAFreeze(t *testing.T) {
+	zone := setupTest(t)
+	now := time.Now()
+	scheduleActivation(t, now.Add(-time.Minute), "")
+	start, end := now.Add(-time.Hour), now.Add(time.Hour)
+	if err := updateServerConfig(context.Background(), func(config *ServerConfig) error {
+		config.FreezeWindows = []FreezeWindow{{ID: "f1", Name: "payout", Start: &start, End: &end}}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	runDueSchedules(context.Background(), now)
+	if live := zone.live(); len(live) != 0 {
+		t.Fatalf("a frozen schedule changed the records: %+v", live)
+	}
+	if s := loadedSchedule(t); s.LastSuccess || !strings.Contains(s.LastResult, "frozen") {
+		t.Errorf("schedule during a freeze: %+v", s)
+	}
+}
+
+func TestScheduledRunIsNotRepeatedAfterARestart(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cron string
+	}{
+		{name: "one-off"},
+		{name: "cron", cron: "* * * * *"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			zone := setupTest(t)
+			now := time.Now().Truncate(time.Minute)
+			scheduleActivation(t, now, tc.cron)
+
+			runDueSchedules(context.Background(), now.Add(10*time.Second))
+			posts := 0
+			for _, call := range zone.calls {
+				if strings.HasPrefix(call, "POST") {
+					posts++
+				}
+			}
+			if posts != 1 {
+				t.Fatalf("first run sent %d creates, want 1: %v", posts, zone.calls)
+			}
+
+			// A restarted process only has what was saved
+			calls := len(zone.calls)
+			runDueSchedules(context.Background(), now.Add(20*time.Second))
+			if len(zone.calls) != calls {
+				t.Errorf("the run was repeated: %v", zone.calls[calls:])
+			}
+		})
+	}
+}
+
+func TestProfileSwitchAppliesTheSetBehindTheGuards(t *testing.T) {
+	zone := setupTest(t)
+	zone.add("xmr.example.com", "1.1.1.1", "")
+	zone.add("xmr.example.com", "2.2.2.2", "")
+	start, end := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	if err := updateServerConfig(context.Background(), func(config *ServerConfig) error {
+		config.Profiles = []Profile{{Name: "night", Servers: []ActiveServer{{IP: "3.3.3.3", Name: "xmr", Active: true}}}}
+		config.FreezeWindows = []FreezeWindow{{ID: "f1", Name: "payout", Start: &start, End: &end}}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cfClient := NewCloudflareClient(credentials)
+	unchanged := func(step string) {
+		t.Helper()
+		if live := zone.live(); len(live) != 2 || live[0].Content != "1.1.1.1" || live[1].Content != "2.2.2.2" {
+			t.Fatalf("%s changed the records: %+v", step, live)
+		}
+	}
+
+	response := switchToProfile(context.Background(), cfClient, "night", UpdateRequest{}, "alice", "test", nil)
+	if response.Success || !response.Frozen {
+		t.Fatalf("switch during a freeze: %+v", response)
+	}
+	unchanged("a frozen switch")
+
+	// Both live records go away, which is more than the guard allows
+	response = switchToProfile(context.Background(), cfClient, "night", UpdateRequest{BreakGlassReason: "outage"}, "alice", "test", nil)
+	if response.Success || !response.Guarded {
+		t.Fatalf("switch removing every record: %+v", response)
+	}
+	unchanged("a guarded switch")
+
+	response = switchToProfile(context.Background(), cfClient, "night", UpdateRequest{BreakGlassReason: "outage", Force: true, ForceReason: "planned"}, "alice", "test", nil)
+	if !response.Success {
+		t.Fatalf("switch with overrides: %+v", response)
+	}
+	if live := zone.live(); len(live) != 1 || live[0].Content != "3.3.3.3" {
+		t.Errorf("live records: got %+v, want only the profile's 3.3.3.3", live)
+	}
+}
+
+func TestMaintenanceLifecycle(t *testing.T) {
+	zone := setupTest(t)
+	zone.add("xmr.example.com", "1.1.1.1", "")
+	zone.add("xmr.example.com", "2.2.2.2", "")
+	if err := updateServerConfig(context.Background(), func(config *ServerConfig) error {
+		config.Servers = []Server{
+			{UniqueID: "s1", Name: "xmr.example.com", Alias: "node1", Content: "1.1.1.1", State: "active"},
+			{UniqueID: "s2", Name: "xmr.example.com", Alias: "node2", Content: "2.2.2.2", State: "active"},
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cfClient := NewCloudflareClient(credentials)
+
+	server, response, err := startMaintenance(context.Background(), cfClient, "s1", "disk swap", "1h", "alice", "", "")
+	if err != nil || !response.Success {
+		t.Fatalf("entering maintenance: %v %+v", err, response)
+	}
+	if server.State != "maintenance" || server.Maintenance.Owner != "alice" || server.Maintenance.IsOverdue() {
+		t.Errorf("server in maintenance: %+v", server)
+	}
+	if live := zone.live(); len(live) != 1 || live[0].Content != "2.2.2.2" {
+		t.Errorf("live records: got %+v, want the record of node1 removed", live)
+	}
+	if reason := activationBlocked(storedServer(t, "s1")); reason == "" {
+		t.Error("a server in maintenance can be activated")
+	}
+
+	// The expected end passes
+	if err := updateServerConfig(context.Background(), func(config *ServerConfig) error {
+		past := time.Now().Add(-time.Minute)
+		config.Servers[0].Maintenance.ExpectedEnd = &past
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	healthHandler(w, httptest.NewRequest("GET", "/health", nil))
+	var health struct {
+		Maintenance []struct {
+			UniqueID string `json:"unique_id"`
+			Overdue  bool   `json:"overdue"`
+		} `json:"maintenance"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &health)
+	if len(health.Maintenance) != 1 || health.Maintenance[0].UniqueID != "s1" || !health.Maintenance[0].Overdue {
+		t.Errorf("health: got %+v, want node1 overdue", health.Maintenance)
+	}
+
+	server, err = endMaintenance(context.Background(), "s1", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.State != "standby" || server.Maintenance != nil {
+		t.Errorf("server after maintenance: %+v", server)
+	}
+	if len(zone.live()) != 1 {
+		t.Error("ending maintenance changed the records")
+	}
+	if _, err := endMaintenance(context.Background(), "s1", "bob"); err == nil {
+		t.Error("ended the maintenance of a server not in maintenance")
+	}
+}
+
+func TestMaintenanceRespectsFreezeAndGuard(t *testing.T) {
+	zone := setupTest(t)
+	zone.add("xmr.example.com", "1.1.1.1", "")
+	start, end := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	if err := updateServerConfig(context.Background(), func(config *ServerConfig) error {
+		config.Servers = []Server{{UniqueID: "s1", Name: "xmr.example.com", Alias: "node1", Content: "1.1.1.1", State: "active"}}
+		config.FreezeWindows = []FreezeWindow{{ID: "f1", Name: "payout", Start: &start, End: &end}}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cfClient := NewCloudflareClient(credentials)
+
+	var freezeErr *FreezeError
+	if _, _, err := startMaintenance(context.Background(), cfClient, "s1", "disk swap", "", "alice", "", ""); !errors.As(err, &freezeErr) {
+		t.Fatalf("during a freeze: got %v, want a freeze error", err)
+	}
+	// Removing the only record trips the guard
+	var guardErr *BlastRadiusError
+	if _, _, err := startMaintenance(context.Background(), cfClient, "s1", "disk swap", "", "alice", "outage", ""); !errors.As(err, &guardErr) {
+		t.Fatalf("removing the last record: got %v, want the blast-radius guard", err)
+	}
+	if server := storedServer(t, "s1"); server.State != "active" || server.Maintenance != nil || len(zone.live()) != 1 {
+		t.Fatalf("a refused maintenance changed something: %+v", server)
+	}
+}
+
+func TestJobsAreTrackedAndPrunedAroundRunningOnes(t *testing.T) {
+	setupTest(t)
+	ctx := workCtx
+	workCtx = context.Background()
+	t.Cleanup(func() {
+		workCtx = ctx
+		jobs.jobs, jobs.order = nil, nil
+	})
+	jobs.jobs, jobs.order = nil, nil
+
+	release := make(chan struct{})
+	running := startJob("import", "alice", func(ctx context.Context, progress func(UpdateDetail)) (bool, string, interface{}) {
+		<-release
+		return true, "imported", nil
+	})
+	if appliesRunning() != 1 {
+		t.Fatalf("running job not tracked for shutdown: %d running", appliesRunning())
+	}
+	for i := 0; i < maxJobs+5; i++ {
+		job := startJob("restore", "alice", func(ctx context.Context, progress func(UpdateDetail)) (bool, string, interface{}) {
+			return true, "restored", nil
+		})
+		<-job.done
+	}
+
+	jobs.mu.Lock()
+	kept, found := len(jobs.order), jobs.jobs[running.ID] != nil
+	jobs.mu.Unlock()
+	if kept != maxJobs || !found {
+		t.Errorf("kept %d jobs (running one kept: %v), want %d including the running one", kept, found, maxJobs)
+	}
+
+	close(release)
+	<-running.done
+	for deadline := time.Now().Add(time.Second); appliesRunning() > 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if appliesRunning() != 0 {
+		t.Errorf("%d jobs still tracked after all finished", appliesRunning())
+	}
+}
+
+func TestDriftCheckWritesMetadataOnlyWhenAllowed(t *testing.T) {
+	for _, tc := range []struct {
+		policy string
+		write  bool
+		patch  bool
+	}{
+		{policy: "report", write: true},
+		{policy: "adopt"},
+		{policy: "adopt", write: true, patch: true},
+	} {
+		t.Run(fmt.Sprintf("%s write %v", tc.policy, tc.write), func(t *testing.T) {
+			zone := setupTest(t)
+			policy, interval, sync, write := *driftPolicy, *driftInterval, *syncMetadata, *writeMetadata
+			*driftPolicy, *driftInterval, *syncMetadata, *writeMetadata = tc.policy, time.Hour, true, tc.write
+			t.Cleanup(func() {
+				*driftPolicy, *driftInterval, *syncMetadata, *writeMetadata = policy, interval, sync, write
+				driftSightings = make(map[string]time.Time)
+			})
+			zone.add("xmr.example.com", "1.1.1.1", "pool-eu-1")
+			if err := updateServerConfig(context.Background(), func(config *ServerConfig) error {
+				config.Servers = append(config.Servers, Server{
+					UniqueID: generateServerID("xmr.example.com", "1.1.1.1"),
+					Alias:    "pool-eu-1",
+					Account:  "Pool1",
+					Type:     "A",
+					Name:     "xmr.example.com",
+					Content:  "1.1.1.1",
+					TTL:      60,
+					Comment:  "pool-eu-1",
+				})
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			checkDrift(context.Background())
+			patched := false
+			for _, call := range zone.calls {
+				patched = patched || strings.HasPrefix(call, "PATCH ")
+			}
+			if patched != tc.patch {
+				t.Errorf("record written: %v, want %v (calls %v)", patched, tc.patch, zone.calls)
+			}
+		})
+	}
+}
+
+func TestRecordCommentRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		meta       RecordMetadata
+		comment    string
+		structured bool
+	}{
+		{name: "alias only", meta: RecordMetadata{Alias: "pool-eu-1"}, comment: "pool-eu-1"},
+		{
+			name:       "all fields",
+			meta:       RecordMetadata{UniqueID: "0123456789abcdef", Alias: "pool-eu-1", Account: "Pool1", Container: "Group1"},
+			comment:    "pool-eu-1 [xsm:id=0123456789abcdef;account=Pool1;container=Group1]",
+			structured: true,
+		},
+		{
+			name:       "escaped values",
+			meta:       RecordMetadata{Alias: "eu [old]", Account: "Pool 1;x=y"},
+			comment:    "eu [old] [xsm:account=Pool+1%3Bx%3Dy]",
+			structured: true,
+		},
+		{name: "no alias", meta: RecordMetadata{Account: "Pool1"}, comment: "[xsm:account=Pool1]", structured: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			comment := encodeRecordComment(tc.meta)
+			if comment != tc.comment {
+				t.Errorf("encode: got %q, want %q", comment, tc.comment)
+			}
+			meta, structured := parseRecordComment(comment)
+			if meta != tc.meta || structured != tc.structured {
+				t.Errorf("parse: got %+v (structured %v), want %+v (structured %v)", meta, structured, tc.meta, tc.structured)
+			}
+		})
+	}
+
+	// Long aliases are shortened so the structured part always fits
+	meta := RecordMetadata{UniqueID: "0123456789abcdef", Alias: strings.Repeat("a", 120), Account: "Pool1"}
+	comment := encodeRecordComment(meta)
+	parsed, structured := parseRecordComment(comment)
+	if len([]rune(comment)) > maxCommentLength || !structured || parsed.Account != "Pool1" || !strings.HasSuffix(parsed.Alias, "…") {
+		t.Errorf("long alias: got %q (%d runes), parsed %+v", comment, len([]rune(comment)), parsed)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		attempt  int
+		err      error
+		min, max time.Duration
+	}{
+		{name: "first retry", attempt: 1, err: errors.New("timeout"), min: 500 * time.Millisecond, max: time.Second},
+		{name: "third retry", attempt: 3, err: errors.New("timeout"), min: 2 * time.Second, max: 4 * time.Second},
+		{name: "capped", attempt: 10, err: &APIError{Status: http.StatusBadGateway}, min: 15 * time.Second, max: 30 * time.Second},
+		{name: "retry-after", attempt: 1, err: &APIError{Status: http.StatusTooManyRequests, RetryAfter: 7 * time.Second}, min: 7 * time.Second, max: 7 * time.Second},
+		{name: "retry-after capped", attempt: 1, err: &APIError{Status: http.StatusServiceUnavailable, RetryAfter: time.Hour}, min: maxRetryDelay, max: maxRetryDelay},
+		{name: "wrapped retry-after", attempt: 5, err: fmt.Errorf("page 2: %w", &APIError{Status: http.StatusTooManyRequests, RetryAfter: time.Second}), min: time.Second, max: time.Second},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if delay := retryDelay(tc.attempt, tc.err); delay < tc.min || delay > tc.max {
+					t.Fatalf("got %v, want between %v and %v", delay, tc.min, tc.max)
+				}
+			}
+		})
+	}
+}
+
+func TestRetriedDeleteOfGoneRecordSucceeds(t *testing.T) {
+	zone := setupTest(t)
+	*apiRetries = 1
+	cfClient := NewCloudflareClient(credentials)
+
+	id := zone.add("xmr.example.com", "1.1.1.1", "")
+	zone.lostDels = 1
+	if _, err := cfClient.DeleteDNSRecord(context.Background(), id); err != nil {
+		t.Fatalf("delete whose first response was lost: %v", err)
+	}
+	if len(zone.live()) != 0 {
+		t.Fatal("the record is still live")
+	}
+
+	// Without an earlier attempt a 404 is still an error
+	if _, err := cfClient.DeleteDNSRecord(context.Background(), id); err == nil {
+		t.Fatal("deleting a missing record succeeded")
+	}
+}
+
+func TestFetchDNSRecordsPaginates(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		records   int
+		listTotal int
+		pages     int
+		complete  bool
+	}{
+		{name: "one page", records: 2, pages: 1, complete: true},
+		{name: "partial last page", records: 5, pages: 3, complete: true},
+		{name: "exact pages", records: 4, pages: 2, complete: true},
+		{name: "records missing from the listing", records: 5, listTotal: 7, pages: 4},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			zone := setupTest(t)
+			size := *pageSize
+			*pageSize = 2
+			t.Cleanup(func() { *pageSize = size })
+			for i := 0; i < tc.records; i++ {
+				zone.add("xmr.example.com", fmt.Sprintf("1.1.1.%d", i+1), "")
+			}
+			zone.listTotal = tc.listTotal
+
+			records, count, err := NewCloudflareClient(credentials).fetchDNSRecords(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			lists := 0
+			for _, call := range zone.calls {
+				if call == "GET " {
+					lists++
+				}
+			}
+			if len(records) != tc.records || lists != tc.pages || count.Complete() != tc.complete {
+				t.Errorf("got %d records in %d pages (complete %v), want %d in %d (complete %v)", len(records), lists, count.Complete(), tc.records, tc.pages, tc.complete)
+			}
+		})
+	}
+}
+
+func TestIncompleteListingRefusesChanges(t *testing.T) {
+	zone := setupTest(t)
+	size := *pageSize
+	*pageSize = 2
+	t.Cleanup(func() { *pageSize = size })
+	for i := 0; i < 3; i++ {
+		zone.add("xmr.example.com", fmt.Sprintf("1.1.1.%d", i+1), "")
+	}
+	// Cloudflare reports three pages of records but serves only three records
+	zone.listTotal = 6
+	cfClient := NewCloudflareClient(credentials)
+
+	var incomplete *IncompleteListingError
+	if _, err := cfClient.GetDNSRecords(context.Background()); !errors.As(err, &incomplete) {
+		t.Fatalf("got %v, want an incomplete listing", err)
+	}
+	cached, err := cfClient.GetCachedDNSRecords(context.Background())
+	if err != nil || len(cached.Records) != 3 || cached.Total.Complete() {
+		t.Fatalf("cached listing: %v %+v, want the three records marked incomplete", err, cached)
+	}
+
+	req := UpdateRequest{ActiveServers: []ActiveServer{{IP: "1.1.1.1", Name: "xmr", Active: true}}}
+	response := applyUpdate(context.Background(), cfClient, req, ApplyOptions{Source: "test"})
+	if response.Success {
+		t.Fatalf("update from an incomplete listing succeeded: %+v", response)
+	}
+	if len(zone.live()) != 3 {
+		t.Errorf("got %d live records, want all 3 kept", len(zone.live()))
+	}
+	for _, call := range zone.calls {
+		if strings.HasPrefix(call, "DELETE") {
+			t.Errorf("update from an incomplete listing sent %s", call)
+		}
+	}
+}
+
+// runningCanary stores a probing canary for a server listening on 127.0.0.1
+// and returns its ID and the time it started
+func runningCanary(t *testing.T, zone *fakeZone) (string, time.Time) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	id := generateServerID("xmr.example.com", "127.0.0.1")
+	started := time.Now()
+	zone.add(canaryName("xmr"), "127.0.0.1", "")
+	if err := updateServerConfig(context.Background(), func(config *ServerConfig) error {
+		config.Servers = append(config.Servers, Server{
+			UniqueID: id, Alias: "new", Type: "A", Name: "xmr.example.com", Content: "127.0.0.1", TTL: 60, State: "provisioning",
+			Canary: &CanaryState{State: "probing", CanaryName: canaryName("xmr"), StartedAt: started, Period: "1h", ProbePort: listener.Addr().(*net.TCPAddr).Port},
+		})
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return id, started
+}
+
+// storedServer returns a server from the saved configuration
+func storedServer(t *testing.T, id string) Server {
+	t.Helper()
+	config, err := loadServerConfig(*environment)
+	if err != nil || config == nil {
+		t.Fatalf("loading config: %v", err)
+	}
+	for _, server := range config.Servers {
+		if server.UniqueID == id {
+			return server
+		}
+	}
+	t.Fatalf("server %s not in config", id)
+	return Server{}
+}
+
+func TestCanaryProgressesToPromotion(t *testing.T) {
+	zone := setupTest(t)
+	id, started := runningCanary(t, zone)
+
+	processCanaries(context.Background(), started.Add(time.Minute))
+	if state := storedServer(t, id).Canary.State; state != "healthy" {
+		t.Fatalf("after a passing probe: got %s, want healthy", state)
+	}
+
+	// Probes that change nothing must not save the configuration
+	before, _ := os.ReadFile(fmt.Sprintf("servers.%s.json", *environment))
+	processCanaries(context.Background(), started.Add(2*time.Minute))
+	after, _ := os.ReadFile(fmt.Sprintf("servers.%s.json", *environment))
+	if string(before) != string(after) {
+		t.Error("a probe without state change saved the configuration")
+	}
+	if canary := withLatestProbe(id, storedServer(t, id).Canary); !canary.LastProbeAt.Equal(started.Add(2 * time.Minute)) {
+		t.Errorf("latest probe not shown: %v", canary.LastProbeAt)
+	}
+
+	processCanaries(context.Background(), started.Add(2*time.Hour))
+	server := storedServer(t, id)
+	if server.Canary.State != "promoted" || server.State != "active" {
+		t.Fatalf("after the period: canary %s, state %s; want promoted, active", server.Canary.State, server.State)
+	}
+	var names []string
+	for _, record := range zone.live() {
+		names = append(names, record.Name)
+	}
+	if strings.Join(names, ",") != "xmr.example.com" {
+		t.Errorf("records after promotion: %v, want only the main name", names)
+	}
+}
+
+func TestCanaryAbort(t *testing.T) {
+	t.Run("record removed", func(t *testing.T) {
+		zone := setupTest(t)
+		id, started := runningCanary(t, zone)
+		for _, record := range zone.live() {
+			delete(zone.records, record.ID)
+		}
+
+		processCanaries(context.Background(), started.Add(time.Minute))
+		if state := storedServer(t, id).Canary.State; state != "aborted" {
+			t.Errorf("got %s, want aborted", state)
+		}
+	})
+
+	t.Run("by an operator", func(t *testing.T) {
+		zone := setupTest(t)
+		id, _ := runningCanary(t, zone)
+
+		w := httptest.NewRecorder()
+		abortCanaryHandler(w, requestFrom("alice", "/api/canary/abort", fmt.Sprintf(`{"unique_id": %q}`, id)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("abort: %d %s", w.Code, w.Body)
+		}
+		if state := storedServer(t, id).Canary.State; state != "aborted" {
+			t.Errorf("got %s, want aborted", state)
+		}
+		if len(zone.live()) != 0 {
+			t.Errorf("canary record not removed: %v", zone.live())
+		}
+	})
+}
+
+func TestBlockedDrainSavesOnlyNewErrors(t *testing.T) {
+	zone := setupTest(t)
+	zone.add("xmr.example.com", "1.1.1.1", "")
+	zone.add("xmr.example.com", "2.2.2.2", "")
+	if err := updateServerConfig(context.Background(), func(config *ServerConfig) error {
+		config.Servers = []Server{
+			{UniqueID: "s1", Alias: "one", Type: "A", Name: "xmr.example.com", Content: "1.1.1.1", State: "active"},
+			{UniqueID: "s2", Alias: "two", Type: "A", Name: "xmr.example.com", Content: "2.2.2.2", State: "active"},
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cfClient := NewCloudflareClient(credentials)
+	if _, err := startDrain(context.Background(), cfClient, DrainRequest{UniqueID: "s1"}, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A freeze that starts during the drain blocks the removal
+	start, end := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	if err := updateServerConfig(context.Background(), func(config *ServerConfig) error {
+		config.FreezeWindows = []FreezeWindow{{ID: "f1", Name: "release", Start: &start, End: &end}}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	configFile := fmt.Sprintf("servers.%s.json", *environment)
+	for i := 0; i < 3; i++ {
+		before, _ := os.ReadFile(configFile)
+		removeDrainedRecord(context.Background(), cfClient, storedServer(t, "s1"), time.Now())
+		after, _ := os.ReadFile(configFile)
+		if saved := string(before) != string(after); saved != (i == 0) {
+			t.Errorf("check %d: configuration saved %v, want %v", i+1, saved, i == 0)
+		}
+	}
+	if server := storedServer(t, "s1"); server.Drain == nil || server.Drain.Error == "" {
+		t.Errorf("blocked drain has no error: %+v", server.Drain)
+	}
+	if len(zone.live()) != 2 {
+		t.Errorf("record removed during the freeze: %v", zone.live())
+	}
+}
+
+// subscriberCount returns how many event streams are registered
+func subscriberCount() int {
+	uiEvents.mu.Lock()
+	defer uiEvents.mu.Unlock()
+	return len(uiEvents.subscribers)
+}
+
+// openEventStream connects to the event stream and reads up to the
+// connected comment; the returned function reads the next event's fields
+func openEventStream(t *testing.T, url, lastID string) (*http.Response, func() map[string]string, []map[string]string) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type %q", ct)
+	}
+	lines := bufio.NewScanner(resp.Body)
+	next := func() map[string]string {
+		fields := map[string]string{}
+		for lines.Scan() {
+			line := lines.Text()
+			if line == "" {
+				if len(fields) > 0 {
+					return fields
+				}
+				continue
+			}
+			if strings.HasPrefix(line, ":") {
+				fields["comment"] = strings.TrimSpace(line[1:])
+				continue
+			}
+			key, value, _ := strings.Cut(line, ": ")
+			fields[key] = value
+		}
+		return nil
+	}
+	var replayed []map[string]string
+	for {
+		fields := next()
+		if fields == nil {
+			t.Fatal("stream ended before it was connected")
+		}
+		if fields["comment"] == "connected" {
+			return resp, next, replayed
+		}
+		replayed = append(replayed, fields)
+	}
+}
+
+func TestEventStreamDeliversAndCleansUp(t *testing.T) {
+	setupTest(t)
+	server := httptest.NewServer(http.HandlerFunc(eventsHandler))
+	defer server.Close()
+	before := subscriberCount()
+
+	resp, next, _ := openEventStream(t, server.URL, "")
+	publishState(requestFrom("alice", "/api/state", "{}"), Server{UniqueID: "s1", Name: "xmr.example.com", Content: "1.1.1.1", State: "standby"}, "alice moved node1 to standby")
+
+	// Other tests may still publish from the background
+	fields := next()
+	for fields != nil && fields["event"] != "state" {
+		fields = next()
+	}
+	var event UIEvent
+	if err := json.Unmarshal([]byte(fields["data"]), &event); err != nil {
+		t.Fatalf("event %v: %v", fields, err)
+	}
+	if fields["event"] != "state" || fields["id"] != strconv.FormatInt(event.ID, 10) || event.Operator != "alice" || len(event.Servers) != 1 || event.Servers[0].State != "standby" {
+		t.Fatalf("got event %v, want the state change by alice", fields)
+	}
+
+	// A closed browser tab is unsubscribed
+	resp.Body.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for subscriberCount() != before {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d subscribers after the disconnect, want %d", subscriberCount(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Reconnecting with Last-Event-ID replays what was missed
+	publishEvent(UIEvent{Type: "notes", Message: "missed"})
+	resp, _, replayed := openEventStream(t, server.URL, fields["id"])
+	defer resp.Body.Close()
+	if len(replayed) == 0 || !strings.Contains(replayed[len(replayed)-1]["data"], `"missed"`) {
+		t.Errorf("replayed %v, want the missed notes event", replayed)
+	}
+}
+
+func TestSlowEventSubscriberIsDropped(t *testing.T) {
+	slow, _ := subscribeEvents(0)
+	fast, _ := subscribeEvents(0)
+	defer unsubscribeEvents(fast)
+
+	received := make(chan int)
+	go func() {
+		count := 0
+		for range fast {
+			count++
+			if count == 40 {
+				break
+			}
+		}
+		received <- count
+	}()
+	for i := 0; i < 40; i++ {
+		publishEvent(UIEvent{Type: "notes", Message: fmt.Sprintf("event %d", i)})
+		time.Sleep(time.Millisecond)
+	}
+	if count := <-received; count != 40 {
+		t.Errorf("the reading subscriber got %d events, want 40", count)
+	}
+
+	// The subscriber that never read is closed once its buffer is full
+	buffered := 0
+	for range slow {
+		buffered++
+	}
+	if buffered != cap(slow) {
+		t.Errorf("the slow subscriber got %d events before it was dropped, want %d", buffered, cap(slow))
+	}
+	uiEvents.mu.Lock()
+	registered := uiEvents.subscribers[slow]
+	uiEvents.mu.Unlock()
+	if registered {
+		t.Error("the slow subscriber is still registered")
+	}
+}